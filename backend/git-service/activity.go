@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/gorilla/mux"
+)
+
+// defaultActivityCommits bounds the history scanned for activity unless overridden
+const defaultActivityCommits = 10000
+
+// ActivityDay is the number of commits authored on one day
+type ActivityDay struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// Get commit activity heatmap endpoint
+func (gs *GitService) activityHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	query := r.URL.Query()
+
+	// limit=0 scans the whole history
+	limit := defaultActivityCommits
+	if limitStr := query.Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l < 0 {
+			gs.sendError(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = l
+	}
+
+	since, err := parseActivityTime(query.Get("since"), false)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid since: %v", err), http.StatusBadRequest)
+		return
+	}
+	until, err := parseActivityTime(query.Get("until"), true)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid until: %v", err), http.StatusBadRequest)
+		return
+	}
+	author := strings.ToLower(strings.TrimSpace(query.Get("author")))
+	byHour := query.Get("hourOfWeek") == "true"
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	counts := make(map[string]int)
+	var hourOfWeek [7][24]int
+	total, scanned, truncated := 0, 0, false
+	if _, err := repo.Head(); err == nil {
+		mm := gs.loadMailmap(projectID, repo)
+		iter, err := repo.Log(&git.LogOptions{})
+		if err != nil {
+			gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+			return
+		}
+		err = iter.ForEach(func(c *object.Commit) error {
+			if limit > 0 && scanned >= limit {
+				truncated = true
+				return storer.ErrStop
+			}
+			scanned++
+
+			// Days are bucketed in the author's own time zone, like git log shows them
+			when := c.Author.When
+			if !since.IsZero() && when.Before(since) || !until.IsZero() && when.After(until) {
+				return nil
+			}
+			if author != "" {
+				name, email := mm.resolve(c.Author.Name, c.Author.Email)
+				if strings.ToLower(name) != author && strings.ToLower(email) != author {
+					return nil
+				}
+			}
+
+			counts[when.Format("2006-01-02")]++
+			hourOfWeek[when.Weekday()][when.Hour()]++
+			total++
+			return nil
+		})
+		if err != nil {
+			gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+			return
+		}
+	} else if err != plumbing.ErrReferenceNotFound {
+		gs.sendError(w, "Failed to read HEAD", http.StatusInternalServerError)
+		return
+	}
+
+	days := make([]ActivityDay, 0, len(counts))
+	for date, count := range counts {
+		days = append(days, ActivityDay{Date: date, Count: count})
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+
+	response := map[string]interface{}{
+		"days":           days,
+		"total":          total,
+		"commitsScanned": scanned,
+		"truncated":      truncated,
+	}
+	if byHour {
+		// Rows are weekdays starting on Sunday, columns hours of the day
+		response["hourOfWeek"] = hourOfWeek
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseActivityTime accepts an RFC 3339 timestamp or a plain date. A plain
+// date used as an upper bound covers the whole day.
+func parseActivityTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected YYYY-MM-DD or an RFC 3339 timestamp")
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+type activityResponse struct {
+	Days       []ActivityDay `json:"days"`
+	Total      int           `json:"total"`
+	HourOfWeek [7][24]int    `json:"hourOfWeek"`
+}
+
+func getActivity(t *testing.T, gs *GitService, query string) activityResponse {
+	t.Helper()
+	rec := serve(t, gs.activityHandler, "GET", "/git/p/activity?"+query, project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body activityResponse
+	decodeBody(t, rec, &body)
+	return body
+}
+
+func TestActivityBucketsByAuthorDay(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, when := range []time.Time{
+		time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 2, 23, 30, 0, 0, time.FixedZone("", 2*3600)),
+		// Already March 3rd in UTC, but still the 2nd where it was written
+		time.Date(2024, 3, 2, 23, 30, 0, 0, time.FixedZone("", -5*3600)),
+	} {
+		writeFiles(t, repo, map[string]string{"a.txt": fmt.Sprintf("%d\n", i)})
+		if _, err := worktree.Add("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		sig := &object.Signature{Name: "Test User", Email: "test@example.com", When: when}
+		if _, err := worktree.Commit(fmt.Sprintf("Change %d", i), &git.CommitOptions{Author: sig, Committer: sig}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	body := getActivity(t, gs, "hourOfWeek=true")
+	want := []ActivityDay{{"2024-01-02", 1}, {"2024-03-01", 2}, {"2024-03-02", 2}}
+	if body.Total != 5 || len(body.Days) != len(want) {
+		t.Fatalf("total %d, days %+v", body.Total, body.Days)
+	}
+	for i := range want {
+		if body.Days[i] != want[i] {
+			t.Errorf("day %d = %+v, want %+v", i, body.Days[i], want[i])
+		}
+	}
+	if got := body.HourOfWeek[time.Saturday][23]; got != 2 {
+		t.Errorf("Saturday 23:00 has %d commits, want 2", got)
+	}
+
+	if body := getActivity(t, gs, "since=2024-03-01"); body.Total != 4 {
+		t.Errorf("since March 1st: %d commits, want 4", body.Total)
+	}
+	// A plain until date covers the whole day
+	if body := getActivity(t, gs, "until=2024-03-01"); body.Total != 3 {
+		t.Errorf("until March 1st: %d commits, want 3", body.Total)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// errNothingToAmend is returned when amending a repository without commits
+var errNothingToAmend = errors.New("nothing to amend: the repository has no commits")
+
+// amendResult is a rewritten HEAD commit and what it changes relative to its parent
+type amendResult struct {
+	commit   *object.Commit
+	replaces plumbing.Hash
+	files    []*FileDiff
+}
+
+// amendCommit builds the commit that would replace HEAD, taking its tree from
+// entries and keeping HEAD's parents. Objects are written to s; a nil storer
+// only computes hashes. Refs are never touched here.
+func (gs *GitService) amendCommit(s storer.EncodedObjectStorer, projectID string, repo *git.Repository, entries map[string]*diffEntry, req CommitRequest, committer Author) (*amendResult, error) {
+	if _, err := repo.Head(); err == plumbing.ErrReferenceNotFound {
+		return nil, errNothingToAmend
+	} else if err != nil {
+		return nil, err
+	}
+	head, err := gs.resolveCommit(repo, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Like git commit --amend: keep the message and author unless overridden
+	message := req.Message
+	if message == "" {
+		message = head.Message
+	}
+	author := head.Author
+	if req.Author.Name != "" {
+		author.Name = req.Author.Name
+	}
+	if req.Author.Email != "" {
+		author.Email = req.Author.Email
+	}
+
+	treeHash, err := buildTree(s, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	commit := &object.Commit{
+		Author:       author,
+		Committer:    object.Signature{Name: committer.Name, Email: committer.Email, When: time.Now()},
+		Message:      message,
+		TreeHash:     treeHash,
+		ParentHashes: head.ParentHashes,
+	}
+	if commit.Hash, err = storeObject(s, commit); err != nil {
+		return nil, err
+	}
+
+	parentEntries := map[string]*diffEntry{}
+	if len(head.ParentHashes) > 0 {
+		parent, err := repo.CommitObject(head.ParentHashes[0])
+		if err != nil {
+			return nil, err
+		}
+		if parentEntries, err = treeEntries(parent, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		return nil, err
+	}
+	files, err := diffEntries(parentEntries, entries, settings.diffOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	return &amendResult{commit: commit, replaces: head.Hash, files: files}, nil
+}
+
+// headUpstream returns the remote-tracking ref of the current branch when it
+// already contains HEAD, and nil when HEAD is unpushed or has no upstream
+func headUpstream(repo *git.Repository) (*plumbing.Reference, error) {
+	head, err := repo.Head()
+	if err != nil || !head.Name().IsBranch() {
+		return nil, nil
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	upstream := upstreamRef(repo, cfg, head.Name().Short())
+	if upstream == nil {
+		return nil, nil
+	}
+	onUpstream, err := commitAncestors(repo, []plumbing.Hash{upstream.Hash()}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !onUpstream[head.Hash()] {
+		return nil, nil
+	}
+	return upstream, nil
+}
+
+// previewStagedEntries computes the index commitHandler would commit after
+// staging, without writing the index
+func previewStagedEntries(repo *git.Repository, files []string) (map[string]*diffEntry, error) {
+	if len(files) == 0 {
+		return worktreeEntries(repo, "")
+	}
+
+	entries, err := indexEntries(repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		filter := strings.Trim(filepath.ToSlash(file), "/")
+		if filter == "." {
+			filter = ""
+		}
+		for p := range entries {
+			if matchesPathFilter(p, filter) {
+				delete(entries, p)
+			}
+		}
+		current, err := worktreeEntries(repo, filter)
+		if err != nil {
+			return nil, err
+		}
+		for p, entry := range current {
+			entries[p] = entry
+		}
+	}
+	return entries, nil
+}
+
+// Preview an amend without changing refs or the index
+func (gs *GitService) previewAmend(w http.ResponseWriter, projectID string, repo *git.Repository, req CommitRequest, committer Author) {
+	entries, err := previewStagedEntries(repo, req.Files)
+	if err != nil {
+		gs.sendError(w, "Failed to read working tree", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := gs.amendCommit(nil, projectID, repo, entries, req, committer)
+	if err == errNothingToAmend {
+		gs.sendError(w, "Nothing to amend: the repository has no commits", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		gs.sendError(w, "Failed to preview amend", http.StatusInternalServerError)
+		return
+	}
+
+	gs.sendAmendResult(w, "Amend preview", true, result)
+}
+
+// Amend HEAD with the staged index
+func (gs *GitService) amendHead(w http.ResponseWriter, projectID string, repo *git.Repository, req CommitRequest, committer Author) {
+	entries, err := indexEntries(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := gs.amendCommit(repo.Storer, projectID, repo, entries, req, committer)
+	if err == errNothingToAmend {
+		gs.sendError(w, "Nothing to amend: the repository has no commits", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		gs.sendError(w, "Failed to amend commit", http.StatusInternalServerError)
+		return
+	}
+
+	head, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		gs.sendError(w, "Failed to read HEAD", http.StatusInternalServerError)
+		return
+	}
+	name := plumbing.HEAD
+	if head.Type() == plumbing.SymbolicReference {
+		name = head.Target()
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(name, result.commit.Hash)); err != nil {
+		gs.sendError(w, "Failed to update HEAD", http.StatusInternalServerError)
+		return
+	}
+	subject := strings.SplitN(strings.TrimSpace(result.commit.Message), "\n", 2)[0]
+	gs.logHeadUpdate(projectID, repo, result.replaces, result.commit.Hash, committer, "commit (amend): "+subject)
+
+	gs.sendAmendResult(w, "Commit amended successfully", false, result)
+}
+
+// sendAmendResult writes an amended or previewed commit with its diff stat
+func (gs *GitService) sendAmendResult(w http.ResponseWriter, message string, dryRun bool, result *amendResult) {
+	commitInfo := newCommitInfo(result.commit)
+	commitInfo.Files = make([]string, 0, len(result.files))
+	for _, file := range result.files {
+		commitInfo.Files = append(commitInfo.Files, file.Path)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  message,
+		"dryRun":   dryRun,
+		"commit":   commitInfo,
+		"replaces": result.replaces.String(),
+		"files":    result.files,
+		"stat":     newDiffStat(result.files),
+	})
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+)
+
+// Actions an edit operation can perform
+const (
+	editWrite  = "write"
+	editPatch  = "patch"
+	editDelete = "delete"
+)
+
+// EditOperation changes one file: it replaces the content with NewContent,
+// applies a unified diff Patch to the working tree version, or deletes it
+type EditOperation struct {
+	Path            string  `json:"path"`
+	NewContent      *string `json:"newContent,omitempty"`
+	ContentEncoding string  `json:"contentEncoding,omitempty"`
+	Patch           string  `json:"patch,omitempty"`
+	Delete          bool    `json:"delete,omitempty"`
+}
+
+// ApplyEditsRequest represents a set of edits committed together
+type ApplyEditsRequest struct {
+	Message string          `json:"message"`
+	Author  Author          `json:"author"`
+	Edits   []EditOperation `json:"edits"`
+
+	// AllowConflictMarkers commits files that still contain conflict markers
+	AllowConflictMarkers bool `json:"allowConflictMarkers,omitempty"`
+}
+
+// EditResult reports the outcome of one edit operation
+type EditResult struct {
+	Path    string `json:"path"`
+	Action  string `json:"action"`
+	Applied bool   `json:"applied"`
+	Error   string `json:"error,omitempty"`
+}
+
+// editedFile is the original working tree state of an edited file, kept so
+// a failed apply can put it back
+type editedFile struct {
+	path    string
+	existed bool
+	data    []byte
+	perm    os.FileMode
+}
+
+// Apply edits and commit them endpoint
+func (gs *GitService) applyEditsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req ApplyEditsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(req.Message) == "" {
+		gs.sendError(w, "Commit message is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Edits) == 0 {
+		gs.sendError(w, "At least one edit is required", http.StatusBadRequest)
+		return
+	}
+
+	results := make([]EditResult, len(req.Edits))
+	paths := make([]string, len(req.Edits))
+	seen := make(map[string]bool)
+	for i, edit := range req.Edits {
+		path, ok := repoPath(edit.Path)
+		if !ok {
+			gs.sendError(w, fmt.Sprintf("Invalid path %q", edit.Path), http.StatusBadRequest)
+			return
+		}
+		if seen[path] {
+			gs.sendError(w, fmt.Sprintf("Path %s is edited more than once", path), http.StatusBadRequest)
+			return
+		}
+		seen[path] = true
+		paths[i] = path
+
+		action, count := "", 0
+		if edit.NewContent != nil {
+			action, count = editWrite, count+1
+		}
+		if edit.Patch != "" {
+			action, count = editPatch, count+1
+		}
+		if edit.Delete {
+			action, count = editDelete, count+1
+		}
+		if count != 1 {
+			gs.sendError(w, fmt.Sprintf("Edit of %s needs exactly one of newContent, patch or delete", path), http.StatusBadRequest)
+			return
+		}
+		results[i] = EditResult{Path: path, Action: action}
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+	if settings.RequireSignedCommits {
+		gs.sendError(w, unsignedCommitMessage, http.StatusUnprocessableEntity)
+		return
+	}
+
+	author := gs.fillIdentity(projectID, req.Author)
+	if author.Name == "" || author.Email == "" {
+		gs.sendError(w, missingIdentityMessage, http.StatusBadRequest)
+		return
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+	fs := worktree.Filesystem
+
+	head, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		gs.sendError(w, "Failed to read HEAD", http.StatusInternalServerError)
+		return
+	}
+	entries := map[string]*diffEntry{}
+	var parents []plumbing.Hash
+	oldHash := plumbing.ZeroHash
+	if resolved, err := repo.Head(); err == nil {
+		commit, err := repo.CommitObject(resolved.Hash())
+		if err != nil {
+			gs.sendError(w, "Failed to read HEAD commit", http.StatusInternalServerError)
+			return
+		}
+		if entries, err = treeEntries(commit, ""); err != nil {
+			gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+			return
+		}
+		oldHash = commit.Hash
+		parents = []plumbing.Hash{commit.Hash}
+	} else if err != plumbing.ErrReferenceNotFound {
+		gs.sendError(w, "Failed to read HEAD", http.StatusInternalServerError)
+		return
+	}
+
+	// Every edit is worked out in memory first, so one that fails leaves
+	// the working tree, index and HEAD exactly as they were
+	failed := func(i int, err error) {
+		results[i].Error = err.Error()
+		gs.sendErrorWithDetails(w, fmt.Sprintf("Edit of %s failed; no edits were applied", paths[i]), http.StatusUnprocessableEntity, map[string]interface{}{
+			"results": results,
+		})
+	}
+	contents := make([][]byte, len(req.Edits))
+	var warnings []string
+	for i, edit := range req.Edits {
+		path := paths[i]
+		current, err := util.ReadFile(fs, path)
+		exists := err == nil
+		if err != nil && !os.IsNotExist(err) {
+			failed(i, err)
+			return
+		}
+
+		switch results[i].Action {
+		case editDelete:
+			if _, tracked := entries[path]; !tracked && !exists {
+				failed(i, fmt.Errorf("%s does not exist", path))
+				return
+			}
+			delete(entries, path)
+			continue
+		case editWrite:
+			content, decodeWarnings, err := decodeContent(*edit.NewContent, edit.ContentEncoding)
+			if err != nil {
+				failed(i, fmt.Errorf("invalid content: %v", err))
+				return
+			}
+			content, _, _, decodeWarnings = gs.convertContent(projectID, fs, path, content, edit.ContentEncoding == "base64", decodeWarnings)
+			for _, warning := range decodeWarnings {
+				warnings = append(warnings, path+": "+warning)
+			}
+			contents[i] = content
+		case editPatch:
+			if isBinary(current) {
+				failed(i, fmt.Errorf("cannot patch binary file %s", path))
+				return
+			}
+			patched, err := applyUnifiedPatch(string(current), edit.Patch)
+			if err != nil {
+				failed(i, err)
+				return
+			}
+			contents[i] = []byte(patched)
+		}
+
+		// A file cannot replace a directory or sit below an existing file
+		for p := range entries {
+			if p != path && (strings.HasPrefix(p, path+"/") || strings.HasPrefix(path, p+"/")) {
+				failed(i, fmt.Errorf("path %s conflicts with %s", path, p))
+				return
+			}
+		}
+
+		mode := filemode.Regular
+		if previous, ok := entries[path]; ok && previous.mode == filemode.Executable {
+			mode = filemode.Executable
+		}
+		hash, err := storeBlob(repo.Storer, contents[i])
+		if err != nil {
+			gs.sendError(w, "Failed to write blob", http.StatusInternalServerError)
+			return
+		}
+		data := contents[i]
+		entries[path] = &diffEntry{hash: hash, mode: mode, read: func() ([]byte, error) { return data, nil }}
+	}
+
+	if !req.AllowConflictMarkers {
+		files, err := scanConflictMarkers(entries, func(path string, _ *diffEntry) bool { return seen[path] })
+		if err != nil {
+			gs.sendError(w, "Failed to scan edited files", http.StatusInternalServerError)
+			return
+		}
+		if len(files) > 0 {
+			gs.sendErrorWithDetails(w, "Edited files contain conflict markers", http.StatusUnprocessableEntity, map[string]interface{}{
+				"files": files,
+			})
+			return
+		}
+	}
+
+	treeHash, err := buildTree(repo.Storer, entries)
+	if err != nil {
+		gs.sendError(w, "Failed to write tree", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	commit := &object.Commit{
+		Author:       object.Signature{Name: author.Name, Email: author.Email, When: now},
+		Committer:    object.Signature{Name: author.Name, Email: author.Email, When: now},
+		Message:      req.Message,
+		TreeHash:     treeHash,
+		ParentHashes: parents,
+	}
+	if commit.Hash, err = storeObject(repo.Storer, commit); err != nil {
+		gs.sendError(w, "Failed to write commit", http.StatusInternalServerError)
+		return
+	}
+
+	// Only the edited paths change in the index; anything else already
+	// staged stays staged and out of this commit
+	original, err := repo.Storer.Index()
+	if err != nil {
+		gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+
+	var journal []editedFile
+	rollback := func() {
+		for i := len(journal) - 1; i >= 0; i-- {
+			file := journal[i]
+			if !file.existed {
+				fs.Remove(file.path)
+				removeEmptyParents(fs, file.path)
+				continue
+			}
+			util.WriteFile(fs, file.path, file.data, file.perm)
+		}
+	}
+
+	for i := range req.Edits {
+		path := paths[i]
+		saved := editedFile{path: path, perm: 0644}
+		if info, err := fs.Lstat(path); err == nil {
+			if saved.data, err = util.ReadFile(fs, path); err != nil {
+				rollback()
+				gs.sendInternalError(w, fmt.Sprintf("Failed to read %s", path), err)
+				return
+			}
+			saved.existed = true
+			saved.perm = info.Mode().Perm()
+		}
+		journal = append(journal, saved)
+
+		for {
+			if _, err := idx.Remove(path); err != nil {
+				break
+			}
+		}
+		entry, ok := entries[path]
+		if !ok {
+			if saved.existed {
+				if err := fs.Remove(path); err != nil {
+					rollback()
+					gs.sendInternalError(w, fmt.Sprintf("Failed to delete %s", path), err)
+					return
+				}
+				removeEmptyParents(fs, path)
+			}
+			results[i].Applied = true
+			continue
+		}
+
+		blob, err := repo.BlobObject(entry.hash)
+		if err == nil {
+			err = writeBlobToWorktree(fs, path, blob, entry.mode)
+		}
+		if err != nil {
+			rollback()
+			gs.sendInternalError(w, fmt.Sprintf("Failed to write %s", path), err)
+			return
+		}
+		modifiedAt := now
+		if info, err := fs.Lstat(path); err == nil {
+			modifiedAt = info.ModTime()
+		}
+		e := idx.Add(path)
+		e.Hash = entry.hash
+		e.Mode = entry.mode
+		e.Size = uint32(len(contents[i]))
+		e.ModifiedAt = modifiedAt
+		results[i].Applied = true
+	}
+
+	if err := repo.Storer.SetIndex(idx); err != nil {
+		rollback()
+		gs.sendError(w, "Failed to write index", http.StatusInternalServerError)
+		return
+	}
+
+	// HEAD moves last; on an unborn or checked out branch the branch moves
+	target := plumbing.HEAD
+	if head.Type() == plumbing.SymbolicReference {
+		target = head.Target()
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(target, commit.Hash)); err != nil {
+		rollback()
+		repo.Storer.SetIndex(original)
+		gs.sendError(w, "Failed to update HEAD", http.StatusInternalServerError)
+		return
+	}
+	gs.logCommit(projectID, repo, oldHash, commit.Hash, author, req.Message)
+
+	if warnings == nil {
+		warnings = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  fmt.Sprintf("Applied %d edit%s in commit %s", len(req.Edits), plural(len(req.Edits)), commit.Hash.String()[:7]),
+		"commit":   newCommitInfo(commit),
+		"results":  results,
+		"warnings": warnings,
+	})
+}
+
+// hunkHeader matches "@@ -start[,count] +start[,count] @@"
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// patchHunk is one hunk of a unified diff as the lines it expects and the
+// lines it leaves behind
+type patchHunk struct {
+	start    int
+	old, new []string
+}
+
+// applyUnifiedPatch applies the hunks of a unified diff to content. Like git
+// apply, a hunk whose context has moved is found by searching outwards from
+// the line it names; headers before the first hunk are ignored.
+func applyUnifiedPatch(content, patch string) (string, error) {
+	hunks, err := parsePatchHunks(patch)
+	if err != nil {
+		return "", err
+	}
+	if len(hunks) == 0 {
+		return "", fmt.Errorf("patch contains no hunks")
+	}
+
+	lines := splitLines(content)
+	var result []string
+	next, drift := 0, 0
+	for n, hunk := range hunks {
+		// A pure insertion names the line it goes after
+		base := hunk.start - 1
+		if len(hunk.old) == 0 {
+			base = hunk.start
+		}
+		expected := base + drift
+		at := -1
+		for distance := 0; at < 0 && (expected-distance >= next || expected+distance <= len(lines)); distance++ {
+			for _, candidate := range []int{expected - distance, expected + distance} {
+				if candidate >= next && candidate+len(hunk.old) <= len(lines) && linesEqual(lines[candidate:candidate+len(hunk.old)], hunk.old) {
+					at = candidate
+					break
+				}
+			}
+		}
+		if at < 0 {
+			return "", fmt.Errorf("hunk %d does not apply at line %d", n+1, hunk.start)
+		}
+		result = append(result, lines[next:at]...)
+		result = append(result, hunk.new...)
+		next = at + len(hunk.old)
+		drift = at - base
+	}
+	result = append(result, lines[next:]...)
+	return strings.Join(result, ""), nil
+}
+
+// parsePatchHunks splits a unified diff into hunks. Each line keeps its
+// newline unless the patch marks it with "\ No newline at end of file".
+func parsePatchHunks(patch string) ([]patchHunk, error) {
+	var hunks []patchHunk
+	var current *patchHunk
+	var last *[]string
+	oldLeft, newLeft := 0, 0
+	for _, line := range strings.Split(patch, "\n") {
+		if strings.HasPrefix(line, "\\") {
+			// The marker applies to the line before it, on one side or both
+			if current != nil && last != nil {
+				trimLastNewline(*last)
+			} else if current != nil {
+				trimLastNewline(current.old)
+				trimLastNewline(current.new)
+			}
+			continue
+		}
+
+		if current != nil && (oldLeft > 0 || newLeft > 0) {
+			text := ""
+			if len(line) > 0 {
+				text = line[1:]
+			}
+			switch {
+			case line == "" || line[0] == ' ':
+				current.old = append(current.old, text+"\n")
+				current.new = append(current.new, text+"\n")
+				oldLeft--
+				newLeft--
+				last = nil
+			case line[0] == '-':
+				current.old = append(current.old, text+"\n")
+				oldLeft--
+				last = &current.old
+			case line[0] == '+':
+				current.new = append(current.new, text+"\n")
+				newLeft--
+				last = &current.new
+			default:
+				return nil, fmt.Errorf("hunk %d is shorter than its header says", len(hunks)+1)
+			}
+			continue
+		}
+
+		match := hunkHeader.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if current != nil {
+			hunks = append(hunks, *current)
+		}
+		start, _ := strconv.Atoi(match[1])
+		oldLeft, newLeft = 1, 1
+		if match[2] != "" {
+			oldLeft, _ = strconv.Atoi(match[2])
+		}
+		if match[4] != "" {
+			newLeft, _ = strconv.Atoi(match[4])
+		}
+		current = &patchHunk{start: start}
+		last = nil
+	}
+	if current != nil {
+		if oldLeft > 0 || newLeft > 0 {
+			return nil, fmt.Errorf("hunk %d is shorter than its header says", len(hunks)+1)
+		}
+		hunks = append(hunks, *current)
+	}
+	return hunks, nil
+}
+
+// trimLastNewline drops the newline of the final line in lines
+func trimLastNewline(lines []string) {
+	if n := len(lines); n > 0 {
+		lines[n-1] = strings.TrimSuffix(lines[n-1], "\n")
+	}
+}
+
+// linesEqual reports whether two line slices hold the same text
+func linesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+type applyEditsResponse struct {
+	Commit  *Commit      `json:"commit"`
+	Results []EditResult `json:"results"`
+}
+
+// applyEdits commits edits to project p, expecting status
+func applyEdits(t *testing.T, gs *GitService, status int, edits ...EditOperation) applyEditsResponse {
+	t.Helper()
+	rec := serve(t, gs.applyEditsHandler, "POST", "/git/p/apply-edits", project("p"), ApplyEditsRequest{Message: "Apply edits", Author: testAuthor(), Edits: edits})
+	expectStatus(t, rec, status)
+	var body applyEditsResponse
+	decodeBody(t, rec, &body)
+	return body
+}
+
+// newContent returns a pointer for EditOperation.NewContent
+func newContent(s string) *string { return &s }
+
+const appendTwo = "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1,2 @@\n one\n+two\n"
+
+func TestApplyEditsCommitsAllFiles(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	dir := gs.getProjectPath("p")
+	commitTestFiles(t, repo, "Add b", map[string]string{"b.txt": "b\n"})
+	// Something staged beforehand stays staged and out of the commit
+	writeFiles(t, repo, map[string]string{"staged.txt": "staged\n"})
+	runGit(t, dir, "add", "staged.txt")
+
+	body := applyEdits(t, gs, http.StatusOK,
+		EditOperation{Path: "a.txt", Patch: appendTwo},
+		EditOperation{Path: "b.txt", Delete: true},
+		EditOperation{Path: "src/c.txt", NewContent: newContent("c\n")},
+	)
+	if body.Commit == nil || body.Commit.Hash != refHash(t, repo, "HEAD").String() {
+		t.Fatalf("commit %+v is not HEAD", body.Commit)
+	}
+	for i, action := range []string{editPatch, editDelete, editWrite} {
+		if result := body.Results[i]; result.Action != action || !result.Applied || result.Error != "" {
+			t.Errorf("result %d: %+v", i, result)
+		}
+	}
+
+	if got := runGit(t, dir, "ls-tree", "-r", "--name-only", "HEAD"); got != "a.txt\nsrc/c.txt" {
+		t.Errorf("committed files:\n%s", got)
+	}
+	if got := runGit(t, dir, "show", "HEAD:a.txt"); got != "one\ntwo" {
+		t.Errorf("committed a.txt = %q", got)
+	}
+	if got := runGit(t, dir, "status", "--porcelain"); got != "A  staged.txt" {
+		t.Errorf("status after the edits:\n%s", got)
+	}
+	if got := readProjectFile(t, gs, "src/c.txt"); got != "c\n" {
+		t.Errorf("src/c.txt = %q", got)
+	}
+}
+
+func TestApplyEditsRollsBackOnFailedPatch(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	dir := gs.getProjectPath("p")
+	commitTestFiles(t, repo, "Add b", map[string]string{"b.txt": "b\n"})
+	writeFiles(t, repo, map[string]string{"b.txt": "edited but not committed\n"})
+	head := refHash(t, repo, "HEAD")
+	status := runGit(t, dir, "status", "--porcelain")
+
+	body := applyEdits(t, gs, http.StatusUnprocessableEntity,
+		EditOperation{Path: "new.txt", NewContent: newContent("new\n")},
+		EditOperation{Path: "b.txt", Delete: true},
+		EditOperation{Path: "a.txt", Patch: "@@ -1 +1 @@\n-not what is there\n+replacement\n"},
+	)
+	if len(body.Results) != 3 || body.Results[2].Error == "" {
+		t.Fatalf("results: %+v", body.Results)
+	}
+	for _, result := range body.Results {
+		if result.Applied {
+			t.Errorf("%s reported as applied", result.Path)
+		}
+	}
+
+	if refHash(t, repo, "HEAD") != head {
+		t.Error("HEAD moved")
+	}
+	if got := runGit(t, dir, "status", "--porcelain"); got != status {
+		t.Errorf("status changed from\n%s\nto\n%s", status, got)
+	}
+	if got := readProjectFile(t, gs, "b.txt"); got != "edited but not committed\n" {
+		t.Errorf("b.txt = %q", got)
+	}
+	if got := readProjectFile(t, gs, "a.txt"); got != "one\n" {
+		t.Errorf("a.txt = %q", got)
+	}
+}
+
+func TestApplyEditsRejectsBadRequests(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "p")
+	for name, edits := range map[string][]EditOperation{
+		"no edits":        nil,
+		"two actions":     {{Path: "a.txt", NewContent: newContent("x\n"), Delete: true}},
+		"no action":       {{Path: "a.txt"}},
+		"escaping path":   {{Path: "../outside.txt", NewContent: newContent("x\n")}},
+		"same path twice": {{Path: "a.txt", Delete: true}, {Path: "./a.txt", NewContent: newContent("x\n")}},
+	} {
+		rec := serve(t, gs.applyEditsHandler, "POST", "/git/p/apply-edits", project("p"), ApplyEditsRequest{Message: "Edit", Author: testAuthor(), Edits: edits})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d; body: %s", name, rec.Code, rec.Body.String())
+		}
+	}
+}
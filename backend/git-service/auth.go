@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Environment variables naming the server's default SSH key
+const (
+	sshKeyPathEnv       = "SSH_KEY_PATH"
+	sshKeyPassphraseEnv = "SSH_KEY_PASSPHRASE"
+)
+
+// redactedSecret replaces credentials in anything sent back to clients
+const redactedSecret = "***"
+
+// urlUserinfo matches the user[:password]@ part of a URL
+var urlUserinfo = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/@\s]+@`)
+
+// RemoteAuth holds the credentials for a single request, which only live in
+// memory for the duration of the request. Token is a password or personal
+// access token for HTTPS remotes; PrivateKey is a PEM key for SSH remotes.
+// KnownHosts is the content of a known_hosts file; without it the user's
+// known_hosts files are consulted.
+type RemoteAuth struct {
+	Username              string `json:"username,omitempty"`
+	Token                 string `json:"token,omitempty"`
+	PrivateKey            string `json:"privateKey,omitempty"`
+	Passphrase            string `json:"passphrase,omitempty"`
+	KnownHosts            string `json:"knownHosts,omitempty"`
+	InsecureIgnoreHostKey bool   `json:"insecureIgnoreHostKey,omitempty"`
+}
+
+// String keeps credentials out of anything that formats the value
+func (a RemoteAuth) String() string {
+	return "RemoteAuth{redacted}"
+}
+
+// GoString keeps credentials out of %#v as well
+func (a RemoteAuth) GoString() string {
+	return a.String()
+}
+
+// redactedError carries a message with credentials removed while still
+// matching the original error with errors.Is
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactError strips the request's secrets and any URL credentials from an
+// error. Errors with nothing to strip are returned as is, so comparisons
+// against go-git's sentinel errors keep working.
+func redactError(err error, auth *RemoteAuth) error {
+	if err == nil {
+		return nil
+	}
+	msg := redactSecrets(err.Error(), auth)
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+// redactSecrets removes credentials from text, both as given and in the
+// escaped form they take inside a URL
+func redactSecrets(text string, auth *RemoteAuth) string {
+	if auth != nil {
+		for _, secret := range []string{auth.Token, auth.Passphrase, auth.PrivateKey} {
+			if secret == "" {
+				continue
+			}
+			text = strings.ReplaceAll(text, secret, redactedSecret)
+			text = strings.ReplaceAll(text, url.PathEscape(secret), redactedSecret)
+			text = strings.ReplaceAll(text, url.QueryEscape(secret), redactedSecret)
+		}
+	}
+	return urlUserinfo.ReplaceAllString(text, "${1}"+redactedSecret+"@")
+}
+
+// anonymizeURL drops the userinfo from a URL, as git does before writing a
+// remote's URL into history
+func anonymizeURL(rawURL string) string {
+	return urlUserinfo.ReplaceAllString(rawURL, "${1}")
+}
+
+// remoteAuth picks the credentials for rawURL: the request's token or key,
+// else the server's default key for SSH URLs, else none, in which case
+// go-git falls back to any credentials in the URL itself
+func remoteAuth(rawURL string, auth *RemoteAuth) (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(rawURL)
+	if err != nil {
+		return nil, redactError(err, auth)
+	}
+	isSSH := endpoint.Protocol == "ssh"
+	isHTTP := endpoint.Protocol == "http" || endpoint.Protocol == "https"
+
+	if auth != nil && auth.Token != "" {
+		if !isHTTP {
+			return nil, errors.New("token auth requires an http or https URL")
+		}
+		username := auth.Username
+		if username == "" {
+			// GitHub and GitLab accept any non-empty user alongside a token
+			username = "git"
+		}
+		return &githttp.BasicAuth{Username: username, Password: auth.Token}, nil
+	}
+
+	var keys *gitssh.PublicKeys
+	if auth != nil && auth.PrivateKey != "" {
+		if !isSSH {
+			return nil, errors.New("SSH auth requires an ssh URL")
+		}
+		// The parse error never includes the key material
+		keys, err = gitssh.NewPublicKeys(sshUser(auth.Username, endpoint), []byte(auth.PrivateKey), auth.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %v", err)
+		}
+	} else {
+		keyPath := os.Getenv(sshKeyPathEnv)
+		if !isSSH || keyPath == "" {
+			return nil, nil
+		}
+		user := ""
+		if auth != nil {
+			user = auth.Username
+		}
+		keys, err = gitssh.NewPublicKeysFromFile(sshUser(user, endpoint), keyPath, os.Getenv(sshKeyPassphraseEnv))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %v", sshKeyPathEnv, err)
+		}
+	}
+
+	// Host keys are checked against the user's known_hosts files unless the
+	// request brings its own
+	if auth != nil {
+		switch {
+		case auth.InsecureIgnoreHostKey:
+			keys.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		case auth.KnownHosts != "":
+			if keys.HostKeyCallback, err = knownHostsCallback([]byte(auth.KnownHosts)); err != nil {
+				return nil, fmt.Errorf("invalid knownHosts: %v", err)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// remoteAuthFor resolves the credentials for a configured remote. A missing
+// remote is left for the operation itself to report.
+func remoteAuthFor(repo *git.Repository, remoteName string, auth *RemoteAuth) (transport.AuthMethod, error) {
+	remote, err := repo.Remote(remoteName)
+	if err != nil {
+		return nil, nil
+	}
+	urls := remote.Config().URLs
+	if len(urls) == 0 {
+		return nil, nil
+	}
+	return remoteAuth(urls[0], auth)
+}
+
+// sshUser prefers an explicit user, then the one in the URL, then git
+func sshUser(user string, endpoint *transport.Endpoint) string {
+	if user != "" {
+		return user
+	}
+	if endpoint.User != "" {
+		return endpoint.User
+	}
+	return "git"
+}
+
+// knownHostEntry is one host key line of a known_hosts file
+type knownHostEntry struct {
+	patterns []string
+	key      ssh.PublicKey
+	revoked  bool
+}
+
+// knownHostsCallback verifies host keys against known_hosts content held in
+// memory. Errors are knownhosts.KeyError values so go-git can derive the
+// host key algorithms to negotiate from them.
+func knownHostsCallback(data []byte) (ssh.HostKeyCallback, error) {
+	var entries []knownHostEntry
+	for len(bytes.TrimSpace(data)) > 0 {
+		marker, hosts, key, _, rest, err := ssh.ParseKnownHosts(data)
+		if err != nil {
+			return nil, err
+		}
+		data = rest
+		// CA lines would need certificate checking, which plain keys cannot do
+		if marker == "cert-authority" {
+			continue
+		}
+		entries = append(entries, knownHostEntry{patterns: hosts, key: key, revoked: marker == "revoked"})
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("no host keys found")
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		names := []string{knownhosts.Normalize(hostname)}
+		if remote != nil {
+			names = append(names, knownhosts.Normalize(remote.String()))
+		}
+
+		var want []knownhosts.KnownKey
+		for _, entry := range entries {
+			if !entry.matches(names) {
+				continue
+			}
+			if entry.revoked {
+				if bytes.Equal(entry.key.Marshal(), key.Marshal()) {
+					return &knownhosts.RevokedError{Revoked: knownhosts.KnownKey{Key: entry.key}}
+				}
+				continue
+			}
+			if bytes.Equal(entry.key.Marshal(), key.Marshal()) {
+				return nil
+			}
+			want = append(want, knownhosts.KnownKey{Key: entry.key})
+		}
+		return &knownhosts.KeyError{Want: want}
+	}, nil
+}
+
+// matches reports whether any of the names is covered by the entry's host
+// patterns. A matching negated pattern excludes the name, as in OpenSSH.
+func (e knownHostEntry) matches(names []string) bool {
+	for _, name := range names {
+		matched := false
+		for _, pattern := range e.patterns {
+			negated := strings.HasPrefix(pattern, "!")
+			if hostPatternMatches(strings.TrimPrefix(pattern, "!"), name) {
+				if negated {
+					matched = false
+					break
+				}
+				matched = true
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// hostPatternMatches checks one known_hosts pattern, which may be hashed
+// (|1|salt|hash) or contain * and ? wildcards
+func hostPatternMatches(pattern, name string) bool {
+	if salted, ok := strings.CutPrefix(pattern, "|1|"); ok {
+		saltText, hashText, ok := strings.Cut(salted, "|")
+		if !ok {
+			return false
+		}
+		salt, err := base64.StdEncoding.DecodeString(saltText)
+		if err != nil {
+			return false
+		}
+		hash, err := base64.StdEncoding.DecodeString(hashText)
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha1.New, salt)
+		mac.Write([]byte(name))
+		return hmac.Equal(mac.Sum(nil), hash)
+	}
+	return wildcardMatch(pattern, name)
+}
+
+// wildcardMatch matches * and ? the way OpenSSH host patterns do; unlike
+// path.Match, brackets are literal so [host]:port entries compare as text
+func wildcardMatch(pattern, name string) bool {
+	if pattern == "" {
+		return name == ""
+	}
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(name); i++ {
+			if wildcardMatch(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		return name != "" && wildcardMatch(pattern[1:], name[1:])
+	}
+	return name != "" && pattern[0] == name[0] && wildcardMatch(pattern[1:], name[1:])
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// BlameHunk represents a run of consecutive lines attributed to one commit
+type BlameHunk struct {
+	StartLine int      `json:"startLine"`
+	LineCount int      `json:"lineCount"`
+	Commit    *Commit  `json:"commit"`
+	Lines     []string `json:"lines"`
+
+	// Unblamable marks lines an ignored commit introduced outright, which
+	// no earlier commit can take over
+	Unblamable bool `json:"unblamable,omitempty"`
+}
+
+// BlameLine attributes a single line of a file to a commit
+type BlameLine struct {
+	Line    int       `json:"line"`
+	Content string    `json:"content"`
+	Hash    string    `json:"hash"`
+	Author  Author    `json:"author"`
+	Date    time.Time `json:"date"`
+}
+
+// blameItem is a commit still holding unattributed lines. lines maps a line
+// index in this commit's version of the file to its index in the final file.
+type blameItem struct {
+	commit *object.Commit
+	raw    string
+	lines  map[int]int
+}
+
+// blameQueue orders pending commits newest first, like git blame
+type blameQueue []*blameItem
+
+func (q blameQueue) Len() int { return len(q) }
+func (q blameQueue) Less(i, j int) bool {
+	return q[i].commit.Committer.When.After(q[j].commit.Committer.When)
+}
+func (q blameQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *blameQueue) Push(x interface{}) { *q = append(*q, x.(*blameItem)) }
+func (q *blameQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// blameFile attributes every line of path at commit to the commit that
+// introduced it, calling emit as soon as each commit's lines are known.
+// Lines are passed to the first parent that contains them unchanged, so
+// merges are followed through all parents. Renames are not followed.
+// Lines changed by a commit in ignore are handed on to the matching lines
+// of its first parent, like git blame --ignore-rev.
+//
+// go-git's git.Blame covers none of this: it cannot skip ignored commits or
+// compare lines with whitespace ignored, returns only once the whole file is
+// attributed, and cannot be cancelled when the client goes away.
+func blameFile(ctx context.Context, commit *object.Commit, path string, opts diffOptions, ignore map[plumbing.Hash]bool, emit func(*BlameHunk) error) (int, error) {
+	file, err := commit.File(path)
+	if err != nil {
+		return 0, err
+	}
+	raw, err := file.Contents()
+	if err != nil {
+		return 0, err
+	}
+
+	final := splitLines(raw)
+	start := &blameItem{commit: commit, raw: raw, lines: make(map[int]int, len(final))}
+	for i := range final {
+		start.lines[i] = i
+	}
+
+	queue := &blameQueue{start}
+	pending := map[plumbing.Hash]*blameItem{commit.Hash: start}
+
+	for queue.Len() > 0 {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		item := heap.Pop(queue).(*blameItem)
+		delete(pending, item.commit.Hash)
+
+		remaining := item.lines
+		currentFile, err := item.commit.File(path)
+		if err != nil {
+			return 0, err
+		}
+
+		err = item.commit.Parents().ForEach(func(parent *object.Commit) error {
+			if len(remaining) == 0 {
+				return nil
+			}
+			parentFile, err := parent.File(path)
+			if err == object.ErrFileNotFound {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			var parentItem *blameItem
+			if existing, ok := pending[parent.Hash]; ok {
+				parentItem = existing
+			} else {
+				parentRaw, err := parentFile.Contents()
+				if err != nil {
+					return err
+				}
+				parentItem = &blameItem{commit: parent, raw: parentRaw, lines: make(map[int]int)}
+			}
+
+			passed := 0
+			if parentFile.Hash == currentFile.Hash {
+				for line, finalLine := range remaining {
+					parentItem.lines[line] = finalLine
+					passed++
+				}
+				remaining = map[int]int{}
+			} else {
+				mapping := unchangedLineMapping(diffLinesWith(parentItem.raw, item.raw, opts))
+				for line, finalLine := range remaining {
+					if parentLine, ok := mapping[line]; ok {
+						parentItem.lines[parentLine] = finalLine
+						delete(remaining, line)
+						passed++
+					}
+				}
+			}
+
+			if passed > 0 {
+				if _, ok := pending[parent.Hash]; !ok {
+					pending[parent.Hash] = parentItem
+					heap.Push(queue, parentItem)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		if ignore[item.commit.Hash] && len(remaining) > 0 && item.commit.NumParents() > 0 {
+			parent, err := item.commit.Parent(0)
+			if err != nil {
+				return 0, err
+			}
+			parentFile, err := parent.File(path)
+			if err != nil && err != object.ErrFileNotFound {
+				return 0, err
+			}
+			if parentFile != nil {
+				parentItem, queued := pending[parent.Hash]
+				if !queued {
+					parentRaw, err := parentFile.Contents()
+					if err != nil {
+						return 0, err
+					}
+					parentItem = &blameItem{commit: parent, raw: parentRaw, lines: make(map[int]int)}
+				}
+				passed := 0
+				mapping := changedLineMapping(diffLinesWith(parentItem.raw, item.raw, opts))
+				for line, finalLine := range remaining {
+					parentLine, ok := mapping[line]
+					if _, taken := parentItem.lines[parentLine]; !ok || taken {
+						continue
+					}
+					parentItem.lines[parentLine] = finalLine
+					delete(remaining, line)
+					passed++
+				}
+				if passed > 0 && !queued {
+					pending[parent.Hash] = parentItem
+					heap.Push(queue, parentItem)
+				}
+			}
+		}
+
+		// Whatever no parent accounts for was introduced by this commit
+		for _, hunk := range blameHunks(item.commit, remaining, final) {
+			hunk.Unblamable = ignore[item.commit.Hash]
+			if err := emit(hunk); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return len(final), nil
+}
+
+// unchangedLineMapping maps destination line indexes to source line indexes
+// for lines a diff leaves untouched
+func unchangedLineMapping(ops []lineOp) map[int]int {
+	mapping := make(map[int]int)
+	src, dst := 0, 0
+	for _, op := range ops {
+		switch op.Type {
+		case diffmatchpatch.DiffDelete:
+			src++
+		case diffmatchpatch.DiffInsert:
+			dst++
+		default:
+			mapping[dst] = src
+			src++
+			dst++
+		}
+	}
+	return mapping
+}
+
+// changedLineMapping pairs the lines a diff replaces, mapping the nth
+// inserted line of each change to its nth deleted line. Inserted lines
+// beyond the deleted ones have no counterpart.
+func changedLineMapping(ops []lineOp) map[int]int {
+	mapping := make(map[int]int)
+	src, dst := 0, 0
+	deleted := []int{}
+	for _, op := range ops {
+		switch op.Type {
+		case diffmatchpatch.DiffDelete:
+			deleted = append(deleted, src)
+			src++
+		case diffmatchpatch.DiffInsert:
+			if len(deleted) > 0 {
+				mapping[dst] = deleted[0]
+				deleted = deleted[1:]
+			}
+			dst++
+		default:
+			deleted = deleted[:0]
+			src++
+			dst++
+		}
+	}
+	return mapping
+}
+
+// blameHunks groups the final lines claimed by a commit into consecutive runs
+func blameHunks(commit *object.Commit, claimed map[int]int, final []string) []*BlameHunk {
+	if len(claimed) == 0 {
+		return nil
+	}
+
+	finalLines := make([]int, 0, len(claimed))
+	for _, finalLine := range claimed {
+		finalLines = append(finalLines, finalLine)
+	}
+	sort.Ints(finalLines)
+
+	info := newCommitInfo(commit)
+	var hunks []*BlameHunk
+	for _, line := range finalLines {
+		if n := len(hunks); n > 0 && hunks[n-1].StartLine+hunks[n-1].LineCount-1 == line {
+			hunks[n-1].LineCount++
+			hunks[n-1].Lines = append(hunks[n-1].Lines, final[line])
+			continue
+		}
+		hunks = append(hunks, &BlameHunk{
+			StartLine: line + 1,
+			LineCount: 1,
+			Commit:    info,
+			Lines:     []string{final[line]},
+		})
+	}
+	return hunks
+}
+
+// parseIgnoreRevs resolves the commits blame should look through, given as
+// ignoreRevs: a comma separated list that may be repeated
+func (gs *GitService) parseIgnoreRevs(repo *git.Repository, query url.Values) (map[plumbing.Hash]bool, error) {
+	ignore := make(map[plumbing.Hash]bool)
+	for _, value := range query["ignoreRevs"] {
+		for _, rev := range strings.Split(value, ",") {
+			if rev = strings.TrimSpace(rev); rev == "" {
+				continue
+			}
+			ignored, err := gs.resolveCommit(repo, rev)
+			if err != nil {
+				return nil, fmt.Errorf("Commit %s not found", rev)
+			}
+			ignore[ignored.Hash] = true
+		}
+	}
+	return ignore, nil
+}
+
+// Blame file endpoint. Unlike the stream, every line is returned at once, so
+// files above the project's blameMaxFileSize are refused.
+func (gs *GitService) blameHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	query := r.URL.Query()
+
+	if query.Get("path") == "" {
+		gs.sendError(w, "Path is required", http.StatusBadRequest)
+		return
+	}
+	p, ok := repoPath(query.Get("path"))
+	if !ok {
+		gs.sendError(w, fmt.Sprintf("Invalid path %s", query.Get("path")), http.StatusBadRequest)
+		return
+	}
+	ref := query.Get("ref")
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	commit, err := gs.resolveCommit(repo, ref)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Revision %s not found", ref), http.StatusNotFound)
+		return
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+		return
+	}
+	entry, err := tree.FindEntry(p)
+	if err == object.ErrEntryNotFound || err == object.ErrDirectoryNotFound {
+		gs.sendError(w, fmt.Sprintf("Path %s not found at %s", p, ref), http.StatusNotFound)
+		return
+	} else if err != nil {
+		gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+		return
+	}
+	switch entry.Mode {
+	case filemode.Dir:
+		gs.sendError(w, fmt.Sprintf("Path %s is a directory", p), http.StatusBadRequest)
+		return
+	case filemode.Submodule:
+		gs.sendError(w, fmt.Sprintf("Path %s is a submodule", p), http.StatusBadRequest)
+		return
+	}
+
+	ignore, err := gs.parseIgnoreRevs(repo, query)
+	if err != nil {
+		gs.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+	obj, err := repo.Storer.EncodedObject(plumbing.BlobObject, entry.Hash)
+	if err != nil {
+		gs.sendError(w, "Failed to read blob", http.StatusInternalServerError)
+		return
+	}
+	if obj.Size() > settings.BlameMaxFileSize {
+		gs.sendErrorWithDetails(w, fmt.Sprintf("File %s is too large to blame", p), http.StatusRequestEntityTooLarge, map[string]interface{}{
+			"size":  obj.Size(),
+			"limit": settings.BlameMaxFileSize,
+		})
+		return
+	}
+
+	lines := []BlameLine{}
+	_, err = blameFile(r.Context(), commit, p, settings.diffOptions(), ignore, func(hunk *BlameHunk) error {
+		for i, content := range hunk.Lines {
+			lines = append(lines, BlameLine{
+				Line:    hunk.StartLine + i,
+				Content: content,
+				Hash:    hunk.Commit.Hash,
+				Author:  hunk.Commit.Author,
+				Date:    hunk.Commit.Date,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		gs.sendInternalError(w, "Blame failed", err)
+		return
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].Line < lines[j].Line })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":   p,
+		"ref":    ref,
+		"commit": commit.Hash.String(),
+		"lines":  lines,
+	})
+}
+
+// Stream blame endpoint
+func (gs *GitService) blameStreamHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	if r.URL.Query().Get("path") == "" {
+		gs.sendError(w, "Path is required", http.StatusBadRequest)
+		return
+	}
+	path, ok := repoPath(r.URL.Query().Get("path"))
+	if !ok {
+		gs.sendError(w, fmt.Sprintf("Invalid path %s", r.URL.Query().Get("path")), http.StatusBadRequest)
+		return
+	}
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	commit, err := gs.resolveCommit(repo, r.URL.Query().Get("ref"))
+	if err != nil {
+		gs.sendError(w, "Failed to resolve ref", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := commit.File(path); err != nil {
+		gs.sendError(w, fmt.Sprintf("Path %s not found", path), http.StatusNotFound)
+		return
+	}
+
+	ignore, err := gs.parseIgnoreRevs(repo, r.URL.Query())
+	if err != nil {
+		gs.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+
+	stream, err := newSSEWriter(w)
+	if err != nil {
+		gs.sendError(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	hunks := 0
+	lines, err := blameFile(r.Context(), commit, path, settings.diffOptions(), ignore, func(hunk *BlameHunk) error {
+		hunks++
+		return stream.send("hunk", hunk)
+	})
+	if err != nil {
+		// A disconnected client cancels the context; there is nobody left to tell
+		if r.Context().Err() == nil {
+			stream.send("error", map[string]string{"message": fmt.Sprintf("Blame failed: %v", err)})
+		}
+		return
+	}
+
+	stream.send("done", map[string]interface{}{
+		"path":  path,
+		"lines": lines,
+		"hunks": hunks,
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// blameLines returns the commit each line of a.txt is attributed to
+func blameLines(t *testing.T, gs *GitService, query string) []string {
+	t.Helper()
+	rec := serve(t, gs.blameHandler, "GET", "/git/p/blame?path=a.txt"+query, project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Lines []BlameLine `json:"lines"`
+	}
+	decodeBody(t, rec, &body)
+	hashes := make([]string, len(body.Lines))
+	for i, line := range body.Lines {
+		hashes[i] = line.Hash
+	}
+	return hashes
+}
+
+func TestBlameIgnoresFormattingCommit(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	first := commitTestFiles(t, repo, "Add lines", map[string]string{"a.txt": "alpha\nbeta\ngamma\n"})
+	format := commitTestFiles(t, repo, "Reindent", map[string]string{"a.txt": "alpha\n    beta\ngamma\n"})
+	last := commitTestFiles(t, repo, "Add delta", map[string]string{"a.txt": "alpha\n    beta\ngamma\ndelta\n"})
+
+	got := blameLines(t, gs, "")
+	want := []string{first.String(), format.String(), first.String(), last.String()}
+	if len(got) != len(want) {
+		t.Fatalf("blamed %d lines, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d blamed on %s, want %s", i+1, got[i], want[i])
+		}
+	}
+
+	got = blameLines(t, gs, "&ignoreRevs="+format.String())
+	want[1] = first.String()
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("with the reindent ignored, line %d blamed on %s, want %s", i+1, got[i], want[i])
+		}
+	}
+}
+
+func TestBlameRejectsUnknownIgnoreRev(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "p")
+	rec := serve(t, gs.blameHandler, "GET", "/git/p/blame?path=a.txt&ignoreRevs=nope", project("p"), nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestBlameStreamSendsHunksThenDone(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	commitTestFiles(t, repo, "Add lines", map[string]string{"a.txt": "one\ntwo\nthree\n"})
+	commitTestFiles(t, repo, "Change middle", map[string]string{"a.txt": "one\nTWO\nthree\n"})
+
+	rec := serve(t, gs.blameStreamHandler, "GET", "/git/p/blame/stream?path=a.txt", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	events := readEvents(t, rec)
+	if len(events) == 0 {
+		t.Fatal("no events were sent")
+	}
+
+	lines := 0
+	for _, event := range events[:len(events)-1] {
+		if event.Event != "hunk" {
+			t.Fatalf("got a %s event before done", event.Event)
+		}
+		var hunk BlameHunk
+		if err := json.Unmarshal([]byte(event.Data), &hunk); err != nil {
+			t.Fatal(err)
+		}
+		lines += hunk.LineCount
+	}
+	// Lines one and three come from one commit and two from the other, so
+	// there are at least three runs
+	if hunks := len(events) - 1; hunks < 3 {
+		t.Errorf("got %d hunks, want at least 3", hunks)
+	}
+	if lines != 3 {
+		t.Errorf("hunks cover %d lines, want 3", lines)
+	}
+
+	done := events[len(events)-1]
+	if done.Event != "done" {
+		t.Fatalf("last event is %s, want done", done.Event)
+	}
+	var summary struct {
+		Lines int `json:"lines"`
+		Hunks int `json:"hunks"`
+	}
+	if err := json.Unmarshal([]byte(done.Data), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Lines != 3 || summary.Hunks != len(events)-1 {
+		t.Errorf("done reports %d lines in %d hunks, want 3 in %d", summary.Lines, summary.Hunks, len(events)-1)
+	}
+}
+
+func TestBlameStreamRejectsPathsOutsideTheRepository(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "p")
+	for _, path := range []string{"../secret", "a/../../secret", "/etc/passwd", ".git/config"} {
+		rec := serve(t, gs.blameStreamHandler, "GET", "/git/p/blame/stream?path="+url.QueryEscape(path), project("p"), nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("path %q: status %d, want 400", path, rec.Code)
+		}
+		rec = serve(t, gs.blameHandler, "GET", "/git/p/blame?path="+url.QueryEscape(path), project("p"), nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("path %q: blame status %d, want 400", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/gorilla/mux"
+)
+
+// BlobSpec identifies a blob either by hash or by a path at a ref
+type BlobSpec struct {
+	Hash string `json:"hash,omitempty"`
+	Ref  string `json:"ref,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+// BlobDiffRequest represents a request to diff two blobs
+type BlobDiffRequest struct {
+	From BlobSpec `json:"from"`
+	To   BlobSpec `json:"to"`
+}
+
+// Diff two blobs endpoint
+func (gs *GitService) blobDiffHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req BlobDiffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+
+	src, srcLabel, status, err := gs.resolveBlob(repo, req.From)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid from blob: %v", err), status)
+		return
+	}
+	dst, dstLabel, status, err := gs.resolveBlob(repo, req.To)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid to blob: %v", err), status)
+		return
+	}
+
+	pair := filePair{srcPath: srcLabel, dstPath: dstLabel, src: src, dst: dst}
+	file, err := fileDiff(pair, settings.diffOptions())
+	if err != nil {
+		gs.sendInternalError(w, "Failed to compute diff", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if file == nil {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"identical": true,
+			"binary":    false,
+			"additions": 0,
+			"deletions": 0,
+			"patch":     "",
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"identical": false,
+		"binary":    file.Binary,
+		"additions": file.Additions,
+		"deletions": file.Deletions,
+		"patch":     file.Patch,
+	})
+}
+
+// resolveBlob finds the blob a spec names, returning it with the label used
+// in patch headers and the HTTP status to report on failure
+func (gs *GitService) resolveBlob(repo *git.Repository, spec BlobSpec) (*diffEntry, string, int, error) {
+	if spec.Hash != "" {
+		if spec.Ref != "" || spec.Path != "" {
+			return nil, "", http.StatusBadRequest, fmt.Errorf("give either hash or ref and path")
+		}
+		if !plumbing.IsHash(spec.Hash) {
+			return nil, "", http.StatusBadRequest, fmt.Errorf("invalid hash %q", spec.Hash)
+		}
+		hash := plumbing.NewHash(spec.Hash)
+		if _, err := repo.BlobObject(hash); err != nil {
+			return nil, "", http.StatusNotFound, fmt.Errorf("blob %s not found", spec.Hash)
+		}
+		return blobEntry(repo, hash, filemode.Regular), spec.Hash, http.StatusOK, nil
+	}
+
+	if spec.Path == "" {
+		return nil, "", http.StatusBadRequest, fmt.Errorf("hash or path is required")
+	}
+	commit, err := gs.resolveCommit(repo, spec.Ref)
+	if err != nil {
+		return nil, "", http.StatusBadRequest, fmt.Errorf("failed to resolve ref %q", spec.Ref)
+	}
+	file, err := commit.File(spec.Path)
+	if err != nil {
+		return nil, "", http.StatusNotFound, fmt.Errorf("path %s not found", spec.Path)
+	}
+	return blobEntry(repo, file.Hash, file.Mode), spec.Path, http.StatusOK, nil
+}
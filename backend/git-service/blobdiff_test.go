@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type blobDiffResponse struct {
+	Identical bool   `json:"identical"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Patch     string `json:"patch"`
+}
+
+func TestBlobDiffAcrossPathsAndRefs(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	initial := refHash(t, repo, "HEAD")
+	commitTestFiles(t, repo, "Add b", map[string]string{"b.txt": "one\ntwo\n"})
+
+	req := BlobDiffRequest{
+		From: BlobSpec{Ref: initial.String(), Path: "a.txt"},
+		To:   BlobSpec{Ref: "HEAD", Path: "b.txt"},
+	}
+	rec := serve(t, gs.blobDiffHandler, "POST", "/git/p/blob-diff", project("p"), req)
+	expectStatus(t, rec, http.StatusOK)
+	var body blobDiffResponse
+	decodeBody(t, rec, &body)
+	if body.Identical || body.Additions != 1 || body.Deletions != 0 {
+		t.Errorf("got %+v, want one added line", body)
+	}
+	if !strings.Contains(body.Patch, "a.txt") || !strings.Contains(body.Patch, "b.txt") || !strings.Contains(body.Patch, "+two\n") {
+		t.Errorf("patch:\n%s", body.Patch)
+	}
+
+	// The same blob by hash and by path is identical
+	commit, err := repo.CommitObject(initial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := commit.File("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = BlobDiffRequest{From: BlobSpec{Hash: blob.Hash.String()}, To: BlobSpec{Ref: "HEAD", Path: "a.txt"}}
+	rec = serve(t, gs.blobDiffHandler, "POST", "/git/p/blob-diff", project("p"), req)
+	expectStatus(t, rec, http.StatusOK)
+	body = blobDiffResponse{}
+	decodeBody(t, rec, &body)
+	if !body.Identical || body.Patch != "" {
+		t.Errorf("got %+v, want identical", body)
+	}
+
+	for _, tc := range []struct {
+		spec   BlobSpec
+		status int
+	}{
+		{BlobSpec{Hash: "nothex"}, http.StatusBadRequest},
+		{BlobSpec{Hash: blob.Hash.String(), Path: "a.txt"}, http.StatusBadRequest},
+		{BlobSpec{Hash: "0123456789abcdef0123456789abcdef01234567"}, http.StatusNotFound},
+	} {
+		rec := serve(t, gs.blobDiffHandler, "POST", "/git/p/blob-diff", project("p"), BlobDiffRequest{From: tc.spec, To: req.To})
+		if rec.Code != tc.status {
+			t.Errorf("%+v: status %d, want %d", tc.spec, rec.Code, tc.status)
+		}
+	}
+}
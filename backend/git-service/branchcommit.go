@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+)
+
+// BranchCommitFile is a file to write, or delete, in the new branch's first commit
+type BranchCommitFile struct {
+	Path            string `json:"path"`
+	Content         string `json:"content"`
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+	Executable      bool   `json:"executable,omitempty"`
+	Delete          bool   `json:"delete,omitempty"`
+}
+
+// BranchCommitRequest creates a branch from Base with one commit on top
+type BranchCommitRequest struct {
+	Branch   string             `json:"branch"`
+	Base     string             `json:"base,omitempty"`
+	Message  string             `json:"message"`
+	Author   Author             `json:"author"`
+	Files    []BranchCommitFile `json:"files"`
+	Checkout bool               `json:"checkout,omitempty"`
+}
+
+// Create a branch with a commit endpoint
+func (gs *GitService) branchCommitHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req BranchCommitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateRefName(req.Branch); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid branch name: %v", err), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		gs.sendError(w, "Commit message is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Files) == 0 {
+		gs.sendError(w, "At least one file is required", http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	branchRef := plumbing.NewBranchReferenceName(req.Branch)
+	if _, err := repo.Reference(branchRef, false); err == nil {
+		gs.sendError(w, fmt.Sprintf("Branch '%s' already exists", req.Branch), http.StatusConflict)
+		return
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+	if settings.RequireSignedCommits {
+		gs.sendError(w, unsignedCommitMessage, http.StatusUnprocessableEntity)
+		return
+	}
+	if !gs.checkBranchName(w, settings, req.Branch) {
+		return
+	}
+
+	author := gs.fillIdentity(projectID, req.Author)
+	if author.Name == "" || author.Email == "" {
+		gs.sendError(w, missingIdentityMessage, http.StatusBadRequest)
+		return
+	}
+
+	base, err := gs.resolveCommit(repo, req.Base)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Base %s not found", req.Base), http.StatusNotFound)
+		return
+	}
+	baseName := req.Base
+	if baseName == "" {
+		baseName = "HEAD"
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+
+	// The commit is built from the base tree without touching the index or
+	// working tree, so the branch only appears once the commit exists
+	entries, err := treeEntries(base, "")
+	if err != nil {
+		gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+		return
+	}
+	var warnings []string
+	for _, file := range req.Files {
+		path, ok := repoPath(file.Path)
+		if !ok {
+			gs.sendError(w, fmt.Sprintf("Invalid path %q", file.Path), http.StatusBadRequest)
+			return
+		}
+		if file.Delete {
+			if _, ok := entries[path]; !ok {
+				gs.sendError(w, fmt.Sprintf("Cannot delete %s: not in %s", path, baseName), http.StatusBadRequest)
+				return
+			}
+			delete(entries, path)
+			continue
+		}
+
+		content, decodeWarnings, err := decodeContent(file.Content, file.ContentEncoding)
+		if err != nil {
+			gs.sendError(w, fmt.Sprintf("Invalid content for %s: %v", path, err), http.StatusBadRequest)
+			return
+		}
+		content, _, _, decodeWarnings = gs.convertContent(projectID, worktree.Filesystem, path, content, file.ContentEncoding == "base64", decodeWarnings)
+		for _, warning := range decodeWarnings {
+			warnings = append(warnings, path+": "+warning)
+		}
+
+		// A file cannot replace a directory or sit below an existing file
+		for p := range entries {
+			if strings.HasPrefix(p, path+"/") || strings.HasPrefix(path, p+"/") {
+				gs.sendError(w, fmt.Sprintf("Path %s conflicts with %s", path, p), http.StatusBadRequest)
+				return
+			}
+		}
+
+		hash, err := storeBlob(repo.Storer, content)
+		if err != nil {
+			gs.sendError(w, "Failed to write blob", http.StatusInternalServerError)
+			return
+		}
+		mode := filemode.Regular
+		if file.Executable {
+			mode = filemode.Executable
+		}
+		data := content
+		entries[path] = &diffEntry{hash: hash, mode: mode, read: func() ([]byte, error) { return data, nil }}
+	}
+
+	treeHash, err := buildTree(repo.Storer, entries)
+	if err != nil {
+		gs.sendError(w, "Failed to write tree", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	commit := &object.Commit{
+		Author:       object.Signature{Name: author.Name, Email: author.Email, When: now},
+		Committer:    object.Signature{Name: author.Name, Email: author.Email, When: now},
+		Message:      req.Message,
+		TreeHash:     treeHash,
+		ParentHashes: []plumbing.Hash{base.Hash},
+	}
+	if commit.Hash, err = storeObject(repo.Storer, commit); err != nil {
+		gs.sendError(w, "Failed to write commit", http.StatusInternalServerError)
+		return
+	}
+
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(branchRef, commit.Hash)); err != nil {
+		gs.sendError(w, "Failed to create branch", http.StatusInternalServerError)
+		return
+	}
+
+	// Moving onto the branch is the last step; if it cannot happen the
+	// branch is removed again so nothing is left half done
+	if req.Checkout {
+		previousHead, err := repo.Head()
+		if err != nil {
+			repo.Storer.RemoveReference(branchRef)
+			gs.sendError(w, "Failed to read HEAD", http.StatusInternalServerError)
+			return
+		}
+		status, err := worktree.Status()
+		if err != nil {
+			repo.Storer.RemoveReference(branchRef)
+			gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+			return
+		}
+		conflicts, err := gs.switchCarryingChanges(repo, worktree, previousHead.Hash(), commit.Hash, status)
+		if err != nil || len(conflicts) > 0 {
+			repo.Storer.RemoveReference(branchRef)
+			if err != nil {
+				gs.sendInternalError(w, "Failed to update working tree", err)
+				return
+			}
+			gs.sendErrorWithDetails(w, fmt.Sprintf("Local changes would be overwritten by switching to '%s'", req.Branch), http.StatusConflict, map[string]interface{}{
+				"conflicts": conflicts,
+			})
+			return
+		}
+		if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, branchRef)); err != nil {
+			repo.Storer.RemoveReference(branchRef)
+			gs.sendError(w, "Failed to switch branch", http.StatusInternalServerError)
+			return
+		}
+		gs.logCheckout(projectID, repo, previousHead)
+		gs.recordRecentBranch(projectID, req.Branch)
+	}
+
+	subject, _ := splitCommitMessage(req.Message)
+	gs.appendReflog(projectID, branchRef, plumbing.ZeroHash, base.Hash, author, "branch: Created from "+baseName)
+	gs.appendReflog(projectID, branchRef, base.Hash, commit.Hash, author, "commit: "+subject)
+
+	if warnings == nil {
+		warnings = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    fmt.Sprintf("Created branch '%s' with commit %s", req.Branch, commit.Hash.String()[:7]),
+		"branch":     req.Branch,
+		"commit":     newCommitInfo(commit),
+		"checkedOut": req.Checkout,
+		"warnings":   warnings,
+	})
+}
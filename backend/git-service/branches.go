@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/gorilla/mux"
+)
+
+// RemoteBranch represents a remote-tracking branch. Name is the full
+// "<remote>/<branch>" form; HasLocal reports a local branch named Branch.
+type RemoteBranch struct {
+	Name       string  `json:"name"`
+	Remote     string  `json:"remote"`
+	Branch     string  `json:"branch"`
+	HasLocal   bool    `json:"hasLocal"`
+	LastCommit *Commit `json:"lastCommit"`
+}
+
+// remoteBranches lists the remote-tracking branches sorted by name, skipping
+// symbolic refs such as origin/HEAD
+func remoteBranches(repo *git.Repository) ([]*RemoteBranch, error) {
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	refs, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+	branches := []*RemoteBranch{}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if !ref.Name().IsRemote() || ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		// Remote names may contain slashes, so the longest configured
+		// remote that prefixes the ref wins
+		rest := strings.TrimPrefix(ref.Name().String(), "refs/remotes/")
+		remote := ""
+		for name := range cfg.Remotes {
+			if strings.HasPrefix(rest, name+"/") && len(name) > len(remote) {
+				remote = name
+			}
+		}
+		if remote == "" {
+			return nil
+		}
+		branch := strings.TrimPrefix(rest, remote+"/")
+
+		commit, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return err
+		}
+		_, err = repo.Reference(plumbing.NewBranchReferenceName(branch), false)
+		branches = append(branches, &RemoteBranch{
+			Name:       remote + "/" + branch,
+			Remote:     remote,
+			Branch:     branch,
+			HasLocal:   err == nil,
+			LastCommit: newCommitInfo(commit),
+		})
+		return nil
+	})
+	sort.Slice(branches, func(i, j int) bool { return branches[i].Name < branches[j].Name })
+	return branches, err
+}
+
+// Create orphan branch endpoint
+func (gs *GitService) createOrphanBranchHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" {
+		gs.sendError(w, "Branch name is required", http.StatusBadRequest)
+		return
+	}
+	if err := validateRefName(req.Name); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid branch name: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	branchRef := plumbing.NewBranchReferenceName(req.Name)
+	if _, err := repo.Reference(branchRef, false); err == nil {
+		gs.sendError(w, fmt.Sprintf("Branch '%s' already exists", req.Name), http.StatusConflict)
+		return
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+	if !gs.checkBranchName(w, settings, req.Name) {
+		return
+	}
+
+	// Start from an empty staging area so the first commit only contains
+	// what the caller stages; working tree files are left untouched
+	version := uint32(2)
+	if idx, err := repo.Storer.Index(); err == nil {
+		version = idx.Version
+	}
+	if err := repo.Storer.SetIndex(&index.Index{Version: version}); err != nil {
+		gs.sendError(w, "Failed to clear index", http.StatusInternalServerError)
+		return
+	}
+
+	// HEAD points at a branch that does not exist yet, so the next commit
+	// becomes a root commit and creates the branch
+	head := plumbing.NewSymbolicReference(plumbing.HEAD, branchRef)
+	if err := repo.Storer.SetReference(head); err != nil {
+		gs.sendError(w, "Failed to update HEAD", http.StatusInternalServerError)
+		return
+	}
+	gs.recordRecentBranch(projectID, req.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Orphan branch '%s' created successfully", req.Name),
+		"branch":  req.Name,
+	})
+}
+
+// Delete branch endpoint
+func (gs *GitService) deleteBranchHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	branchName := vars["branchName"]
+
+	force := false
+	if value := r.URL.Query().Get("force"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			gs.sendError(w, "Invalid force value", http.StatusBadRequest)
+			return
+		}
+		force = parsed
+	}
+	if err := validateRefName(branchName); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid branch name: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	branchRef := plumbing.NewBranchReferenceName(branchName)
+	ref, err := repo.Reference(branchRef, false)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Branch '%s' not found", branchName), http.StatusNotFound)
+		return
+	}
+
+	// Compare the symbolic target so an unborn branch counts as checked out too
+	head, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		gs.sendError(w, "Failed to read HEAD", http.StatusInternalServerError)
+		return
+	}
+	if head.Type() == plumbing.SymbolicReference && head.Target() == branchRef {
+		gs.sendError(w, fmt.Sprintf("Cannot delete branch '%s' while it is checked out", branchName), http.StatusConflict)
+		return
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		gs.sendError(w, "Failed to read config", http.StatusInternalServerError)
+		return
+	}
+
+	// Like git branch -d, a branch without an upstream must be merged into HEAD
+	if !force {
+		target := upstreamRef(repo, cfg, branchName)
+		into := "its upstream"
+		if target == nil {
+			// An unborn HEAD leaves nothing the branch could be merged into
+			target, _ = repo.Head()
+			into = "HEAD"
+		}
+		merged := false
+		if target != nil {
+			reachable, err := commitAncestors(repo, []plumbing.Hash{target.Hash()}, nil)
+			if err != nil {
+				gs.sendError(w, "Failed to check whether the branch is merged", http.StatusInternalServerError)
+				return
+			}
+			merged = reachable[ref.Hash()]
+		}
+		if !merged {
+			gs.sendErrorWithDetails(w, fmt.Sprintf("Branch '%s' is not fully merged into %s", branchName, into), http.StatusConflict, map[string]interface{}{
+				"hint": "Pass force=true to delete it anyway",
+			})
+			return
+		}
+	}
+
+	if err := repo.Storer.RemoveReference(branchRef); err != nil {
+		gs.sendError(w, "Failed to delete branch", http.StatusInternalServerError)
+		return
+	}
+
+	// The branch's tracking config and reflog go with it, as with git
+	if _, ok := cfg.Branches[branchName]; ok {
+		delete(cfg.Branches, branchName)
+		if err := repo.SetConfig(cfg); err != nil {
+			gs.logger.Warn("failed to remove branch config", "projectId", projectID, "branch", branchName, "error", err)
+		}
+	}
+	if err := os.Remove(gs.reflogPath(projectID, branchRef)); err != nil && !os.IsNotExist(err) {
+		gs.logger.Warn("failed to remove branch reflog", "projectId", projectID, "branch", branchName, "error", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Branch '%s' deleted successfully", branchName),
+		"branch":  branchName,
+		"commit":  ref.Hash().String(),
+	})
+}
+
+// Rename branch endpoint. Like git branch -m, the tracking config and reflog
+// move with the branch and HEAD follows it when it is checked out.
+func (gs *GitService) renameBranchHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	branchName := vars["branchName"]
+
+	var req struct {
+		NewName string `json:"newName"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.NewName == "" {
+		gs.sendError(w, "New branch name is required", http.StatusBadRequest)
+		return
+	}
+	if err := validateRefName(branchName); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid branch name: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := validateRefName(req.NewName); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid branch name: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	oldRef := plumbing.NewBranchReferenceName(branchName)
+	ref, err := repo.Reference(oldRef, false)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Branch '%s' not found", branchName), http.StatusNotFound)
+		return
+	}
+	newRef := plumbing.NewBranchReferenceName(req.NewName)
+	if _, err := repo.Reference(newRef, false); err == nil {
+		gs.sendError(w, fmt.Sprintf("Branch '%s' already exists", req.NewName), http.StatusConflict)
+		return
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+	if !gs.checkBranchName(w, settings, req.NewName) {
+		return
+	}
+
+	head, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		gs.sendError(w, "Failed to read HEAD", http.StatusInternalServerError)
+		return
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		gs.sendError(w, "Failed to read config", http.StatusInternalServerError)
+		return
+	}
+
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(newRef, ref.Hash())); err != nil {
+		gs.sendInternalError(w, fmt.Sprintf("Failed to create branch '%s'", req.NewName), err)
+		return
+	}
+	if branch, ok := cfg.Branches[branchName]; ok {
+		delete(cfg.Branches, branchName)
+		branch.Name = req.NewName
+		cfg.Branches[req.NewName] = branch
+		if err := repo.SetConfig(cfg); err != nil {
+			repo.Storer.RemoveReference(newRef)
+			gs.sendError(w, "Failed to update branch config", http.StatusInternalServerError)
+			return
+		}
+	}
+	checkedOut := head.Type() == plumbing.SymbolicReference && head.Target() == oldRef
+	if checkedOut {
+		if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, newRef)); err != nil {
+			gs.sendError(w, "Failed to update HEAD", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := repo.Storer.RemoveReference(oldRef); err != nil {
+		gs.sendError(w, fmt.Sprintf("Failed to remove branch '%s'", branchName), http.StatusInternalServerError)
+		return
+	}
+
+	newLog := gs.reflogPath(projectID, newRef)
+	if err := os.MkdirAll(filepath.Dir(newLog), 0755); err == nil {
+		if err := os.Rename(gs.reflogPath(projectID, oldRef), newLog); err != nil && !os.IsNotExist(err) {
+			gs.logger.Warn("failed to move branch reflog", "projectId", projectID, "branch", branchName, "error", err)
+		}
+	}
+	gs.appendReflog(projectID, newRef, ref.Hash(), ref.Hash(), gs.resolveIdentity(projectID), fmt.Sprintf("Branch: renamed %s to %s", oldRef, newRef))
+	if checkedOut {
+		gs.recordRecentBranch(projectID, req.NewName)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      fmt.Sprintf("Branch '%s' renamed to '%s'", branchName, req.NewName),
+		"branch":       req.NewName,
+		"previousName": branchName,
+		"commit":       ref.Hash().String(),
+		"checkedOut":   checkedOut,
+	})
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestOrphanBranchStartsWithoutHistory(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	master := refHash(t, repo, "refs/heads/master")
+
+	rec := serve(t, gs.createOrphanBranchHandler, "POST", "/git/p/branches/orphan", project("p"), map[string]string{"name": "fresh"})
+	expectStatus(t, rec, http.StatusOK)
+	writeFiles(t, repo, map[string]string{"new.txt": "new\n"})
+	rec = serveCommit(t, gs, CommitRequest{Message: "Start over", Files: []string{"new.txt"}})
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Commit Commit `json:"commit"`
+	}
+	decodeBody(t, rec, &body)
+
+	commit, err := repo.CommitObject(plumbing.NewHash(body.Commit.Hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commit.ParentHashes) != 0 {
+		t.Errorf("the first commit of an orphan branch has parents %v", commit.ParentHashes)
+	}
+	if got := refHash(t, repo, "refs/heads/fresh"); got != commit.Hash {
+		t.Errorf("fresh = %s, want %s", got, commit.Hash)
+	}
+	var files []string
+	iter, err := commit.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	iter.ForEach(func(f *object.File) error {
+		files = append(files, f.Name)
+		return nil
+	})
+	if !equalStrings(files, []string{"new.txt"}) {
+		t.Errorf("files %v; the orphan commit should not carry master's files", files)
+	}
+	if got := refHash(t, repo, "refs/heads/master"); got != master {
+		t.Error("master moved")
+	}
+
+	rec = serve(t, gs.createOrphanBranchHandler, "POST", "/git/p/branches/orphan", project("p"), map[string]string{"name": "master"})
+	expectStatus(t, rec, http.StatusConflict)
+}
+
+func TestBranchCommitCreatesBranchWithCommit(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	master := commitTestFiles(t, repo, "Add b", map[string]string{"b.txt": "b\n"})
+
+	req := BranchCommitRequest{
+		Branch:  "fix",
+		Message: "Fix things",
+		Author:  testAuthor(),
+		Files:   []BranchCommitFile{{Path: "a.txt", Content: "fixed\n"}, {Path: "b.txt", Delete: true}},
+	}
+	rec := serve(t, gs.branchCommitHandler, "POST", "/git/p/branch-commit", project("p"), req)
+	expectStatus(t, rec, http.StatusOK)
+
+	commit, err := repo.CommitObject(refHash(t, repo, "refs/heads/fix"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commit.ParentHashes) != 1 || commit.ParentHashes[0] != master {
+		t.Errorf("parents %v, want %s", commit.ParentHashes, master)
+	}
+	if file, err := commit.File("a.txt"); err != nil {
+		t.Error(err)
+	} else if content, _ := file.Contents(); content != "fixed\n" {
+		t.Errorf("a.txt = %q", content)
+	}
+	if _, err := commit.File("b.txt"); err == nil {
+		t.Error("b.txt was not deleted")
+	}
+	if headBranch(t, gs) != "master" || readProjectFile(t, gs, "a.txt") != "one\n" {
+		t.Error("the working tree changed without checkout")
+	}
+}
+
+func TestFailedBranchCommitLeavesNoBranch(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	writeFiles(t, repo, map[string]string{"a.txt": "local change\n"})
+
+	for name, req := range map[string]BranchCommitRequest{
+		"invalid file": {Files: []BranchCommitFile{{Path: "missing.txt", Delete: true}}},
+		// Checking the branch out would overwrite the local change
+		"checkout conflict": {Files: []BranchCommitFile{{Path: "a.txt", Content: "fixed\n"}}, Checkout: true},
+	} {
+		req.Branch, req.Message, req.Author = "fix", "Fix", testAuthor()
+		rec := serve(t, gs.branchCommitHandler, "POST", "/git/p/branch-commit", project("p"), req)
+		if rec.Code < 400 {
+			t.Errorf("%s: status %d", name, rec.Code)
+		}
+		if _, err := repo.Reference(plumbing.NewBranchReferenceName("fix"), false); err == nil {
+			t.Errorf("%s: the branch was left behind", name)
+		}
+	}
+	if headBranch(t, gs) != "master" || readProjectFile(t, gs, "a.txt") != "local change\n" {
+		t.Error("a failed branch commit touched the working tree")
+	}
+}
+
+func deleteBranch(t *testing.T, gs *GitService, name, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	return serve(t, gs.deleteBranchHandler, "DELETE", "/git/p/branches/"+name+query, map[string]string{"projectId": "p", "branchName": name}, nil)
+}
+
+func TestDeleteBranch(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	head := refHash(t, repo, "HEAD")
+	setRef(t, repo, "refs/heads/merged", head)
+	unmerged := storeTestCommit(t, repo, headTree(t, repo), "Unmerged work", head)
+	setRef(t, repo, "refs/heads/unmerged", unmerged)
+
+	rec := deleteBranch(t, gs, "master", "")
+	expectStatus(t, rec, http.StatusConflict)
+	refHash(t, repo, "refs/heads/master")
+
+	rec = deleteBranch(t, gs, "unmerged", "")
+	expectStatus(t, rec, http.StatusConflict)
+	refHash(t, repo, "refs/heads/unmerged")
+
+	rec = deleteBranch(t, gs, "unmerged", "?force=true")
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Branch string `json:"branch"`
+		Commit string `json:"commit"`
+	}
+	decodeBody(t, rec, &body)
+	if body.Branch != "unmerged" || body.Commit != unmerged.String() {
+		t.Errorf("forced delete: %+v", body)
+	}
+	if _, err := repo.Reference(plumbing.NewBranchReferenceName("unmerged"), false); err == nil {
+		t.Error("the forced branch is still there")
+	}
+
+	rec = deleteBranch(t, gs, "merged", "")
+	expectStatus(t, rec, http.StatusOK)
+	rec = deleteBranch(t, gs, "merged", "")
+	expectStatus(t, rec, http.StatusNotFound)
+	rec = deleteBranch(t, gs, "master", "?force=maybe")
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+// A branch with an upstream is checked against it rather than HEAD, which
+// lacks the feature commit here, and its tracking config goes with it
+func TestDeleteBranchMergedIntoUpstream(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	dir := gs.getProjectPath("p")
+	addTestRemote(t, repo)
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	commitTestFiles(t, repo, "Feature", map[string]string{"f.txt": "f\n"})
+	runGit(t, dir, "push", "-q", "-u", "origin", "feature")
+	runGit(t, dir, "checkout", "-q", "master")
+
+	rec := deleteBranch(t, gs, "feature", "")
+	expectStatus(t, rec, http.StatusOK)
+	fresh, err := gs.openRepository("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := fresh.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.Branches["feature"]; ok {
+		t.Error("the branch's tracking config was left behind")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/gorilla/mux"
+)
+
+// compileBranchPattern compiles a branch name policy so that it has to match
+// the whole name, not just part of it. An empty pattern allows any name.
+func compileBranchPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	// Compiling the pattern as given keeps error messages about what the user wrote
+	if _, err := regexp.Compile(pattern); err != nil {
+		return nil, err
+	}
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+// checkBranchName reports whether a new branch name satisfies the project's
+// naming policy, sending a 422 with the pattern when it does not
+func (gs *GitService) checkBranchName(w http.ResponseWriter, settings ProjectSettings, name string) bool {
+	re, err := compileBranchPattern(settings.BranchNamePattern)
+	if err != nil {
+		gs.sendInternalError(w, "Invalid branch name policy", err)
+		return false
+	}
+	if re != nil && !re.MatchString(name) {
+		gs.sendErrorWithDetails(w, fmt.Sprintf("Branch name '%s' does not match the project's naming policy", name), http.StatusUnprocessableEntity, map[string]interface{}{
+			"pattern": settings.BranchNamePattern,
+		})
+		return false
+	}
+	return true
+}
+
+// Get branch naming policy endpoint
+func (gs *GitService) branchPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	if _, err := gs.openRepository(projectID); err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"pattern":  settings.BranchNamePattern,
+		"enforced": settings.BranchNamePattern != "",
+	})
+}
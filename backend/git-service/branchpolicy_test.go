@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestBranchNamePolicy(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	create := func(name string) map[string]interface{} {
+		t.Helper()
+		rec := serve(t, gs.createBranchHandler, "POST", "/git/p/branches", project("p"), map[string]interface{}{"name": name, "checkout": false})
+		var body map[string]interface{}
+		decodeBody(t, rec, &body)
+		body["status"] = float64(rec.Code)
+		return body
+	}
+
+	// Without a policy any valid name is allowed
+	if body := create("Anything"); body["status"] != float64(http.StatusOK) {
+		t.Fatalf("branch without a policy: %v", body)
+	}
+
+	pattern := "(feature|fix)/[a-z0-9-]+"
+	updateSettings(t, gs, map[string]string{"branchNamePattern": pattern})
+
+	rec := serve(t, gs.branchPolicyHandler, "GET", "/git/p/branch-policy", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var policy struct {
+		Pattern  string `json:"pattern"`
+		Enforced bool   `json:"enforced"`
+	}
+	decodeBody(t, rec, &policy)
+	if policy.Pattern != pattern || !policy.Enforced {
+		t.Errorf("policy = %+v", policy)
+	}
+
+	if body := create("feature/login"); body["status"] != float64(http.StatusOK) {
+		t.Errorf("conforming branch: %v", body)
+	}
+	refHash(t, repo, "refs/heads/feature/login")
+
+	// The pattern has to match the whole name
+	for _, name := range []string{"Login", "feature/Login", "xfeature/login", "feature/login/extra"} {
+		body := create(name)
+		if body["status"] != float64(http.StatusUnprocessableEntity) || body["pattern"] != pattern {
+			t.Errorf("%s: %v", name, body)
+		}
+		if _, err := repo.Reference(plumbing.NewBranchReferenceName(name), false); err == nil {
+			t.Errorf("%s was created despite the policy", name)
+		}
+	}
+
+	// Branches made before the policy are left alone
+	refHash(t, repo, "refs/heads/Anything")
+}
+
+func TestBranchNamePolicyRejectsInvalidPattern(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "p")
+	rec := serve(t, gs.updateSettingsHandler, "PATCH", "/git/p/settings", project("p"), map[string]string{"branchNamePattern": "feature/("})
+	expectStatus(t, rec, http.StatusBadRequest)
+}
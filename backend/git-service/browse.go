@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+)
+
+// maxTreeEntries caps a tree listing so a recursive walk of a huge
+// repository stays bounded
+const maxTreeEntries = 10000
+
+// TreeEntryInfo is one entry of a tree listing. Size is only set for files.
+type TreeEntryInfo struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Type string `json:"type"`
+	Mode string `json:"mode"`
+	Size *int64 `json:"size,omitempty"`
+	Hash string `json:"hash"`
+}
+
+// contentType guesses a file's media type from its extension, then from its bytes
+func contentType(p string, content []byte) string {
+	if byExt := mime.TypeByExtension(path.Ext(p)); byExt != "" {
+		return byExt
+	}
+	return http.DetectContentType(content)
+}
+
+// Get file contents at a revision endpoint. With raw=true the bytes are sent
+// as they are instead of wrapped in JSON.
+func (gs *GitService) fileAtRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	query := r.URL.Query()
+
+	if query.Get("path") == "" {
+		gs.sendError(w, "Path is required", http.StatusBadRequest)
+		return
+	}
+	p, ok := repoPath(query.Get("path"))
+	if !ok {
+		gs.sendError(w, fmt.Sprintf("Invalid path %s", query.Get("path")), http.StatusBadRequest)
+		return
+	}
+	ref := query.Get("ref")
+	if ref == "" {
+		ref = "HEAD"
+	}
+	raw := false
+	if value := query.Get("raw"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			gs.sendError(w, "Invalid raw value", http.StatusBadRequest)
+			return
+		}
+		raw = parsed
+	}
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	commit, err := gs.resolveCommit(repo, ref)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Revision %s not found", ref), http.StatusNotFound)
+		return
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+		return
+	}
+	entry, err := tree.FindEntry(p)
+	if err == object.ErrEntryNotFound || err == object.ErrDirectoryNotFound {
+		gs.sendError(w, fmt.Sprintf("Path %s not found at %s", p, ref), http.StatusNotFound)
+		return
+	} else if err != nil {
+		gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+		return
+	}
+	switch entry.Mode {
+	case filemode.Dir:
+		gs.sendError(w, fmt.Sprintf("Path %s is a directory", p), http.StatusBadRequest)
+		return
+	case filemode.Submodule:
+		gs.sendError(w, fmt.Sprintf("Path %s is a submodule", p), http.StatusBadRequest)
+		return
+	}
+
+	content, err := blobEntry(repo, entry.Hash, entry.Mode).read()
+	if err != nil {
+		gs.sendError(w, "Failed to read blob", http.StatusInternalServerError)
+		return
+	}
+	binary := isBinary(content)
+	mediaType := contentType(p, content)
+
+	if raw {
+		w.Header().Set("Content-Type", mediaType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content)
+		return
+	}
+
+	encoded := string(content)
+	if binary {
+		encoded = base64.StdEncoding.EncodeToString(content)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":        p,
+		"ref":         ref,
+		"commit":      commit.Hash.String(),
+		"hash":        entry.Hash.String(),
+		"mode":        gitMode(entry.Mode),
+		"size":        len(content),
+		"binary":      binary,
+		"contentType": mediaType,
+		"content":     encoded,
+	})
+}
+
+// Get tree listing at a revision endpoint
+func (gs *GitService) treeHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	query := r.URL.Query()
+
+	dir := ""
+	if value := query.Get("path"); value != "" && value != "/" && value != "." {
+		p, ok := repoPath(value)
+		if !ok {
+			gs.sendError(w, fmt.Sprintf("Invalid path %s", value), http.StatusBadRequest)
+			return
+		}
+		dir = p
+	}
+	ref := query.Get("ref")
+	if ref == "" {
+		ref = "HEAD"
+	}
+	recursive := false
+	if value := query.Get("recursive"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			gs.sendError(w, "Invalid recursive value", http.StatusBadRequest)
+			return
+		}
+		recursive = parsed
+	}
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	commit, err := gs.resolveCommit(repo, ref)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Revision %s not found", ref), http.StatusNotFound)
+		return
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+		return
+	}
+	if dir != "" {
+		entry, err := tree.FindEntry(dir)
+		if err == object.ErrEntryNotFound || err == object.ErrDirectoryNotFound {
+			gs.sendError(w, fmt.Sprintf("Path %s not found at %s", dir, ref), http.StatusNotFound)
+			return
+		} else if err != nil {
+			gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+			return
+		}
+		if entry.Mode != filemode.Dir {
+			gs.sendError(w, fmt.Sprintf("Path %s is not a directory", dir), http.StatusBadRequest)
+			return
+		}
+		if tree, err = repo.TreeObject(entry.Hash); err != nil {
+			gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	entries := []TreeEntryInfo{}
+	truncated := false
+	add := func(name string, entry object.TreeEntry) error {
+		if len(entries) == maxTreeEntries {
+			truncated = true
+			return nil
+		}
+		info, err := newTreeEntryInfo(repo, path.Join(dir, name), entry)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, info)
+		return nil
+	}
+	if recursive {
+		walker := object.NewTreeWalker(tree, true, nil)
+		defer walker.Close()
+		for !truncated {
+			name, entry, err := walker.Next()
+			if err == io.EOF {
+				break
+			}
+			if err == nil {
+				err = add(name, entry)
+			}
+			if err != nil {
+				gs.sendError(w, "Failed to walk tree", http.StatusInternalServerError)
+				return
+			}
+		}
+	} else {
+		for _, entry := range tree.Entries {
+			if err := add(entry.Name, entry); err != nil {
+				gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ref":       ref,
+		"commit":    commit.Hash.String(),
+		"path":      dir,
+		"recursive": recursive,
+		"entries":   entries,
+		"truncated": truncated,
+	})
+}
+
+// newTreeEntryInfo describes a tree entry, reading the blob size for files
+func newTreeEntryInfo(repo *git.Repository, p string, entry object.TreeEntry) (TreeEntryInfo, error) {
+	info := TreeEntryInfo{
+		Name: path.Base(p),
+		Path: p,
+		Type: "file",
+		Mode: gitMode(entry.Mode),
+		Hash: entry.Hash.String(),
+	}
+	switch entry.Mode {
+	case filemode.Dir:
+		info.Type = "dir"
+	case filemode.Submodule:
+		info.Type = "submodule"
+	default:
+		obj, err := repo.Storer.EncodedObject(plumbing.BlobObject, entry.Hash)
+		if err != nil {
+			return info, err
+		}
+		size := obj.Size()
+		info.Size = &size
+	}
+	return info, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// failingRemote returns the URL of a remote that answers every request with
+// a server error
+func failingRemote(t *testing.T) string {
+	return echoCredentialsServer(t, nil).URL + "/repo.git"
+}
+
+// expectNoProject fails the test if the project directory exists
+func expectNoProject(t *testing.T, gs *GitService, projectID string) {
+	t.Helper()
+	if _, err := os.Lstat(gs.getProjectPath(projectID)); !os.IsNotExist(err) {
+		t.Errorf("project directory left behind: %v", err)
+	}
+}
+
+func TestCloneFromLocalRemote(t *testing.T) {
+	gs := newTestService(t)
+	source := initTestRepo(t, gs, "source")
+	remote := addTestRemote(t, source)
+
+	rec := serve(t, gs.cloneHandler, "POST", "/git/clone", nil, CloneRequest{URL: remote, ProjectID: "p"})
+	expectStatus(t, rec, http.StatusOK)
+	repo, err := gs.openRepository("p")
+	if err != nil {
+		t.Fatalf("clone left no repository: %v", err)
+	}
+	if got, want := refHash(t, repo, "HEAD"), refHash(t, source, "HEAD"); got != want {
+		t.Errorf("cloned HEAD %s, want %s", got, want)
+	}
+}
+
+func TestFailedCloneRemovesProjectDirectory(t *testing.T) {
+	t.Run("remote error", func(t *testing.T) {
+		gs := newTestService(t)
+		rec := serve(t, gs.cloneHandler, "POST", "/git/clone", nil, CloneRequest{URL: failingRemote(t), ProjectID: "p"})
+		if rec.Code < 400 {
+			t.Fatalf("status %d", rec.Code)
+		}
+		expectNoProject(t, gs, "p")
+	})
+
+	t.Run("missing branch", func(t *testing.T) {
+		gs := newTestService(t)
+		remote := addTestRemote(t, initTestRepo(t, gs, "source"))
+		rec := serve(t, gs.cloneHandler, "POST", "/git/clone", nil, CloneRequest{URL: remote, ProjectID: "p", Branch: "nope"})
+		if rec.Code < 400 {
+			t.Fatalf("status %d", rec.Code)
+		}
+		expectNoProject(t, gs, "p")
+	})
+
+	t.Run("operation id in use", func(t *testing.T) {
+		gs := newTestService(t)
+		if _, err := gs.startOperation("busy", "other", "push"); err != nil {
+			t.Fatal(err)
+		}
+		rec := serve(t, gs.cloneHandler, "POST", "/git/clone", nil, CloneRequest{URL: failingRemote(t), ProjectID: "p", OperationID: "busy"})
+		expectStatus(t, rec, http.StatusConflict)
+		expectNoProject(t, gs, "p")
+	})
+
+	t.Run("directory cannot be created", func(t *testing.T) {
+		gs := newTestService(t)
+		// A file where the workspace should be makes MkdirAll fail
+		gs.workspaceDir = filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(gs.workspaceDir, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		rec := serve(t, gs.cloneHandler, "POST", "/git/clone", nil, CloneRequest{URL: failingRemote(t), ProjectID: "p"})
+		expectStatus(t, rec, http.StatusInternalServerError)
+		if info, err := os.Stat(gs.workspaceDir); err != nil || info.IsDir() {
+			t.Errorf("workspace file was replaced: %v", err)
+		}
+	})
+
+	t.Run("forced re-clone", func(t *testing.T) {
+		gs := newTestService(t)
+		initTestRepo(t, gs, "p")
+		rec := serve(t, gs.cloneHandler, "POST", "/git/clone?force=true", nil, CloneRequest{URL: failingRemote(t), ProjectID: "p"})
+		if rec.Code < 400 {
+			t.Fatalf("status %d", rec.Code)
+		}
+		expectNoProject(t, gs, "p")
+	})
+}
+
+// A directory the client created is emptied by go-git but not removed
+func TestFailedCloneKeepsExistingDirectory(t *testing.T) {
+	gs := newTestService(t)
+	if err := os.MkdirAll(gs.getProjectPath("p"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	rec := serve(t, gs.cloneHandler, "POST", "/git/clone", nil, CloneRequest{URL: failingRemote(t), ProjectID: "p"})
+	if rec.Code < 400 {
+		t.Fatalf("status %d", rec.Code)
+	}
+	if info, err := os.Stat(gs.getProjectPath("p")); err != nil || !info.IsDir() {
+		t.Errorf("existing directory was removed: %v", err)
+	}
+	if _, err := git.PlainOpen(gs.getProjectPath("p")); err == nil {
+		t.Error("a half-written repository was left in the directory")
+	}
+}
+
+func TestCloneIntoExistingRepositoryConflicts(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "p")
+	rec := serve(t, gs.cloneHandler, "POST", "/git/clone", nil, CloneRequest{URL: failingRemote(t), ProjectID: "p"})
+	expectStatus(t, rec, http.StatusConflict)
+	if _, err := gs.openRepository("p"); err != nil {
+		t.Errorf("existing repository was touched: %v", err)
+	}
+}
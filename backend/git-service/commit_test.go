@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCommitAllStagesDeletions(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	commitTestFiles(t, repo, "Add b", map[string]string{"b.txt": "b\n"})
+
+	if err := os.Remove(filepath.Join(gs.getProjectPath("p"), "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, repo, map[string]string{"a.txt": "two\n"})
+	rec := serveCommit(t, gs, CommitRequest{Message: "Drop b"})
+	expectStatus(t, rec, http.StatusOK)
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := commit.File("b.txt"); err == nil {
+		t.Error("the deleted file is still in the commit")
+	}
+	if file, err := commit.File("a.txt"); err != nil {
+		t.Error("a.txt is missing from the commit")
+	} else if content, _ := file.Contents(); content != "two\n" {
+		t.Errorf("a.txt = %q, want the modified content", content)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.IsClean() {
+		t.Errorf("changes left after committing everything:\n%s", status)
+	}
+}
+
+type amendResponse struct {
+	DryRun   bool     `json:"dryRun"`
+	Commit   Commit   `json:"commit"`
+	Replaces string   `json:"replaces"`
+	Stat     DiffStat `json:"stat"`
+}
+
+func TestAmendDryRunMatchesAmend(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	parent := refHash(t, repo, "HEAD")
+	head := commitTestFiles(t, repo, "Add b", map[string]string{"b.txt": "b\n"})
+	writeFiles(t, repo, map[string]string{"c.txt": "c\n"})
+
+	rec := serveCommit(t, gs, CommitRequest{Message: "Add b and c", Amend: true, DryRun: true})
+	expectStatus(t, rec, http.StatusOK)
+	var preview amendResponse
+	decodeBody(t, rec, &preview)
+	if !preview.DryRun || preview.Replaces != head.String() {
+		t.Errorf("preview %+v", preview)
+	}
+	if refHash(t, repo, "HEAD") != head {
+		t.Fatal("a dry run moved HEAD")
+	}
+
+	rec = serveCommit(t, gs, CommitRequest{Message: "Add b and c", Amend: true})
+	expectStatus(t, rec, http.StatusOK)
+	var amended amendResponse
+	decodeBody(t, rec, &amended)
+	if amended.DryRun || !equalStrings(amended.Commit.Files, preview.Commit.Files) || amended.Stat != preview.Stat || amended.Commit.Message != preview.Commit.Message {
+		t.Errorf("amend %+v does not match its preview %+v", amended, preview)
+	}
+	if !equalStrings(amended.Commit.Files, []string{"b.txt", "c.txt"}) {
+		t.Errorf("files %v, want b.txt and c.txt", amended.Commit.Files)
+	}
+
+	commit, err := repo.CommitObject(refHash(t, repo, "HEAD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.Hash.String() != amended.Commit.Hash || len(commit.ParentHashes) != 1 || commit.ParentHashes[0] != parent {
+		t.Errorf("HEAD %s with parents %v, want %s on %s", commit.Hash, commit.ParentHashes, amended.Commit.Hash, parent)
+	}
+	if commit.Author.Name != "Test User" {
+		t.Errorf("author %s, want the original author kept", commit.Author.Name)
+	}
+}
+
+func TestAmendRefusesPushedCommit(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	addTestRemote(t, repo)
+	runGit(t, gs.getProjectPath("p"), "branch", "--set-upstream-to=origin/master")
+	head := refHash(t, repo, "HEAD")
+
+	rec := serveCommit(t, gs, CommitRequest{Message: "Reworded", Amend: true})
+	expectStatus(t, rec, http.StatusConflict)
+	if refHash(t, repo, "HEAD") != head {
+		t.Fatal("a refused amend moved HEAD")
+	}
+	rec = serveCommit(t, gs, CommitRequest{Message: "Reworded", Amend: true, Force: true})
+	expectStatus(t, rec, http.StatusOK)
+}
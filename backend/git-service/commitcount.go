@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/gorilla/mux"
+)
+
+// commitCount is a cached count, valid while the commits it was counted
+// from are unchanged
+type commitCount struct {
+	key   string
+	count int
+}
+
+// Get commit count endpoint
+func (gs *GitService) commitCountHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	query := r.URL.Query()
+	ref := query.Get("ref")
+	all := query.Get("all") == "true"
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	// The starting commits identify the count: it only has to be redone
+	// once one of them moves
+	var roots []plumbing.Hash
+	if all {
+		if roots, err = gs.refRoots(repo); err != nil {
+			gs.sendError(w, "Failed to list references", http.StatusInternalServerError)
+			return
+		}
+	} else if commit, err := gs.resolveCommit(repo, ref); err == nil {
+		roots = []plumbing.Hash{commit.Hash}
+	} else if _, headErr := repo.Head(); ref != "HEAD" || headErr != plumbing.ErrReferenceNotFound {
+		// An unborn HEAD simply has no commits yet
+		gs.sendError(w, fmt.Sprintf("Ref %s not found", ref), http.StatusNotFound)
+		return
+	}
+
+	keys := make([]string, 0, len(roots))
+	for _, hash := range roots {
+		keys = append(keys, hash.String())
+	}
+	key := strings.Join(keys, ",")
+	scope := projectID + "\x00" + ref
+	if all {
+		scope = projectID + "\x00--all"
+	}
+
+	gs.countsMu.Lock()
+	cached, ok := gs.commitCounts[scope]
+	gs.countsMu.Unlock()
+	fromCache := ok && cached.key == key
+	count := cached.count
+	if !fromCache {
+		reachable, err := commitAncestors(repo, roots, nil)
+		if err != nil {
+			gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+			return
+		}
+		count = len(reachable)
+		gs.countsMu.Lock()
+		gs.commitCounts[scope] = commitCount{key: key, count: count}
+		gs.countsMu.Unlock()
+	}
+
+	response := map[string]interface{}{
+		"count":  count,
+		"cached": fromCache,
+	}
+	if all {
+		response["all"] = true
+	} else {
+		response["ref"] = ref
+		if len(roots) > 0 {
+			response["hash"] = roots[0].String()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// refRoots returns the distinct commits the refs of a repository point at,
+// sorted by hash
+func (gs *GitService) refRoots(repo *git.Repository) ([]plumbing.Hash, error) {
+	var roots []plumbing.Hash
+	seen := make(map[plumbing.Hash]bool)
+	iter, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+	err = iter.ForEach(func(r *plumbing.Reference) error {
+		// Refs that do not lead to a commit, like a tag of a blob, add nothing
+		commit, err := gs.resolveCommit(repo, r.Name().String())
+		if err == nil && !seen[commit.Hash] {
+			seen[commit.Hash] = true
+			roots = append(roots, commit.Hash)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(roots, func(i, j int) bool { return roots[i].String() < roots[j].String() })
+	return roots, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+type commitCountResponse struct {
+	Count  int    `json:"count"`
+	Cached bool   `json:"cached"`
+	Ref    string `json:"ref"`
+	Hash   string `json:"hash"`
+	All    bool   `json:"all"`
+}
+
+func getCommitCount(t *testing.T, gs *GitService, query string) commitCountResponse {
+	t.Helper()
+	rec := serve(t, gs.commitCountHandler, "GET", "/git/p/commit-count"+query, project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body commitCountResponse
+	decodeBody(t, rec, &body)
+	return body
+}
+
+func TestCommitCountIsCachedUntilHeadMoves(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	commitTestFiles(t, repo, "Second", map[string]string{"b.txt": "b\n"})
+
+	first := getCommitCount(t, gs, "")
+	if first.Count != 2 || first.Cached || first.Ref != "HEAD" || first.Hash != refHash(t, repo, "HEAD").String() {
+		t.Fatalf("first count: %+v", first)
+	}
+	if again := getCommitCount(t, gs, "?ref=HEAD"); again.Count != 2 || !again.Cached {
+		t.Errorf("repeated count: %+v", again)
+	}
+
+	head := commitTestFiles(t, repo, "Third", map[string]string{"c.txt": "c\n"})
+	after := getCommitCount(t, gs, "")
+	if after.Count != 3 || after.Cached || after.Hash != head.String() {
+		t.Errorf("count after a new commit: %+v", after)
+	}
+	if again := getCommitCount(t, gs, ""); again.Count != 3 || !again.Cached {
+		t.Errorf("repeated count after a new commit: %+v", again)
+	}
+}
+
+func TestCommitCountAcrossAllRefs(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	base := refHash(t, repo, "HEAD")
+	side := storeTestCommit(t, repo, headTree(t, repo), "Side", base)
+	setRef(t, repo, "refs/heads/side", side)
+	commitTestFiles(t, repo, "Main", map[string]string{"b.txt": "b\n"})
+
+	if body := getCommitCount(t, gs, "?ref=side"); body.Count != 2 || body.Hash != side.String() {
+		t.Errorf("count of side: %+v", body)
+	}
+	all := getCommitCount(t, gs, "?all=true")
+	if all.Count != 3 || !all.All || all.Cached {
+		t.Errorf("count of all refs: %+v", all)
+	}
+	if again := getCommitCount(t, gs, "?all=true"); !again.Cached {
+		t.Errorf("repeated count of all refs: %+v", again)
+	}
+
+	// Moving any ref, not just HEAD, invalidates the count of all refs
+	setRef(t, repo, "refs/heads/side", storeTestCommit(t, repo, headTree(t, repo), "More", side))
+	if body := getCommitCount(t, gs, "?all=true"); body.Count != 4 || body.Cached {
+		t.Errorf("count of all refs after side moved: %+v", body)
+	}
+}
+
+func TestCommitCountOfUnbornHead(t *testing.T) {
+	gs := newTestService(t)
+	if _, err := git.PlainInit(gs.getProjectPath("p"), false); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if body := getCommitCount(t, gs, ""); body.Count != 0 {
+		t.Errorf("count of an empty repository: %+v", body)
+	}
+	rec := serve(t, gs.commitCountHandler, "GET", "/git/p/commit-count?ref=missing", project("p"), nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
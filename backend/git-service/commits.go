@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+)
+
+// CommitDetail represents a single commit in full
+type CommitDetail struct {
+	Hash          string    `json:"hash"`
+	Message       string    `json:"message"`
+	Author        Author    `json:"author"`
+	AuthorDate    time.Time `json:"authorDate"`
+	Committer     Author    `json:"committer"`
+	CommitterDate time.Time `json:"committerDate"`
+	Parents       []string  `json:"parents"`
+}
+
+// newCommitDetail converts a commit for the API
+func newCommitDetail(commit *object.Commit) CommitDetail {
+	detail := CommitDetail{
+		Hash:          commit.Hash.String(),
+		Message:       commit.Message,
+		Author:        Author{Name: commit.Author.Name, Email: commit.Author.Email},
+		AuthorDate:    commit.Author.When,
+		Committer:     Author{Name: commit.Committer.Name, Email: commit.Committer.Email},
+		CommitterDate: commit.Committer.When,
+		Parents:       []string{},
+	}
+	for _, parent := range commit.ParentHashes {
+		detail.Parents = append(detail.Parents, parent.String())
+	}
+	return detail
+}
+
+// Show commit endpoint. The changes are diffed against the first parent, or
+// the one chosen with parent=N counting from 1 like git's <commit>^N; a root
+// commit is diffed against the empty tree.
+func (gs *GitService) showCommitHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	hash := vars["hash"]
+	query := r.URL.Query()
+
+	parentNumber := 0
+	if value := query.Get("parent"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			gs.sendError(w, "parent must be a positive number", http.StatusBadRequest)
+			return
+		}
+		parentNumber = parsed
+	}
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+	opts := settings.diffOptions()
+	if opts.detectRenames, opts.renameThreshold, err = parseRenameOptions(query, settings); err != nil {
+		gs.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	commit, err := gs.resolveCommit(repo, hash)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Commit %s not found", hash), http.StatusNotFound)
+		return
+	}
+	if parentNumber > commit.NumParents() {
+		gs.sendError(w, fmt.Sprintf("Commit %s has %d parent%s", commit.Hash.String()[:7], commit.NumParents(), plural(commit.NumParents())), http.StatusBadRequest)
+		return
+	}
+
+	to, err := treeEntries(commit, "")
+	if err != nil {
+		gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+		return
+	}
+	from := map[string]*diffEntry{}
+	if commit.NumParents() > 0 {
+		if parentNumber == 0 {
+			parentNumber = 1
+		}
+		parent, err := commit.Parent(parentNumber - 1)
+		if err != nil {
+			gs.sendError(w, "Failed to read parent commit", http.StatusInternalServerError)
+			return
+		}
+		if from, err = treeEntries(parent, ""); err != nil {
+			gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	files, err := diffEntries(from, to, opts)
+	if err != nil {
+		gs.sendInternalError(w, "Failed to compute diff", err)
+		return
+	}
+	var patch strings.Builder
+	for _, file := range files {
+		patch.WriteString(file.Patch)
+	}
+
+	response := map[string]interface{}{
+		"commit": newCommitDetail(commit),
+		"parent": nil,
+		"files":  files,
+		"stat":   newDiffStat(files),
+		"patch":  patch.String(),
+	}
+	if parentNumber > 0 {
+		response["parent"] = parentNumber
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Get raw commit object endpoint
+func (gs *GitService) rawCommitHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	hash := vars["hash"]
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	commit, err := gs.resolveCommit(repo, hash)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Commit %s not found", hash), http.StatusNotFound)
+		return
+	}
+
+	obj, err := repo.Storer.EncodedObject(plumbing.CommitObject, commit.Hash)
+	if err != nil {
+		gs.sendError(w, "Failed to read commit object", http.StatusInternalServerError)
+		return
+	}
+	reader, err := obj.Reader()
+	if err != nil {
+		gs.sendError(w, "Failed to read commit object", http.StatusInternalServerError)
+		return
+	}
+	defer reader.Close()
+
+	// The body is the object content without git's "commit <size>\0" header,
+	// exactly what cat-file prints
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(obj.Size(), 10))
+	w.Header().Set("X-Git-Object-Type", obj.Type().String())
+	w.Header().Set("X-Git-Object-Hash", obj.Hash().String())
+	io.Copy(w, reader)
+}
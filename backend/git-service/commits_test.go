@@ -0,0 +1,35 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestRawCommitHashesToItsID(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	// A signature header spans lines, which a re-encoded commit could get wrong
+	signed := storeSignedCommit(t, repo, refHash(t, repo, "HEAD"))
+
+	target := fmt.Sprintf("/git/p/commits/%s/raw", signed)
+	rec := serve(t, gs.rawCommitHandler, "GET", target, map[string]string{"projectId": "p", "hash": signed.String()}, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if rec.Header().Get("X-Git-Object-Type") != "commit" || rec.Header().Get("X-Git-Object-Hash") != signed.String() {
+		t.Errorf("headers %v", rec.Header())
+	}
+
+	body := rec.Body.Bytes()
+	sum := sha1.Sum(append([]byte(fmt.Sprintf("commit %d\x00", len(body))), body...))
+	if got := hex.EncodeToString(sum[:]); got != signed.String() {
+		t.Errorf("the raw object hashes to %s, want %s", got, signed)
+	}
+	if want := runGit(t, gs.getProjectPath("p"), "cat-file", "commit", signed.String()); string(body) != want+"\n" {
+		t.Errorf("raw object differs from git cat-file:\n%s\nwant:\n%s", body, want)
+	}
+
+	rec = serve(t, gs.rawCommitHandler, "GET", "/git/p/commits/nope/raw", map[string]string{"projectId": "p", "hash": "nope"}, nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/gorilla/mux"
+)
+
+// ConflictMarkerFile is a file containing conflict markers and the lines they are on
+type ConflictMarkerFile struct {
+	Path  string `json:"path"`
+	Lines []int  `json:"lines"`
+}
+
+// Scan working tree for conflict markers endpoint
+func (gs *GitService) conflictMarkersHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	filter := r.URL.Query().Get("path")
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	entries, err := worktreeEntries(repo, filter)
+	if err != nil {
+		gs.sendError(w, "Failed to read working tree", http.StatusInternalServerError)
+		return
+	}
+	files, err := scanConflictMarkers(entries, nil)
+	if err != nil {
+		gs.sendError(w, "Failed to scan working tree", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"files": files,
+		"count": len(files),
+	})
+}
+
+// stagedConflictMarkers scans the files whose staged content differs from
+// HEAD, which are the ones the next commit would change
+func stagedConflictMarkers(repo *git.Repository) ([]ConflictMarkerFile, error) {
+	staged, err := indexEntries(repo)
+	if err != nil {
+		return nil, err
+	}
+	committed := map[string]*diffEntry{}
+	if head, err := repo.Head(); err == nil {
+		commit, err := repo.CommitObject(head.Hash())
+		if err != nil {
+			return nil, err
+		}
+		if committed, err = treeEntries(commit, ""); err != nil {
+			return nil, err
+		}
+	} else if err != plumbing.ErrReferenceNotFound {
+		return nil, err
+	}
+
+	return scanConflictMarkers(staged, func(path string, entry *diffEntry) bool {
+		previous, ok := committed[path]
+		return !ok || previous.hash != entry.hash
+	})
+}
+
+// scanConflictMarkers lists the entries, optionally narrowed by include,
+// whose text contains conflict markers. Binary files are skipped.
+func scanConflictMarkers(entries map[string]*diffEntry, include func(string, *diffEntry) bool) ([]ConflictMarkerFile, error) {
+	files := []ConflictMarkerFile{}
+	for path, entry := range entries {
+		if !entry.mode.IsFile() || include != nil && !include(path, entry) {
+			continue
+		}
+		data, err := entry.read()
+		if err != nil {
+			return nil, err
+		}
+		if isBinary(data) {
+			continue
+		}
+		if lines := findConflictMarkers(data); len(lines) > 0 {
+			files = append(files, ConflictMarkerFile{Path: path, Lines: lines})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// findConflictMarkers returns the line numbers of conflict markers in data.
+// Separator lines only count inside a conflict, so setext headings and
+// similar ======= lines are not mistaken for one.
+func findConflictMarkers(data []byte) []int {
+	var lines []int
+	open := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case isConflictMarker(line, "<<<<<<<"):
+			open = true
+			lines = append(lines, n)
+		case isConflictMarker(line, ">>>>>>>"):
+			open = false
+			lines = append(lines, n)
+		case open && (line == "=======" || isConflictMarker(line, "|||||||")):
+			lines = append(lines, n)
+		}
+	}
+	return lines
+}
+
+// isConflictMarker reports whether line is marker on its own or followed by a label
+func isConflictMarker(line, marker string) bool {
+	return line == marker || strings.HasPrefix(line, marker+" ")
+}
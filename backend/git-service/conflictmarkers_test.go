@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+const conflicted = "start\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> other\nend\n"
+
+func TestFindConflictMarkers(t *testing.T) {
+	if lines := findConflictMarkers([]byte(conflicted)); !equalInts(lines, []int{2, 4, 6}) {
+		t.Errorf("conflict lines = %v", lines)
+	}
+	diff3 := "<<<<<<< ours\na\n||||||| base\nb\n=======\nc\n>>>>>>> theirs\n"
+	if lines := findConflictMarkers([]byte(diff3)); !equalInts(lines, []int{1, 3, 5, 7}) {
+		t.Errorf("diff3 conflict lines = %v", lines)
+	}
+	// A setext heading is not a conflict separator
+	if lines := findConflictMarkers([]byte("Title\n=======\n\n<<<<<<<<< not a marker\n")); len(lines) != 0 {
+		t.Errorf("markdown reported as conflicted at %v", lines)
+	}
+}
+
+func TestCommitRejectsConflictMarkers(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	before := refHash(t, repo, "HEAD")
+	writeFiles(t, repo, map[string]string{"a.txt": conflicted, "README.md": "Title\n=======\n"})
+
+	rec := serveCommit(t, gs, CommitRequest{Message: "Resolve"})
+	expectStatus(t, rec, http.StatusUnprocessableEntity)
+	var body struct {
+		Files []ConflictMarkerFile `json:"files"`
+	}
+	decodeBody(t, rec, &body)
+	if len(body.Files) != 1 || body.Files[0].Path != "a.txt" || !equalInts(body.Files[0].Lines, []int{2, 4, 6}) {
+		t.Errorf("offending files: %+v", body.Files)
+	}
+	if refHash(t, repo, "HEAD") != before {
+		t.Error("HEAD moved although the commit was rejected")
+	}
+
+	rec = serveCommit(t, gs, CommitRequest{Message: "Keep the markers", AllowConflictMarkers: true})
+	expectStatus(t, rec, http.StatusOK)
+	if refHash(t, repo, "HEAD") == before {
+		t.Error("the overridden commit was not made")
+	}
+
+	// Markers already committed do not block later commits
+	writeFiles(t, repo, map[string]string{"b.txt": "b\n"})
+	rec = serveCommit(t, gs, CommitRequest{Message: "Add b"})
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestConflictMarkersEndpointScansWorkingTree(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	writeFiles(t, repo, map[string]string{"src/x.go": conflicted, "src/y.go": "package y\n", "docs/z.md": conflicted})
+
+	scan := func(query string) []ConflictMarkerFile {
+		t.Helper()
+		rec := serve(t, gs.conflictMarkersHandler, "GET", "/git/p/conflict-markers"+query, project("p"), nil)
+		expectStatus(t, rec, http.StatusOK)
+		var body struct {
+			Files []ConflictMarkerFile `json:"files"`
+			Count int                  `json:"count"`
+		}
+		decodeBody(t, rec, &body)
+		if body.Count != len(body.Files) {
+			t.Errorf("count %d for %d files", body.Count, len(body.Files))
+		}
+		return body.Files
+	}
+
+	files := scan("")
+	if len(files) != 2 || files[0].Path != "docs/z.md" || files[1].Path != "src/x.go" {
+		t.Errorf("working tree scan: %+v", files)
+	}
+	if files := scan("?path=src"); len(files) != 1 || files[0].Path != "src/x.go" {
+		t.Errorf("scan of src: %+v", files)
+	}
+}
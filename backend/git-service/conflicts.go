@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/gorilla/mux"
+)
+
+// CheckoutStageRequest represents a request to take a file from one side of a conflict
+type CheckoutStageRequest struct {
+	Path  string `json:"path"`
+	Stage string `json:"stage"`
+}
+
+// conflictStages maps the conflict side names used by the API to index stages
+var conflictStages = map[string]index.Stage{
+	"base":   index.AncestorMode,
+	"ours":   index.OurMode,
+	"theirs": index.TheirMode,
+}
+
+// Conflict is a conflicted path with the blob each side has for it. A side
+// that deleted the file, or never had it, is left out.
+type Conflict struct {
+	Path   string `json:"path"`
+	Base   string `json:"base,omitempty"`
+	Ours   string `json:"ours,omitempty"`
+	Theirs string `json:"theirs,omitempty"`
+}
+
+// newConflicts describes the conflicts of an in-memory merge, sorted by path
+func newConflicts(paths []string, base, ours, theirs map[string]*diffEntry) []Conflict {
+	side := func(entries map[string]*diffEntry, p string) string {
+		if entry := entries[p]; entry != nil {
+			return entry.hash.String()
+		}
+		return ""
+	}
+	conflicts := make([]Conflict, 0, len(paths))
+	for _, p := range paths {
+		conflicts = append(conflicts, Conflict{
+			Path:   p,
+			Base:   side(base, p),
+			Ours:   side(ours, p),
+			Theirs: side(theirs, p),
+		})
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Path < conflicts[j].Path })
+	return conflicts
+}
+
+// indexConflicts describes the conflicts left in the index from its stages
+func indexConflicts(repo *git.Repository) ([]Conflict, error) {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	byPath := make(map[string]int)
+	conflicts := []Conflict{}
+	for _, e := range idx.Entries {
+		if e.Stage == 0 {
+			continue
+		}
+		i, ok := byPath[e.Name]
+		if !ok {
+			i = len(conflicts)
+			byPath[e.Name] = i
+			conflicts = append(conflicts, Conflict{Path: e.Name})
+		}
+		c := &conflicts[i]
+		switch e.Stage {
+		case index.AncestorMode:
+			c.Base = e.Hash.String()
+		case index.OurMode:
+			c.Ours = e.Hash.String()
+		case index.TheirMode:
+			c.Theirs = e.Hash.String()
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Path < conflicts[j].Path })
+	return conflicts, nil
+}
+
+// Checkout a single conflict stage into the working tree endpoint
+func (gs *GitService) checkoutStageHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req CheckoutStageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Path == "" {
+		gs.sendError(w, "Path is required", http.StatusBadRequest)
+		return
+	}
+
+	stage, ok := conflictStages[req.Stage]
+	if !ok {
+		gs.sendError(w, "Stage must be one of ours, theirs or base", http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+
+	path := filepath.ToSlash(filepath.Clean(req.Path))
+	var entry *index.Entry
+	found, conflicted := false, false
+	for _, e := range idx.Entries {
+		if e.Name != path {
+			continue
+		}
+		found = true
+		// Stage 0 is a resolved entry; stages 1-3 only exist during a conflict
+		if e.Stage != 0 {
+			conflicted = true
+		}
+		if e.Stage == stage {
+			entry = e
+		}
+	}
+
+	if !found {
+		gs.sendError(w, fmt.Sprintf("Path %s not found in index", req.Path), http.StatusNotFound)
+		return
+	}
+	if !conflicted {
+		gs.sendError(w, fmt.Sprintf("Path %s is not conflicted", req.Path), http.StatusConflict)
+		return
+	}
+	if entry == nil {
+		gs.sendError(w, fmt.Sprintf("Path %s has no %s version", req.Path, req.Stage), http.StatusNotFound)
+		return
+	}
+
+	blob, err := repo.BlobObject(entry.Hash)
+	if err != nil {
+		gs.sendError(w, "Failed to read staged blob", http.StatusInternalServerError)
+		return
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+
+	if err := writeBlobToWorktree(worktree.Filesystem, path, blob, entry.Mode); err != nil {
+		gs.sendInternalError(w, fmt.Sprintf("Failed to write %s", req.Path), err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Checked out %s version of %s", req.Stage, req.Path),
+		"path":    path,
+		"stage":   req.Stage,
+		"hash":    entry.Hash.String(),
+	})
+}
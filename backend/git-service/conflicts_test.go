@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// conflictedRepo merges a branch that changed a.txt differently from master,
+// leaving the merge stopped on the conflict
+func conflictedRepo(t *testing.T, gs *GitService) string {
+	t.Helper()
+	repo := initTestRepo(t, gs, "p")
+	dir := gs.getProjectPath("p")
+	runGit(t, dir, "branch", "other")
+	commitTestFiles(t, repo, "Ours", map[string]string{"a.txt": "ours\n", "b.txt": "b\n"})
+	runGit(t, dir, "checkout", "-q", "other")
+	commitTestFiles(t, repo, "Theirs", map[string]string{"a.txt": "theirs\n"})
+	runGit(t, dir, "checkout", "-q", "master")
+	cmd := exec.Command("git", "-c", "user.name=Test User", "-c", "user.email=test@example.com", "merge", "other")
+	cmd.Dir = dir
+	if err := cmd.Run(); err == nil {
+		t.Fatal("the merge did not conflict")
+	}
+	return dir
+}
+
+func TestCheckoutStageTheirs(t *testing.T) {
+	gs := newTestService(t)
+	dir := conflictedRepo(t, gs)
+
+	rec := serve(t, gs.checkoutStageHandler, "POST", "/git/p/checkout-stage", project("p"), CheckoutStageRequest{Path: "a.txt", Stage: "theirs"})
+	expectStatus(t, rec, http.StatusOK)
+	content, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "theirs\n" {
+		t.Errorf("a.txt = %q, want their version", content)
+	}
+}
+
+func TestCheckoutStageRejections(t *testing.T) {
+	gs := newTestService(t)
+	conflictedRepo(t, gs)
+
+	for _, tc := range []struct {
+		req    CheckoutStageRequest
+		status int
+	}{
+		{CheckoutStageRequest{Path: "a.txt", Stage: "mine"}, http.StatusBadRequest},
+		{CheckoutStageRequest{Path: "missing.txt", Stage: "ours"}, http.StatusNotFound},
+		{CheckoutStageRequest{Path: "b.txt", Stage: "ours"}, http.StatusConflict},
+	} {
+		rec := serve(t, gs.checkoutStageHandler, "POST", "/git/p/checkout-stage", project("p"), tc.req)
+		if rec.Code != tc.status {
+			t.Errorf("%+v: status %d, want %d; body: %s", tc.req, rec.Code, tc.status, rec.Body.String())
+		}
+	}
+}
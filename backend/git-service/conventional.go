@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/gorilla/mux"
+)
+
+// defaultConventionalCommits bounds a range parse unless overridden
+const defaultConventionalCommits = 1000
+
+var (
+	conventionalHeader = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9-]*)(?:\(([^()\r\n]*)\))?(!)?: (.*)$`)
+	conventionalFooter = regexp.MustCompile(`^(BREAKING CHANGE|BREAKING-CHANGE|[A-Za-z0-9][A-Za-z0-9-]*)(?:: | #)(.*)$`)
+)
+
+// ConventionalFooter is one "token: value" or "token #value" footer
+type ConventionalFooter struct {
+	Token string `json:"token"`
+	Value string `json:"value"`
+}
+
+// ConventionalCommit is a commit message parsed per the Conventional Commits spec
+type ConventionalCommit struct {
+	Type         string               `json:"type"`
+	Scope        string               `json:"scope,omitempty"`
+	Subject      string               `json:"subject"`
+	Body         string               `json:"body,omitempty"`
+	Breaking     bool                 `json:"breaking"`
+	BreakingNote string               `json:"breakingNote,omitempty"`
+	Footers      []ConventionalFooter `json:"footers"`
+}
+
+// ConventionalResult is the parse of one commit in a range
+type ConventionalResult struct {
+	Hash         string              `json:"hash"`
+	Conventional *ConventionalCommit `json:"conventional,omitempty"`
+	Error        string              `json:"error,omitempty"`
+}
+
+// Parse a commit message as a conventional commit endpoint
+func (gs *GitService) conventionalCommitHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	hash := vars["hash"]
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	commit, err := gs.resolveCommit(repo, hash)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Commit %s not found", hash), http.StatusNotFound)
+		return
+	}
+
+	parsed, err := parseConventionalCommit(commit.Message)
+	if err != nil {
+		gs.sendErrorWithDetails(w, fmt.Sprintf("Commit message is not a conventional commit: %v", err), http.StatusUnprocessableEntity, map[string]interface{}{
+			"commit": commit.Hash.String(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"commit":       commit.Hash.String(),
+		"conventional": parsed,
+	})
+}
+
+// Parse a range of commit messages as conventional commits endpoint
+func (gs *GitService) conventionalCommitsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	query := r.URL.Query()
+	fromRef := query.Get("from")
+	toRef := query.Get("to")
+
+	// limit=0 parses the whole range
+	limit := defaultConventionalCommits
+	if limitStr := query.Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l < 0 {
+			gs.sendError(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = l
+	}
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	to, err := gs.resolveCommit(repo, toRef)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Commit %s not found", toRef), http.StatusNotFound)
+		return
+	}
+
+	// Like git log from..to, commits reachable from from are left out
+	var excluded map[plumbing.Hash]bool
+	if fromRef != "" {
+		from, err := gs.resolveCommit(repo, fromRef)
+		if err != nil {
+			gs.sendError(w, fmt.Sprintf("Commit %s not found", fromRef), http.StatusNotFound)
+			return
+		}
+		if excluded, err = commitAncestors(repo, []plumbing.Hash{from.Hash}, nil); err != nil {
+			gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	results := []ConventionalResult{}
+	conforming, truncated := 0, false
+	err = object.NewCommitIterCTime(to, excluded, nil).ForEach(func(c *object.Commit) error {
+		if limit > 0 && len(results) >= limit {
+			truncated = true
+			return storer.ErrStop
+		}
+		result := ConventionalResult{Hash: c.Hash.String()}
+		if parsed, err := parseConventionalCommit(c.Message); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Conventional = parsed
+			conforming++
+		}
+		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"commits":       results,
+		"conforming":    conforming,
+		"nonConforming": len(results) - conforming,
+		"truncated":     truncated,
+	})
+}
+
+// parseConventionalCommit splits a message into its header, body and
+// footers. The footers are the trailing paragraphs that each start with a
+// footer token; a value may continue over the lines that follow it.
+func parseConventionalCommit(message string) (*ConventionalCommit, error) {
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(message, "\r\n", "\n"), "\n"), "\n")
+	header := lines[0]
+	match := conventionalHeader.FindStringSubmatch(header)
+	if match == nil {
+		return nil, errors.New("header must be \"type(scope): description\"")
+	}
+	if strings.TrimSpace(match[4]) == "" {
+		return nil, errors.New("description is empty")
+	}
+	if len(lines) > 1 && strings.TrimSpace(lines[1]) != "" {
+		return nil, errors.New("header must be followed by a blank line")
+	}
+	commit := &ConventionalCommit{
+		Type:     match[1],
+		Scope:    match[2],
+		Subject:  strings.TrimSpace(match[4]),
+		Breaking: match[3] == "!",
+		Footers:  []ConventionalFooter{},
+	}
+
+	rest := lines[1:]
+	footerStart := len(rest)
+	for i := len(rest) - 1; i >= 0; i-- {
+		if i > 0 && strings.TrimSpace(rest[i-1]) != "" {
+			continue
+		}
+		if strings.TrimSpace(rest[i]) == "" {
+			continue
+		}
+		if !conventionalFooter.MatchString(rest[i]) {
+			break
+		}
+		footerStart = i
+	}
+
+	commit.Body = strings.TrimSpace(strings.Join(rest[:footerStart], "\n"))
+	for _, line := range rest[footerStart:] {
+		if m := conventionalFooter.FindStringSubmatch(line); m != nil {
+			commit.Footers = append(commit.Footers, ConventionalFooter{Token: m[1], Value: m[2]})
+			continue
+		}
+		last := &commit.Footers[len(commit.Footers)-1]
+		last.Value += "\n" + line
+	}
+	for i := range commit.Footers {
+		footer := &commit.Footers[i]
+		footer.Value = strings.TrimSpace(footer.Value)
+		if footer.Token == "BREAKING CHANGE" || footer.Token == "BREAKING-CHANGE" {
+			commit.Breaking = true
+			if commit.BreakingNote == "" {
+				commit.BreakingNote = footer.Value
+			}
+		}
+	}
+	// With only the ! marker the description is what describes the break
+	if commit.Breaking && commit.BreakingNote == "" {
+		commit.BreakingNote = commit.Subject
+	}
+	return commit, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseConventionalCommit(t *testing.T) {
+	message := "feat(api)!: drop the v1 endpoints\n\nClients have had a year to move.\n\nBREAKING CHANGE: /v1 is gone,\n  use /v2 instead\nRefs #42\n"
+	got, err := parseConventionalCommit(message)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := &ConventionalCommit{
+		Type:         "feat",
+		Scope:        "api",
+		Subject:      "drop the v1 endpoints",
+		Body:         "Clients have had a year to move.",
+		Breaking:     true,
+		BreakingNote: "/v1 is gone,\n  use /v2 instead",
+		Footers: []ConventionalFooter{
+			{Token: "BREAKING CHANGE", Value: "/v1 is gone,\n  use /v2 instead"},
+			{Token: "Refs", Value: "42"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parsed\n%+v\nwant\n%+v", got, want)
+	}
+
+	// The ! marker alone makes the description the breaking note
+	got, err = parseConventionalCommit("fix!: reject empty names")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if !got.Breaking || got.BreakingNote != "reject empty names" || got.Scope != "" || len(got.Footers) != 0 {
+		t.Errorf("parsed %+v", got)
+	}
+
+	for _, message := range []string{
+		"Update the readme",
+		"feat(api) add endpoint",
+		"feat: ",
+		"feat: add endpoint\nwith no blank line",
+	} {
+		if got, err := parseConventionalCommit(message); err == nil {
+			t.Errorf("%q parsed as %+v", message, got)
+		}
+	}
+}
+
+func TestConventionalCommitEndpoints(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	base := refHash(t, repo, "HEAD")
+	feat := commitTestFiles(t, repo, "feat(api)!: drop v1\n\nBREAKING CHANGE: v1 is gone\n", map[string]string{"b.txt": "b\n"})
+	other := commitTestFiles(t, repo, "Tidy up", map[string]string{"c.txt": "c\n"})
+
+	rec := serve(t, gs.conventionalCommitHandler, "GET", "/git/p/commits/"+feat.String()+"/conventional", map[string]string{"projectId": "p", "hash": feat.String()}, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var single struct {
+		Commit       string             `json:"commit"`
+		Conventional ConventionalCommit `json:"conventional"`
+	}
+	decodeBody(t, rec, &single)
+	if single.Commit != feat.String() || single.Conventional.Type != "feat" || !single.Conventional.Breaking || single.Conventional.BreakingNote != "v1 is gone" {
+		t.Errorf("conventional commit: %+v", single)
+	}
+
+	rec = serve(t, gs.conventionalCommitHandler, "GET", "/git/p/commits/"+other.String()+"/conventional", map[string]string{"projectId": "p", "hash": other.String()}, nil)
+	expectStatus(t, rec, http.StatusUnprocessableEntity)
+	var failed map[string]interface{}
+	decodeBody(t, rec, &failed)
+	if failed["commit"] != other.String() {
+		t.Errorf("non-conforming commit: %v", failed)
+	}
+
+	rec = serve(t, gs.conventionalCommitsHandler, "GET", "/git/p/commits/conventional?from="+base.String()+"&to=master", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var bulk struct {
+		Commits       []ConventionalResult `json:"commits"`
+		Conforming    int                  `json:"conforming"`
+		NonConforming int                  `json:"nonConforming"`
+		Truncated     bool                 `json:"truncated"`
+	}
+	decodeBody(t, rec, &bulk)
+	if len(bulk.Commits) != 2 || bulk.Conforming != 1 || bulk.NonConforming != 1 || bulk.Truncated {
+		t.Fatalf("range: %+v", bulk)
+	}
+	if bulk.Commits[0].Hash != other.String() || bulk.Commits[0].Error == "" || bulk.Commits[1].Conventional == nil {
+		t.Errorf("range results: %+v", bulk.Commits)
+	}
+
+	rec = serve(t, gs.conventionalCommitsHandler, "GET", "/git/p/commits/conventional?to=master&limit=1", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	decodeBody(t, rec, &bulk)
+	if len(bulk.Commits) != 1 || !bulk.Truncated {
+		t.Errorf("limited range: %+v", bulk)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rs/cors"
+)
+
+// corsOptions builds the CORS policy from the environment.
+// CORS_ALLOWED_ORIGINS is a comma-separated list of origins; without it only
+// a development setup (NODE_ENV=development) allows every origin, and
+// anything else allows none. CORS_ALLOW_CREDENTIALS=true lets browsers send
+// credentials, which requires the origins to be listed explicitly.
+func corsOptions() (cors.Options, error) {
+	options := cors.Options{
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"*"},
+		ExposedHeaders: []string{requestIDHeader},
+	}
+
+	if value := os.Getenv("CORS_ALLOW_CREDENTIALS"); value != "" {
+		credentials, err := strconv.ParseBool(value)
+		if err != nil {
+			return options, fmt.Errorf("invalid CORS_ALLOW_CREDENTIALS value %q", value)
+		}
+		options.AllowCredentials = credentials
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 {
+		if os.Getenv("NODE_ENV") != "development" {
+			// An empty AllowedOrigins means every origin to rs/cors
+			options.AllowOriginFunc = func(string) bool { return false }
+			return options, nil
+		}
+		origins = []string{"*"}
+	}
+	for _, origin := range origins {
+		if strings.Contains(origin, "*") && options.AllowCredentials {
+			return options, errors.New("CORS_ALLOW_CREDENTIALS requires CORS_ALLOWED_ORIGINS to list origins without wildcards")
+		}
+	}
+	options.AllowedOrigins = origins
+	return options, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/cors"
+)
+
+// corsResponse sends a request from origin through the policy built from the
+// environment and returns the response headers
+func corsResponse(t *testing.T, method, origin string) http.Header {
+	t.Helper()
+	options, err := corsOptions()
+	if err != nil {
+		t.Fatalf("corsOptions: %v", err)
+	}
+	handler := cors.New(options).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(method, "/health", nil)
+	req.Header.Set("Origin", origin)
+	if method == http.MethodOptions {
+		req.Header.Set("Access-Control-Request-Method", "POST")
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Header()
+}
+
+func TestCORSAllowsListedOrigins(t *testing.T) {
+	t.Setenv("NODE_ENV", "production")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://ide.example.com, https://admin.example.com")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+
+	for _, method := range []string{http.MethodGet, http.MethodOptions} {
+		headers := corsResponse(t, method, "https://admin.example.com")
+		if got := headers.Get("Access-Control-Allow-Origin"); got != "https://admin.example.com" {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q", method, got)
+		}
+		if got := headers.Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Errorf("%s: Access-Control-Allow-Credentials = %q", method, got)
+		}
+
+		headers = corsResponse(t, method, "https://evil.example.com")
+		if got := headers.Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("%s: disallowed origin got Access-Control-Allow-Origin %q", method, got)
+		}
+		if got := headers.Get("Access-Control-Allow-Credentials"); got != "" {
+			t.Errorf("%s: disallowed origin got Access-Control-Allow-Credentials %q", method, got)
+		}
+	}
+}
+
+func TestCORSWithoutOrigins(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "")
+
+	t.Setenv("NODE_ENV", "production")
+	if got := corsResponse(t, http.MethodGet, "https://ide.example.com").Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("outside development an unset list allowed %q", got)
+	}
+
+	t.Setenv("NODE_ENV", "development")
+	if got := corsResponse(t, http.MethodGet, "https://ide.example.com").Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("in development Access-Control-Allow-Origin = %q, want *", got)
+	}
+}
+
+func TestCORSRejectsWildcardWithCredentials(t *testing.T) {
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	for _, origins := range []string{"*", "https://*.example.com"} {
+		t.Setenv("CORS_ALLOWED_ORIGINS", origins)
+		if _, err := corsOptions(); err == nil {
+			t.Errorf("credentials allowed with origins %q", origins)
+		}
+	}
+	t.Setenv("NODE_ENV", "development")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "")
+	if _, err := corsOptions(); err == nil {
+		t.Error("credentials allowed with the development wildcard")
+	}
+
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "maybe")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://ide.example.com")
+	if _, err := corsOptions(); err == nil {
+		t.Error("invalid CORS_ALLOW_CREDENTIALS accepted")
+	}
+}
@@ -0,0 +1,574 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Change types reported for a file in a diff
+const (
+	changeAdded    = "added"
+	changeDeleted  = "deleted"
+	changeModified = "modified"
+	changeRenamed  = "renamed"
+)
+
+// diffContextLines is the number of unchanged lines shown around each change
+const diffContextLines = 3
+
+// FileDiff represents the changes to a single file
+type FileDiff struct {
+	Path       string `json:"path"`
+	OldPath    string `json:"oldPath,omitempty"`
+	ChangeType string `json:"changeType"`
+	Similarity int    `json:"similarity,omitempty"`
+	Additions  int    `json:"additions"`
+	Deletions  int    `json:"deletions"`
+	Binary     bool   `json:"binary"`
+	Patch      string `json:"patch"`
+}
+
+// DiffStat summarizes the size of a diff
+type DiffStat struct {
+	FilesChanged int `json:"filesChanged"`
+	Additions    int `json:"additions"`
+	Deletions    int `json:"deletions"`
+}
+
+// newDiffStat totals the line counts of a set of file diffs
+func newDiffStat(files []*FileDiff) DiffStat {
+	stat := DiffStat{FilesChanged: len(files)}
+	for _, file := range files {
+		stat.Additions += file.Additions
+		stat.Deletions += file.Deletions
+	}
+	return stat
+}
+
+// diffEntry is one side of a file being compared
+type diffEntry struct {
+	hash plumbing.Hash
+	mode filemode.FileMode
+	read func() ([]byte, error)
+}
+
+// Diff endpoint
+func (gs *GitService) diffHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	query := r.URL.Query()
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+	opts := settings.diffOptions()
+	for name, field := range map[string]*bool{"ignoreAllSpace": &opts.ignoreAllSpace, "ignoreEol": &opts.ignoreEOL} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				gs.sendError(w, fmt.Sprintf("Invalid %s value", name), http.StatusBadRequest)
+				return
+			}
+			*field = parsed
+		}
+	}
+
+	if opts.detectRenames, opts.renameThreshold, err = parseRenameOptions(query, settings); err != nil {
+		gs.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter := strings.Trim(query.Get("path"), "/")
+
+	// Without from, an unborn HEAD compares against the empty tree so every
+	// file of a fresh repository shows as added
+	from := map[string]*diffEntry{}
+	fromCommit, err := gs.resolveCommit(repo, query.Get("from"))
+	if err == nil {
+		if from, err = treeEntries(fromCommit, filter); err != nil {
+			gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+			return
+		}
+	} else if _, headErr := repo.Head(); query.Get("from") != "" || headErr != plumbing.ErrReferenceNotFound {
+		gs.sendError(w, "Failed to resolve from", http.StatusBadRequest)
+		return
+	}
+
+	var to map[string]*diffEntry
+	if ref := query.Get("to"); ref != "" {
+		toCommit, err := gs.resolveCommit(repo, ref)
+		if err != nil {
+			gs.sendError(w, "Failed to resolve to", http.StatusBadRequest)
+			return
+		}
+		to, err = treeEntries(toCommit, filter)
+		if err != nil {
+			gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		to, err = worktreeEntries(repo, filter)
+		if err != nil {
+			gs.sendError(w, "Failed to read working tree", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	files, err := diffEntries(from, to, opts)
+	if err != nil {
+		gs.sendInternalError(w, "Failed to compute diff", err)
+		return
+	}
+
+	var patch strings.Builder
+	for _, file := range files {
+		patch.WriteString(file.Patch)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"files": files,
+		"stat":  newDiffStat(files),
+		"patch": patch.String(),
+	})
+}
+
+// matchesPathFilter reports whether p is the filtered path or lies beneath it
+func matchesPathFilter(p, filter string) bool {
+	return filter == "" || p == filter || strings.HasPrefix(p, filter+"/")
+}
+
+// treeEntries lists the files of a commit's tree
+func treeEntries(commit *object.Commit, filter string) (map[string]*diffEntry, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]*diffEntry)
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if !matchesPathFilter(f.Name, filter) {
+			return nil
+		}
+		blob := f.Blob
+		entries[f.Name] = &diffEntry{
+			hash: f.Hash,
+			mode: f.Mode,
+			read: func() ([]byte, error) {
+				reader, err := blob.Reader()
+				if err != nil {
+					return nil, err
+				}
+				defer reader.Close()
+				return io.ReadAll(reader)
+			},
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// blobEntry describes a stored blob, reading it only when needed
+func blobEntry(repo *git.Repository, hash plumbing.Hash, mode filemode.FileMode) *diffEntry {
+	return &diffEntry{
+		hash: hash,
+		mode: mode,
+		read: func() ([]byte, error) {
+			blob, err := repo.BlobObject(hash)
+			if err != nil {
+				return nil, err
+			}
+			reader, err := blob.Reader()
+			if err != nil {
+				return nil, err
+			}
+			defer reader.Close()
+			return io.ReadAll(reader)
+		},
+	}
+}
+
+// indexEntries lists the files staged in the index, skipping unresolved
+// conflict stages
+func indexEntries(repo *git.Repository) (map[string]*diffEntry, error) {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]*diffEntry, len(idx.Entries))
+	for _, e := range idx.Entries {
+		if e.Stage != 0 {
+			continue
+		}
+		entries[e.Name] = blobEntry(repo, e.Hash, e.Mode)
+	}
+	return entries, nil
+}
+
+// worktreeEntries lists the working tree files git would consider: tracked
+// files plus untracked files that are not ignored
+func worktreeEntries(repo *git.Repository, filter string) (map[string]*diffEntry, error) {
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	tracked := make(map[string]bool, len(idx.Entries))
+	staged := make(map[string]*index.Entry, len(idx.Entries))
+	for _, e := range idx.Entries {
+		tracked[e.Name] = true
+		if e.Stage == 0 {
+			staged[e.Name] = e
+		}
+	}
+	indexTime := indexModTime(repo)
+
+	patterns, err := gitignore.ReadPatterns(wt.Filesystem, nil)
+	if err != nil {
+		return nil, err
+	}
+	matcher := gitignore.NewMatcher(append(patterns, wt.Excludes...))
+
+	entries := make(map[string]*diffEntry)
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		infos, err := wt.Filesystem.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			name := path.Join(dir, info.Name())
+			if dir == "" {
+				name = info.Name()
+			}
+			if name == git.GitDirName {
+				continue
+			}
+			parts := strings.Split(name, "/")
+			if info.IsDir() {
+				if !matcher.Match(parts, true) || hasTrackedPrefix(tracked, name) {
+					if err := walk(name); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if !matchesPathFilter(name, filter) {
+				continue
+			}
+			if !tracked[name] && matcher.Match(parts, false) {
+				continue
+			}
+			if e := staged[name]; e != nil && statMatches(e, info, indexTime) {
+				entries[name] = fileEntry(wt.Filesystem, name, e.Hash, e.Mode)
+				continue
+			}
+			entry, err := worktreeEntry(wt.Filesystem, name, info)
+			if err != nil {
+				return err
+			}
+			entries[name] = entry
+		}
+		return nil
+	}
+	return entries, walk("")
+}
+
+// hasTrackedPrefix reports whether any tracked file lives under dir
+func hasTrackedPrefix(tracked map[string]bool, dir string) bool {
+	for name := range tracked {
+		if strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// indexModTime returns when the index was last written, or the zero time
+// when the storage does not say
+func indexModTime(repo *git.Repository) time.Time {
+	storage, ok := repo.Storer.(interface{ Filesystem() billy.Filesystem })
+	if !ok {
+		return time.Time{}
+	}
+	info, err := storage.Filesystem().Stat("index")
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// statMatches reports whether a file is unchanged since it was staged, going
+// by its mode, size and modification time as git does. A file modified no
+// earlier than the index was written may have changed again within the
+// same timestamp, so it does not match.
+func statMatches(e *index.Entry, info os.FileInfo, indexTime time.Time) bool {
+	if fileMode(info) != e.Mode || int64(e.Size) != info.Size() {
+		return false
+	}
+	return e.ModifiedAt.Equal(info.ModTime()) && info.ModTime().Before(indexTime)
+}
+
+// fileMode returns the mode git would record for a working tree file
+func fileMode(info os.FileInfo) filemode.FileMode {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return filemode.Symlink
+	case info.Mode()&0111 != 0:
+		return filemode.Executable
+	default:
+		return filemode.Regular
+	}
+}
+
+// fileEntry is a working tree file whose content is read when it is needed.
+// Callers store what read returns under hash, so content that no longer
+// matches it is an error.
+func fileEntry(fs billy.Filesystem, name string, hash plumbing.Hash, mode filemode.FileMode) *diffEntry {
+	return &diffEntry{
+		hash: hash,
+		mode: mode,
+		read: func() ([]byte, error) {
+			var content []byte
+			if mode == filemode.Symlink {
+				target, err := fs.Readlink(name)
+				if err != nil {
+					return nil, err
+				}
+				content = []byte(target)
+			} else {
+				f, err := fs.Open(name)
+				if err != nil {
+					return nil, err
+				}
+				content, err = io.ReadAll(f)
+				f.Close()
+				if err != nil {
+					return nil, err
+				}
+			}
+			if plumbing.ComputeHash(plumbing.BlobObject, content) != hash {
+				return nil, fmt.Errorf("%s changed while it was being read", name)
+			}
+			return content, nil
+		},
+	}
+}
+
+// worktreeEntry hashes a working tree file the way git would store it. The
+// content is streamed through the hasher rather than held in memory.
+func worktreeEntry(fs billy.Filesystem, name string, info os.FileInfo) (*diffEntry, error) {
+	mode := fileMode(info)
+	if mode == filemode.Symlink {
+		target, err := fs.Readlink(name)
+		if err != nil {
+			return nil, err
+		}
+		return fileEntry(fs, name, plumbing.ComputeHash(plumbing.BlobObject, []byte(target)), mode), nil
+	}
+
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hasher := plumbing.NewHasher(plumbing.BlobObject, info.Size())
+	if n, err := io.Copy(hasher, f); err != nil {
+		return nil, err
+	} else if n != info.Size() {
+		return nil, fmt.Errorf("%s changed while it was being read", name)
+	}
+	return fileEntry(fs, name, hasher.Sum(), mode), nil
+}
+
+// filePair is a file as it appears on each side of a diff. Either side may
+// be nil; a rename pairs entries stored under different paths.
+type filePair struct {
+	srcPath, dstPath string
+	src, dst         *diffEntry
+	rename           bool
+	similarity       int
+}
+
+// diffEntries compares two file sets and returns the changed files sorted by
+// path. The sets come from a commit, the index or the working tree, which is
+// why this does not build on object.Tree.Diff and Patch: those only compare
+// two stored trees, and the index and working tree have none until written.
+// Patch also has no way to ignore whitespace. The line diff underneath is
+// the same diffmatchpatch go-git uses.
+func diffEntries(from, to map[string]*diffEntry, opts diffOptions) ([]*FileDiff, error) {
+	var pairs []filePair
+	renamed := make(map[string]bool)
+	if opts.detectRenames {
+		renames, err := detectRenames(from, to, opts.renameThreshold)
+		if err != nil {
+			return nil, err
+		}
+		for _, pair := range renames {
+			renamed[pair.srcPath] = true
+			renamed[pair.dstPath] = true
+			pairs = append(pairs, pair)
+		}
+	}
+
+	for p, src := range from {
+		if !renamed[p] {
+			pairs = append(pairs, filePair{srcPath: p, dstPath: p, src: src, dst: to[p]})
+		}
+	}
+	for p, dst := range to {
+		if _, ok := from[p]; !ok && !renamed[p] {
+			pairs = append(pairs, filePair{srcPath: p, dstPath: p, dst: dst})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].dstPath < pairs[j].dstPath
+	})
+
+	files := []*FileDiff{}
+	for _, pair := range pairs {
+		src, dst := pair.src, pair.dst
+		if pair.srcPath == pair.dstPath && src != nil && dst != nil && src.hash == dst.hash && src.mode == dst.mode {
+			continue
+		}
+		file, err := fileDiff(pair, opts)
+		if err != nil {
+			return nil, err
+		}
+		if file != nil {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// fileDiff renders the change between two versions of a file. It returns nil
+// when the only differences are ignored whitespace.
+func fileDiff(pair filePair, opts diffOptions) (*FileDiff, error) {
+	src, dst := pair.src, pair.dst
+	var srcData, dstData []byte
+	var err error
+	if src != nil {
+		if srcData, err = src.read(); err != nil {
+			return nil, err
+		}
+	}
+	if dst != nil {
+		if dstData, err = dst.read(); err != nil {
+			return nil, err
+		}
+	}
+
+	file := &FileDiff{Path: pair.dstPath, ChangeType: changeModified}
+	var header strings.Builder
+	fmt.Fprintf(&header, "diff --git a/%s b/%s\n", pair.srcPath, pair.dstPath)
+	switch {
+	case src == nil:
+		file.ChangeType = changeAdded
+		fmt.Fprintf(&header, "new file mode %s\n", gitMode(dst.mode))
+		fmt.Fprintf(&header, "index %s..%s\n", plumbing.ZeroHash.String()[:7], dst.hash.String()[:7])
+	case dst == nil:
+		file.ChangeType = changeDeleted
+		fmt.Fprintf(&header, "deleted file mode %s\n", gitMode(src.mode))
+		fmt.Fprintf(&header, "index %s..%s\n", src.hash.String()[:7], plumbing.ZeroHash.String()[:7])
+	default:
+		if pair.rename {
+			file.ChangeType = changeRenamed
+			file.OldPath = pair.srcPath
+			file.Similarity = pair.similarity
+		}
+		if src.mode != dst.mode {
+			fmt.Fprintf(&header, "old mode %s\nnew mode %s\n", gitMode(src.mode), gitMode(dst.mode))
+		}
+		if file.ChangeType == changeRenamed {
+			fmt.Fprintf(&header, "similarity index %d%%\nrename from %s\nrename to %s\n", pair.similarity, pair.srcPath, pair.dstPath)
+		}
+		if src.hash != dst.hash {
+			fmt.Fprintf(&header, "index %s..%s", src.hash.String()[:7], dst.hash.String()[:7])
+			if src.mode == dst.mode {
+				fmt.Fprintf(&header, " %s", gitMode(src.mode))
+			}
+			header.WriteString("\n")
+		}
+	}
+
+	if isBinary(srcData) || isBinary(dstData) {
+		file.Binary = true
+		if src == nil || dst == nil || src.hash != dst.hash {
+			fmt.Fprintf(&header, "Binary files %s and %s differ\n", diffSideName("a", pair.srcPath, src), diffSideName("b", pair.dstPath, dst))
+		}
+		file.Patch = header.String()
+		return file, nil
+	}
+
+	ops := diffLinesWith(string(srcData), string(dstData), opts)
+	for _, op := range ops {
+		switch op.Type {
+		case diffmatchpatch.DiffInsert:
+			file.Additions++
+		case diffmatchpatch.DiffDelete:
+			file.Deletions++
+		}
+	}
+
+	hunks := unifiedPatch(ops, diffContextLines)
+	if hunks == "" && file.ChangeType == changeModified && src.mode == dst.mode {
+		return nil, nil
+	}
+	if hunks != "" {
+		fmt.Fprintf(&header, "--- %s\n+++ %s\n", diffSideName("a", pair.srcPath, src), diffSideName("b", pair.dstPath, dst))
+	}
+	file.Patch = header.String() + hunks
+	return file, nil
+}
+
+// diffSideName names one side of a patch, using /dev/null for a missing file
+func diffSideName(prefix, p string, entry *diffEntry) string {
+	if entry == nil {
+		return "/dev/null"
+	}
+	return prefix + "/" + p
+}
+
+// gitMode formats a file mode the way git prints it in patch headers
+func gitMode(mode filemode.FileMode) string {
+	return strconv.FormatUint(uint64(mode), 8)
+}
+
+// isBinary uses git's heuristic: a NUL byte in the first 8000 bytes
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+type diffResponse struct {
+	Files []*FileDiff `json:"files"`
+	Stat  DiffStat    `json:"stat"`
+	Patch string      `json:"patch"`
+}
+
+func getDiff(t *testing.T, gs *GitService, query string) diffResponse {
+	t.Helper()
+	rec := serve(t, gs.diffHandler, "GET", "/git/p/diff?"+query, project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body diffResponse
+	decodeBody(t, rec, &body)
+	return body
+}
+
+// changedLines totals the lines a diff adds and removes across its files
+func changedLines(body diffResponse) (additions, deletions int) {
+	for _, file := range body.Files {
+		additions += file.Additions
+		deletions += file.Deletions
+	}
+	return additions, deletions
+}
+
+func TestDiffBetweenCommits(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	from := commitTestFiles(t, repo, "Add files", map[string]string{"b.txt": "keep\nold\n", "gone.txt": "bye\n"})
+	worktree, _ := repo.Worktree()
+	if _, err := worktree.Remove("gone.txt"); err != nil {
+		t.Fatal(err)
+	}
+	to := commitTestFiles(t, repo, "Change files", map[string]string{"b.txt": "keep\nnew\nmore\n", "c.txt": "added\n"})
+
+	body := getDiff(t, gs, "from="+from.String()+"&to="+to.String())
+	want := map[string]struct {
+		change             string
+		additions, removed int
+	}{
+		"b.txt":    {changeModified, 2, 1},
+		"c.txt":    {changeAdded, 1, 0},
+		"gone.txt": {changeDeleted, 0, 1},
+	}
+	if len(body.Files) != len(want) {
+		t.Fatalf("got %d files, want %d: %+v", len(body.Files), len(want), body.Files)
+	}
+	for _, file := range body.Files {
+		w, ok := want[file.Path]
+		if !ok {
+			t.Errorf("unexpected file %s", file.Path)
+			continue
+		}
+		if file.ChangeType != w.change || file.Additions != w.additions || file.Deletions != w.removed {
+			t.Errorf("%s: %s +%d -%d, want %s +%d -%d", file.Path, file.ChangeType, file.Additions, file.Deletions, w.change, w.additions, w.removed)
+		}
+	}
+	if body.Stat != (DiffStat{FilesChanged: 3, Additions: 3, Deletions: 2}) {
+		t.Errorf("stat = %+v", body.Stat)
+	}
+
+	// The worktree is at to, so the patch must apply in reverse
+	patch := filepath.Join(t.TempDir(), "diff.patch")
+	if err := os.WriteFile(patch, []byte(body.Patch), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, gs.getProjectPath("p"), "apply", "--check", "-R", patch)
+}
+
+func TestDiffAgainstWorktreeWithPathFilter(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	commitTestFiles(t, repo, "Add dir", map[string]string{"dir/x.txt": "x\n"})
+	writeFiles(t, repo, map[string]string{"a.txt": "one\ntwo\n", "dir/x.txt": "changed\n"})
+
+	body := getDiff(t, gs, "from=HEAD")
+	if len(body.Files) != 2 {
+		t.Fatalf("got %d files, want 2", len(body.Files))
+	}
+
+	body = getDiff(t, gs, "from=HEAD&path=dir")
+	if len(body.Files) != 1 || body.Files[0].Path != "dir/x.txt" {
+		t.Fatalf("path filter returned %+v", body.Files)
+	}
+	if body.Files[0].Additions != 1 || body.Files[0].Deletions != 1 {
+		t.Errorf("dir/x.txt +%d -%d, want +1 -1", body.Files[0].Additions, body.Files[0].Deletions)
+	}
+}
+
+func TestDiffUnbornHeadShowsFilesAdded(t *testing.T) {
+	gs := newTestService(t)
+	repo, err := git.PlainInit(gs.getProjectPath("p"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, repo, map[string]string{"new.txt": "hello\n"})
+
+	body := getDiff(t, gs, "")
+	if len(body.Files) != 1 || body.Files[0].ChangeType != changeAdded {
+		t.Fatalf("files = %+v, want new.txt added", body.Files)
+	}
+}
+
+func TestDiffRejectsUnknownRevision(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "p")
+	rec := serve(t, gs.diffHandler, "GET", "/git/p/diff?from=nope", project("p"), nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestDiffAgainstWorktreeMatchesGit(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	commitTestFiles(t, repo, "Add files", map[string]string{"b.txt": "1\n2\n3\n4\n5\n6\n7\n8\n9\n", "c.txt": "c\n"})
+	writeFiles(t, repo, map[string]string{"a.txt": "one\ntwo\n", "b.txt": "1\n2\nthree\n4\n5\n6\n7\neight\n9\n"})
+	if err := os.Remove(filepath.Join(gs.getProjectPath("p"), "c.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	body := getDiff(t, gs, "from=HEAD")
+	if want := runGit(t, gs.getProjectPath("p"), "diff", "HEAD") + "\n"; body.Patch != want {
+		t.Errorf("patch\n%s\nwant git's\n%s", body.Patch, want)
+	}
+	if body.Stat != (DiffStat{FilesChanged: 3, Additions: 3, Deletions: 3}) {
+		t.Errorf("stat = %+v", body.Stat)
+	}
+}
+
+// Tracked files whose stat matches the index are not read again, as in git,
+// unless they were modified too close to the index write to tell
+func TestWorktreeEntriesTrustUnchangedStat(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	staged, err := idx.Entry("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexPath := filepath.Join(gs.gitDir("p"), "index")
+	indexInfo, err := os.Stat(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same size and mtime: the staged hash is used without reading the file
+	name := filepath.Join(gs.getProjectPath("p"), "a.txt")
+	if err := os.WriteFile(name, []byte("two\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, staged.ModifiedAt, staged.ModifiedAt); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := worktreeEntries(repo, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries["a.txt"].hash != staged.Hash {
+		t.Errorf("a file with unchanged stat was rehashed")
+	}
+	if _, err := entries["a.txt"].read(); err == nil {
+		t.Error("read returned content that does not match the hash")
+	}
+
+	// A file written as late as the index is racily clean and rehashed
+	if err := os.Chtimes(indexPath, indexInfo.ModTime(), staged.ModifiedAt); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = worktreeEntries(repo, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := runGit(t, gs.getProjectPath("p"), "hash-object", "a.txt"); entries["a.txt"].hash.String() != want {
+		t.Errorf("racily clean file hashed to %s, want %s", entries["a.txt"].hash, want)
+	}
+	if content, err := entries["a.txt"].read(); err != nil || string(content) != "two\n" {
+		t.Errorf("read %q (%v)", content, err)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// maxDirtyScanWorkers bounds how many repositories are scanned at once
+const maxDirtyScanWorkers = 8
+
+// DirtyProject summarizes the uncommitted changes of one project
+type DirtyProject struct {
+	ProjectID string       `json:"projectId"`
+	Branch    string       `json:"branch,omitempty"`
+	Changes   ChangeCounts `json:"changes"`
+}
+
+// DirtyScanError records a project that could not be scanned
+type DirtyScanError struct {
+	ProjectID string `json:"projectId"`
+	Error     string `json:"error"`
+}
+
+// List projects with uncommitted changes endpoint
+func (gs *GitService) dirtyProjectsHandler(w http.ResponseWriter, r *http.Request) {
+	infos, err := os.ReadDir(gs.workspaceDir)
+	if err != nil {
+		gs.sendError(w, "Failed to read workspace", http.StatusInternalServerError)
+		return
+	}
+
+	var projectIDs []string
+	for _, info := range infos {
+		if info.IsDir() {
+			projectIDs = append(projectIDs, info.Name())
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		dirty    = []*DirtyProject{}
+		failures = []DirtyScanError{}
+		scanned  int
+	)
+	jobs := make(chan string)
+	workers := maxDirtyScanWorkers
+	if len(projectIDs) < workers {
+		workers = len(projectIDs)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for projectID := range jobs {
+				project, err := gs.scanDirtyProject(projectID)
+				if err == git.ErrRepositoryNotExists {
+					continue
+				}
+
+				mu.Lock()
+				scanned++
+				if err != nil {
+					failures = append(failures, DirtyScanError{ProjectID: projectID, Error: err.Error()})
+				} else if project != nil {
+					dirty = append(dirty, project)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, projectID := range projectIDs {
+		jobs <- projectID
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(dirty, func(i, j int) bool { return dirty[i].ProjectID < dirty[j].ProjectID })
+	sort.Slice(failures, func(i, j int) bool { return failures[i].ProjectID < failures[j].ProjectID })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"projects": dirty,
+		"scanned":  scanned,
+		"errors":   failures,
+	})
+}
+
+// scanDirtyProject counts a project's uncommitted changes, returning nil
+// when its working tree is clean
+func (gs *GitService) scanDirtyProject(projectID string) (*DirtyProject, error) {
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		return nil, err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return nil, err
+	}
+	if status.IsClean() {
+		return nil, nil
+	}
+
+	project := &DirtyProject{ProjectID: projectID}
+	if head, err := repo.Head(); err == nil && head.Name().IsBranch() {
+		project.Branch = head.Name().Short()
+	}
+	for _, fileStatus := range status {
+		if fileStatus.Staging != git.Unmodified || fileStatus.Worktree != git.Unmodified {
+			project.Changes.add(changeCountsFor(fileStatus))
+		}
+	}
+	return project, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirtyListsOnlyDirtyProjects(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "clean")
+	dirty := initTestRepo(t, gs, "dirty")
+	writeFiles(t, dirty, map[string]string{"a.txt": "changed\n", "new.txt": "new\n"})
+	// Directories that are not repositories are skipped, not reported
+	if err := os.Mkdir(filepath.Join(gs.workspaceDir, "notes"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(t, gs.dirtyProjectsHandler, "GET", "/git/dirty", nil, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Projects []DirtyProject   `json:"projects"`
+		Scanned  int              `json:"scanned"`
+		Errors   []DirtyScanError `json:"errors"`
+	}
+	decodeBody(t, rec, &body)
+	if body.Scanned != 2 || len(body.Errors) != 0 {
+		t.Errorf("scanned %d with errors %+v, want the two repositories", body.Scanned, body.Errors)
+	}
+	want := DirtyProject{ProjectID: "dirty", Branch: "master", Changes: ChangeCounts{Modified: 1, Untracked: 1, Total: 2}}
+	if len(body.Projects) != 1 || body.Projects[0] != want {
+		t.Errorf("projects %+v, want only %+v", body.Projects, want)
+	}
+}
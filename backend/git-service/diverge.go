@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/gorilla/mux"
+)
+
+// BranchDivergence describes how far a branch has drifted from the base
+type BranchDivergence struct {
+	Name      string   `json:"name"`
+	Hash      string   `json:"hash"`
+	Current   bool     `json:"current"`
+	Ahead     int      `json:"ahead"`
+	Behind    int      `json:"behind"`
+	MergeBase string   `json:"mergeBase,omitempty"`
+	Stat      DiffStat `json:"stat"`
+}
+
+// Get divergence of every local branch from a base endpoint
+func (gs *GitService) branchDivergenceHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	baseRef := r.URL.Query().Get("base")
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	base, err := gs.resolveCommit(repo, baseRef)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Base %s not found", baseRef), http.StatusNotFound)
+		return
+	}
+	if baseRef == "" {
+		baseRef = "HEAD"
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+
+	// The base history is walked once; each branch then only walks the
+	// commits it has that the base lacks
+	onBase, err := commitAncestors(repo, []plumbing.Hash{base.Hash}, nil)
+	if err != nil {
+		gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+		return
+	}
+
+	var current plumbing.ReferenceName
+	if head, err := repo.Storer.Reference(plumbing.HEAD); err == nil && head.Type() == plumbing.SymbolicReference {
+		current = head.Target()
+	}
+
+	iter, err := repo.Branches()
+	if err != nil {
+		gs.sendError(w, "Failed to list branches", http.StatusInternalServerError)
+		return
+	}
+	var refs []*plumbing.Reference
+	iter.ForEach(func(ref *plumbing.Reference) error {
+		refs = append(refs, ref)
+		return nil
+	})
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name() < refs[j].Name() })
+
+	// Branches forked from the same commits share the walk that counts what
+	// the base gained since
+	sharedCounts := make(map[string]int)
+	branches := make([]*BranchDivergence, 0, len(refs))
+	for _, ref := range refs {
+		tip, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			gs.sendError(w, fmt.Sprintf("Failed to read branch %s", ref.Name().Short()), http.StatusInternalServerError)
+			return
+		}
+
+		ahead, err := commitAncestors(repo, []plumbing.Hash{tip.Hash}, onBase)
+		if err != nil {
+			gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+			return
+		}
+		var boundary []plumbing.Hash
+		if onBase[tip.Hash] {
+			boundary = append(boundary, tip.Hash)
+		}
+		for hash := range ahead {
+			commit, err := repo.CommitObject(hash)
+			if err != nil {
+				gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+				return
+			}
+			for _, parent := range commit.ParentHashes {
+				if onBase[parent] {
+					boundary = append(boundary, parent)
+				}
+			}
+		}
+
+		keys := make([]string, 0, len(boundary))
+		for _, hash := range boundary {
+			keys = append(keys, hash.String())
+		}
+		sort.Strings(keys)
+		key := strings.Join(keys, ",")
+		shared, ok := sharedCounts[key]
+		if !ok {
+			common, err := commitAncestors(repo, boundary, nil)
+			if err != nil {
+				gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+				return
+			}
+			shared = len(common)
+			sharedCounts[key] = shared
+		}
+
+		divergence := &BranchDivergence{
+			Name:    ref.Name().Short(),
+			Hash:    tip.Hash.String(),
+			Current: ref.Name() == current,
+			Ahead:   len(ahead),
+			Behind:  len(onBase) - shared,
+		}
+
+		// The stat covers what the branch changed since it left the base
+		from := map[string]*diffEntry{}
+		if mergeBase := newestSharedAncestor(tip, onBase); mergeBase != nil {
+			divergence.MergeBase = mergeBase.Hash.String()
+			if from, err = treeEntries(mergeBase, ""); err != nil {
+				gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+				return
+			}
+		}
+		to, err := treeEntries(tip, "")
+		if err != nil {
+			gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+			return
+		}
+		files, err := diffEntries(from, to, settings.diffOptions())
+		if err != nil {
+			gs.sendInternalError(w, "Failed to compute diff", err)
+			return
+		}
+		divergence.Stat = newDiffStat(files)
+
+		branches = append(branches, divergence)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"base": map[string]interface{}{
+			"ref":  baseRef,
+			"hash": base.Hash.String(),
+		},
+		"branches": branches,
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBranchDivergenceFromBase(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	dir := gs.getProjectPath("p")
+	runGit(t, dir, "branch", "old")
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	commitTestFiles(t, repo, "F1", map[string]string{"f.txt": "one\ntwo\n"})
+	commitTestFiles(t, repo, "F2", map[string]string{"f.txt": "one\n"})
+	commitTestFiles(t, repo, "F3", map[string]string{"g.txt": "g\n"})
+	runGit(t, dir, "checkout", "-q", "master")
+	commitTestFiles(t, repo, "M1", map[string]string{"m.txt": "m\n"})
+	commitTestFiles(t, repo, "M2", map[string]string{"a.txt": "two\n"})
+
+	rec := serve(t, gs.branchDivergenceHandler, "GET", "/git/p/branches/diverge?base=master", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Branches []BranchDivergence `json:"branches"`
+	}
+	decodeBody(t, rec, &body)
+	branches := make(map[string]BranchDivergence)
+	for _, branch := range body.Branches {
+		branches[branch.Name] = branch
+	}
+	if len(branches) != 3 {
+		t.Fatalf("branches %+v", body.Branches)
+	}
+
+	// The counts agree with git's own
+	for _, name := range []string{"feature", "old", "master"} {
+		counts := strings.Fields(runGit(t, dir, "rev-list", "--left-right", "--count", "master..."+name))
+		got := branches[name]
+		if want := fmt.Sprintf("%d %d", got.Behind, got.Ahead); want != strings.Join(counts, " ") {
+			t.Errorf("%s: behind/ahead %s, git says %v", name, want, counts)
+		}
+	}
+	if branches["feature"].Ahead != 3 || branches["feature"].Behind != 2 {
+		t.Errorf("feature %+v", branches["feature"])
+	}
+	if want := runGit(t, dir, "merge-base", "master", "feature"); branches["feature"].MergeBase != want {
+		t.Errorf("merge base %s, want %s", branches["feature"].MergeBase, want)
+	}
+	if stat := branches["feature"].Stat; stat != (DiffStat{FilesChanged: 2, Additions: 2, Deletions: 0}) {
+		t.Errorf("feature stat %+v", stat)
+	}
+	if !branches["master"].Current || branches["feature"].Current {
+		t.Error("only master is current")
+	}
+}
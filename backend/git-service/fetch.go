@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/gorilla/mux"
+)
+
+// Tag fetching modes
+const (
+	fetchTagsAll       = "all"
+	fetchTagsNone      = "none"
+	fetchTagsFollowing = "following"
+)
+
+// FetchRequest represents a fetch request. Tags is all, none or following,
+// which only fetches tags pointing into the fetched history. RefSpecs
+// default to the remote's configured ones.
+type FetchRequest struct {
+	Remote      string      `json:"remote,omitempty"`
+	RefSpecs    []string    `json:"refSpecs,omitempty"`
+	Prune       bool        `json:"prune,omitempty"`
+	Tags        string      `json:"tags,omitempty"`
+	OperationID string      `json:"operationId,omitempty"`
+	Auth        *RemoteAuth `json:"auth,omitempty"`
+}
+
+// FetchedRef is a reference changed by a fetch. OldHash is empty for a new
+// reference and NewHash for a pruned one.
+type FetchedRef struct {
+	Name    string `json:"name"`
+	OldHash string `json:"oldHash,omitempty"`
+	NewHash string `json:"newHash,omitempty"`
+}
+
+// Fetch from remote endpoint. Only refs and objects are written, so the
+// project lock is not taken.
+func (gs *GitService) fetchHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req FetchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tags := git.TagFollowing
+	switch req.Tags {
+	case "", fetchTagsFollowing:
+		req.Tags = fetchTagsFollowing
+	case fetchTagsAll:
+		tags = git.AllTags
+	case fetchTagsNone:
+		tags = git.NoTags
+	default:
+		gs.sendError(w, "tags must be all, none or following", http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	remoteName := req.Remote
+	if remoteName == "" {
+		remoteName = git.DefaultRemoteName
+	}
+	remote, err := repo.Remote(remoteName)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Remote %s not found", remoteName), http.StatusNotFound)
+		return
+	}
+	auth, err := remoteAuthFor(repo, remoteName, req.Auth)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid auth: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	refSpecs := remote.Config().Fetch
+	if len(req.RefSpecs) > 0 {
+		refSpecs = nil
+		for _, spec := range req.RefSpecs {
+			refSpec := config.RefSpec(spec)
+			if err := refSpec.Validate(); err != nil {
+				gs.sendError(w, fmt.Sprintf("Invalid refspec %s: %v", spec, err), http.StatusBadRequest)
+				return
+			}
+			// The wildcard stands in for a remote name, which is checked as
+			// the fetch writes it
+			dst := refSpecDst(refSpec)
+			if err := validateFullRefName(strings.Replace(dst, "*", "x", 1)); err != nil {
+				gs.sendError(w, fmt.Sprintf("Invalid refspec %s: %v", spec, err), http.StatusBadRequest)
+				return
+			}
+			refSpecs = append(refSpecs, refSpec)
+		}
+	}
+
+	// Like git without --update-head-ok, never move the checked-out branch
+	// under the working tree
+	if head, err := repo.Storer.Reference(plumbing.HEAD); err == nil && head.Type() == plumbing.SymbolicReference {
+		for _, refSpec := range refSpecs {
+			if refSpecWrites(refSpec, head.Target()) {
+				gs.sendError(w, fmt.Sprintf("Refusing to fetch into the checked-out branch %s", head.Target().Short()), http.StatusConflict)
+				return
+			}
+		}
+	}
+
+	before, err := refHashes(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to list references", http.StatusInternalServerError)
+		return
+	}
+
+	op, err := gs.startOperation(req.OperationID, projectID, "fetch")
+	if err != nil {
+		gs.sendError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	ctx, cancel := gs.remoteContext(r.Context())
+	defer cancel()
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: remoteName,
+		RefSpecs:   refSpecs,
+		Tags:       tags,
+		Auth:       auth,
+		Progress:   io.MultiWriter(os.Stdout, op),
+	})
+	if err == git.NoErrAlreadyUpToDate {
+		err = nil
+	}
+	// go-git has no fetch pruning, so stale tracking refs are removed here
+	if err == nil && req.Prune {
+		err = pruneTrackingRefs(ctx, repo, remote, refSpecs, auth)
+	}
+	err = redactError(timeoutError(ctx, err), req.Auth)
+	gs.finishOperation(op, err)
+	if errors.Is(err, errRemoteTimeout) {
+		gs.sendError(w, fmt.Sprintf("Failed to fetch: %v", err), http.StatusGatewayTimeout)
+		return
+	} else if err != nil {
+		gs.sendInternalError(w, "Failed to fetch", err)
+		return
+	}
+	gs.recordFetch(projectID, remoteName)
+
+	after, err := refHashes(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to list references", http.StatusInternalServerError)
+		return
+	}
+	updated := []FetchedRef{}
+	tagsUpdated := 0
+	for name, hash := range after {
+		if previous, ok := before[name]; !ok || previous != hash {
+			updated = append(updated, FetchedRef{Name: name.String(), OldHash: hashString(before, name), NewHash: hash.String()})
+			if name.IsTag() {
+				tagsUpdated++
+			}
+		}
+	}
+	for name, hash := range before {
+		if _, ok := after[name]; !ok {
+			updated = append(updated, FetchedRef{Name: name.String(), OldHash: hash.String()})
+		}
+	}
+	sort.Slice(updated, func(i, j int) bool { return updated[i].Name < updated[j].Name })
+
+	alreadyUpToDate := len(updated) == 0
+	message := "Fetched successfully"
+	if alreadyUpToDate {
+		message = "Already up to date"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":         message,
+		"remote":          remoteName,
+		"alreadyUpToDate": alreadyUpToDate,
+		"tags":            req.Tags,
+		"tagsUpdated":     tagsUpdated,
+		"updated":         updated,
+		"operationId":     op.snapshot().ID,
+	})
+}
+
+// refSpecDst returns the destination side of a refspec, which may hold a wildcard
+func refSpecDst(refSpec config.RefSpec) string {
+	spec := refSpec.String()
+	return spec[strings.Index(spec, ":")+1:]
+}
+
+// refSpecWrites reports whether a refspec can update the named ref
+func refSpecWrites(refSpec config.RefSpec, name plumbing.ReferenceName) bool {
+	dst := refSpecDst(refSpec)
+	prefix, suffix, wildcard := strings.Cut(dst, "*")
+	if !wildcard {
+		return dst == name.String()
+	}
+	return len(name) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(name.String(), prefix) &&
+		strings.HasSuffix(name.String(), suffix)
+}
+
+// refHashes maps every direct reference to the object it points at
+func refHashes(repo *git.Repository) (map[plumbing.ReferenceName]plumbing.Hash, error) {
+	iter, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[plumbing.ReferenceName]plumbing.Hash)
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			hashes[ref.Name()] = ref.Hash()
+		}
+		return nil
+	})
+	return hashes, err
+}
+
+// hashString formats the hash of name, or returns "" when it is missing
+func hashString(hashes map[plumbing.ReferenceName]plumbing.Hash, name plumbing.ReferenceName) string {
+	if hash, ok := hashes[name]; ok {
+		return hash.String()
+	}
+	return ""
+}
+
+// pruneTrackingRefs deletes the local refs a refspec maps into whose source
+// no longer exists on the remote
+func pruneTrackingRefs(ctx context.Context, repo *git.Repository, remote *git.Remote, refSpecs []config.RefSpec, auth transport.AuthMethod) error {
+	remoteRefs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return err
+	}
+	existing := make(map[plumbing.ReferenceName]bool, len(remoteRefs))
+	for _, ref := range remoteRefs {
+		existing[ref.Name()] = true
+	}
+
+	local, err := refHashes(repo)
+	if err != nil {
+		return err
+	}
+	for name := range local {
+		for _, refSpec := range refSpecs {
+			if refSpec.IsExactSHA1() || refSpec.IsDelete() {
+				continue
+			}
+			reverse := config.RefSpec(strings.TrimPrefix(refSpec.String(), "+")).Reverse()
+			if !reverse.Match(name) {
+				continue
+			}
+			if !existing[reverse.Dst(name)] {
+				if err := repo.Storer.RemoveReference(name); err != nil {
+					return err
+				}
+			}
+			break
+		}
+	}
+	return nil
+}
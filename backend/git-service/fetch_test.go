@@ -0,0 +1,185 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type fetchResponse struct {
+	AlreadyUpToDate bool         `json:"alreadyUpToDate"`
+	Tags            string       `json:"tags"`
+	TagsUpdated     int          `json:"tagsUpdated"`
+	Updated         []FetchedRef `json:"updated"`
+}
+
+func fetch(t *testing.T, gs *GitService, req FetchRequest) fetchResponse {
+	t.Helper()
+	rec := serve(t, gs.fetchHandler, "POST", "/git/p/fetch", project("p"), req)
+	expectStatus(t, rec, http.StatusOK)
+	var body fetchResponse
+	decodeBody(t, rec, &body)
+	return body
+}
+
+// updatedNames lists the names of the refs a fetch changed
+func updatedNames(body fetchResponse) []string {
+	names := []string{}
+	for _, ref := range body.Updated {
+		names = append(names, ref.Name)
+	}
+	return names
+}
+
+// tagRemote pushes a commit on master tagged v1 to remote, and a tag
+// "detached" of a commit no branch contains
+func tagRemote(t *testing.T, remote string) {
+	t.Helper()
+	dir := t.TempDir()
+	runGit(t, dir, "clone", "-q", remote, ".")
+	runGit(t, dir, "commit", "-q", "--allow-empty", "-m", "Release")
+	runGit(t, dir, "tag", "v1")
+	runGit(t, dir, "checkout", "-q", "--detach")
+	runGit(t, dir, "commit", "-q", "--allow-empty", "-m", "Experiment")
+	runGit(t, dir, "tag", "-a", "-m", "Detached", "detached")
+	runGit(t, dir, "push", "-q", "origin", "master", "v1", "detached")
+}
+
+func TestFetchTagModes(t *testing.T) {
+	for _, test := range []struct {
+		tags string
+		want []string
+	}{
+		{"none", []string{"refs/remotes/origin/master"}},
+		{"", []string{"refs/remotes/origin/master", "refs/tags/v1"}},
+		{"all", []string{"refs/remotes/origin/master", "refs/tags/detached", "refs/tags/v1"}},
+	} {
+		gs := newTestService(t)
+		repo := initTestRepo(t, gs, "p")
+		remote := addTestRemote(t, repo)
+		tagRemote(t, remote)
+
+		body := fetch(t, gs, FetchRequest{Tags: test.tags})
+		if got := updatedNames(body); !equalStrings(got, test.want) {
+			t.Errorf("tags %q updated %v, want %v", test.tags, got, test.want)
+		}
+		if wantTags := len(test.want) - 1; body.TagsUpdated != wantTags {
+			t.Errorf("tags %q: tagsUpdated = %d, want %d", test.tags, body.TagsUpdated, wantTags)
+		}
+		if test.tags == "" && body.Tags != "following" {
+			t.Errorf("default tag mode reported as %q", body.Tags)
+		}
+		if again := fetch(t, gs, FetchRequest{Tags: test.tags}); !again.AlreadyUpToDate || len(again.Updated) != 0 {
+			t.Errorf("tags %q: second fetch %+v", test.tags, again)
+		}
+	}
+
+	gs := newTestService(t)
+	addTestRemote(t, initTestRepo(t, gs, "p"))
+	rec := serve(t, gs.fetchHandler, "POST", "/git/p/fetch", project("p"), FetchRequest{Tags: "some"})
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestFetchLeavesWorktreeAlone(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	remote := addTestRemote(t, repo)
+	head := refHash(t, repo, "HEAD")
+	old := refHash(t, repo, "refs/remotes/origin/master")
+	pushed := pushFromClone(t, remote, map[string]string{"b.txt": "b\n"})
+
+	body := fetch(t, gs, FetchRequest{})
+	want := []FetchedRef{{Name: "refs/remotes/origin/master", OldHash: old.String(), NewHash: pushed.String()}}
+	if len(body.Updated) != 1 || body.Updated[0] != want[0] || body.AlreadyUpToDate {
+		t.Errorf("updated %+v, want %+v", body.Updated, want)
+	}
+	if refHash(t, repo, "HEAD") != head {
+		t.Error("fetch moved HEAD")
+	}
+	// A fresh handle sees the pack the fetch wrote
+	fresh, err := gs.openRepository("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := gs.getRepositoryStatus(fresh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Clean || status.Behind == nil || *status.Behind != 1 {
+		t.Errorf("status after the fetch: %+v", status)
+	}
+
+	rec := serve(t, gs.fetchHandler, "POST", "/git/p/fetch", project("p"), FetchRequest{Remote: "upstream"})
+	expectStatus(t, rec, http.StatusNotFound)
+	rec = serve(t, gs.fetchHandler, "POST", "/git/p/fetch", project("p"), FetchRequest{RefSpecs: []string{"refs/heads/*"}})
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestFetchPrunesStaleTrackingRefs(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	remote := addTestRemote(t, repo)
+	dir := t.TempDir()
+	runGit(t, dir, "clone", "-q", remote, ".")
+	runGit(t, dir, "push", "-q", "origin", "master:gone", "master:kept")
+
+	fetch(t, gs, FetchRequest{})
+	gone := refHash(t, repo, "refs/remotes/origin/gone")
+	runGit(t, dir, "push", "-q", "origin", ":gone")
+
+	// Without prune the stale ref stays
+	if body := fetch(t, gs, FetchRequest{}); len(body.Updated) != 0 {
+		t.Errorf("fetch without prune updated %v", updatedNames(body))
+	}
+	refHash(t, repo, "refs/remotes/origin/gone")
+
+	body := fetch(t, gs, FetchRequest{Prune: true})
+	if len(body.Updated) != 1 || body.Updated[0] != (FetchedRef{Name: "refs/remotes/origin/gone", OldHash: gone.String()}) {
+		t.Errorf("pruning fetch updated %+v", body.Updated)
+	}
+	if _, err := repo.Reference("refs/remotes/origin/gone", false); err == nil {
+		t.Error("the stale tracking ref was not pruned")
+	}
+	refHash(t, repo, "refs/remotes/origin/kept")
+	refHash(t, repo, "refs/remotes/origin/master")
+}
+
+func TestFetchRefusesUnsafeDestinations(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	remote := addTestRemote(t, repo)
+	pushFromClone(t, remote, map[string]string{"b.txt": "b\n"})
+	configPath := filepath.Join(gs.gitDir("p"), "config")
+	config, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := refHash(t, repo, "HEAD")
+
+	for _, test := range []struct {
+		spec   string
+		status int
+	}{
+		{"+refs/heads/master:refs/../config", http.StatusBadRequest},
+		{"+refs/heads/*:refs/remotes/../../*", http.StatusBadRequest},
+		{"+refs/heads/master:config", http.StatusBadRequest},
+		{"+refs/heads/master:refs/heads/master", http.StatusConflict},
+		{"+refs/heads/*:refs/heads/*", http.StatusConflict},
+	} {
+		rec := serve(t, gs.fetchHandler, "POST", "/git/p/fetch", project("p"), FetchRequest{RefSpecs: []string{test.spec}})
+		expectStatus(t, rec, test.status)
+	}
+	if got, err := os.ReadFile(configPath); err != nil || string(got) != string(config) {
+		t.Errorf("config changed to %q (%v)", got, err)
+	}
+	if refHash(t, repo, "HEAD") != head {
+		t.Error("fetch moved the checked-out branch")
+	}
+
+	// Other branches can still be written directly
+	body := fetch(t, gs, FetchRequest{RefSpecs: []string{"+refs/heads/master:refs/heads/upstream"}})
+	if got := updatedNames(body); !equalStrings(got, []string{"refs/heads/upstream"}) {
+		t.Errorf("updated %v", got)
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+)
+
+// mboxFromLine is the fixed date git puts on the separator line of each
+// message so the output does not depend on when it was generated
+const mboxFromLine = "From %s Mon Sep 17 00:00:00 2001\n"
+
+// diffStatGraphWidth caps the +/- graph of a diffstat line
+const diffStatGraphWidth = 50
+
+// patchMessage is one email of a patch series
+type patchMessage struct {
+	filename string
+	content  string
+}
+
+// Format a branch as a patch series endpoint
+func (gs *GitService) formatPatchHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	query := r.URL.Query()
+
+	branch := query.Get("branch")
+	base := query.Get("base")
+	format := query.Get("format")
+	if format == "" {
+		format = "mbox"
+	}
+	if base == "" {
+		gs.sendError(w, "base is required", http.StatusBadRequest)
+		return
+	}
+	if format != "mbox" && format != "zip" {
+		gs.sendError(w, "format must be mbox or zip", http.StatusBadRequest)
+		return
+	}
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	tip, err := gs.resolveCommit(repo, branch)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Branch %s not found", branch), http.StatusNotFound)
+		return
+	}
+	baseCommit, err := gs.resolveCommit(repo, base)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Base %s not found", base), http.StatusNotFound)
+		return
+	}
+
+	commits, err := seriesCommits(repo, tip, baseCommit)
+	if err != nil {
+		gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+		return
+	}
+	if len(commits) == 0 {
+		gs.sendError(w, fmt.Sprintf("No commits to format since %s", base), http.StatusBadRequest)
+		return
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+	// Whitespace settings stay off: the patches have to apply exactly
+	opts := diffOptions{detectRenames: true, renameThreshold: settings.RenameThreshold}
+
+	var signer *Author
+	if query.Get("signoff") == "true" {
+		identity := gs.resolveIdentity(projectID)
+		signer = &identity
+	}
+
+	messages := make([]patchMessage, 0, len(commits)+1)
+	for i, commit := range commits {
+		message, err := formatPatch(commit, i+1, len(commits), opts, signer)
+		if err != nil {
+			gs.sendInternalError(w, fmt.Sprintf("Failed to format %s", commit.Hash), err)
+			return
+		}
+		messages = append(messages, message)
+	}
+
+	if query.Get("coverLetter") == "true" {
+		cover, err := formatCoverLetter(baseCommit, commits, opts, gs.resolveIdentity(projectID))
+		if err != nil {
+			gs.sendInternalError(w, "Failed to format cover letter", err)
+			return
+		}
+		messages = append([]patchMessage{cover}, messages...)
+	}
+
+	if format == "zip" {
+		name := strings.ReplaceAll(branch, "/", "-")
+		if name == "" {
+			name = "HEAD"
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+"-patches.zip"))
+		archive := zip.NewWriter(w)
+		for _, message := range messages {
+			f, err := archive.Create(message.filename)
+			if err != nil {
+				return
+			}
+			f.Write([]byte(message.content))
+		}
+		archive.Close()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/mbox")
+	for _, message := range messages {
+		w.Write([]byte(message.content))
+	}
+}
+
+// seriesCommits lists the non-merge commits reachable from tip but not from
+// base, oldest first, which is what git format-patch base..tip emits
+func seriesCommits(repo *git.Repository, tip, base *object.Commit) ([]*object.Commit, error) {
+	excluded, err := commitAncestors(repo, []plumbing.Hash{base.Hash}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []*object.Commit
+	err = object.NewCommitIterCTime(tip, excluded, nil).ForEach(func(c *object.Commit) error {
+		if c.NumParents() <= 1 {
+			commits = append(commits, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+	return commits, nil
+}
+
+// formatPatch renders a commit as patch number n of total in git's email format
+func formatPatch(commit *object.Commit, n, total int, opts diffOptions, signer *Author) (patchMessage, error) {
+	from := map[string]*diffEntry{}
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return patchMessage{}, err
+		}
+		if from, err = treeEntries(parent, ""); err != nil {
+			return patchMessage{}, err
+		}
+	}
+	to, err := treeEntries(commit, "")
+	if err != nil {
+		return patchMessage{}, err
+	}
+	files, err := diffEntries(from, to, opts)
+	if err != nil {
+		return patchMessage{}, err
+	}
+
+	subject, body := splitCommitMessage(commit.Message)
+	if signer != nil {
+		trailer := fmt.Sprintf("Signed-off-by: %s <%s>", signer.Name, signer.Email)
+		if !strings.Contains(body, trailer) {
+			if body == "" {
+				body = trailer + "\n"
+			} else {
+				body += "\n" + trailer + "\n"
+			}
+		}
+	}
+
+	var out strings.Builder
+	writePatchHeader(&out, commit.Hash, commit.Author.Name, commit.Author.Email, commit.Author.When, patchSubject(n, total, subject), body)
+	out.WriteString("---\n")
+	writeDiffStat(&out, files)
+	out.WriteString("\n")
+	for _, file := range files {
+		out.WriteString(file.Patch)
+	}
+	out.WriteString("-- \nneoai-git-service\n\n")
+
+	return patchMessage{
+		filename: fmt.Sprintf("%04d-%s.patch", n, patchFilename(subject)),
+		content:  out.String(),
+	}, nil
+}
+
+// formatCoverLetter renders the 0000 message summarizing a series, with the
+// subject and blurb left for the sender to fill in like git's template
+func formatCoverLetter(base *object.Commit, commits []*object.Commit, opts diffOptions, sender Author) (patchMessage, error) {
+	from, err := treeEntries(base, "")
+	if err != nil {
+		return patchMessage{}, err
+	}
+	to, err := treeEntries(commits[len(commits)-1], "")
+	if err != nil {
+		return patchMessage{}, err
+	}
+	files, err := diffEntries(from, to, opts)
+	if err != nil {
+		return patchMessage{}, err
+	}
+
+	var body strings.Builder
+	body.WriteString("*** BLURB HERE ***\n\n")
+	var authors []string
+	byAuthor := make(map[string][]string)
+	for _, commit := range commits {
+		name := commit.Author.Name
+		if _, ok := byAuthor[name]; !ok {
+			authors = append(authors, name)
+		}
+		subject, _ := splitCommitMessage(commit.Message)
+		byAuthor[name] = append(byAuthor[name], subject)
+	}
+	for _, name := range authors {
+		fmt.Fprintf(&body, "%s (%d):\n", name, len(byAuthor[name]))
+		for _, subject := range byAuthor[name] {
+			fmt.Fprintf(&body, "  %s\n", subject)
+		}
+		body.WriteString("\n")
+	}
+	writeDiffStat(&body, files)
+
+	var out strings.Builder
+	writePatchHeader(&out, plumbing.ZeroHash, sender.Name, sender.Email, time.Now(), patchSubject(0, len(commits), "*** SUBJECT HERE ***"), body.String())
+	out.WriteString("-- \nneoai-git-service\n\n")
+
+	return patchMessage{filename: "0000-cover-letter.patch", content: out.String()}, nil
+}
+
+// writePatchHeader writes the mbox separator, mail headers and message body
+func writePatchHeader(out *strings.Builder, hash plumbing.Hash, name, email string, when time.Time, subject, body string) {
+	fmt.Fprintf(out, mboxFromLine, hash.String())
+	fmt.Fprintf(out, "From: %s <%s>\n", encodeHeaderWord(name), email)
+	fmt.Fprintf(out, "Date: %s\n", when.Format(time.RFC1123Z))
+	fmt.Fprintf(out, "Subject: %s\n", encodeHeaderWord(subject))
+	if !isASCII(body) {
+		out.WriteString("MIME-Version: 1.0\nContent-Type: text/plain; charset=UTF-8\nContent-Transfer-Encoding: 8bit\n")
+	}
+	out.WriteString("\n")
+	if body != "" {
+		out.WriteString(body)
+		if !strings.HasSuffix(body, "\n") {
+			out.WriteString("\n")
+		}
+	}
+}
+
+// writeDiffStat writes the per-file change counts and summary line that git
+// puts between the message and the diff
+func writeDiffStat(out *strings.Builder, files []*FileDiff) {
+	names := make([]string, len(files))
+	width, most := 0, 0
+	for i, file := range files {
+		names[i] = file.Path
+		if file.ChangeType == changeRenamed {
+			names[i] = file.OldPath + " => " + file.Path
+		}
+		if len(names[i]) > width {
+			width = len(names[i])
+		}
+		if changes := file.Additions + file.Deletions; changes > most {
+			most = changes
+		}
+	}
+	for i, file := range files {
+		if file.Binary {
+			fmt.Fprintf(out, " %-*s | Bin\n", width, names[i])
+			continue
+		}
+		plus, minus := file.Additions, file.Deletions
+		if most > diffStatGraphWidth {
+			plus = scaleStat(plus, most)
+			minus = scaleStat(minus, most)
+		}
+		fmt.Fprintf(out, " %-*s | %d %s%s\n", width, names[i], file.Additions+file.Deletions,
+			strings.Repeat("+", plus), strings.Repeat("-", minus))
+	}
+
+	stat := newDiffStat(files)
+	noun := "files"
+	if stat.FilesChanged == 1 {
+		noun = "file"
+	}
+	fmt.Fprintf(out, " %d %s changed", stat.FilesChanged, noun)
+	if stat.Additions > 0 {
+		fmt.Fprintf(out, ", %d insertion%s(+)", stat.Additions, plural(stat.Additions))
+	}
+	if stat.Deletions > 0 {
+		fmt.Fprintf(out, ", %d deletion%s(-)", stat.Deletions, plural(stat.Deletions))
+	}
+	out.WriteString("\n")
+}
+
+// scaleStat shrinks a change count onto the graph width, keeping any change visible
+func scaleStat(n, most int) int {
+	if n == 0 {
+		return 0
+	}
+	if scaled := n * diffStatGraphWidth / most; scaled > 0 {
+		return scaled
+	}
+	return 1
+}
+
+// splitCommitMessage separates a commit message into its subject, with the
+// first paragraph joined onto one line, and the remaining body
+func splitCommitMessage(message string) (string, string) {
+	message = strings.TrimSpace(message)
+	subject, body := message, ""
+	if i := strings.Index(message, "\n\n"); i >= 0 {
+		subject, body = message[:i], strings.TrimLeft(message[i:], "\n")+"\n"
+	}
+	return strings.Join(strings.Fields(subject), " "), body
+}
+
+// patchSubject prefixes a subject with its position in the series, leaving a
+// single patch unnumbered like git
+func patchSubject(n, total int, subject string) string {
+	if total == 1 && n == 1 {
+		return "[PATCH] " + subject
+	}
+	return fmt.Sprintf("[PATCH %d/%d] %s", n, total, subject)
+}
+
+// patchFilename turns a subject into the slug git uses for patch file names
+func patchFilename(subject string) string {
+	var slug strings.Builder
+	dash := false
+	for _, c := range subject {
+		if c < unicode.MaxASCII && (unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_' || c == '.') {
+			slug.WriteRune(c)
+			dash = false
+		} else if !dash && slug.Len() > 0 {
+			slug.WriteByte('-')
+			dash = true
+		}
+	}
+	name := strings.Trim(slug.String(), "-.")
+	if len(name) > 52 {
+		name = strings.TrimRight(name[:52], "-.")
+	}
+	return name
+}
+
+// encodeHeaderWord encodes a non-ASCII header value as an RFC 2047 word
+func encodeHeaderWord(s string) string {
+	if isASCII(s) {
+		return s
+	}
+	return mime.QEncoding.Encode("UTF-8", s)
+}
+
+// isASCII reports whether s contains only ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
+
+// plural returns the suffix for a count
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
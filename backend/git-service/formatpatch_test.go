@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatPatchSeriesAppliesWithAm(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	dir := gs.getProjectPath("p")
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	commitTestFiles(t, repo, "Change a\n\nWith a body explaining it.", map[string]string{"a.txt": "one\ntwo\n"})
+	commitTestFiles(t, repo, "Add nested file", map[string]string{"sub/c.txt": "c\n"})
+	want := runGit(t, dir, "rev-parse", "feature^{tree}")
+
+	rec := serve(t, gs.formatPatchHandler, "GET", "/git/p/format-patch?branch=feature&base=master", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	mbox := rec.Body.String()
+	if strings.Count(mbox, "\nSubject: [PATCH ") != 2 {
+		t.Fatalf("want two patches:\n%s", mbox)
+	}
+
+	clone := filepath.Join(t.TempDir(), "clone")
+	runGit(t, t.TempDir(), "clone", "-q", "--branch", "master", dir, clone)
+	patches := filepath.Join(t.TempDir(), "series.mbox")
+	if err := os.WriteFile(patches, []byte(mbox), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, clone, "am", "-q", patches)
+	if got := runGit(t, clone, "rev-parse", "HEAD^{tree}"); got != want {
+		t.Errorf("applied tree %s, want %s", got, want)
+	}
+	if got := runGit(t, clone, "log", "-1", "--format=%B", "HEAD~1"); got != "Change a\n\nWith a body explaining it." {
+		t.Errorf("first patch message %q", got)
+	}
+
+	rec = serve(t, gs.formatPatchHandler, "GET", "/git/p/format-patch?branch=master&base=master", project("p"), nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/gorilla/mux"
+)
+
+// defaultFsckMaxObjects bounds how many objects a single fsck run inspects
+const defaultFsckMaxObjects = 200000
+
+// FsckObject identifies an object reported by fsck
+type FsckObject struct {
+	Hash string `json:"hash"`
+	Type string `json:"type"`
+}
+
+// FsckRefIssue represents a reference that points at an unusable object
+type FsckRefIssue struct {
+	Ref    string `json:"ref"`
+	Target string `json:"target"`
+	Error  string `json:"error"`
+}
+
+// FsckObjectIssue represents a missing or undecodable object
+type FsckObjectIssue struct {
+	Hash         string `json:"hash"`
+	Type         string `json:"type,omitempty"`
+	ReferencedBy string `json:"referencedBy,omitempty"`
+	Error        string `json:"error"`
+}
+
+// FsckReport represents the result of a repository integrity check
+type FsckReport struct {
+	Healthy        bool              `json:"healthy"`
+	ObjectsChecked int               `json:"objectsChecked"`
+	Truncated      bool              `json:"truncated"`
+	BrokenRefs     []FsckRefIssue    `json:"brokenRefs"`
+	MissingObjects []FsckObjectIssue `json:"missingObjects"`
+	CorruptObjects []FsckObjectIssue `json:"corruptObjects"`
+	Dangling       []FsckObject      `json:"dangling"`
+	Unreachable    []FsckObject      `json:"unreachable"`
+}
+
+// errFsckLimit stops the object walk once the configured bound is reached
+var errFsckLimit = errors.New("fsck object limit reached")
+
+// fsckWalker tracks the state of a connectivity walk
+type fsckWalker struct {
+	repo       *git.Repository
+	report     *FsckReport
+	maxObjects int
+	seen       map[plumbing.Hash]bool
+}
+
+// fsckItem is a pending object in the connectivity walk
+type fsckItem struct {
+	hash     plumbing.Hash
+	expected plumbing.ObjectType
+	from     string
+}
+
+// Verify repository integrity endpoint
+func (gs *GitService) fsckHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	maxObjects := defaultFsckMaxObjects
+	if maxStr := r.URL.Query().Get("maxObjects"); maxStr != "" {
+		if m, err := strconv.Atoi(maxStr); err == nil && m > 0 {
+			maxObjects = m
+		}
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	report, err := gs.fsck(repo, maxObjects)
+	if err != nil {
+		gs.sendError(w, "Failed to verify repository", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"report": report,
+	})
+}
+
+// fsck walks every object reachable from refs and the index, then compares
+// the result against the object database to find unreachable objects
+func (gs *GitService) fsck(repo *git.Repository, maxObjects int) (*FsckReport, error) {
+	report := &FsckReport{
+		BrokenRefs:     []FsckRefIssue{},
+		MissingObjects: []FsckObjectIssue{},
+		CorruptObjects: []FsckObjectIssue{},
+		Dangling:       []FsckObject{},
+		Unreachable:    []FsckObject{},
+	}
+	walker := &fsckWalker{
+		repo:       repo,
+		report:     report,
+		maxObjects: maxObjects,
+		seen:       make(map[plumbing.Hash]bool),
+	}
+
+	refs, err := repo.Storer.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []*plumbing.Reference
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		roots = append(roots, ref)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range roots {
+		if ref.Type() == plumbing.SymbolicReference {
+			// An unborn HEAD on a fresh repository is not corruption
+			if _, err := repo.Reference(ref.Target(), true); err != nil && ref.Name() != plumbing.HEAD {
+				report.BrokenRefs = append(report.BrokenRefs, FsckRefIssue{
+					Ref:    ref.Name().String(),
+					Target: ref.Target().String(),
+					Error:  err.Error(),
+				})
+			}
+			continue
+		}
+
+		if _, err := repo.Storer.EncodedObject(plumbing.AnyObject, ref.Hash()); err != nil {
+			report.BrokenRefs = append(report.BrokenRefs, FsckRefIssue{
+				Ref:    ref.Name().String(),
+				Target: ref.Hash().String(),
+				Error:  err.Error(),
+			})
+			continue
+		}
+
+		if err := walker.walk(ref.Hash(), plumbing.AnyObject, ref.Name().String()); err != nil {
+			if errors.Is(err, errFsckLimit) {
+				break
+			}
+			return nil, err
+		}
+	}
+
+	// Staged blobs are reachable even if no commit references them yet
+	if idx, err := repo.Storer.Index(); err == nil && !report.Truncated {
+		for _, entry := range idx.Entries {
+			if entry.Mode == filemode.Submodule {
+				continue
+			}
+			if err := walker.walk(entry.Hash, plumbing.BlobObject, "index:"+entry.Name); err != nil {
+				if errors.Is(err, errFsckLimit) {
+					break
+				}
+				return nil, err
+			}
+		}
+	}
+
+	if !report.Truncated {
+		if err := walker.findUnreachable(); err != nil {
+			return nil, err
+		}
+	}
+
+	report.ObjectsChecked = len(walker.seen)
+	report.Healthy = len(report.BrokenRefs) == 0 &&
+		len(report.MissingObjects) == 0 &&
+		len(report.CorruptObjects) == 0
+
+	return report, nil
+}
+
+// walk marks an object and everything it references as reachable
+func (fw *fsckWalker) walk(hash plumbing.Hash, expected plumbing.ObjectType, referencedBy string) error {
+	stack := []fsckItem{{hash, expected, referencedBy}}
+
+	for len(stack) > 0 {
+		item := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if fw.seen[item.hash] {
+			continue
+		}
+		if len(fw.seen) >= fw.maxObjects {
+			fw.report.Truncated = true
+			return errFsckLimit
+		}
+		fw.seen[item.hash] = true
+
+		encoded, err := fw.repo.Storer.EncodedObject(item.expected, item.hash)
+		if err != nil {
+			issue := FsckObjectIssue{
+				Hash:         item.hash.String(),
+				ReferencedBy: item.from,
+				Error:        err.Error(),
+			}
+			if item.expected != plumbing.AnyObject {
+				issue.Type = item.expected.String()
+			}
+			fw.report.MissingObjects = append(fw.report.MissingObjects, issue)
+			continue
+		}
+
+		// Blobs have no outgoing references, so there is nothing to decode
+		if encoded.Type() == plumbing.BlobObject {
+			continue
+		}
+
+		obj, err := object.DecodeObject(fw.repo.Storer, encoded)
+		if err != nil {
+			fw.report.CorruptObjects = append(fw.report.CorruptObjects, FsckObjectIssue{
+				Hash:         item.hash.String(),
+				Type:         encoded.Type().String(),
+				ReferencedBy: item.from,
+				Error:        err.Error(),
+			})
+			continue
+		}
+
+		from := item.hash.String()
+		switch o := obj.(type) {
+		case *object.Commit:
+			stack = append(stack, fsckItem{o.TreeHash, plumbing.TreeObject, from})
+			for _, parent := range o.ParentHashes {
+				stack = append(stack, fsckItem{parent, plumbing.CommitObject, from})
+			}
+		case *object.Tree:
+			for _, entry := range o.Entries {
+				if entry.Mode == filemode.Submodule {
+					continue
+				}
+				expected := plumbing.BlobObject
+				if entry.Mode == filemode.Dir {
+					expected = plumbing.TreeObject
+				}
+				stack = append(stack, fsckItem{entry.Hash, expected, from})
+			}
+		case *object.Tag:
+			stack = append(stack, fsckItem{o.Target, o.TargetType, from})
+		}
+	}
+
+	return nil
+}
+
+// findUnreachable lists objects the walk never visited. Unreachable objects
+// that no other unreachable object points at are reported as dangling.
+func (fw *fsckWalker) findUnreachable() error {
+	iter, err := fw.repo.Storer.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	var unreachable []plumbing.EncodedObject
+	referenced := make(map[plumbing.Hash]bool)
+
+	err = iter.ForEach(func(encoded plumbing.EncodedObject) error {
+		if fw.seen[encoded.Hash()] {
+			return nil
+		}
+		if len(unreachable) >= fw.maxObjects {
+			fw.report.Truncated = true
+			return storer.ErrStop
+		}
+		unreachable = append(unreachable, encoded)
+
+		if encoded.Type() == plumbing.BlobObject {
+			return nil
+		}
+		obj, err := object.DecodeObject(fw.repo.Storer, encoded)
+		if err != nil {
+			fw.report.CorruptObjects = append(fw.report.CorruptObjects, FsckObjectIssue{
+				Hash:  encoded.Hash().String(),
+				Type:  encoded.Type().String(),
+				Error: err.Error(),
+			})
+			return nil
+		}
+
+		switch o := obj.(type) {
+		case *object.Commit:
+			referenced[o.TreeHash] = true
+			for _, parent := range o.ParentHashes {
+				referenced[parent] = true
+			}
+		case *object.Tree:
+			for _, entry := range o.Entries {
+				referenced[entry.Hash] = true
+			}
+		case *object.Tag:
+			referenced[o.Target] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, encoded := range unreachable {
+		entry := FsckObject{Hash: encoded.Hash().String(), Type: encoded.Type().String()}
+		fw.report.Unreachable = append(fw.report.Unreachable, entry)
+		if !referenced[encoded.Hash()] {
+			fw.report.Dangling = append(fw.report.Dangling, entry)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func runFsck(t *testing.T, gs *GitService) FsckReport {
+	t.Helper()
+	rec := serve(t, gs.fsckHandler, "POST", "/git/p/fsck", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Report FsckReport `json:"report"`
+	}
+	decodeBody(t, rec, &body)
+	return body.Report
+}
+
+func TestFsckHealthyRepository(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	commitTestFiles(t, repo, "Second", map[string]string{"dir/b.txt": "b\n"})
+
+	report := runFsck(t, gs)
+	if !report.Healthy {
+		t.Errorf("healthy repository reported unhealthy: %+v", report)
+	}
+	if report.ObjectsChecked == 0 {
+		t.Error("no objects were checked")
+	}
+	if len(report.BrokenRefs)+len(report.MissingObjects)+len(report.CorruptObjects)+len(report.Dangling) != 0 {
+		t.Errorf("issues in a healthy repository: %+v", report)
+	}
+}
+
+func TestFsckReportsBrokenRefAndDanglingCommit(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	missing := plumbing.NewHash("0123456789abcdef0123456789abcdef01234567")
+	setRef(t, repo, "refs/heads/broken", missing)
+	dangling := storeTestCommit(t, repo, headTree(t, repo), "Unreferenced", refHash(t, repo, "HEAD"))
+
+	report := runFsck(t, gs)
+	if report.Healthy {
+		t.Error("a broken ref was reported healthy")
+	}
+	found := false
+	for _, issue := range report.BrokenRefs {
+		if issue.Ref == "refs/heads/broken" && issue.Target == missing.String() {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("refs/heads/broken not reported: %+v", report.BrokenRefs)
+	}
+	found = false
+	for _, object := range report.Dangling {
+		if object.Hash == dangling.String() && object.Type == "commit" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("dangling commit %s not reported: %+v", dangling, report.Dangling)
+	}
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/gorilla/mux"
+)
+
+// defaultPruneExpire matches git's gc.pruneExpire of 2.weeks.ago: newer
+// unreachable objects may still be in use by a running command
+const defaultPruneExpire = 14 * 24 * time.Hour
+
+// gcBlockSize approximates the filesystem block each loose object occupies
+const gcBlockSize = 4096
+
+// GcEstimate reports what gc would do without doing it. Reclaimed bytes
+// count pruned loose objects plus the block slack of the ones packed; the
+// delta compression a repack achieves on top of that is not predicted.
+type GcEstimate struct {
+	LooseObjects            int   `json:"looseObjects"`
+	LooseBytes              int64 `json:"looseBytes"`
+	PackableObjects         int   `json:"packableObjects"`
+	PackableBytes           int64 `json:"packableBytes"`
+	PrunableObjects         int   `json:"prunableObjects"`
+	PrunableBytes           int64 `json:"prunableBytes"`
+	RecentUnreachable       int   `json:"recentUnreachable"`
+	Packs                   int   `json:"packs"`
+	PackBytes               int64 `json:"packBytes"`
+	EstimatedReclaimedBytes int64 `json:"estimatedReclaimedBytes"`
+	Truncated               bool  `json:"truncated"`
+}
+
+// looseObject is an object file under .git/objects
+type looseObject struct {
+	hash    plumbing.Hash
+	size    int64
+	modTime time.Time
+}
+
+// gcPlan is what a gc would do with the loose objects: the ones it packs and
+// the unreachable, expired ones it prunes
+type gcPlan struct {
+	estimate *GcEstimate
+	pack     []plumbing.Hash
+	prune    []plumbing.Hash
+}
+
+// parsePruneExpire reads a pruneExpire value: "now" or a duration
+func parsePruneExpire(value string) (time.Duration, error) {
+	switch value {
+	case "":
+		return defaultPruneExpire, nil
+	case "now":
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, errors.New("pruneExpire must be now or a duration such as 336h")
+	}
+	return d, nil
+}
+
+// planGc classifies the loose objects of a repository. Refs, the index and
+// reflogs keep objects alive; unreachable objects are only pruned once older
+// than expire.
+func (gs *GitService) planGc(projectID string, repo *git.Repository, expire time.Duration) (*gcPlan, error) {
+	loose, err := looseObjects(gs.gitDir(projectID))
+	if err != nil {
+		return nil, fmt.Errorf("read object directory: %w", err)
+	}
+	plan := &gcPlan{estimate: &GcEstimate{}}
+	estimate := plan.estimate
+	if estimate.Packs, estimate.PackBytes, err = packFiles(gs.gitDir(projectID)); err != nil {
+		return nil, fmt.Errorf("read pack directory: %w", err)
+	}
+
+	// Same walk as fsck, so refs and the index keep objects alive
+	report, err := gs.fsck(repo, defaultFsckMaxObjects)
+	if err != nil {
+		return nil, fmt.Errorf("walk repository: %w", err)
+	}
+	estimate.Truncated = report.Truncated
+	if !estimate.Truncated {
+		unreachable := make(map[plumbing.Hash]bool, len(report.Unreachable))
+		for _, obj := range report.Unreachable {
+			unreachable[plumbing.NewHash(obj.Hash)] = true
+		}
+
+		// gc also keeps anything a reflog entry still points at
+		walker := &fsckWalker{
+			repo:       repo,
+			report:     &FsckReport{},
+			maxObjects: defaultFsckMaxObjects,
+			seen:       make(map[plumbing.Hash]bool),
+		}
+		reflogs, err := gs.readAllReflogs(projectID)
+		if err != nil {
+			return nil, fmt.Errorf("read reflogs: %w", err)
+		}
+		for _, entries := range reflogs {
+			for _, entry := range entries {
+				for _, hash := range []plumbing.Hash{plumbing.NewHash(entry.OldHash), plumbing.NewHash(entry.NewHash)} {
+					if !hash.IsZero() && unreachable[hash] {
+						if err := walker.walk(hash, plumbing.AnyObject, "reflog"); err != nil {
+							if errors.Is(err, errFsckLimit) {
+								estimate.Truncated = true
+							} else {
+								return nil, fmt.Errorf("walk reflogs: %w", err)
+							}
+						}
+					}
+				}
+			}
+		}
+		for hash := range walker.seen {
+			delete(unreachable, hash)
+		}
+
+		cutoff := time.Now().Add(-expire)
+		for _, obj := range loose {
+			estimate.LooseObjects++
+			estimate.LooseBytes += obj.size
+			switch {
+			case !unreachable[obj.hash]:
+				estimate.PackableObjects++
+				estimate.PackableBytes += obj.size
+				estimate.EstimatedReclaimedBytes += blockUsage(obj.size) - obj.size
+				plan.pack = append(plan.pack, obj.hash)
+			case obj.modTime.Before(cutoff) || expire == 0:
+				estimate.PrunableObjects++
+				estimate.PrunableBytes += obj.size
+				estimate.EstimatedReclaimedBytes += blockUsage(obj.size)
+				plan.prune = append(plan.prune, obj.hash)
+			default:
+				estimate.RecentUnreachable++
+			}
+		}
+	}
+
+	// Without a complete walk nothing is known to be unreachable, so every
+	// loose object is assumed to be packed
+	if estimate.Truncated {
+		*estimate = GcEstimate{Packs: estimate.Packs, PackBytes: estimate.PackBytes, Truncated: true}
+		plan.pack, plan.prune = nil, nil
+		for _, obj := range loose {
+			estimate.LooseObjects++
+			estimate.LooseBytes += obj.size
+			estimate.PackableObjects++
+			estimate.PackableBytes += obj.size
+			estimate.EstimatedReclaimedBytes += blockUsage(obj.size) - obj.size
+			plan.pack = append(plan.pack, obj.hash)
+		}
+	}
+	return plan, nil
+}
+
+// Estimate gc savings endpoint
+func (gs *GitService) gcEstimateHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	expire, err := parsePruneExpire(r.URL.Query().Get("pruneExpire"))
+	if err != nil {
+		gs.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	plan, err := gs.planGc(projectID, repo, expire)
+	if err != nil {
+		gs.sendInternalError(w, "Failed to analyze objects", err)
+		return
+	}
+	estimate := plan.estimate
+
+	// Worth running when there is something to prune or git's own gc.auto
+	// and gc.autoPackLimit thresholds would trigger
+	worthwhile := estimate.PrunableObjects > 0 || estimate.LooseObjects > 6700 || estimate.Packs > 50
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"estimate":    estimate,
+		"pruneExpire": expire.String(),
+		"worthwhile":  worthwhile,
+	})
+}
+
+// GcStats describes a repository's object storage
+type GcStats struct {
+	LooseObjects  int   `json:"looseObjects"`
+	LooseBytes    int64 `json:"looseBytes"`
+	PackedObjects int   `json:"packedObjects"`
+	Packs         int   `json:"packs"`
+	PackBytes     int64 `json:"packBytes"`
+	DiskUsage     int64 `json:"diskUsage"`
+}
+
+// gcStats measures the object storage of a project
+func (gs *GitService) gcStats(projectID string) (GcStats, error) {
+	gitDir := gs.gitDir(projectID)
+	var stats GcStats
+	loose, err := looseObjects(gitDir)
+	if err != nil {
+		return stats, err
+	}
+	for _, obj := range loose {
+		stats.LooseObjects++
+		stats.LooseBytes += obj.size
+		stats.DiskUsage += blockUsage(obj.size)
+	}
+	if stats.Packs, stats.PackBytes, err = packFiles(gitDir); err != nil {
+		return stats, err
+	}
+	packed, err := packedObjects(gitDir)
+	if err != nil {
+		return stats, err
+	}
+	stats.PackedObjects = len(packed)
+	stats.DiskUsage += stats.PackBytes
+	return stats, nil
+}
+
+// packedObjects lists the objects in every pack, read from the pack indexes
+func packedObjects(gitDir string) (map[plumbing.Hash]bool, error) {
+	packDir := filepath.Join(gitDir, "objects", "pack")
+	files, err := os.ReadDir(packDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[plumbing.Hash]bool{}, nil
+		}
+		return nil, err
+	}
+	objects := make(map[plumbing.Hash]bool)
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".idx") {
+			continue
+		}
+		f, err := os.Open(filepath.Join(packDir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		idx := idxfile.NewMemoryIndex()
+		err = idxfile.NewDecoder(f).Decode(idx)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name(), err)
+		}
+		entries, err := idx.Entries()
+		if err != nil {
+			return nil, err
+		}
+		for {
+			entry, err := entries.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				entries.Close()
+				return nil, err
+			}
+			objects[entry.Hash] = true
+		}
+		entries.Close()
+	}
+	return objects, nil
+}
+
+// Run gc endpoint. Loose objects still in use are packed together with
+// everything already packed into a single new pack, and unreachable loose
+// objects older than pruneExpire are deleted. go-git's own repack and prune
+// only consider refs, so they would drop staged and reflog-only objects.
+func (gs *GitService) gcHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	query := r.URL.Query()
+
+	expire, err := parsePruneExpire(query.Get("pruneExpire"))
+	if err != nil {
+		gs.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+	packer, ok := repo.Storer.(interface {
+		storer.PackedObjectStorer
+		storer.LooseObjectStorer
+		storer.PackfileWriter
+	})
+	if !ok {
+		gs.sendError(w, "The repository storage cannot be repacked", http.StatusInternalServerError)
+		return
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		gs.sendError(w, "Failed to read git config", http.StatusInternalServerError)
+		return
+	}
+
+	op, err := gs.startOperation(query.Get("operationId"), projectID, "gc")
+	if err != nil {
+		gs.sendError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	gc := func(ctx context.Context, progress io.Writer) (interface{}, error) {
+		out := io.MultiWriter(op, progress)
+		result, err := gs.runGc(projectID, repo, packer, cfg.Pack.Window, expire, out)
+		gs.finishOperation(op, err)
+		if err != nil {
+			return nil, err
+		}
+		result["operationId"] = op.snapshot().ID
+		return result, nil
+	}
+
+	// With Accept: text/event-stream the progress is streamed as it arrives
+	if wantsEventStream(r) {
+		gs.streamOperation(w, r, op, gc)
+		return
+	}
+
+	result, err := gc(context.Background(), io.Discard)
+	if err != nil {
+		gs.sendInternalError(w, "Failed to gc repository", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// runGc packs and prunes a repository per its gc plan, reporting each phase
+// to progress the way git does
+func (gs *GitService) runGc(projectID string, repo *git.Repository, packer interface {
+	storer.PackedObjectStorer
+	storer.LooseObjectStorer
+	storer.PackfileWriter
+}, window uint, expire time.Duration, progress io.Writer) (map[string]interface{}, error) {
+	before, err := gs.gcStats(projectID)
+	if err != nil {
+		return nil, fmt.Errorf("measure objects: %w", err)
+	}
+	plan, err := gs.planGc(projectID, repo, expire)
+	if err != nil {
+		return nil, err
+	}
+
+	packed, err := packedObjects(gs.gitDir(projectID))
+	if err != nil {
+		return nil, fmt.Errorf("read pack indexes: %w", err)
+	}
+	hashes := make([]plumbing.Hash, 0, len(packed)+len(plan.pack))
+	for hash := range packed {
+		hashes = append(hashes, hash)
+	}
+	for _, hash := range plan.pack {
+		if !packed[hash] {
+			hashes = append(hashes, hash)
+		}
+	}
+	fmt.Fprintf(progress, "Counting objects: %d, done.\n", len(hashes))
+
+	// A single pack with no loose objects to add is already as compact
+	// as this gets
+	repacked := len(hashes) > 0 && (len(plan.pack) > 0 || before.Packs > 1)
+	if repacked {
+		oldPacks, err := packer.ObjectPacks()
+		if err != nil {
+			return nil, fmt.Errorf("list packs: %w", err)
+		}
+		newPack, err := writePack(repo, packer, hashes, window)
+		if err != nil {
+			return nil, fmt.Errorf("write pack: %w", err)
+		}
+		fmt.Fprintf(progress, "Writing objects: %d, done.\n", len(hashes))
+		for _, hash := range oldPacks {
+			if hash == newPack {
+				continue
+			}
+			if err := packer.DeleteOldObjectPackAndIndex(hash, time.Time{}); err != nil {
+				return nil, fmt.Errorf("delete old pack: %w", err)
+			}
+		}
+		for _, hash := range plan.pack {
+			if err := packer.DeleteLooseObject(hash); err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("delete packed loose object: %w", err)
+			}
+		}
+	}
+
+	for _, hash := range plan.prune {
+		if err := packer.DeleteLooseObject(hash); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("prune object: %w", err)
+		}
+	}
+	fmt.Fprintf(progress, "Pruning objects: %d, done.\n", len(plan.prune))
+
+	after, err := gs.gcStats(projectID)
+	if err != nil {
+		return nil, fmt.Errorf("measure objects: %w", err)
+	}
+	gs.statsMu.Lock()
+	delete(gs.stats, projectID)
+	gs.statsMu.Unlock()
+
+	message := fmt.Sprintf("Packed %d object%s and pruned %d", len(hashes), plural(len(hashes)), len(plan.prune))
+	if !repacked {
+		message = fmt.Sprintf("Objects were already packed; pruned %d", len(plan.prune))
+	}
+	return map[string]interface{}{
+		"message":     message,
+		"before":      before,
+		"after":       after,
+		"repacked":    repacked,
+		"pruned":      len(plan.prune),
+		"pruneExpire": expire.String(),
+		"truncated":   plan.estimate.Truncated,
+	}, nil
+}
+
+// writePack encodes the objects into a new pack and returns its hash
+func writePack(repo *git.Repository, packer storer.PackfileWriter, hashes []plumbing.Hash, window uint) (hash plumbing.Hash, err error) {
+	wc, err := packer.PackfileWriter()
+	if err != nil {
+		return hash, err
+	}
+	defer func() {
+		if closeErr := wc.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	return packfile.NewEncoder(wc, repo.Storer, false).Encode(hashes, window)
+}
+
+// looseObjects lists the object files in the fan-out directories of objects/
+func looseObjects(gitDir string) ([]looseObject, error) {
+	objectsDir := filepath.Join(gitDir, "objects")
+	dirs, err := os.ReadDir(objectsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var objects []looseObject
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+		if _, err := strconv.ParseUint(dir.Name(), 16, 8); err != nil {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(objectsDir, dir.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			name := dir.Name() + file.Name()
+			if file.IsDir() || len(name) != 40 || strings.Trim(name, "0123456789abcdef") != "" {
+				continue
+			}
+			info, err := file.Info()
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, looseObject{hash: plumbing.NewHash(name), size: info.Size(), modTime: info.ModTime()})
+		}
+	}
+	return objects, nil
+}
+
+// packFiles counts the packs under objects/pack and their total size
+func packFiles(gitDir string) (int, int64, error) {
+	files, err := os.ReadDir(filepath.Join(gitDir, "objects", "pack"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+	count, size := 0, int64(0)
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".pack") {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			return 0, 0, err
+		}
+		count++
+		size += info.Size()
+	}
+	return count, size, nil
+}
+
+// blockUsage rounds a file size up to whole filesystem blocks
+func blockUsage(size int64) int64 {
+	return (size + gcBlockSize - 1) / gcBlockSize * gcBlockSize
+}
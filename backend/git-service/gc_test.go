@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type gcEstimateResponse struct {
+	Estimate   GcEstimate `json:"estimate"`
+	Worthwhile bool       `json:"worthwhile"`
+}
+
+func gcEstimate(t *testing.T, gs *GitService, query string) gcEstimateResponse {
+	t.Helper()
+	rec := serve(t, gs.gcEstimateHandler, "GET", "/git/p/gc/estimate"+query, project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body gcEstimateResponse
+	decodeBody(t, rec, &body)
+	return body
+}
+
+// looseCount is git's count of loose objects
+func looseCount(t *testing.T, gs *GitService) string {
+	t.Helper()
+	for _, line := range strings.Split(runGit(t, gs.getProjectPath("p"), "count-objects", "-v"), "\n") {
+		if count, ok := strings.CutPrefix(line, "count: "); ok {
+			return count
+		}
+	}
+	t.Fatal("git count-objects reported no count")
+	return ""
+}
+
+func TestGcEstimateReflectsLooseObjects(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	commitTestFiles(t, repo, "Second", map[string]string{"b.txt": "b\n"})
+
+	// The two commits, their trees and blobs are all in use
+	body := gcEstimate(t, gs, "")
+	if e := body.Estimate; e.LooseObjects != 6 || e.PackableObjects != 6 || e.PrunableObjects != 0 || e.Packs != 0 || body.Worthwhile {
+		t.Fatalf("estimate of a fresh repository: %+v, worthwhile %v", e, body.Worthwhile)
+	}
+
+	old, err := storeBlob(repo.Storer, []byte("discarded long ago\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storeBlob(repo.Storer, []byte("discarded just now\n")); err != nil {
+		t.Fatal(err)
+	}
+	longAgo := time.Now().Add(-30 * 24 * time.Hour)
+	path := filepath.Join(gs.gitDir("p"), "objects", old.String()[:2], old.String()[2:])
+	if err := os.Chtimes(path, longAgo, longAgo); err != nil {
+		t.Fatal(err)
+	}
+
+	body = gcEstimate(t, gs, "")
+	e := body.Estimate
+	if e.LooseObjects != 8 || e.PackableObjects != 6 || e.PrunableObjects != 1 || e.RecentUnreachable != 1 || !body.Worthwhile {
+		t.Errorf("estimate with unreachable objects: %+v, worthwhile %v", e, body.Worthwhile)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.PrunableBytes != info.Size() || e.EstimatedReclaimedBytes < gcBlockSize {
+		t.Errorf("prunable %d bytes, reclaimed %d; the object is %d bytes", e.PrunableBytes, e.EstimatedReclaimedBytes, info.Size())
+	}
+	if got := looseCount(t, gs); got != "8" {
+		t.Errorf("git counts %s loose objects after the estimate", got)
+	}
+
+	if e := gcEstimate(t, gs, "?pruneExpire=now").Estimate; e.PrunableObjects != 2 || e.RecentUnreachable != 0 {
+		t.Errorf("estimate pruning now: %+v", e)
+	}
+	rec := serve(t, gs.gcEstimateHandler, "GET", "/git/p/gc/estimate?pruneExpire=soon", project("p"), nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+// Staged content and reflog entries keep objects alive, as they do for git gc
+func TestGcEstimateKeepsIndexAndReflogObjects(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	dir := gs.getProjectPath("p")
+	writeFiles(t, repo, map[string]string{"staged.txt": "staged\n"})
+	runGit(t, dir, "add", "staged.txt")
+	runGit(t, dir, "commit", "-q", "--allow-empty", "-m", "Dropped")
+	runGit(t, dir, "reset", "-q", "--soft", "HEAD^")
+
+	body := gcEstimate(t, gs, "?pruneExpire=now")
+	if e := body.Estimate; e.PrunableObjects != 0 || e.PackableObjects != e.LooseObjects {
+		t.Errorf("estimate: %+v", e)
+	}
+}
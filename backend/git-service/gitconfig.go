@@ -0,0 +1,502 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	format "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/gorilla/mux"
+)
+
+// Config scopes, in increasing order of precedence
+const (
+	configScopeSystem = "system"
+	configScopeGlobal = "global"
+	configScopeLocal  = "local"
+)
+
+// maxConfigIncludeDepth matches git's limit on nested include directives
+const maxConfigIncludeDepth = 10
+
+// ConfigEntry represents a single git config value and where it was read from
+type ConfigEntry struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Scope  string `json:"scope"`
+	Origin string `json:"origin"`
+}
+
+// configLoader reads git config files, following include and includeIf
+type configLoader struct {
+	gitDir  string
+	branch  string
+	entries []ConfigEntry
+}
+
+// systemConfigPaths returns the system config file locations
+func systemConfigPaths() []string {
+	if os.Getenv("GIT_CONFIG_NOSYSTEM") != "" {
+		return nil
+	}
+	if path := os.Getenv("GIT_CONFIG_SYSTEM"); path != "" {
+		return []string{path}
+	}
+	return []string{"/etc/gitconfig"}
+}
+
+// globalConfigPaths returns the global config file locations in the order git reads them
+func globalConfigPaths() []string {
+	if path := os.Getenv("GIT_CONFIG_GLOBAL"); path != "" {
+		return []string{path}
+	}
+
+	home, _ := os.UserHomeDir()
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" && home != "" {
+		xdg = filepath.Join(home, ".config")
+	}
+
+	var paths []string
+	if xdg != "" {
+		paths = append(paths, filepath.Join(xdg, "git", "config"))
+	}
+	if home != "" {
+		paths = append(paths, filepath.Join(home, ".gitconfig"))
+	}
+	return paths
+}
+
+// loadConfigEntries returns the config entries for a project in the given
+// scope. The effective scope merges system, global and local config in
+// precedence order, so later entries override earlier ones.
+func (gs *GitService) loadConfigEntries(projectID, scope string) ([]ConfigEntry, error) {
+	loader := &configLoader{}
+	if projectID != "" {
+		loader.gitDir = gs.gitDir(projectID)
+		if repo, err := gs.openRepository(projectID); err == nil {
+			if head, err := repo.Storer.Reference(plumbing.HEAD); err == nil && head.Type() == plumbing.SymbolicReference {
+				loader.branch = head.Target().Short()
+			}
+		}
+	}
+
+	if scope == "effective" || scope == configScopeSystem {
+		for _, path := range systemConfigPaths() {
+			if err := loader.load(path, configScopeSystem, 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if scope == "effective" || scope == configScopeGlobal {
+		for _, path := range globalConfigPaths() {
+			if err := loader.load(path, configScopeGlobal, 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if (scope == "effective" || scope == configScopeLocal) && loader.gitDir != "" {
+		if err := loader.load(filepath.Join(loader.gitDir, "config"), configScopeLocal, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return loader.entries, nil
+}
+
+// secretConfigOptions are option names whose values are credentials in
+// their own right, such as an Authorization header in http.extraHeader
+var secretConfigOptions = map[string]bool{
+	"extraheader": true,
+	"smtppass":    true,
+	"password":    true,
+	"token":       true,
+}
+
+// redactConfigEntries masks credentials before config goes back to a client.
+// Keys are redacted too, since url.<base>.insteadOf puts a URL in the key.
+func redactConfigEntries(entries []ConfigEntry) []ConfigEntry {
+	redacted := make([]ConfigEntry, 0, len(entries))
+	for _, entry := range entries {
+		option := entry.Key[strings.LastIndex(entry.Key, ".")+1:]
+		entry.Key = redactSecrets(entry.Key, nil)
+		if secretConfigOptions[option] {
+			entry.Value = redactedSecret
+		} else {
+			entry.Value = redactSecrets(entry.Value, nil)
+		}
+		redacted = append(redacted, entry)
+	}
+	return redacted
+}
+
+// lookupConfig returns the winning value for a key, or "" when unset
+func lookupConfig(entries []ConfigEntry, key string) string {
+	value := ""
+	for _, entry := range entries {
+		if entry.Key == key {
+			value = entry.Value
+		}
+	}
+	return value
+}
+
+// resolveIdentity returns the user identity configured for a project,
+// taking global and system config into account
+func (gs *GitService) resolveIdentity(projectID string) Author {
+	entries, err := gs.loadConfigEntries(projectID, "effective")
+	if err != nil {
+		return Author{}
+	}
+	return Author{
+		Name:  lookupConfig(entries, "user.name"),
+		Email: lookupConfig(entries, "user.email"),
+	}
+}
+
+// missingIdentityMessage explains a commit refused for lack of an author
+const missingIdentityMessage = "Commit author is required: provide one or set user.name and user.email in git config"
+
+// fillIdentity completes who with the identity configured for a project,
+// for whichever of name and email the request left out
+func (gs *GitService) fillIdentity(projectID string, who Author) Author {
+	if who.Name != "" && who.Email != "" {
+		return who
+	}
+	identity := gs.resolveIdentity(projectID)
+	if who.Name == "" {
+		who.Name = identity.Name
+	}
+	if who.Email == "" {
+		who.Email = identity.Email
+	}
+	return who
+}
+
+// load parses one config file and any files it includes. Missing files are
+// skipped, as git does. Included files are applied after the options of the
+// including file, which matches git whenever includes sit at the end of a file.
+func (cl *configLoader) load(path, scope string, depth int) error {
+	if depth > maxConfigIncludeDepth {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	cfg := format.New()
+	if err := format.NewDecoder(f).Decode(cfg); err != nil {
+		return err
+	}
+
+	var includes []string
+	for _, section := range cfg.Sections {
+		name := strings.ToLower(section.Name)
+		for _, opt := range section.Options {
+			cl.add(name+"."+strings.ToLower(opt.Key), opt.Value, scope, path)
+			if name == "include" && strings.EqualFold(opt.Key, "path") {
+				includes = append(includes, opt.Value)
+			}
+		}
+		for _, sub := range section.Subsections {
+			for _, opt := range sub.Options {
+				cl.add(name+"."+sub.Name+"."+strings.ToLower(opt.Key), opt.Value, scope, path)
+				if name == "includeif" && strings.EqualFold(opt.Key, "path") && cl.matchCondition(sub.Name, path) {
+					includes = append(includes, opt.Value)
+				}
+			}
+		}
+	}
+
+	for _, include := range includes {
+		if err := cl.load(resolveIncludePath(include, path), scope, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cl *configLoader) add(key, value, scope, origin string) {
+	cl.entries = append(cl.entries, ConfigEntry{Key: key, Value: value, Scope: scope, Origin: origin})
+}
+
+// matchCondition evaluates an includeIf condition such as "gitdir:~/work/"
+// or "onbranch:feature/**"
+func (cl *configLoader) matchCondition(condition, configPath string) bool {
+	switch {
+	case strings.HasPrefix(condition, "gitdir:"):
+		return cl.matchGitDir(strings.TrimPrefix(condition, "gitdir:"), configPath, false)
+	case strings.HasPrefix(condition, "gitdir/i:"):
+		return cl.matchGitDir(strings.TrimPrefix(condition, "gitdir/i:"), configPath, true)
+	case strings.HasPrefix(condition, "onbranch:"):
+		if cl.branch == "" {
+			return false
+		}
+		pattern := strings.TrimPrefix(condition, "onbranch:")
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+		return globMatch(pattern, cl.branch, false)
+	}
+	return false
+}
+
+func (cl *configLoader) matchGitDir(pattern, configPath string, foldCase bool) bool {
+	if cl.gitDir == "" {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(pattern, "~/"):
+		if home, err := os.UserHomeDir(); err == nil {
+			pattern = filepath.Join(home, pattern[2:]) + suffixSlash(pattern)
+		}
+	case strings.HasPrefix(pattern, "./"):
+		pattern = filepath.Join(filepath.Dir(configPath), pattern[2:]) + suffixSlash(pattern)
+	case !filepath.IsAbs(pattern):
+		pattern = "**/" + pattern
+	}
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+
+	gitDir, err := filepath.Abs(cl.gitDir)
+	if err != nil {
+		return false
+	}
+	return globMatch(filepath.ToSlash(pattern), filepath.ToSlash(gitDir), foldCase) ||
+		globMatch(filepath.ToSlash(pattern), filepath.ToSlash(gitDir)+"/", foldCase)
+}
+
+func suffixSlash(pattern string) string {
+	if strings.HasSuffix(pattern, "/") {
+		return "/"
+	}
+	return ""
+}
+
+// resolveIncludePath expands ~ and resolves relative include paths against
+// the directory of the including file
+func resolveIncludePath(include, from string) string {
+	if strings.HasPrefix(include, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, include[2:])
+		}
+	}
+	if filepath.IsAbs(include) {
+		return include
+	}
+	return filepath.Join(filepath.Dir(from), include)
+}
+
+// globMatch matches git's wildmatch syntax where "**" crosses directories
+// and "*" does not
+func globMatch(pattern, name string, foldCase bool) bool {
+	var expr strings.Builder
+	if foldCase {
+		expr.WriteString("(?i)")
+	}
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*' && strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case c == '*' && strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return false
+	}
+	return re.MatchString(name)
+}
+
+// ConfigSummary is the part of a repository's local config the service
+// reads and writes directly
+type ConfigSummary struct {
+	User          Author   `json:"user"`
+	DefaultRemote string   `json:"defaultRemote"`
+	Remotes       []string `json:"remotes"`
+}
+
+// ConfigUpdateRequest changes the local config. Fields left out are kept
+// and an empty string unsets a value. DefaultRemote is stored as
+// remote.pushDefault, which push uses when no remote is named.
+type ConfigUpdateRequest struct {
+	User *struct {
+		Name  *string `json:"name,omitempty"`
+		Email *string `json:"email,omitempty"`
+	} `json:"user,omitempty"`
+	DefaultRemote *string `json:"defaultRemote,omitempty"`
+}
+
+// pushDefaultRemote returns the remote a push goes to when none is named
+func pushDefaultRemote(cfg *config.Config) string {
+	if name := cfg.Raw.Section("remote").Option("pushDefault"); name != "" {
+		return name
+	}
+	return git.DefaultRemoteName
+}
+
+// newConfigSummary reads the summary out of a local config, with any
+// credentials masked the same way as the full config listing
+func newConfigSummary(cfg *config.Config) ConfigSummary {
+	summary := ConfigSummary{
+		User:          Author{Name: redactSecrets(cfg.User.Name, nil), Email: redactSecrets(cfg.User.Email, nil)},
+		DefaultRemote: redactSecrets(cfg.Raw.Section("remote").Option("pushDefault"), nil),
+		Remotes:       []string{},
+	}
+	for name := range cfg.Remotes {
+		summary.Remotes = append(summary.Remotes, redactSecrets(name, nil))
+	}
+	sort.Strings(summary.Remotes)
+	return summary
+}
+
+// Get git config endpoint
+func (gs *GitService) configHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	scope := r.URL.Query().Get("scope")
+	if scope == "" {
+		scope = configScopeLocal
+	}
+	switch scope {
+	case configScopeLocal, configScopeGlobal, configScopeSystem, "effective":
+	default:
+		gs.sendError(w, "Scope must be one of local, global, system or effective", http.StatusBadRequest)
+		return
+	}
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		gs.sendError(w, "Failed to read git config", http.StatusInternalServerError)
+		return
+	}
+
+	entries, err := gs.loadConfigEntries(projectID, scope)
+	if err != nil {
+		gs.sendError(w, "Failed to read git config", http.StatusInternalServerError)
+		return
+	}
+	entries = redactConfigEntries(entries)
+
+	// Collapse to the winning value per key for quick lookups
+	values := make(map[string]string)
+	for _, entry := range entries {
+		values[entry.Key] = entry.Value
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"scope":   scope,
+		"entries": entries,
+		"values":  values,
+		"local":   newConfigSummary(cfg),
+	})
+}
+
+// Update git config endpoint
+func (gs *GitService) updateConfigHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req ConfigUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.User != nil {
+		for _, value := range []*string{req.User.Name, req.User.Email} {
+			if value != nil && strings.ContainsAny(*value, "\n<>") {
+				gs.sendError(w, "User name and email cannot contain newlines or angle brackets", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		gs.sendError(w, "Failed to read git config", http.StatusInternalServerError)
+		return
+	}
+
+	// go-git skips empty values when writing, so unset ones are removed
+	// from the raw section as well
+	if req.User != nil {
+		if req.User.Name != nil {
+			cfg.User.Name = strings.TrimSpace(*req.User.Name)
+			if cfg.User.Name == "" {
+				cfg.Raw.Section("user").RemoveOption("name")
+			}
+		}
+		if req.User.Email != nil {
+			cfg.User.Email = strings.TrimSpace(*req.User.Email)
+			if cfg.User.Email == "" {
+				cfg.Raw.Section("user").RemoveOption("email")
+			}
+		}
+	}
+	if req.DefaultRemote != nil {
+		name := *req.DefaultRemote
+		if name == "" {
+			cfg.Raw.Section("remote").RemoveOption("pushDefault")
+		} else {
+			if _, ok := cfg.Remotes[name]; !ok {
+				gs.sendError(w, fmt.Sprintf("Remote %s not found", name), http.StatusNotFound)
+				return
+			}
+			cfg.Raw.Section("remote").SetOption("pushDefault", name)
+		}
+	}
+
+	if err := repo.SetConfig(cfg); err != nil {
+		gs.sendInternalError(w, "Failed to write git config", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Git config updated",
+		"local":   newConfigSummary(cfg),
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// RefDecoration names a ref pointing at a commit. Type is head, branch,
+// remote or tag.
+type RefDecoration struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// GraphCommit is a history entry with what a client needs to lay out the
+// commit graph: the parent edges and the refs at the commit
+type GraphCommit struct {
+	*Commit
+	Parents []string        `json:"parents"`
+	Refs    []RefDecoration `json:"refs"`
+}
+
+// refDecorations maps commits to the refs pointing at them, like git log
+// --decorate. Tags are peeled to their commit; refs that do not lead to a
+// commit are left out.
+func (gs *GitService) refDecorations(repo *git.Repository) (map[plumbing.Hash][]RefDecoration, error) {
+	decorations := make(map[plumbing.Hash][]RefDecoration)
+	if head, err := repo.Head(); err == nil {
+		decorations[head.Hash()] = append(decorations[head.Hash()], RefDecoration{Name: "HEAD", Type: "head"})
+	}
+
+	iter, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		var kind string
+		switch {
+		case ref.Name().IsBranch():
+			kind = "branch"
+		case ref.Name().IsRemote():
+			kind = "remote"
+		case ref.Name().IsTag():
+			kind = "tag"
+		default:
+			return nil
+		}
+		commit, err := gs.resolveCommit(repo, ref.Name().String())
+		if err != nil {
+			return nil
+		}
+		decorations[commit.Hash] = append(decorations[commit.Hash], RefDecoration{Name: ref.Name().Short(), Type: kind})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// HEAD first, then branches, remotes and tags, each by name
+	order := map[string]int{"head": 0, "branch": 1, "remote": 2, "tag": 3}
+	for _, refs := range decorations {
+		sort.Slice(refs, func(i, j int) bool {
+			if refs[i].Type != refs[j].Type {
+				return order[refs[i].Type] < order[refs[j].Type]
+			}
+			return refs[i].Name < refs[j].Name
+		})
+	}
+	return decorations, nil
+}
+
+// graphCommits adds parents and ref decorations to a page of history
+func (gs *GitService) graphCommits(repo *git.Repository, commits []*Commit) ([]*GraphCommit, error) {
+	decorations, err := gs.refDecorations(repo)
+	if err != nil {
+		return nil, err
+	}
+	graph := make([]*GraphCommit, 0, len(commits))
+	for _, info := range commits {
+		hash := plumbing.NewHash(info.Hash)
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			return nil, err
+		}
+		entry := &GraphCommit{Commit: info, Parents: []string{}, Refs: decorations[hash]}
+		if entry.Refs == nil {
+			entry.Refs = []RefDecoration{}
+		}
+		for _, parent := range commit.ParentHashes {
+			entry.Parents = append(entry.Parents, parent.String())
+		}
+		graph = append(graph, entry)
+	}
+	return graph, nil
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+)
+
+// newTestService returns a service on an empty temporary workspace. HOME
+// points at an empty directory so the host's global git config is not read.
+func newTestService(t testing.TB) *GitService {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	return NewGitService(t.TempDir())
+}
+
+// testAuthor is the identity sent in requests that need an author
+func testAuthor() Author {
+	return Author{Name: "Test User", Email: "test@example.com"}
+}
+
+// testSignature is the author of commits made by the tests
+func testSignature() *object.Signature {
+	return &object.Signature{Name: "Test User", Email: "test@example.com", When: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)}
+}
+
+// initTestRepo creates a project repository with one commit of a.txt on
+// master
+func initTestRepo(t testing.TB, gs *GitService, projectID string) *git.Repository {
+	t.Helper()
+	repo, err := git.PlainInit(gs.getProjectPath(projectID), false)
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	commitTestFiles(t, repo, "Initial commit", map[string]string{"a.txt": "one\n"})
+	return repo
+}
+
+// writeFiles writes files into the worktree of repo, creating directories
+func writeFiles(t testing.TB, repo *git.Repository, files map[string]string) {
+	t.Helper()
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("worktree: %v", err)
+	}
+	for name, content := range files {
+		path := filepath.Join(worktree.Filesystem.Root(), name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+}
+
+// commitTestFiles writes and stages files, then commits them with message
+func commitTestFiles(t testing.TB, repo *git.Repository, message string, files map[string]string) plumbing.Hash {
+	t.Helper()
+	writeFiles(t, repo, files)
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("worktree: %v", err)
+	}
+	for name := range files {
+		if _, err := worktree.Add(name); err != nil {
+			t.Fatalf("add %s: %v", name, err)
+		}
+	}
+	hash, err := worktree.Commit(message, &git.CommitOptions{Author: testSignature(), AllowEmptyCommits: true})
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	return hash
+}
+
+// runGit runs the git command line in dir for what go-git cannot do, and
+// returns its trimmed output
+func runGit(t testing.TB, dir string, args ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	cmd := exec.Command("git", append([]string{"-c", "user.name=Test User", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// serve calls handler with a request built from method, target and body,
+// which is encoded as JSON unless it is a string. vars are the route
+// variables mux would have set.
+func serve(t testing.TB, handler http.HandlerFunc, method, target string, vars map[string]string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader *bytes.Reader
+	switch b := body.(type) {
+	case nil:
+		reader = bytes.NewReader(nil)
+	case string:
+		reader = bytes.NewReader([]byte(b))
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	if vars != nil {
+		req = mux.SetURLVars(req, vars)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// decodeBody decodes a JSON response into v, failing the test if it is not
+// JSON
+func decodeBody(t testing.TB, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode response %q: %v", rec.Body.String(), err)
+	}
+}
+
+// expectStatus fails the test unless the response has the given status
+func expectStatus(t testing.TB, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, status, rec.Body.String())
+	}
+}
+
+// project returns the route variables naming a project
+func project(projectID string) map[string]string {
+	return map[string]string{"projectId": projectID}
+}
+
+// storeTestCommit writes a commit with the given parents and tree directly to
+// the object store, without touching the worktree or any ref
+func storeTestCommit(t testing.TB, repo *git.Repository, tree plumbing.Hash, message string, parents ...plumbing.Hash) plumbing.Hash {
+	t.Helper()
+	commit := &object.Commit{
+		Author:       *testSignature(),
+		Committer:    *testSignature(),
+		Message:      message,
+		TreeHash:     tree,
+		ParentHashes: parents,
+	}
+	obj := repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		t.Fatalf("encode commit: %v", err)
+	}
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatalf("store commit: %v", err)
+	}
+	return hash
+}
+
+// setRef points a ref at hash
+func setRef(t testing.TB, repo *git.Repository, name string, hash plumbing.Hash) {
+	t.Helper()
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.ReferenceName(name), hash)); err != nil {
+		t.Fatalf("set %s: %v", name, err)
+	}
+}
+
+// headTree returns the tree of the commit HEAD points at
+func headTree(t testing.TB, repo *git.Repository) plumbing.Hash {
+	t.Helper()
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("head: %v", err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatalf("head commit: %v", err)
+	}
+	return commit.TreeHash
+}
+
+// sseEvent is one Server-Sent Event read back from a response
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// readEvents splits a Server-Sent Events response into its events
+func readEvents(t testing.TB, rec *httptest.ResponseRecorder) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	for _, block := range strings.Split(rec.Body.String(), "\n\n") {
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+		var event sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			if value, ok := strings.CutPrefix(line, "event: "); ok {
+				event.Event = value
+			} else if value, ok := strings.CutPrefix(line, "data: "); ok {
+				event.Data = value
+			}
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// addTestRemote creates a bare repository, adds it to repo as origin and
+// pushes master to it, leaving origin/master fetched. It returns the bare
+// repository's path.
+func addTestRemote(t testing.TB, repo *git.Repository) string {
+	t.Helper()
+	dir := t.TempDir()
+	if _, err := git.PlainInit(dir, true); err != nil {
+		t.Fatalf("init remote: %v", err)
+	}
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{dir}}); err != nil {
+		t.Fatalf("add remote: %v", err)
+	}
+	if err := repo.Push(&git.PushOptions{RemoteName: "origin", RefSpecs: []config.RefSpec{"refs/heads/master:refs/heads/master"}}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	if err := repo.Fetch(&git.FetchOptions{RemoteName: "origin"}); err != nil && err != git.NoErrAlreadyUpToDate {
+		t.Fatalf("fetch: %v", err)
+	}
+	return dir
+}
+
+// serveGitHTTP serves the bare repositories under root over smart HTTP with
+// git http-backend, returning the server's base URL. Credentials in the URL
+// are accepted and ignored.
+func serveGitHTTP(t testing.TB, root string) string {
+	t.Helper()
+	execPath := runGit(t, root, "--exec-path")
+	server := httptest.NewServer(&cgi.Handler{
+		Path: filepath.Join(execPath, "git-http-backend"),
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"},
+	})
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// pushFromClone clones remote, commits files on master and pushes them, as
+// another developer would, returning the new commit
+func pushFromClone(t testing.TB, remote string, files map[string]string) plumbing.Hash {
+	t.Helper()
+	clone, err := git.PlainClone(t.TempDir(), false, &git.CloneOptions{URL: remote})
+	if err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+	hash := commitTestFiles(t, clone, "Change from elsewhere", files)
+	if err := clone.Push(&git.PushOptions{}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	return hash
+}
+
+// refHash returns the hash a ref of repo points at
+func refHash(t testing.TB, repo *git.Repository, name string) plumbing.Hash {
+	t.Helper()
+	ref, err := repo.Reference(plumbing.ReferenceName(name), true)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return ref.Hash()
+}
+
+// equalStrings reports whether two string slices hold the same elements in
+// the same order
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// serveCommit calls the commit endpoint of project p, authoring as the test
+// user unless req names someone
+func serveCommit(t testing.TB, gs *GitService, req CommitRequest) *httptest.ResponseRecorder {
+	t.Helper()
+	if req.Author.Name == "" {
+		req.Author = testAuthor()
+	}
+	return serve(t, gs.commitHandler, "POST", "/git/p/commit", project("p"), req)
+}
+
+// equalInts reports whether two int slices hold the same elements in the
+// same order
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/gorilla/mux"
+)
+
+// defaultIdentityCommits bounds the history scanned for identities unless overridden
+const defaultIdentityCommits = 1000
+
+// Identity represents a distinct author or committer seen in history
+type Identity struct {
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Commits   int    `json:"commits"`
+	Authored  int    `json:"authored"`
+	Committed int    `json:"committed"`
+}
+
+// List known authors and committers endpoint
+func (gs *GitService) identitiesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	// limit=0 scans the whole history
+	limit := defaultIdentityCommits
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l < 0 {
+			gs.sendError(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = l
+	}
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	identities := []*Identity{}
+	scanned, truncated := 0, false
+	if _, err := repo.Head(); err == nil {
+		mm := gs.loadMailmap(projectID, repo)
+		byKey := make(map[string]*Identity)
+		lookup := func(sig object.Signature) *Identity {
+			name, email := mm.resolve(sig.Name, sig.Email)
+			key := strings.ToLower(email) + "\x00" + name
+			if id, ok := byKey[key]; ok {
+				return id
+			}
+			id := &Identity{Name: name, Email: email}
+			byKey[key] = id
+			identities = append(identities, id)
+			return id
+		}
+
+		iter, err := repo.Log(&git.LogOptions{})
+		if err != nil {
+			gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+			return
+		}
+		err = iter.ForEach(func(c *object.Commit) error {
+			if limit > 0 && scanned >= limit {
+				truncated = true
+				return storer.ErrStop
+			}
+			scanned++
+
+			author, committer := lookup(c.Author), lookup(c.Committer)
+			author.Authored++
+			author.Commits++
+			committer.Committed++
+			if committer != author {
+				committer.Commits++
+			}
+			return nil
+		})
+		if err != nil {
+			gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+			return
+		}
+	} else if err != plumbing.ErrReferenceNotFound {
+		gs.sendError(w, "Failed to read HEAD", http.StatusInternalServerError)
+		return
+	}
+
+	sort.SliceStable(identities, func(i, j int) bool {
+		if identities[i].Commits != identities[j].Commits {
+			return identities[i].Commits > identities[j].Commits
+		}
+		return identities[i].Name < identities[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"identities":     identities,
+		"commitsScanned": scanned,
+		"truncated":      truncated,
+	})
+}
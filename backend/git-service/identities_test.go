@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// commitAs commits a change authored by author and committed by committer
+func commitAs(t *testing.T, repo *git.Repository, author, committer Author, n int) {
+	t.Helper()
+	writeFiles(t, repo, map[string]string{"a.txt": fmt.Sprintf("change %d\n", n)})
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worktree.Add("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	when := testSignature().When
+	_, err = worktree.Commit(fmt.Sprintf("Change %d", n), &git.CommitOptions{
+		Author:    &object.Signature{Name: author.Name, Email: author.Email, When: when},
+		Committer: &object.Signature{Name: committer.Name, Email: committer.Email, When: when},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIdentitiesByFrequency(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	alice := Author{Name: "Alice", Email: "alice@example.com"}
+	oldAlice := Author{Name: "alice", Email: "alice@old.example.com"}
+	bob := Author{Name: "Bob", Email: "bob@example.com"}
+	commitAs(t, repo, alice, alice, 1)
+	commitAs(t, repo, oldAlice, oldAlice, 2)
+	commitAs(t, repo, alice, alice, 3)
+	commitAs(t, repo, bob, alice, 4)
+	if err := os.WriteFile(filepath.Join(gs.getProjectPath("p"), ".mailmap"), []byte("Alice <alice@example.com> <alice@old.example.com>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(t, gs.identitiesHandler, "GET", "/git/p/identities", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Identities     []Identity `json:"identities"`
+		CommitsScanned int        `json:"commitsScanned"`
+	}
+	decodeBody(t, rec, &body)
+
+	want := []Identity{
+		{Name: "Alice", Email: "alice@example.com", Commits: 4, Authored: 3, Committed: 4},
+		{Name: "Bob", Email: "bob@example.com", Commits: 1, Authored: 1},
+		{Name: "Test User", Email: "test@example.com", Commits: 1, Authored: 1, Committed: 1},
+	}
+	if body.CommitsScanned != 5 || len(body.Identities) != len(want) {
+		t.Fatalf("scanned %d commits, got %+v", body.CommitsScanned, body.Identities)
+	}
+	for i := range want {
+		if body.Identities[i] != want[i] {
+			t.Errorf("identity %d = %+v, want %+v", i, body.Identities[i], want[i])
+		}
+	}
+
+	rec = serve(t, gs.identitiesHandler, "GET", "/git/p/identities?limit=2", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var limited struct {
+		CommitsScanned int  `json:"commitsScanned"`
+		Truncated      bool `json:"truncated"`
+	}
+	decodeBody(t, rec, &limited)
+	if limited.CommitsScanned != 2 || !limited.Truncated {
+		t.Errorf("with limit=2: %+v", limited)
+	}
+}
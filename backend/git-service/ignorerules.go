@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/gorilla/mux"
+)
+
+// Ignore rule scopes, in increasing order of precedence
+const (
+	ignoreScopeGlobal    = "global"
+	ignoreScopeExclude   = "exclude"
+	ignoreScopeGitignore = "gitignore"
+)
+
+// IgnoreRule is one pattern of an ignore file
+type IgnoreRule struct {
+	Pattern string `json:"pattern"`
+	Line    int    `json:"line"`
+	Negated bool   `json:"negated"`
+}
+
+// IgnoreSource is an ignore file and the patterns it contributes. Directory
+// is the part of the tree its patterns apply to, relative to the repository root.
+type IgnoreSource struct {
+	Path      string       `json:"path"`
+	Scope     string       `json:"scope"`
+	Directory string       `json:"directory"`
+	Rules     []IgnoreRule `json:"rules"`
+}
+
+// Get effective ignore rules endpoint
+func (gs *GitService) ignoreRulesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	if _, err := gs.openRepository(projectID); err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	var sources []*IgnoreSource
+	var patterns []gitignore.Pattern
+	addSource := func(file, display, scope, dir string) error {
+		source, err := readIgnoreSource(file, display, scope, dir)
+		if err != nil || source == nil {
+			return err
+		}
+		sources = append(sources, source)
+		var domain []string
+		if dir != "" {
+			domain = strings.Split(dir, "/")
+		}
+		for _, rule := range source.Rules {
+			patterns = append(patterns, gitignore.ParsePattern(rule.Pattern, domain))
+		}
+		return nil
+	}
+
+	if file := gs.globalExcludesFile(projectID); file != "" {
+		if err := addSource(file, file, ignoreScopeGlobal, ""); err != nil {
+			gs.sendError(w, "Failed to read global excludes file", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := addSource(filepath.Join(gs.gitDir(projectID), "info", "exclude"), ".git/info/exclude", ignoreScopeExclude, ""); err != nil {
+		gs.sendError(w, "Failed to read .git/info/exclude", http.StatusInternalServerError)
+		return
+	}
+
+	// git never reads .gitignore files inside ignored directories, so the
+	// walk stops at any directory the rules gathered so far exclude. Walking
+	// parents first lists every file after the ones it takes precedence over.
+	root := gs.getProjectPath(projectID)
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		if err := addSource(filepath.Join(root, filepath.FromSlash(dir), ".gitignore"), path.Join(dir, ".gitignore"), ignoreScopeGitignore, dir); err != nil {
+			return err
+		}
+		infos, err := os.ReadDir(filepath.Join(root, filepath.FromSlash(dir)))
+		if err != nil {
+			return err
+		}
+		matcher := gitignore.NewMatcher(patterns)
+		for _, info := range infos {
+			if !info.IsDir() || (dir == "" && info.Name() == ".git") {
+				continue
+			}
+			child := path.Join(dir, info.Name())
+			if matcher.Match(strings.Split(child, "/"), true) {
+				continue
+			}
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(""); err != nil {
+		gs.sendError(w, "Failed to read .gitignore files", http.StatusInternalServerError)
+		return
+	}
+
+	if sources == nil {
+		sources = []*IgnoreSource{}
+	}
+	ruleCount := 0
+	for _, source := range sources {
+		ruleCount += len(source.Rules)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sources":   sources,
+		"ruleCount": ruleCount,
+	})
+}
+
+// globalExcludesFile returns the user-wide ignore file: core.excludesFile
+// when set, otherwise git's default under the XDG config directory
+func (gs *GitService) globalExcludesFile(projectID string) string {
+	entries, err := gs.loadConfigEntries(projectID, "effective")
+	if err == nil {
+		if file := lookupConfig(entries, "core.excludesfile"); file != "" {
+			if strings.HasPrefix(file, "~/") {
+				home, _ := os.UserHomeDir()
+				file = filepath.Join(home, file[2:])
+			}
+			return file
+		}
+	}
+
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		home, err := os.UserHomeDir()
+		if err != nil || home == "" {
+			return ""
+		}
+		xdg = filepath.Join(home, ".config")
+	}
+	return filepath.Join(xdg, "git", "ignore")
+}
+
+// readIgnoreSource parses an ignore file, returning nil when it does not exist
+func readIgnoreSource(file, display, scope, dir string) (*IgnoreSource, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	source := &IgnoreSource{Path: display, Scope: scope, Directory: dir, Rules: []IgnoreRule{}}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		pattern := strings.TrimRight(scanner.Text(), "\r")
+		if !strings.HasSuffix(pattern, "\\ ") {
+			pattern = strings.TrimRight(pattern, " \t")
+		}
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		source.Rules = append(source.Rules, IgnoreRule{
+			Pattern: pattern,
+			Line:    line,
+			Negated: strings.HasPrefix(pattern, "!"),
+		})
+	}
+	return source, scanner.Err()
+}
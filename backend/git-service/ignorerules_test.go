@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreRulesListsEverySource(t *testing.T) {
+	gs := newTestService(t)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	repo := initTestRepo(t, gs, "p")
+	global := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "git", "ignore")
+	if err := os.MkdirAll(filepath.Dir(global), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(global, []byte("*.swp\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, repo, map[string]string{
+		".git/info/exclude":      "# local only\nscratch/\n",
+		".gitignore":             "build/\n\n*.log\n",
+		"src/.gitignore":         "!keep.log\n",
+		"build/.gitignore":       "never read\n",
+		"scratch/sub/.gitignore": "never read either\n",
+	})
+
+	rec := serve(t, gs.ignoreRulesHandler, "GET", "/git/p/ignore-rules", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Sources   []IgnoreSource `json:"sources"`
+		RuleCount int            `json:"ruleCount"`
+	}
+	decodeBody(t, rec, &body)
+
+	want := []IgnoreSource{
+		{Path: global, Scope: ignoreScopeGlobal, Rules: []IgnoreRule{{Pattern: "*.swp", Line: 1}}},
+		{Path: ".git/info/exclude", Scope: ignoreScopeExclude, Rules: []IgnoreRule{{Pattern: "scratch/", Line: 2}}},
+		{Path: ".gitignore", Scope: ignoreScopeGitignore, Rules: []IgnoreRule{{Pattern: "build/", Line: 1}, {Pattern: "*.log", Line: 3}}},
+		{Path: "src/.gitignore", Scope: ignoreScopeGitignore, Directory: "src", Rules: []IgnoreRule{{Pattern: "!keep.log", Line: 1, Negated: true}}},
+	}
+	if len(body.Sources) != len(want) || body.RuleCount != 5 {
+		t.Fatalf("got %d rules in %+v", body.RuleCount, body.Sources)
+	}
+	for i, w := range want {
+		got := body.Sources[i]
+		if got.Path != w.Path || got.Scope != w.Scope || got.Directory != w.Directory || len(got.Rules) != len(w.Rules) {
+			t.Errorf("source %d = %+v, want %+v", i, got, w)
+			continue
+		}
+		for j := range w.Rules {
+			if got.Rules[j] != w.Rules[j] {
+				t.Errorf("%s rule %d = %+v, want %+v", w.Path, j, got.Rules[j], w.Rules[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// defaultInitialBranch names the first branch of a new repository
+const defaultInitialBranch = "main"
+
+// InitRequest represents a repository initialization request
+type InitRequest struct {
+	ProjectID     string `json:"projectId"`
+	Bare          bool   `json:"bare,omitempty"`
+	DefaultBranch string `json:"defaultBranch,omitempty"`
+}
+
+// Initialize repository endpoint
+func (gs *GitService) initHandler(w http.ResponseWriter, r *http.Request) {
+	var req InitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.ProjectID == "" {
+		gs.sendError(w, "projectId is required", http.StatusBadRequest)
+		return
+	}
+	if err := validateProjectID(req.ProjectID); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid project id: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.DefaultBranch == "" {
+		req.DefaultBranch = defaultInitialBranch
+	}
+	if err := validateRefName(req.DefaultBranch); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid branch name: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(req.ProjectID)
+	defer unlock()
+
+	if _, err := gs.openLockedRepository(req.ProjectID); err == nil {
+		gs.sendError(w, fmt.Sprintf("A repository already exists for project %s", req.ProjectID), http.StatusConflict)
+		return
+	}
+
+	projectPath := gs.getProjectPath(req.ProjectID)
+	if err := os.MkdirAll(projectPath, 0755); err != nil {
+		gs.sendError(w, "Failed to create project directory", http.StatusInternalServerError)
+		return
+	}
+
+	repo, err := git.PlainInitWithOptions(projectPath, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName(req.DefaultBranch)},
+		Bare:        req.Bare,
+	})
+	if err == git.ErrRepositoryAlreadyExists {
+		gs.sendError(w, fmt.Sprintf("A repository already exists for project %s", req.ProjectID), http.StatusConflict)
+		return
+	} else if err != nil {
+		gs.sendInternalError(w, "Failed to initialize repository", err)
+		return
+	}
+
+	// A new repository has no commits, and a bare one no working tree to
+	// report on, so the info is built here rather than by getRepositoryInfo
+	info := &Repository{
+		ID:        req.ProjectID,
+		Name:      req.ProjectID,
+		Branch:    req.DefaultBranch,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if !req.Bare {
+		if info.Status, err = gs.getRepositoryStatus(repo); err != nil {
+			gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    "Repository initialized successfully",
+		"repository": info,
+		"bare":       req.Bare,
+	})
+}
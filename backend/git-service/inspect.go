@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// defaultInspectLimit is how many recent commits an inspection returns
+const defaultInspectLimit = 20
+
+// InspectRequest names a remote repository to look at without cloning it to
+// disk. Memory must be true or left out: in-memory is the only mode.
+type InspectRequest struct {
+	URL    string      `json:"url"`
+	Branch string      `json:"branch,omitempty"`
+	Limit  int         `json:"limit,omitempty"`
+	Memory *bool       `json:"memory,omitempty"`
+	Auth   *RemoteAuth `json:"auth,omitempty"`
+}
+
+// Inspect repository endpoint. The remote is cloned into memory just deep
+// enough for the history asked for, and discarded once the response is
+// written, so nothing is persisted and no project is created.
+func (gs *GitService) inspectHandler(w http.ResponseWriter, r *http.Request) {
+	var req InspectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.URL == "" {
+		gs.sendError(w, "URL is required", http.StatusBadRequest)
+		return
+	}
+	if req.Memory != nil && !*req.Memory {
+		gs.sendError(w, "Inspection only clones into memory; use /git/clone to clone to disk", http.StatusBadRequest)
+		return
+	}
+	if req.Branch != "" {
+		if err := validateRefName(req.Branch); err != nil {
+			gs.sendError(w, fmt.Sprintf("Invalid branch name: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Limit < 0 {
+		gs.sendError(w, "limit must not be negative", http.StatusBadRequest)
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultInspectLimit
+	}
+
+	auth, err := remoteAuth(req.URL, req.Auth)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid auth: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// One commit past the limit tells whether there is more history. Nothing
+	// is checked out, the listing is read from the tree.
+	cloneOptions := &git.CloneOptions{
+		URL:        req.URL,
+		Auth:       auth,
+		Depth:      req.Limit + 1,
+		NoCheckout: true,
+	}
+	if req.Branch != "" {
+		cloneOptions.ReferenceName = plumbing.NewBranchReferenceName(req.Branch)
+	}
+	ctx, cancel := gs.remoteContext(r.Context())
+	defer cancel()
+	repo, err := git.CloneContext(ctx, memory.NewStorage(), memfs.New(), cloneOptions)
+	err = timeoutError(ctx, err)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) && req.Branch != "" {
+		gs.sendError(w, fmt.Sprintf("Branch %s not found", req.Branch), http.StatusNotFound)
+		return
+	} else if errors.Is(err, transport.ErrRepositoryNotFound) {
+		gs.sendError(w, "Remote repository not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		// An empty remote has nothing to show yet
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"url":      req.URL,
+			"empty":    true,
+			"branches": []*Branch{},
+			"commits":  []*Commit{},
+			"entries":  []TreeEntryInfo{},
+		})
+		return
+	} else if err != nil {
+		gs.sendError(w, fmt.Sprintf("Failed to inspect repository: %v", redactError(err, req.Auth)), remoteErrorStatus(err, http.StatusBadGateway))
+		return
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		gs.sendError(w, "Failed to get HEAD", http.StatusInternalServerError)
+		return
+	}
+	current := head.Name().Short()
+
+	// The clone has one local branch; the rest are its remote-tracking refs
+	refs, err := repo.References()
+	if err != nil {
+		gs.sendError(w, "Failed to list references", http.StatusInternalServerError)
+		return
+	}
+	branches := []*Branch{}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if !ref.Name().IsRemote() || ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		name := strings.TrimPrefix(ref.Name().Short(), git.DefaultRemoteName+"/")
+		commit, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return err
+		}
+		branches = append(branches, &Branch{
+			Name:       name,
+			IsActive:   name == current,
+			LastCommit: newCommitInfo(commit),
+		})
+		return nil
+	})
+	if err != nil {
+		gs.sendError(w, "Failed to list branches", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(branches, func(i, j int) bool { return branches[i].Name < branches[j].Name })
+
+	commits, next, err := gs.getCommitHistory(repo, head.Hash(), historyFilter{}, 0, req.Limit, false)
+	if err != nil {
+		gs.sendError(w, "Failed to get commit history", http.StatusInternalServerError)
+		return
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		gs.sendError(w, "Failed to read HEAD commit", http.StatusInternalServerError)
+		return
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+		return
+	}
+	entries := make([]TreeEntryInfo, 0, len(tree.Entries))
+	for _, entry := range tree.Entries {
+		info, err := newTreeEntryInfo(repo, entry.Name, entry)
+		if err != nil {
+			gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+			return
+		}
+		entries = append(entries, info)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":      req.URL,
+		"empty":    false,
+		"branch":   current,
+		"head":     head.Hash().String(),
+		"branches": branches,
+		"commits":  commits,
+		"hasMore":  next != nil,
+		"entries":  entries,
+	})
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// lineOp is a single line of a line-oriented diff
+type lineOp struct {
+	Type diffmatchpatch.Operation
+	Text string
+}
+
+// splitLines splits content into lines, keeping a trailing line that has no newline
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffOptions controls how files and lines are compared
+type diffOptions struct {
+	ignoreAllSpace  bool
+	ignoreEOL       bool
+	detectRenames   bool
+	renameThreshold int
+}
+
+// diffLines computes a line-by-line edit script turning src into dst
+func diffLines(src, dst string) []lineOp {
+	return diffLinesWith(src, dst, diffOptions{})
+}
+
+// diffLinesWith computes a line diff where lines that only differ in
+// ignored whitespace compare equal. The script always carries the original
+// line text; unchanged lines take their text from dst.
+func diffLinesWith(src, dst string, opts diffOptions) []lineOp {
+	if !opts.ignoreAllSpace && !opts.ignoreEOL {
+		var ops []lineOp
+		for _, d := range diff.Do(src, dst) {
+			for _, line := range splitLines(d.Text) {
+				ops = append(ops, lineOp{Type: d.Type, Text: line})
+			}
+		}
+		return ops
+	}
+
+	srcLines, dstLines := splitLines(src), splitLines(dst)
+	normalized := func(lines []string) string {
+		var b strings.Builder
+		for _, line := range lines {
+			b.WriteString(opts.normalize(line))
+			b.WriteString("\n")
+		}
+		return b.String()
+	}
+
+	var ops []lineOp
+	srcIdx, dstIdx := 0, 0
+	for _, d := range diff.Do(normalized(srcLines), normalized(dstLines)) {
+		for range splitLines(d.Text) {
+			switch d.Type {
+			case diffmatchpatch.DiffDelete:
+				ops = append(ops, lineOp{Type: d.Type, Text: srcLines[srcIdx]})
+				srcIdx++
+			case diffmatchpatch.DiffInsert:
+				ops = append(ops, lineOp{Type: d.Type, Text: dstLines[dstIdx]})
+				dstIdx++
+			default:
+				ops = append(ops, lineOp{Type: d.Type, Text: dstLines[dstIdx]})
+				srcIdx++
+				dstIdx++
+			}
+		}
+	}
+	return ops
+}
+
+// normalize strips the whitespace a comparison should ignore
+func (o diffOptions) normalize(line string) string {
+	line = strings.TrimRight(line, "\r\n")
+	if o.ignoreAllSpace {
+		return strings.Join(strings.Fields(line), "")
+	}
+	return strings.TrimRight(line, " \t\r")
+}
+
+// unifiedHunk renders an edit script as a single unified diff hunk whose
+// line numbers start at srcStart and dstStart (1-based)
+func unifiedHunk(ops []lineOp, srcStart, dstStart int) string {
+	srcCount, dstCount := 0, 0
+	var body strings.Builder
+	for _, op := range ops {
+		prefix := " "
+		switch op.Type {
+		case diffmatchpatch.DiffDelete:
+			prefix = "-"
+			srcCount++
+		case diffmatchpatch.DiffInsert:
+			prefix = "+"
+			dstCount++
+		default:
+			srcCount++
+			dstCount++
+		}
+		body.WriteString(prefix)
+		body.WriteString(op.Text)
+		if !strings.HasSuffix(op.Text, "\n") {
+			body.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+
+	// An empty side is reported as starting at the line before, like git
+	if srcCount == 0 {
+		srcStart--
+	}
+	if dstCount == 0 {
+		dstStart--
+	}
+	return fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(srcStart, srcCount), hunkRange(dstStart, dstCount)) + body.String()
+}
+
+// hunkRange formats one side of a hunk header, omitting a count of one like git
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// unifiedPatch renders an edit script as unified diff hunks, keeping context
+// unchanged lines around each change and merging hunks that would overlap
+func unifiedPatch(ops []lineOp, context int) string {
+	var patch strings.Builder
+	srcLine, dstLine := 1, 1
+	for i := 0; i < len(ops); {
+		if ops[i].Type == diffmatchpatch.DiffEqual {
+			srcLine++
+			dstLine++
+			i++
+			continue
+		}
+
+		// Back up over leading context
+		start := i
+		for start > 0 && i-start < context && ops[start-1].Type == diffmatchpatch.DiffEqual {
+			start--
+		}
+		srcStart, dstStart := srcLine-(i-start), dstLine-(i-start)
+
+		// Extend until a run of unchanged lines is too long to bridge
+		end := i
+		for end < len(ops) {
+			if ops[end].Type != diffmatchpatch.DiffEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].Type == diffmatchpatch.DiffEqual {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				end += min(run-end, context)
+				break
+			}
+			end = run
+		}
+
+		patch.WriteString(unifiedHunk(ops[start:end], srcStart, dstStart))
+		for _, op := range ops[i:end] {
+			if op.Type != diffmatchpatch.DiffInsert {
+				srcLine++
+			}
+			if op.Type != diffmatchpatch.DiffDelete {
+				dstLine++
+			}
+		}
+		i = end
+	}
+	return patch.String()
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// maxLineLogCommits bounds how far back a line range is traced
+const maxLineLogCommits = 5000
+
+// LineLogEntry represents a commit that changed a tracked line range
+type LineLogEntry struct {
+	Commit *Commit `json:"commit"`
+	Start  int     `json:"start"`
+	End    int     `json:"end"`
+	Patch  string  `json:"patch"`
+}
+
+// Get line range history endpoint
+func (gs *GitService) lineLogHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	query := r.URL.Query()
+	path := query.Get("path")
+	if path == "" {
+		gs.sendError(w, "Path is required", http.StatusBadRequest)
+		return
+	}
+
+	start, err := strconv.Atoi(query.Get("start"))
+	if err != nil || start < 1 {
+		gs.sendError(w, "Start must be a positive line number", http.StatusBadRequest)
+		return
+	}
+	end, err := strconv.Atoi(query.Get("end"))
+	if err != nil || end < start {
+		gs.sendError(w, "End must be a line number not before start", http.StatusBadRequest)
+		return
+	}
+
+	limit := 50 // default
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	commit, err := gs.resolveCommit(repo, query.Get("ref"))
+	if err != nil {
+		gs.sendError(w, "Failed to resolve ref", http.StatusBadRequest)
+		return
+	}
+
+	file, err := commit.File(path)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Path %s not found", path), http.StatusNotFound)
+		return
+	}
+	content, err := file.Contents()
+	if err != nil {
+		gs.sendError(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	if lines := len(splitLines(content)); end > lines {
+		gs.sendError(w, fmt.Sprintf("Line range exceeds file length (%d lines)", lines), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := gs.lineLog(repo, commit, path, content, start, end, limit)
+	if err != nil {
+		gs.sendError(w, "Failed to compute line history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"path":    path,
+		"start":   start,
+		"end":     end,
+		"commits": entries,
+	})
+}
+
+// lineLog traces a line range back through first-parent history, like
+// `git log -L`, shifting the range as earlier commits insert or remove
+// lines above it. Renames are not followed.
+func (gs *GitService) lineLog(repo *git.Repository, commit *object.Commit, path, content string, start, end, limit int) ([]*LineLogEntry, error) {
+	entries := []*LineLogEntry{}
+	current := commit
+
+	for walked := 0; walked < maxLineLogCommits && len(entries) < limit; walked++ {
+		var parentFile *object.File
+		var parent *object.Commit
+		if current.NumParents() > 0 {
+			p, err := current.Parent(0)
+			if err != nil {
+				return nil, err
+			}
+			parent = p
+			if f, err := parent.File(path); err == nil {
+				parentFile = f
+			} else if err != object.ErrFileNotFound {
+				return nil, err
+			}
+		}
+
+		// The file first appears here, so every line in the range originates here
+		if parentFile == nil {
+			var ops []lineOp
+			for _, line := range splitLines(content)[start-1 : end] {
+				ops = append(ops, lineOp{Type: diffmatchpatch.DiffInsert, Text: line})
+			}
+			entries = append(entries, &LineLogEntry{
+				Commit: newCommitInfo(current),
+				Start:  start,
+				End:    end,
+				Patch:  unifiedHunk(ops, 1, start),
+			})
+			break
+		}
+
+		currentFile, err := current.File(path)
+		if err != nil {
+			return nil, err
+		}
+		if currentFile.Hash == parentFile.Hash {
+			current = parent
+			continue
+		}
+
+		parentContent, err := parentFile.Contents()
+		if err != nil {
+			return nil, err
+		}
+
+		scoped, parentStart, parentEnd, changed := mapLineRange(diffLines(parentContent, content), start, end)
+		if changed {
+			entries = append(entries, &LineLogEntry{
+				Commit: newCommitInfo(current),
+				Start:  start,
+				End:    end,
+				Patch:  unifiedHunk(scoped, parentStart, start),
+			})
+		}
+
+		// Nothing of the range existed before this commit
+		if parentEnd < parentStart {
+			break
+		}
+
+		start, end = parentStart, parentEnd
+		current = parent
+		content = parentContent
+	}
+
+	return entries, nil
+}
+
+// mapLineRange maps the line range [start, end] of a diff's destination onto
+// its source. It returns the diff lines within the range, the corresponding
+// source range (empty when end < start) and whether the range was modified.
+// A block of replaced lines that overlaps the range pulls all of its removed
+// lines into the source range, since they cannot be told apart.
+func mapLineRange(ops []lineOp, start, end int) ([]lineOp, int, int, bool) {
+	var scoped []lineOp
+	srcLine, dstLine := 0, 0
+	srcStart, srcEnd := 0, -1
+	changed := false
+
+	include := func(from, to int) {
+		if from > to {
+			return
+		}
+		if srcEnd < srcStart {
+			srcStart = from
+		}
+		srcEnd = to
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].Type == diffmatchpatch.DiffEqual {
+			srcLine++
+			dstLine++
+			if dstLine >= start && dstLine <= end {
+				scoped = append(scoped, ops[i])
+				include(srcLine, srcLine)
+			}
+			i++
+			continue
+		}
+
+		// Collect a block of consecutive removed and added lines
+		var deleted, inserted []lineOp
+		for ; i < len(ops) && ops[i].Type != diffmatchpatch.DiffEqual; i++ {
+			if ops[i].Type == diffmatchpatch.DiffDelete {
+				deleted = append(deleted, ops[i])
+			} else {
+				inserted = append(inserted, ops[i])
+			}
+		}
+
+		blockSrcStart, blockDstStart := srcLine+1, dstLine+1
+		srcLine += len(deleted)
+		dstLine += len(inserted)
+
+		var overlaps bool
+		if len(inserted) > 0 {
+			overlaps = blockDstStart <= end && dstLine >= start
+		} else {
+			// A pure deletion sits between two destination lines
+			overlaps = dstLine >= start && dstLine < end
+		}
+		if !overlaps {
+			continue
+		}
+
+		changed = true
+		scoped = append(scoped, deleted...)
+		include(blockSrcStart, srcLine)
+		for n, op := range inserted {
+			if line := blockDstStart + n; line >= start && line <= end {
+				scoped = append(scoped, op)
+			}
+		}
+		if srcEnd < srcStart {
+			// Only additions so far: anchor the empty source range here
+			srcStart, srcEnd = srcLine+1, srcLine
+		}
+	}
+
+	return scoped, srcStart, srcEnd, changed
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLineLogFollowsShiftedRange(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	commitTestFiles(t, repo, "Add f", map[string]string{"f.txt": "1\n2\n3\n4\n5\n"})
+	commitTestFiles(t, repo, "First edit", map[string]string{"f.txt": "1\n2\nthree\n4\n5\n"})
+	commitTestFiles(t, repo, "Insert above", map[string]string{"f.txt": "a\nb\n1\n2\nthree\n4\n5\n"})
+	commitTestFiles(t, repo, "Unrelated edit", map[string]string{"f.txt": "a\nb\n1\n2\nthree\n4\nfive\n"})
+	commitTestFiles(t, repo, "Second edit", map[string]string{"f.txt": "a\nb\n1\n2\nTHREE\n4\nfive\n"})
+
+	rec := serve(t, gs.lineLogHandler, "GET", "/git/p/line-log?path=f.txt&start=5&end=5", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Commits []LineLogEntry `json:"commits"`
+	}
+	decodeBody(t, rec, &body)
+
+	want := []struct {
+		message    string
+		start, end int
+	}{
+		{"Second edit", 5, 5},
+		{"First edit", 3, 3},
+		{"Add f", 3, 3},
+	}
+	if len(body.Commits) != len(want) {
+		t.Fatalf("got %d commits, want %d: %s", len(body.Commits), len(want), rec.Body.String())
+	}
+	for i, w := range want {
+		got := body.Commits[i]
+		if strings.TrimSpace(got.Commit.Message) != w.message || got.Start != w.start || got.End != w.end {
+			t.Errorf("commit %d: %q lines %d-%d, want %q lines %d-%d", i, got.Commit.Message, got.Start, got.End, w.message, w.start, w.end)
+		}
+	}
+	if !strings.Contains(body.Commits[0].Patch, "-three") || !strings.Contains(body.Commits[0].Patch, "+THREE") {
+		t.Errorf("patch of the second edit:\n%s", body.Commits[0].Patch)
+	}
+
+	rec = serve(t, gs.lineLogHandler, "GET", "/git/p/line-log?path=f.txt&start=5&end=9", project("p"), nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
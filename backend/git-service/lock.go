@@ -0,0 +1,21 @@
+package main
+
+import "sync"
+
+// lockProject acquires the per-project lock and returns its release function.
+// Operations that read a consistent snapshot or mutate a repository hold it
+// so they never interleave with each other on the same project. Holders open
+// the repository with openLockedRepository, which hands them the cached
+// handle no other goroutine can be using.
+func (gs *GitService) lockProject(projectID string) func() {
+	gs.locksMu.Lock()
+	mu, ok := gs.locks[projectID]
+	if !ok {
+		mu = &sync.Mutex{}
+		gs.locks[projectID] = mu
+	}
+	gs.locksMu.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
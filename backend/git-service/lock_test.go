@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Commits racing on one project are serialized by the project lock, and
+// each sees the previous one's result through the cached handle
+func TestConcurrentCommitsAreSerialized(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+
+	const commits = 8
+	for i := 0; i < commits; i++ {
+		writeFiles(t, repo, map[string]string{fmt.Sprintf("file%d.txt", i): fmt.Sprintf("%d\n", i)})
+	}
+
+	var wg sync.WaitGroup
+	codes := make([]int, commits)
+	for i := 0; i < commits; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = serve(t, gs.commitHandler, "POST", "/git/p/commit", project("p"), CommitRequest{
+				Message: fmt.Sprintf("Add file %d", i),
+				Files:   []string{fmt.Sprintf("file%d.txt", i)},
+				Author:  Author{Name: "Test User", Email: "test@example.com"},
+			}).Code
+		}(i)
+	}
+	wg.Wait()
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("commit %d: status %d", i, code)
+		}
+	}
+
+	// One linear chain holding every file means no commit lost another's
+	// index update
+	repo, err := gs.openRepository("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < commits; i++ {
+		if _, err := tree.File(fmt.Sprintf("file%d.txt", i)); err != nil {
+			t.Errorf("file%d.txt missing from HEAD: %v", i, err)
+		}
+	}
+	length := 1
+	for commit.NumParents() > 0 {
+		if commit.NumParents() != 1 {
+			t.Fatalf("commit %s has %d parents", commit.Hash, commit.NumParents())
+		}
+		if commit, err = commit.Parent(0); err != nil {
+			t.Fatal(err)
+		}
+		length++
+	}
+	if length != commits+1 {
+		t.Errorf("history has %d commits, want %d", length, commits+1)
+	}
+
+	status, err := gs.getRepositoryStatus(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Clean {
+		t.Errorf("worktree not clean after the commits: %+v", status)
+	}
+	runGit(t, gs.getProjectPath("p"), "fsck", "--strict")
+
+	// The next lock holder's cached handle sees the final HEAD
+	unlock := gs.lockProject("p")
+	defer unlock()
+	cached, err := gs.openLockedRepository("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cachedHead, err := cached.Head(); err != nil || cachedHead.Hash() != head.Hash() {
+		t.Errorf("cached handle HEAD = %v (%v), want %s", cachedHead, err, head.Hash())
+	}
+}
+
+// Read-only handlers do not take the lock, so a long write does not hold
+// them up
+func TestReadsDoNotWaitForTheProjectLock(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "p")
+
+	unlock := gs.lockProject("p")
+	defer unlock()
+	done := make(chan int, 1)
+	go func() {
+		done <- serve(t, gs.statusHandler, "GET", "/git/p/status", project("p"), nil).Code
+	}()
+	select {
+	case code := <-done:
+		if code != http.StatusOK {
+			t.Errorf("status %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("status waited for the project lock")
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// requestIDHeader carries a request's correlation id, both ways
+const requestIDHeader = "X-Request-ID"
+
+// clientRequestID is the shape of a request id a client may pass in; anything
+// else is replaced so it cannot forge log lines
+var clientRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type requestIDKey struct{}
+
+// newLogger builds the service's structured logger. LOG_FORMAT=text switches
+// from JSON to logfmt-style lines and LOG_LEVEL=debug lowers the threshold.
+func newLogger() *slog.Logger {
+	level := slog.LevelInfo
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		level = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if os.Getenv("LOG_FORMAT") == "text" {
+		return slog.New(slog.NewTextHandler(os.Stderr, opts))
+	}
+	return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+}
+
+// newRequestID generates a random correlation id
+func newRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
+// requestID returns the correlation id of a request, if it has one
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestRecorder remembers what a handler answered so the request can be
+// logged once it is done
+type requestRecorder struct {
+	http.ResponseWriter
+	status  int
+	message string
+	err     error
+}
+
+func (rec *requestRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *requestRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(p)
+}
+
+// Flush keeps Server-Sent Events working through the recorder
+func (rec *requestRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (rec *requestRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// recordError attaches the error behind a response to the request's log line
+func recordError(w http.ResponseWriter, message string, err error) {
+	if rec, ok := w.(*requestRecorder); ok {
+		rec.message = message
+		rec.err = err
+	}
+}
+
+// logRequests gives every request a correlation id, returned in the
+// X-Request-ID header, and logs the request's outcome and duration once it
+// has been handled
+func (gs *GitService) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(requestIDHeader)
+		if !clientRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		rec := &requestRecorder{ResponseWriter: w}
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		attrs := []any{
+			"requestId", id,
+			"method", r.Method,
+			"route", route,
+			"status", status,
+			"durationMs", time.Since(start).Milliseconds(),
+		}
+		if projectID := mux.Vars(r)["projectId"]; projectID != "" {
+			attrs = append(attrs, "projectId", projectID)
+		}
+		if rec.message != "" {
+			attrs = append(attrs, "message", rec.message)
+		}
+		if rec.err != nil {
+			attrs = append(attrs, "error", rec.err.Error())
+		}
+
+		switch {
+		case status >= 500:
+			gs.logger.Error("request failed", attrs...)
+		case status >= 400:
+			gs.logger.Warn("request rejected", attrs...)
+		default:
+			gs.logger.Info("request handled", attrs...)
+		}
+	})
+}
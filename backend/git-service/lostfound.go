@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+)
+
+// maxReachableCommits bounds the walk used to decide which commits refs still reach
+const maxReachableCommits = 100000
+
+// LostCommit represents a commit only reachable through the reflog
+type LostCommit struct {
+	Commit        *Commit                `json:"commit"`
+	Ref           plumbing.ReferenceName `json:"ref"`
+	ReflogMessage string                 `json:"reflogMessage"`
+	ReflogDate    time.Time              `json:"reflogDate"`
+}
+
+// List commits only reachable from the reflog endpoint
+func (gs *GitService) lostFoundHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	reflogs, err := gs.readAllReflogs(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read reflog", http.StatusInternalServerError)
+		return
+	}
+
+	reachable, truncated, err := reachableCommits(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to walk repository history", http.StatusInternalServerError)
+		return
+	}
+
+	// Keep the most recent reflog mention of every commit refs no longer reach
+	lost := make(map[plumbing.Hash]*LostCommit)
+	for ref, entries := range reflogs {
+		for _, entry := range entries {
+			for _, hex := range []string{entry.OldHash, entry.NewHash} {
+				hash := plumbing.NewHash(hex)
+				if hash.IsZero() || reachable[hash] {
+					continue
+				}
+				if existing, ok := lost[hash]; ok && !entry.Date.After(existing.ReflogDate) {
+					continue
+				}
+				commit, err := repo.CommitObject(hash)
+				if err != nil {
+					// Already garbage collected
+					continue
+				}
+				lost[hash] = &LostCommit{
+					Commit:        newCommitInfo(commit),
+					Ref:           ref,
+					ReflogMessage: entry.Message,
+					ReflogDate:    entry.Date,
+				}
+			}
+		}
+	}
+
+	commits := make([]*LostCommit, 0, len(lost))
+	for _, c := range lost {
+		commits = append(commits, c)
+	}
+	sort.Slice(commits, func(i, j int) bool {
+		return commits[i].Commit.Date.After(commits[j].Commit.Date)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"commits":   commits,
+		"truncated": truncated,
+	})
+}
+
+// Create a branch at a lost commit endpoint
+func (gs *GitService) recoverLostCommitHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req struct {
+		Hash   string `json:"hash"`
+		Branch string `json:"branch"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Hash == "" || req.Branch == "" {
+		gs.sendError(w, "Hash and branch are required", http.StatusBadRequest)
+		return
+	}
+	if err := validateRefName(req.Branch); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid branch name: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	commit, err := gs.resolveCommit(repo, req.Hash)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Commit %s not found", req.Hash), http.StatusNotFound)
+		return
+	}
+
+	branchRef := plumbing.NewBranchReferenceName(req.Branch)
+	if _, err := repo.Reference(branchRef, false); err == nil {
+		gs.sendError(w, fmt.Sprintf("Branch '%s' already exists", req.Branch), http.StatusConflict)
+		return
+	}
+
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(branchRef, commit.Hash)); err != nil {
+		gs.sendError(w, "Failed to create branch", http.StatusInternalServerError)
+		return
+	}
+	gs.appendReflog(projectID, branchRef, plumbing.ZeroHash, commit.Hash, gs.resolveIdentity(projectID), "branch: Created from "+commit.Hash.String())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Branch '%s' created at %s", req.Branch, commit.Hash.String()[:7]),
+		"branch":  req.Branch,
+		"commit":  newCommitInfo(commit),
+	})
+}
+
+// reachableCommits returns every commit reachable from any ref, stopping
+// after maxReachableCommits
+func reachableCommits(repo *git.Repository) (map[plumbing.Hash]bool, bool, error) {
+	seen := make(map[plumbing.Hash]bool)
+
+	refs, err := repo.References()
+	if err != nil {
+		return nil, false, err
+	}
+
+	var stack []plumbing.Hash
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			stack = append(stack, ref.Hash())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[hash] {
+			continue
+		}
+		if len(seen) >= maxReachableCommits {
+			return seen, true, nil
+		}
+
+		obj, err := repo.Object(plumbing.AnyObject, hash)
+		if err != nil {
+			continue
+		}
+		seen[hash] = true
+
+		switch o := obj.(type) {
+		case *object.Commit:
+			stack = append(stack, o.ParentHashes...)
+		case *object.Tag:
+			stack = append(stack, o.Target)
+		}
+	}
+
+	return seen, false, nil
+}
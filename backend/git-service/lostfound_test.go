@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func lostCommits(t *testing.T, gs *GitService) []LostCommit {
+	t.Helper()
+	rec := serve(t, gs.lostFoundHandler, "GET", "/git/p/lost-found", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Commits []LostCommit `json:"commits"`
+	}
+	decodeBody(t, rec, &body)
+	return body.Commits
+}
+
+func TestLostFoundAfterHardReset(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	initial := refHash(t, repo, "HEAD")
+	writeFiles(t, repo, map[string]string{"a.txt": "two\n"})
+	expectStatus(t, serveCommit(t, gs, CommitRequest{Message: "Soon lost"}), http.StatusOK)
+	lostHash := refHash(t, repo, "HEAD")
+
+	if lost := lostCommits(t, gs); len(lost) != 0 {
+		t.Fatalf("lost commits before the reset: %+v", lost)
+	}
+
+	// Reset behind the service's back, so only its reflog remembers the commit
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := worktree.Reset(&git.ResetOptions{Commit: initial, Mode: git.HardReset}); err != nil {
+		t.Fatal(err)
+	}
+
+	lost := lostCommits(t, gs)
+	if len(lost) != 1 || lost[0].Commit.Hash != lostHash.String() {
+		t.Fatalf("lost commits %+v, want only %s", lost, lostHash)
+	}
+	if lost[0].Ref != "HEAD" && lost[0].Ref != "refs/heads/master" {
+		t.Errorf("found through %s, want the HEAD or master reflog", lost[0].Ref)
+	}
+
+	rec := serve(t, gs.recoverLostCommitHandler, "POST", "/git/p/lost-found/recover", project("p"), map[string]string{"hash": lostHash.String(), "branch": "rescued"})
+	expectStatus(t, rec, http.StatusOK)
+	if got := refHash(t, repo, "refs/heads/rescued"); got != lostHash {
+		t.Errorf("rescued = %s, want %s", got, lostHash)
+	}
+	if lost := lostCommits(t, gs); len(lost) != 0 {
+		t.Errorf("a recovered commit is still listed: %+v", lost)
+	}
+}
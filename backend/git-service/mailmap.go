@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// mailmapEntry maps a commit identity to a canonical one. An empty
+// commitName matches any name used with commitEmail.
+type mailmapEntry struct {
+	properName, properEmail string
+	commitName, commitEmail string
+}
+
+// mailmap canonicalizes author and committer identities like git's .mailmap
+type mailmap struct {
+	entries []mailmapEntry
+}
+
+// loadMailmap reads .mailmap from the working tree, falling back to the copy
+// committed at HEAD for bare repositories. A missing file yields an empty map.
+func (gs *GitService) loadMailmap(projectID string, repo *git.Repository) *mailmap {
+	if data, err := os.ReadFile(filepath.Join(gs.getProjectPath(projectID), ".mailmap")); err == nil {
+		return parseMailmap(string(data))
+	}
+
+	if commit, err := gs.resolveCommit(repo, ""); err == nil {
+		if file, err := commit.File(".mailmap"); err == nil {
+			if content, err := file.Contents(); err == nil {
+				return parseMailmap(content)
+			}
+		}
+	}
+	return &mailmap{}
+}
+
+// parseMailmap parses the .mailmap format:
+//
+//	Proper Name <commit@email>
+//	<proper@email> <commit@email>
+//	Proper Name <proper@email> <commit@email>
+//	Proper Name <proper@email> Commit Name <commit@email>
+func parseMailmap(content string) *mailmap {
+	m := &mailmap{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		var names, emails []string
+		rest := line
+		for {
+			open := strings.Index(rest, "<")
+			if open < 0 {
+				break
+			}
+			end := strings.Index(rest[open:], ">")
+			if end < 0 {
+				break
+			}
+			names = append(names, strings.TrimSpace(rest[:open]))
+			emails = append(emails, strings.TrimSpace(rest[open+1:open+end]))
+			rest = rest[open+end+1:]
+		}
+
+		switch len(emails) {
+		case 1:
+			m.entries = append(m.entries, mailmapEntry{properName: names[0], commitEmail: emails[0]})
+		case 2:
+			m.entries = append(m.entries, mailmapEntry{
+				properName:  names[0],
+				properEmail: emails[0],
+				commitName:  names[1],
+				commitEmail: emails[1],
+			})
+		}
+	}
+	return m
+}
+
+// resolve returns the canonical identity for a name and email. Entries that
+// also match the name take precedence over email-only entries.
+func (m *mailmap) resolve(name, email string) (string, string) {
+	var match *mailmapEntry
+	for i := range m.entries {
+		e := &m.entries[i]
+		if !strings.EqualFold(e.commitEmail, email) {
+			continue
+		}
+		if e.commitName != "" {
+			if strings.EqualFold(e.commitName, name) {
+				match = e
+				break
+			}
+			continue
+		}
+		if match == nil {
+			match = e
+		}
+	}
+	if match == nil {
+		return name, email
+	}
+
+	if match.properName != "" {
+		name = match.properName
+	}
+	if match.properEmail != "" {
+		email = match.properEmail
+	}
+	return name, email
+}
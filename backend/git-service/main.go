@@ -1,28 +1,52 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 )
 
 // GitService represents the Git service
 type GitService struct {
-	workspaceDir string
+	workspaceDir  string
+	stateMu       sync.Mutex
+	locksMu       sync.Mutex
+	locks         map[string]*sync.Mutex
+	operationsMu  sync.Mutex
+	operations    map[string]*operation
+	countsMu      sync.Mutex
+	commitCounts  map[string]commitCount
+	statsMu       sync.Mutex
+	stats         map[string]*RepositoryStats
+	logger        *slog.Logger
+	draining      atomic.Bool
+	repos         *repoCache
+	readRepos     *repoCache
+	remoteTimeout time.Duration
 }
 
 // Repository represents a Git repository
@@ -42,6 +66,7 @@ type Commit struct {
 	Hash      string    `json:"hash"`
 	Message   string    `json:"message"`
 	Author    Author    `json:"author"`
+	Committer Author    `json:"committer"`
 	Date      time.Time `json:"date"`
 	Files     []string  `json:"files"`
 }
@@ -58,8 +83,9 @@ type Status struct {
 	StagedFiles  []string `json:"stagedFiles"`
 	ModifiedFiles []string `json:"modifiedFiles"`
 	UntrackedFiles []string `json:"untrackedFiles"`
-	Ahead        int      `json:"ahead"`
-	Behind       int      `json:"behind"`
+	Renames      []*RenamedFile `json:"renames,omitempty"`
+	Ahead        *int     `json:"ahead,omitempty"`
+	Behind       *int     `json:"behind,omitempty"`
 }
 
 // Branch represents a Git branch
@@ -67,8 +93,8 @@ type Branch struct {
 	Name      string  `json:"name"`
 	IsActive  bool    `json:"isActive"`
 	LastCommit *Commit `json:"lastCommit"`
-	Ahead     int     `json:"ahead"`
-	Behind    int     `json:"behind"`
+	Ahead     *int    `json:"ahead,omitempty"`
+	Behind    *int    `json:"behind,omitempty"`
 }
 
 // CloneRequest represents a repository clone request
@@ -76,19 +102,47 @@ type CloneRequest struct {
 	URL       string `json:"url"`
 	ProjectID string `json:"projectId"`
 	Branch    string `json:"branch,omitempty"`
+	OperationID string `json:"operationId,omitempty"`
+	Auth *RemoteAuth `json:"auth,omitempty"`
+
+	// Depth limits the clone to that many commits of history. go-git only
+	// partly supports shallow repositories: walking past the shallow
+	// boundary fails, so log, blame, merge bases, ahead/behind counts and
+	// pushes of new history may error or come back incomplete.
+	Depth int `json:"depth,omitempty"`
+
+	// SingleBranch overrides whether only Branch (or the remote HEAD) is
+	// fetched. It defaults to true when Branch is set.
+	SingleBranch *bool `json:"singleBranch,omitempty"`
 }
 
-// CommitRequest represents a commit request
+// CommitRequest represents a commit request. Author is optional: whatever
+// it leaves out is taken from user.name and user.email in git config.
 type CommitRequest struct {
 	Message string   `json:"message"`
 	Files   []string `json:"files,omitempty"`
 	Author  Author   `json:"author"`
+	Amend   bool     `json:"amend,omitempty"`
+	DryRun  bool     `json:"dryRun,omitempty"`
+
+	// AllowConflictMarkers commits files that still contain conflict markers
+	AllowConflictMarkers bool `json:"allowConflictMarkers,omitempty"`
+
+	// Committer defaults to the author
+	Committer *Author `json:"committer,omitempty"`
+
+	// Force amends a commit the upstream branch already contains
+	Force bool `json:"force,omitempty"`
 }
 
 // PushRequest represents a push request
 type PushRequest struct {
-	Remote string `json:"remote,omitempty"`
-	Branch string `json:"branch,omitempty"`
+	Remote         string      `json:"remote,omitempty"`
+	Branch         string      `json:"branch,omitempty"`
+	ForceWithLease bool        `json:"forceWithLease,omitempty"`
+	ExpectedHash   string      `json:"expectedHash,omitempty"`
+	OperationID    string      `json:"operationId,omitempty"`
+	Auth           *RemoteAuth `json:"auth,omitempty"`
 }
 
 // ErrorResponse represents an error response
@@ -101,16 +155,36 @@ type ErrorResponse struct {
 // NewGitService creates a new Git service instance
 func NewGitService(workspaceDir string) *GitService {
 	return &GitService{
-		workspaceDir: workspaceDir,
+		workspaceDir:  workspaceDir,
+		locks:         make(map[string]*sync.Mutex),
+		operations:    make(map[string]*operation),
+		commitCounts:  make(map[string]commitCount),
+		stats:         make(map[string]*RepositoryStats),
+		logger:        slog.Default(),
+		repos:         repoCacheFromEnv(),
+		readRepos:     repoCacheFromEnv(),
+		remoteTimeout: remoteTimeoutFromEnv(),
 	}
 }
 
-// getProjectPath returns the file system path for a project
+// getProjectPath returns the file system path for a project. An id that is
+// not a plain directory name, or whose path would land outside the
+// workspace, maps to invalidProjectPath.
 func (gs *GitService) getProjectPath(projectID string) string {
-	return filepath.Join(gs.workspaceDir, projectID)
+	if validateProjectID(projectID) != nil {
+		return invalidProjectPath
+	}
+	projectPath := filepath.Join(gs.workspaceDir, projectID)
+	if rel, err := filepath.Rel(filepath.Clean(gs.workspaceDir), projectPath); err != nil || rel != projectID {
+		return invalidProjectPath
+	}
+	return projectPath
 }
 
-// openRepository opens a Git repository
+// openRepository opens a Git repository. Every call gets its own handle:
+// go-git's storage is not safe for concurrent use, and readers run without
+// the project lock. Lock holders use openLockedRepository instead, and
+// frequent readers openReadRepository.
 func (gs *GitService) openRepository(projectID string) (*git.Repository, error) {
 	projectPath := gs.getProjectPath(projectID)
 	return git.PlainOpen(projectPath)
@@ -141,45 +215,158 @@ func (gs *GitService) cloneHandler(w http.ResponseWriter, r *http.Request) {
 		gs.sendError(w, "URL and projectId are required", http.StatusBadRequest)
 		return
 	}
+	if err := validateProjectID(req.ProjectID); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid project id: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Branch != "" {
+		if err := validateRefName(req.Branch); err != nil {
+			gs.sendError(w, fmt.Sprintf("Invalid branch name: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.Depth < 0 {
+		gs.sendError(w, "depth must not be negative", http.StatusBadRequest)
+		return
+	}
+	force := false
+	if value := r.URL.Query().Get("force"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			gs.sendError(w, "Invalid force value", http.StatusBadRequest)
+			return
+		}
+		force = parsed
+	}
+
+	auth, err := remoteAuth(req.URL, req.Auth)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid auth: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(req.ProjectID)
+	defer unlock()
 
 	projectPath := gs.getProjectPath(req.ProjectID)
-	
+
+	// An existing repository is only replaced when asked to; otherwise the
+	// client learns where it points so it can pull instead
+	if existing, err := gs.openLockedRepository(req.ProjectID); err == nil {
+		if !force {
+			remoteURL, sameURL := "", false
+			if cfg, err := existing.Config(); err == nil {
+				if remote, ok := cfg.Remotes[pushDefaultRemote(cfg)]; ok && len(remote.URLs) > 0 {
+					remoteURL = redactSecrets(remote.URLs[0], nil)
+					sameURL = remote.URLs[0] == req.URL
+				}
+			}
+			gs.sendErrorWithDetails(w, fmt.Sprintf("A repository already exists for project %s; pull to update it or set force=true to re-clone", req.ProjectID), http.StatusConflict, map[string]interface{}{
+				"projectId": req.ProjectID,
+				"remoteUrl": remoteURL,
+				"sameUrl":   sameURL,
+			})
+			return
+		}
+		if err := gs.removeProject(req.ProjectID); err != nil {
+			gs.sendInternalError(w, "Failed to remove the existing repository", err)
+			return
+		}
+	}
+
+	// A failed clone leaves nothing behind in a directory created for it,
+	// so a retry does not find a half-written repository there. go-git only
+	// empties a directory that was already there.
+	_, statErr := os.Stat(projectPath)
+	created := os.IsNotExist(statErr)
+	cleanup := func() {
+		if !created {
+			return
+		}
+		if err := os.RemoveAll(projectPath); err != nil {
+			gs.logger.Warn("failed to remove partial clone", "projectId", req.ProjectID, "error", err)
+		}
+	}
+
 	// Ensure directory exists
 	if err := os.MkdirAll(projectPath, 0755); err != nil {
+		cleanup()
 		gs.sendError(w, "Failed to create project directory", http.StatusInternalServerError)
 		return
 	}
 
+	op, err := gs.startOperation(req.OperationID, req.ProjectID, "clone")
+	if err != nil {
+		cleanup()
+		gs.sendError(w, err.Error(), http.StatusConflict)
+		return
+	}
+
 	// Clone options
 	cloneOptions := &git.CloneOptions{
-		URL:      req.URL,
-		Progress: os.Stdout,
+		URL:   req.URL,
+		Auth:  auth,
+		Depth: req.Depth,
 	}
 
 	if req.Branch != "" {
 		cloneOptions.ReferenceName = plumbing.ReferenceName("refs/heads/" + req.Branch)
 		cloneOptions.SingleBranch = true
 	}
+	if req.SingleBranch != nil {
+		cloneOptions.SingleBranch = *req.SingleBranch
+	}
 
 	// Clone repository
-	repo, err := git.PlainClone(projectPath, false, cloneOptions)
-	if err != nil {
-		gs.sendError(w, fmt.Sprintf("Failed to clone repository: %v", err), http.StatusInternalServerError)
+	clone := func(ctx context.Context, progress io.Writer) (interface{}, error) {
+		ctx, cancel := gs.remoteContext(ctx)
+		defer cancel()
+		cloneOptions.Progress = io.MultiWriter(os.Stdout, op, progress)
+		repo, err := git.PlainCloneContext(ctx, projectPath, false, cloneOptions)
+		err = redactError(timeoutError(ctx, err), req.Auth)
+		gs.finishOperation(op, err)
+		if err != nil {
+			cleanup()
+			return nil, fmt.Errorf("Failed to clone repository: %w", err)
+		}
+
+		// Get repository info
+		repoInfo, err := gs.getRepositoryInfo(repo, req.ProjectID)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get repository info")
+		}
+		// Clients warn before history-dependent operations on a shallow clone
+		shallow, err := repo.Storer.Shallow()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read shallow commits")
+		}
+		return map[string]interface{}{
+			"message":      "Repository cloned successfully",
+			"repository":   repoInfo,
+			"shallow":      len(shallow) > 0,
+			"singleBranch": cloneOptions.SingleBranch,
+			"operationId":  op.snapshot().ID,
+		}, nil
+	}
+
+	// With Accept: text/event-stream the progress is streamed as it arrives
+	if wantsEventStream(r) {
+		gs.streamOperation(w, r, op, clone)
 		return
 	}
 
-	// Get repository info
-	repoInfo, err := gs.getRepositoryInfo(repo, req.ProjectID)
-	if err != nil {
-		gs.sendError(w, "Failed to get repository info", http.StatusInternalServerError)
+	result, err := clone(r.Context(), io.Discard)
+	if errors.Is(err, git.ErrRepositoryAlreadyExists) {
+		gs.sendError(w, fmt.Sprintf("A repository already exists for project %s", req.ProjectID), http.StatusConflict)
+		return
+	} else if err != nil {
+		gs.sendError(w, err.Error(), remoteErrorStatus(err, http.StatusInternalServerError))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message":    "Repository cloned successfully",
-		"repository": repoInfo,
-	})
+	json.NewEncoder(w).Encode(result)
 }
 
 // Get repository status endpoint
@@ -187,11 +374,23 @@ func (gs *GitService) statusHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	projectID := vars["projectId"]
 
-	repo, err := gs.openRepository(projectID)
+	repo, release, err := gs.openReadRepository(projectID)
 	if err != nil {
 		gs.sendError(w, "Repository not found", http.StatusNotFound)
 		return
 	}
+	defer release()
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+	renames, threshold, err := parseRenameOptions(r.URL.Query(), settings)
+	if err != nil {
+		gs.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	status, err := gs.getRepositoryStatus(repo)
 	if err != nil {
@@ -199,6 +398,27 @@ func (gs *GitService) statusHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if renames {
+		status.Renames, err = gs.stagedRenames(repo, threshold)
+		if err != nil {
+			gs.sendError(w, "Failed to detect renames", http.StatusInternalServerError)
+			return
+		}
+
+		// A staged rename is reported once, under its new path
+		renamedFrom := make(map[string]bool, len(status.Renames))
+		for _, rename := range status.Renames {
+			renamedFrom[rename.From] = true
+		}
+		staged := status.StagedFiles[:0]
+		for _, file := range status.StagedFiles {
+			if !renamedFrom[file] {
+				staged = append(staged, file)
+			}
+		}
+		status.StagedFiles = staged
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status": status,
@@ -210,11 +430,12 @@ func (gs *GitService) infoHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	projectID := vars["projectId"]
 
-	repo, err := gs.openRepository(projectID)
+	repo, release, err := gs.openReadRepository(projectID)
 	if err != nil {
 		gs.sendError(w, "Repository not found", http.StatusNotFound)
 		return
 	}
+	defer release()
 
 	repoInfo, err := gs.getRepositoryInfo(repo, projectID)
 	if err != nil {
@@ -238,30 +459,116 @@ func (gs *GitService) commitHandler(w http.ResponseWriter, r *http.Request) {
 		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	gs.commitChanges(w, projectID, req)
+}
+
+// Amend last commit endpoint
+func (gs *GitService) amendHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req CommitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Amend = true
+	gs.commitChanges(w, projectID, req)
+}
 
-	if req.Message == "" {
+// commitChanges stages the requested files and commits them, or amends HEAD
+func (gs *GitService) commitChanges(w http.ResponseWriter, projectID string, req CommitRequest) {
+	// An amend keeps the previous message unless a new one is given
+	if req.Message == "" && !req.Amend {
 		gs.sendError(w, "Commit message is required", http.StatusBadRequest)
 		return
 	}
 
-	repo, err := gs.openRepository(projectID)
+	if req.DryRun && !req.Amend {
+		gs.sendError(w, "dryRun is only supported with amend", http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
 	if err != nil {
 		gs.sendError(w, "Repository not found", http.StatusNotFound)
 		return
 	}
 
+	// Fall back to the configured identity (local, global or system) for
+	// any part of the author the request leaves out
+	author := gs.fillIdentity(projectID, req.Author)
+	if author.Name == "" || author.Email == "" {
+		gs.sendError(w, missingIdentityMessage, http.StatusBadRequest)
+		return
+	}
+	committer := author
+	if req.Committer != nil {
+		if req.Committer.Name == "" || req.Committer.Email == "" {
+			gs.sendError(w, "Committer needs both a name and an email", http.StatusBadRequest)
+			return
+		}
+		committer = *req.Committer
+	}
+
+	if req.DryRun {
+		gs.previewAmend(w, projectID, repo, req, committer)
+		return
+	}
+
+	// Rewriting a commit the upstream already has forces everyone else to
+	// reconcile with the new history
+	if req.Amend && !req.Force {
+		upstream, err := headUpstream(repo)
+		if err != nil {
+			gs.sendError(w, "Failed to check upstream branch", http.StatusInternalServerError)
+			return
+		}
+		if upstream != nil {
+			gs.sendErrorWithDetails(w, fmt.Sprintf("HEAD has already been pushed to %s; set force to true to amend it anyway", upstream.Name().Short()), http.StatusConflict, map[string]interface{}{
+				"upstream": upstream.Name().Short(),
+			})
+			return
+		}
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+	if settings.RequireSignedCommits {
+		gs.sendError(w, unsignedCommitMessage, http.StatusUnprocessableEntity)
+		return
+	}
+
 	worktree, err := repo.Worktree()
 	if err != nil {
 		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
 		return
 	}
 
+	mergeHead, merging := gs.readMergeHead(projectID)
+	if merging && req.Amend {
+		gs.sendError(w, "A merge is in progress; commit it before amending", http.StatusConflict)
+		return
+	}
+
+	// Staging a conflicted file resolves it
+	if err := resolveConflictStages(repo, worktree, req.Files); err != nil {
+		gs.sendError(w, "Failed to update index", http.StatusInternalServerError)
+		return
+	}
+
 	// Stage files
 	if len(req.Files) > 0 {
 		for _, file := range req.Files {
 			_, err := worktree.Add(file)
 			if err != nil {
-				gs.sendError(w, fmt.Sprintf("Failed to stage file %s: %v", file, err), http.StatusInternalServerError)
+				gs.sendInternalError(w, fmt.Sprintf("Failed to stage file %s", file), err)
 				return
 			}
 		}
@@ -272,20 +579,76 @@ func (gs *GitService) commitHandler(w http.ResponseWriter, r *http.Request) {
 			gs.sendError(w, "Failed to stage changes", http.StatusInternalServerError)
 			return
 		}
+		if err := stageDeletions(worktree); err != nil {
+			gs.sendError(w, "Failed to stage deletions", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	unmerged, err := unmergedPaths(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+	if len(unmerged) > 0 {
+		gs.sendErrorWithDetails(w, "Unmerged paths remain; stage them to mark them resolved", http.StatusConflict, map[string]interface{}{
+			"files": unmerged,
+		})
+		return
+	}
+
+	// Refuse to commit unresolved conflicts unless the caller insists
+	if !req.AllowConflictMarkers {
+		files, err := stagedConflictMarkers(repo)
+		if err != nil {
+			gs.sendError(w, "Failed to scan staged files", http.StatusInternalServerError)
+			return
+		}
+		if len(files) > 0 {
+			gs.sendErrorWithDetails(w, "Staged files contain conflict markers", http.StatusUnprocessableEntity, map[string]interface{}{
+				"files": files,
+			})
+			return
+		}
+	}
+
+	if req.Amend {
+		gs.amendHead(w, projectID, repo, req, committer)
+		return
+	}
+
+	oldHead := plumbing.ZeroHash
+	if head, err := repo.Head(); err == nil {
+		oldHead = head.Hash()
 	}
 
 	// Create commit
-	commit, err := worktree.Commit(req.Message, &git.CommitOptions{
+	now := time.Now()
+	commitOptions := &git.CommitOptions{
 		Author: &object.Signature{
-			Name:  req.Author.Name,
-			Email: req.Author.Email,
-			When:  time.Now(),
+			Name:  author.Name,
+			Email: author.Email,
+			When:  now,
 		},
-	})
+		Committer: &object.Signature{
+			Name:  committer.Name,
+			Email: committer.Email,
+			When:  now,
+		},
+	}
+	// Committing during a merge concludes it
+	if merging && !oldHead.IsZero() {
+		commitOptions.Parents = []plumbing.Hash{oldHead, mergeHead}
+	}
+	commit, err := worktree.Commit(req.Message, commitOptions)
 	if err != nil {
 		gs.sendError(w, "Failed to create commit", http.StatusInternalServerError)
 		return
 	}
+	if merging {
+		gs.clearMergeState(projectID)
+	}
+	gs.logCommit(projectID, repo, oldHead, commit, committer, req.Message)
 
 	// Get commit object
 	commitObj, err := repo.CommitObject(commit)
@@ -294,14 +657,10 @@ func (gs *GitService) commitHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	commitInfo := &Commit{
-		Hash:    commit.String(),
-		Message: commitObj.Message,
-		Author: Author{
-			Name:  commitObj.Author.Name,
-			Email: commitObj.Author.Email,
-		},
-		Date: commitObj.Author.When,
+	commitInfo := newCommitInfo(commitObj)
+	// The commit is already made, so a failure here only leaves Files empty
+	if commitInfo.Files, err = commitFiles(commitObj); err != nil {
+		gs.logger.Warn("failed to list commit files", "projectId", projectID, "commit", commit.String(), "error", err)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -321,8 +680,17 @@ func (gs *GitService) pushHandler(w http.ResponseWriter, r *http.Request) {
 		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if req.Branch != "" {
+		if err := validateRefName(req.Branch); err != nil {
+			gs.sendError(w, fmt.Sprintf("Invalid branch name: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
 
-	repo, err := gs.openRepository(projectID)
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
 	if err != nil {
 		gs.sendError(w, "Repository not found", http.StatusNotFound)
 		return
@@ -330,25 +698,109 @@ func (gs *GitService) pushHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Push options
 	pushOptions := &git.PushOptions{
-		RemoteName: "origin",
+		RemoteName: req.Remote,
 		Progress:   os.Stdout,
 	}
 
-	if req.Remote != "" {
-		pushOptions.RemoteName = req.Remote
+	if req.Remote == "" {
+		cfg, err := repo.Config()
+		if err != nil {
+			gs.sendError(w, "Failed to read git config", http.StatusInternalServerError)
+			return
+		}
+		pushOptions.RemoteName = pushDefaultRemote(cfg)
+	}
+
+	pushOptions.Auth, err = remoteAuthFor(repo, pushOptions.RemoteName, req.Auth)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid auth: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Force with lease only overwrites the remote branch if it still points
+	// where the client last saw it
+	var lease *pushLease
+	if req.ForceWithLease {
+		ctx, cancel := gs.remoteContext(r.Context())
+		lease, err = gs.preparePushLease(ctx, repo, pushOptions.RemoteName, req.Branch, req.ExpectedHash, pushOptions.Auth)
+		cancel()
+		if err != nil {
+			var leaseErr *pushLeaseError
+			if errors.As(err, &leaseErr) {
+				gs.sendErrorWithDetails(w, leaseErr.Error(), http.StatusConflict, leaseErr.details())
+				return
+			}
+			gs.sendError(w, fmt.Sprintf("Failed to check push lease: %v", redactError(err, req.Auth)), remoteErrorStatus(err, http.StatusBadRequest))
+			return
+		}
+		pushOptions.RefSpecs = []config.RefSpec{lease.refSpec}
+		pushOptions.ForceWithLease = lease.options
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+	if settings.RejectUnsignedPushes {
+		ctx, cancel := gs.remoteContext(r.Context())
+		unsigned, err := gs.unsignedPushCommits(ctx, repo, pushOptions)
+		cancel()
+		if err != nil {
+			gs.sendError(w, fmt.Sprintf("Failed to check commit signatures: %v", redactError(err, req.Auth)), remoteErrorStatus(err, http.StatusBadGateway))
+			return
+		}
+		if len(unsigned) > 0 {
+			gs.sendErrorWithDetails(w, "Project policy rejects pushing unsigned commits", http.StatusUnprocessableEntity, map[string]interface{}{
+				"unsignedCommits": unsigned,
+			})
+			return
+		}
 	}
 
+	op, err := gs.startOperation(req.OperationID, projectID, "push")
+	if err != nil {
+		gs.sendError(w, err.Error(), http.StatusConflict)
+		return
+	}
 	// Push to remote
-	err = repo.Push(pushOptions)
+	push := func(ctx context.Context, progress io.Writer) (interface{}, error) {
+		ctx, cancel := gs.remoteContext(ctx)
+		defer cancel()
+		pushOptions.Progress = io.MultiWriter(os.Stdout, op, progress)
+		err := timeoutError(ctx, repo.PushContext(ctx, pushOptions))
+		// The lease is checked again against the push's own ref
+		// advertisement, so the branch can still turn out to have moved
+		err = redactError(rejectedPush(ctx, repo, pushOptions.RemoteName, lease, pushOptions.Auth, err), req.Auth)
+		gs.finishOperation(op, err)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to push: %w", err)
+		}
+		return map[string]interface{}{
+			"message":     "Changes pushed successfully",
+			"operationId": op.snapshot().ID,
+		}, nil
+	}
+
+	// With Accept: text/event-stream the progress is streamed as it arrives
+	if wantsEventStream(r) {
+		gs.streamOperation(w, r, op, push)
+		return
+	}
+
+	result, err := push(r.Context(), io.Discard)
 	if err != nil {
-		gs.sendError(w, fmt.Sprintf("Failed to push: %v", err), http.StatusInternalServerError)
+		var leaseErr *pushLeaseError
+		if errors.As(err, &leaseErr) {
+			gs.sendErrorWithDetails(w, err.Error(), http.StatusConflict, leaseErr.details())
+			return
+		}
+		gs.sendError(w, err.Error(), remoteErrorStatus(err, http.StatusInternalServerError))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Changes pushed successfully",
-	})
+	json.NewEncoder(w).Encode(result)
 }
 
 // Get branches endpoint
@@ -356,6 +808,16 @@ func (gs *GitService) branchesHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	projectID := vars["projectId"]
 
+	includeRemotes := false
+	if value := r.URL.Query().Get("includeRemotes"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			gs.sendError(w, "Invalid includeRemotes value", http.StatusBadRequest)
+			return
+		}
+		includeRemotes = parsed
+	}
+
 	repo, err := gs.openRepository(projectID)
 	if err != nil {
 		gs.sendError(w, "Repository not found", http.StatusNotFound)
@@ -367,11 +829,23 @@ func (gs *GitService) branchesHandler(w http.ResponseWriter, r *http.Request) {
 		gs.sendError(w, "Failed to get branches", http.StatusInternalServerError)
 		return
 	}
+	response := map[string]interface{}{
+		"branches": branches,
+	}
+
+	// Remote-tracking branches are listed separately so they are never
+	// mistaken for local ones
+	if includeRemotes {
+		remote, err := remoteBranches(repo)
+		if err != nil {
+			gs.sendError(w, "Failed to get remote branches", http.StatusInternalServerError)
+			return
+		}
+		response["remoteBranches"] = remote
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"branches": branches,
-	})
+	json.NewEncoder(w).Encode(response)
 }
 
 // Create branch endpoint
@@ -379,9 +853,12 @@ func (gs *GitService) createBranchHandler(w http.ResponseWriter, r *http.Request
 	vars := mux.Vars(r)
 	projectID := vars["projectId"]
 
+	// Checkout defaults to true; false only creates the ref, leaving HEAD
+	// and the working tree alone
 	var req struct {
-		Name string `json:"name"`
-		From string `json:"from,omitempty"`
+		Name     string `json:"name"`
+		From     string `json:"from,omitempty"`
+		Checkout *bool  `json:"checkout,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -393,13 +870,73 @@ func (gs *GitService) createBranchHandler(w http.ResponseWriter, r *http.Request
 		gs.sendError(w, "Branch name is required", http.StatusBadRequest)
 		return
 	}
+	if err := validateRefName(req.Name); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid branch name: %v", err), http.StatusBadRequest)
+		return
+	}
 
-	repo, err := gs.openRepository(projectID)
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
 	if err != nil {
 		gs.sendError(w, "Repository not found", http.StatusNotFound)
 		return
 	}
 
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+	if !gs.checkBranchName(w, settings, req.Name) {
+		return
+	}
+
+	branchRef := plumbing.NewBranchReferenceName(req.Name)
+	if _, err := repo.Reference(branchRef, false); err == nil {
+		gs.sendError(w, fmt.Sprintf("Branch '%s' already exists", req.Name), http.StatusConflict)
+		return
+	}
+
+	// From may name a branch, tag or commit; without it the branch starts at
+	// HEAD, which an unborn repository does not have yet
+	var from *object.Commit
+	if req.From != "" {
+		if from, err = gs.resolveCommit(repo, req.From); err != nil {
+			gs.sendError(w, fmt.Sprintf("Cannot resolve from '%s'", req.From), http.StatusBadRequest)
+			return
+		}
+	}
+	startPoint := req.From
+	if startPoint == "" {
+		startPoint = "HEAD"
+	}
+
+	if req.Checkout != nil && !*req.Checkout {
+		commit := from
+		if commit == nil {
+			if commit, err = gs.resolveCommit(repo, ""); err != nil {
+				gs.sendError(w, "Cannot create a branch before the first commit without checking it out", http.StatusBadRequest)
+				return
+			}
+		}
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(branchRef, commit.Hash)); err != nil {
+			gs.sendError(w, "Failed to create branch", http.StatusInternalServerError)
+			return
+		}
+		gs.appendReflog(projectID, branchRef, plumbing.ZeroHash, commit.Hash, gs.resolveIdentity(projectID), "branch: Created from "+startPoint)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":    fmt.Sprintf("Branch '%s' created at %s", req.Name, commit.Hash.String()[:7]),
+			"branch":     req.Name,
+			"commit":     newCommitInfo(commit),
+			"checkedOut": false,
+		})
+		return
+	}
+
 	worktree, err := repo.Worktree()
 	if err != nil {
 		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
@@ -408,21 +945,34 @@ func (gs *GitService) createBranchHandler(w http.ResponseWriter, r *http.Request
 
 	// Create branch options
 	branchOptions := &git.CheckoutOptions{
-		Branch: plumbing.ReferenceName("refs/heads/" + req.Name),
+		Branch: branchRef,
 		Create: true,
 	}
+	if from != nil {
+		branchOptions.Hash = from.Hash
+	}
+
+	previousHead, _ := repo.Head()
 
 	// Checkout new branch
 	err = worktree.Checkout(branchOptions)
 	if err != nil {
-		gs.sendError(w, fmt.Sprintf("Failed to create branch: %v", err), http.StatusInternalServerError)
+		gs.sendInternalError(w, "Failed to create branch", err)
 		return
 	}
+	if from != nil {
+		gs.appendReflog(projectID, branchRef, plumbing.ZeroHash, from.Hash, gs.resolveIdentity(projectID), "branch: Created from "+startPoint)
+	} else if previousHead != nil {
+		gs.appendReflog(projectID, branchRef, plumbing.ZeroHash, previousHead.Hash(), gs.resolveIdentity(projectID), "branch: Created from HEAD")
+	}
+	gs.logCheckout(projectID, repo, previousHead)
+	gs.recordRecentBranch(projectID, req.Name)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": fmt.Sprintf("Branch '%s' created successfully", req.Name),
-		"branch":  req.Name,
+		"message":    fmt.Sprintf("Branch '%s' created successfully", req.Name),
+		"branch":     req.Name,
+		"checkedOut": true,
 	})
 }
 
@@ -432,7 +982,15 @@ func (gs *GitService) switchBranchHandler(w http.ResponseWriter, r *http.Request
 	projectID := vars["projectId"]
 	branchName := vars["branchName"]
 
-	repo, err := gs.openRepository(projectID)
+	if err := validateRefName(branchName); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid branch name: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
 	if err != nil {
 		gs.sendError(w, "Repository not found", http.StatusNotFound)
 		return
@@ -444,14 +1002,18 @@ func (gs *GitService) switchBranchHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	previousHead, _ := repo.Head()
+
 	// Checkout branch
 	err = worktree.Checkout(&git.CheckoutOptions{
 		Branch: plumbing.ReferenceName("refs/heads/" + branchName),
 	})
 	if err != nil {
-		gs.sendError(w, fmt.Sprintf("Failed to switch branch: %v", err), http.StatusInternalServerError)
+		gs.sendInternalError(w, "Failed to switch branch", err)
 		return
 	}
+	gs.logCheckout(projectID, repo, previousHead)
+	gs.recordRecentBranch(projectID, branchName)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -460,7 +1022,9 @@ func (gs *GitService) switchBranchHandler(w http.ResponseWriter, r *http.Request
 	})
 }
 
-// Get commit history endpoint
+// Get commit history endpoint. graph=true adds each commit's parents and the
+// refs pointing at it, for drawing the commit graph; with a path filter the
+// parents are still the real ones, which may fall outside the page.
 func (gs *GitService) historyHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	projectID := vars["projectId"]
@@ -473,6 +1037,41 @@ func (gs *GitService) historyHandler(w http.ResponseWriter, r *http.Request) {
 			limit = l
 		}
 	}
+	skip := 0
+	if skipStr := r.URL.Query().Get("skip"); skipStr != "" {
+		s, err := strconv.Atoi(skipStr)
+		if err != nil || s < 0 {
+			gs.sendError(w, "Invalid skip value", http.StatusBadRequest)
+			return
+		}
+		skip = s
+	}
+
+	filter := historyFilter{Author: strings.ToLower(strings.TrimSpace(r.URL.Query().Get("author")))}
+	if value := r.URL.Query().Get("path"); value != "" {
+		p, ok := repoPath(value)
+		if !ok {
+			gs.sendError(w, fmt.Sprintf("Invalid path %s", value), http.StatusBadRequest)
+			return
+		}
+		filter.Path = p
+	}
+	var err error
+	if filter.Since, err = parseActivityTime(r.URL.Query().Get("since"), false); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid since: %v", err), http.StatusBadRequest)
+		return
+	}
+	if filter.Until, err = parseActivityTime(r.URL.Query().Get("until"), true); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid until: %v", err), http.StatusBadRequest)
+		return
+	}
+	graph := false
+	if value := r.URL.Query().Get("graph"); value != "" {
+		if graph, err = strconv.ParseBool(value); err != nil {
+			gs.sendError(w, "Invalid graph value", http.StatusBadRequest)
+			return
+		}
+	}
 
 	repo, err := gs.openRepository(projectID)
 	if err != nil {
@@ -480,20 +1079,126 @@ func (gs *GitService) historyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	commits, err := gs.getCommitHistory(repo, limit)
+	// The cursor is the nextCursor of a previous page: the walk resumes at
+	// that commit
+	var from plumbing.Hash
+	if before := r.URL.Query().Get("before"); before != "" {
+		commit, err := gs.resolveCommit(repo, before)
+		if err != nil {
+			gs.sendError(w, fmt.Sprintf("Commit %s not found", before), http.StatusNotFound)
+			return
+		}
+		from = commit.Hash
+	} else {
+		head, err := repo.Head()
+		if err != nil {
+			gs.sendError(w, "Failed to get commit history", http.StatusInternalServerError)
+			return
+		}
+		from = head.Hash()
+	}
+
+	// Diffing every commit is expensive on long histories, so files are opt-in
+	withFiles := r.URL.Query().Get("withFiles") == "true"
+
+	commits, next, err := gs.getCommitHistory(repo, from, filter, skip, limit, withFiles)
 	if err != nil {
 		gs.sendError(w, "Failed to get commit history", http.StatusInternalServerError)
 		return
 	}
+	var page interface{} = commits
+	if graph {
+		if page, err = gs.graphCommits(repo, commits); err != nil {
+			gs.sendError(w, "Failed to read commit graph", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var nextCursor interface{}
+	if next != nil {
+		nextCursor = next.String()
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"commits": commits,
+		"commits":    page,
+		"nextCursor": nextCursor,
 	})
 }
 
 // Helper methods
 
+// resolveCommit resolves a branch, tag or (short) commit hash to a commit, defaulting to HEAD
+func (gs *GitService) resolveCommit(repo *git.Repository, ref string) (*object.Commit, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, err
+	}
+	return repo.CommitObject(*hash)
+}
+
+// commitFiles lists the paths a commit changed relative to its first parent.
+// A root commit lists every file it contains.
+func commitFiles(commit *object.Commit) ([]string, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	if commit.NumParents() == 0 {
+		err := tree.Files().ForEach(func(f *object.File) error {
+			files = append(files, f.Name)
+			return nil
+		})
+		return files, err
+	}
+
+	parent, err := commit.Parents().Next()
+	if err != nil {
+		return nil, err
+	}
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := parentTree.Diff(tree)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, change := range changes {
+		for _, name := range []string{change.From.Name, change.To.Name} {
+			if name != "" && !seen[name] {
+				seen[name] = true
+				files = append(files, name)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// newCommitInfo converts a go-git commit into its API representation
+func newCommitInfo(commit *object.Commit) *Commit {
+	return &Commit{
+		Hash:    commit.Hash.String(),
+		Message: commit.Message,
+		Author: Author{
+			Name:  commit.Author.Name,
+			Email: commit.Author.Email,
+		},
+		Committer: Author{
+			Name:  commit.Committer.Name,
+			Email: commit.Committer.Email,
+		},
+		Date: commit.Author.When,
+	}
+}
+
 func (gs *GitService) getRepositoryInfo(repo *git.Repository, projectID string) (*Repository, error) {
 	head, err := repo.Head()
 	if err != nil {
@@ -505,13 +1210,13 @@ func (gs *GitService) getRepositoryInfo(repo *git.Repository, projectID string)
 		return nil, err
 	}
 
-	// Get remote URL
+	// Get remote URL, without any credentials it was cloned with
 	remotes, err := repo.Remotes()
 	var url string
 	if err == nil && len(remotes) > 0 {
 		urls := remotes[0].Config().URLs
 		if len(urls) > 0 {
-			url = urls[0]
+			url = redactSecrets(urls[0], nil)
 		}
 	}
 
@@ -529,15 +1234,7 @@ func (gs *GitService) getRepositoryInfo(repo *git.Repository, projectID string)
 		Name:   filepath.Base(url),
 		URL:    url,
 		Branch: branchName,
-		LastCommit: &Commit{
-			Hash:    commit.Hash.String(),
-			Message: commit.Message,
-			Author: Author{
-				Name:  commit.Author.Name,
-				Email: commit.Author.Email,
-			},
-			Date: commit.Author.When,
-		},
+		LastCommit: newCommitInfo(commit),
 		Status:    status,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -571,14 +1268,25 @@ func (gs *GitService) getRepositoryStatus(repo *git.Repository) (*Status, error)
 		}
 	}
 
-	return &Status{
+	result := &Status{
 		Clean:          status.IsClean(),
 		StagedFiles:    stagedFiles,
 		ModifiedFiles:  modifiedFiles,
 		UntrackedFiles: untrackedFiles,
-		Ahead:          0, // TODO: Calculate ahead/behind
-		Behind:         0,
-	}, nil
+	}
+
+	// Ahead and behind are left out when HEAD is not on a branch with an upstream
+	if head, err := repo.Head(); err == nil && head.Name().IsBranch() {
+		cfg, err := repo.Config()
+		if err != nil {
+			return nil, err
+		}
+		if result.Ahead, result.Behind, err = trackingCounts(newCommitGraph(repo), cfg, head); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
 }
 
 func (gs *GitService) getBranches(repo *git.Repository) ([]*Branch, error) {
@@ -595,6 +1303,13 @@ func (gs *GitService) getBranches(repo *git.Repository) ([]*Branch, error) {
 	currentBranch := strings.TrimPrefix(head.Name().String(), "refs/heads/")
 	var branches []*Branch
 
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	// One graph serves every branch, so shared history is read only once
+	graph := newCommitGraph(repo)
 	err = refs.ForEach(func(ref *plumbing.Reference) error {
 		if ref.Name().IsBranch() {
 			branchName := strings.TrimPrefix(ref.Name().String(), "refs/heads/")
@@ -604,20 +1319,17 @@ func (gs *GitService) getBranches(repo *git.Repository) ([]*Branch, error) {
 				return err
 			}
 
+			ahead, behind, err := trackingCounts(graph, cfg, ref)
+			if err != nil {
+				return err
+			}
+
 			branch := &Branch{
 				Name:     branchName,
 				IsActive: branchName == currentBranch,
-				LastCommit: &Commit{
-					Hash:    commit.Hash.String(),
-					Message: commit.Message,
-					Author: Author{
-						Name:  commit.Author.Name,
-						Email: commit.Author.Email,
-					},
-					Date: commit.Author.When,
-				},
-				Ahead:  0, // TODO: Calculate ahead/behind
-				Behind: 0,
+				LastCommit: newCommitInfo(commit),
+				Ahead:  ahead,
+				Behind: behind,
 			}
 
 			branches = append(branches, branch)
@@ -628,50 +1340,168 @@ func (gs *GitService) getBranches(repo *git.Repository) ([]*Branch, error) {
 	return branches, err
 }
 
-func (gs *GitService) getCommitHistory(repo *git.Repository, limit int) ([]*Commit, error) {
-	head, err := repo.Head()
-	if err != nil {
-		return nil, err
+// historyFilter narrows the commit history. Author matches a substring of
+// the author's name or email, case-insensitively; Since and Until bound the
+// author date.
+type historyFilter struct {
+	Path   string
+	Author string
+	Since  time.Time
+	Until  time.Time
+}
+
+// matches reports whether a commit passes the author and date filters
+func (f historyFilter) matches(commit *object.Commit) bool {
+	when := commit.Author.When
+	if !f.Since.IsZero() && when.Before(f.Since) || !f.Until.IsZero() && when.After(f.Until) {
+		return false
 	}
+	if f.Author != "" &&
+		!strings.Contains(strings.ToLower(commit.Author.Name), f.Author) &&
+		!strings.Contains(strings.ToLower(commit.Author.Email), f.Author) {
+		return false
+	}
+	return true
+}
 
-	commitIter, err := repo.Log(&git.LogOptions{
-		From: head.Hash(),
-	})
+// getCommitHistory walks the log from a commit, skipping the first skip
+// commits that pass the filter. The returned hash is the commit after the
+// last one returned, or nil once the history is exhausted. withFiles fills
+// in each commit's changed files.
+//
+// Path filtering compares each commit with the one the walk visits next, so
+// it follows first-parent semantics: a merge is compared with its first
+// parent only, and a change brought in by a merge is reported on the merge.
+func (gs *GitService) getCommitHistory(repo *git.Repository, from plumbing.Hash, filter historyFilter, skip, limit int, withFiles bool) ([]*Commit, *plumbing.Hash, error) {
+	opts := &git.LogOptions{
+		From: from,
+	}
+	if filter.Path != "" {
+		opts.FileName = &filter.Path
+	}
+	commitIter, err := repo.Log(opts)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer commitIter.Close()
 
-	var commits []*Commit
+	commits := []*Commit{}
+	var next *plumbing.Hash
 	count := 0
 
 	err = commitIter.ForEach(func(commit *object.Commit) error {
-		if count >= limit {
-			return fmt.Errorf("limit reached")
-		}
-
-		commits = append(commits, &Commit{
-			Hash:    commit.Hash.String(),
-			Message: commit.Message,
-			Author: Author{
-				Name:  commit.Author.Name,
-				Email: commit.Author.Email,
-			},
-			Date: commit.Author.When,
-		})
+		if !filter.matches(commit) {
+			return nil
+		}
+		if count < skip {
+			count++
+			return nil
+		}
+		if len(commits) == limit {
+			hash := commit.Hash
+			next = &hash
+			return storer.ErrStop
+		}
 
+		info := newCommitInfo(commit)
+		if withFiles {
+			files, err := commitFiles(commit)
+			if err != nil {
+				return err
+			}
+			info.Files = files
+		}
+		commits = append(commits, info)
 		count++
 		return nil
 	})
+	if err != nil {
+		return nil, nil, err
+	}
 
-	if err != nil && err.Error() != "limit reached" {
-		return nil, err
+	return commits, next, nil
+}
+
+// stageDeletions removes tracked files that are missing from the working
+// tree from the index, which adding "." does not reliably do
+func stageDeletions(worktree *git.Worktree) error {
+	status, err := worktree.Status()
+	if err != nil {
+		return err
+	}
+
+	for file, fileStatus := range status {
+		if fileStatus.Worktree != git.Deleted {
+			continue
+		}
+		if _, err := worktree.Remove(file); err != nil {
+			return fmt.Errorf("failed to stage deletion of %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// writeBlobToWorktree replaces a working tree file with a blob's content,
+// honoring the executable bit and symlinks recorded in the file mode
+func writeBlobToWorktree(fs billy.Filesystem, path string, blob *object.Blob, mode filemode.FileMode) error {
+	reader, err := blob.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := fs.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	if mode == filemode.Symlink {
+		target, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		fs.Remove(path)
+		return fs.Symlink(string(target), path)
+	}
+
+	perm := os.FileMode(0644)
+	if mode == filemode.Executable {
+		perm = 0755
+	}
+
+	file, err := fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, reader); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// sendErrorWithDetails writes an error response carrying extra structured
+// fields alongside the standard error body
+func (gs *GitService) sendErrorWithDetails(w http.ResponseWriter, message string, statusCode int, details map[string]interface{}) {
+	recordError(w, message, nil)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	body := map[string]interface{}{
+		"error":   http.StatusText(statusCode),
+		"message": message,
+		"code":    statusCode,
+	}
+	for key, value := range details {
+		body[key] = value
 	}
 
-	return commits, nil
+	json.NewEncoder(w).Encode(body)
 }
 
 func (gs *GitService) sendError(w http.ResponseWriter, message string, statusCode int) {
+	recordError(w, message, nil)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	
@@ -684,7 +1514,16 @@ func (gs *GitService) sendError(w http.ResponseWriter, message string, statusCod
 	json.NewEncoder(w).Encode(errorResp)
 }
 
+// sendInternalError answers with a 500 carrying only message, while the
+// full error goes to the server log under the request's id
+func (gs *GitService) sendInternalError(w http.ResponseWriter, message string, err error) {
+	gs.sendError(w, message, http.StatusInternalServerError)
+	recordError(w, message, err)
+}
+
 func main() {
+	slog.SetDefault(newLogger())
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8005"
@@ -697,41 +1536,146 @@ func main() {
 
 	// Ensure workspace directory exists
 	if err := os.MkdirAll(workspaceDir, 0755); err != nil {
-		log.Fatalf("Failed to create workspace directory: %v", err)
+		slog.Error("failed to create workspace directory", "path", workspaceDir, "error", err)
+		os.Exit(1)
 	}
 
 	gitService := NewGitService(workspaceDir)
 
 	// Create router
 	r := mux.NewRouter()
+	r.Use(gitService.logRequests)
+	r.Use(gitService.rejectWritesWhileDraining)
+	r.Use(gitService.validateProjectVars)
 
 	// Health check
 	r.HandleFunc("/health", gitService.healthHandler).Methods("GET")
 
 	// Git operations
 	r.HandleFunc("/git/clone", gitService.cloneHandler).Methods("POST")
+	r.HandleFunc("/git/init", gitService.initHandler).Methods("POST")
+	r.HandleFunc("/git/inspect", gitService.inspectHandler).Methods("POST")
+	r.HandleFunc("/git/dirty", gitService.dirtyProjectsHandler).Methods("GET")
 	r.HandleFunc("/git/{projectId}/status", gitService.statusHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/sync-state", gitService.syncStateHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/status/tree", gitService.statusTreeHandler).Methods("GET")
 	r.HandleFunc("/git/{projectId}/info", gitService.infoHandler).Methods("GET")
 	r.HandleFunc("/git/{projectId}/commit", gitService.commitHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/commit/amend", gitService.amendHandler).Methods("POST")
 	r.HandleFunc("/git/{projectId}/push", gitService.pushHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/pull", gitService.pullHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/fetch", gitService.fetchHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/merge", gitService.mergeHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/merge/abort", gitService.abortMergeHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/reset", gitService.resetHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/restore", gitService.restoreHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/mv", gitService.moveFileHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/stage", gitService.stageHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/unstage", gitService.unstageHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/push/preview", gitService.pushPreviewHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/remotes", gitService.remotesHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/remotes", gitService.addRemoteHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/remotes/{name}", gitService.deleteRemoteHandler).Methods("DELETE")
+	r.HandleFunc("/git/{projectId}/remotes/{remote}/branches/{branchName}", gitService.deleteRemoteBranchHandler).Methods("DELETE")
 	r.HandleFunc("/git/{projectId}/branches", gitService.branchesHandler).Methods("GET")
 	r.HandleFunc("/git/{projectId}/branches", gitService.createBranchHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/branches/diverge", gitService.branchDivergenceHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/branches/recent", gitService.recentBranchesHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/branches/orphan", gitService.createOrphanBranchHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/branches/{branchName}", gitService.deleteBranchHandler).Methods("DELETE")
 	r.HandleFunc("/git/{projectId}/branches/{branchName}/checkout", gitService.switchBranchHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/branches/{branchName}/rename", gitService.renameBranchHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/commits/conventional", gitService.conventionalCommitsHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/commits/{hash}/raw", gitService.rawCommitHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/commits/{hash}/conventional", gitService.conventionalCommitHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/commits/{hash}/merge-diff", gitService.mergeDiffHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/commits/{hash}", gitService.showCommitHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/squash", gitService.squashHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/matches", gitService.matchesHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/format-patch", gitService.formatPatchHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/operations/{id}/progress", gitService.operationProgressHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/operations/{id}/progress/stream", gitService.operationProgressStreamHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/revert", gitService.revertHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/ignore-rules", gitService.ignoreRulesHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/activity", gitService.activityHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/branch-policy", gitService.branchPolicyHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/conflict-markers", gitService.conflictMarkersHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/commit-count", gitService.commitCountHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/move", gitService.moveProjectHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}", gitService.deleteProjectHandler).Methods("DELETE")
+	r.HandleFunc("/git/{projectId}/snapshot", gitService.createSnapshotHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/snapshots", gitService.snapshotsHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/snapshots/{snapshotId}/restore", gitService.restoreSnapshotHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/branch-commit", gitService.branchCommitHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/apply-edits", gitService.applyEditsHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/stash/count", gitService.stashCountHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/stash", gitService.stashListHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/stash", gitService.stashSaveHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/stash/{index}/pop", gitService.stashPopHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/move-changes", gitService.moveChangesHandler).Methods("POST")
 	r.HandleFunc("/git/{projectId}/history", gitService.historyHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/fsck", gitService.fsckHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/gc/estimate", gitService.gcEstimateHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/gc", gitService.gcHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/stats", gitService.statsHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/checkout-stage", gitService.checkoutStageHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/config", gitService.configHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/config", gitService.updateConfigHandler).Methods("PUT")
+	r.HandleFunc("/git/{projectId}/line-log", gitService.lineLogHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/lost-found", gitService.lostFoundHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/lost-found/recover", gitService.recoverLostCommitHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/blame/stream", gitService.blameStreamHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/diff", gitService.diffHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/tags/batch", gitService.batchTagsHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/tags", gitService.tagsHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/tags", gitService.createTagHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/tags/{name}", gitService.deleteTagHandler).Methods("DELETE")
+	r.HandleFunc("/git/{projectId}/staged-blob", gitService.stagedBlobHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/file", gitService.fileAtRevisionHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/tree", gitService.treeHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/blame", gitService.blameHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/stage-content", gitService.stageContentHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/identities", gitService.identitiesHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/blob-diff", gitService.blobDiffHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/refs/export", gitService.exportRefsHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/refs/import", gitService.importRefsHandler).Methods("POST")
+	r.HandleFunc("/git/{projectId}/settings", gitService.getSettingsHandler).Methods("GET")
+	r.HandleFunc("/git/{projectId}/settings", gitService.updateSettingsHandler).Methods("PATCH")
 
 	// CORS
-	c := cors.New(cors.Options{
-		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"*"},
-	})
+	corsPolicy, err := corsOptions()
+	if err != nil {
+		slog.Error("invalid CORS configuration", "error", err)
+		os.Exit(1)
+	}
+	if corsPolicy.AllowOriginFunc != nil {
+		slog.Warn("CORS_ALLOWED_ORIGINS is not set; cross-origin requests are refused")
+	}
+	c := cors.New(corsPolicy)
 
 	handler := c.Handler(r)
 
-	log.Printf("🚀 Git Service starting on port %s", port)
-	log.Printf("📁 Workspace directory: %s", workspaceDir)
-	
-	if err := http.ListenAndServe(":"+port, handler); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	slog.Info("git service starting", "port", port, "workspaceDir", workspaceDir)
+
+	srv := &http.Server{Addr: ":" + port, Handler: handler}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
+		slog.Error("server failed", "error", err)
+		os.Exit(1)
+	case sig := <-stop:
+		slog.Info("shutting down", "signal", sig.String())
+	}
+
+	if err := gitService.shutdown(srv, shutdownTimeout); err != nil {
+		slog.Error("shutdown failed", "error", err)
+		os.Exit(1)
 	}
+	slog.Info("git service stopped")
 }
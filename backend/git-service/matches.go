@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Check whether the working tree matches a commit endpoint
+func (gs *GitService) matchesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	ref := r.URL.Query().Get("ref")
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	commit, err := gs.resolveCommit(repo, ref)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Commit %s not found", ref), http.StatusNotFound)
+		return
+	}
+
+	// Hashing the working tree as a tree object makes the comparison a single
+	// hash check; untracked files that are not ignored count as differences
+	entries, err := worktreeEntries(repo, "")
+	if err != nil {
+		gs.sendError(w, "Failed to read working tree", http.StatusInternalServerError)
+		return
+	}
+	worktreeTree, err := buildTree(nil, entries)
+	if err != nil {
+		gs.sendError(w, "Failed to hash working tree", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"commit":       commit.Hash.String(),
+		"tree":         commit.TreeHash.String(),
+		"worktreeTree": worktreeTree.String(),
+		"matches":      worktreeTree == commit.TreeHash,
+	}
+
+	if r.URL.Query().Get("index") == "true" {
+		entries, err := indexEntries(repo)
+		if err != nil {
+			gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+			return
+		}
+		indexTree, err := buildTree(nil, entries)
+		if err != nil {
+			gs.sendError(w, "Failed to hash index", http.StatusInternalServerError)
+			return
+		}
+		response["indexTree"] = indexTree.String()
+		response["indexMatches"] = indexTree == commit.TreeHash
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
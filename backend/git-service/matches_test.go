@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+type matchesResponse struct {
+	Tree         string `json:"tree"`
+	WorktreeTree string `json:"worktreeTree"`
+	Matches      bool   `json:"matches"`
+	IndexTree    string `json:"indexTree"`
+	IndexMatches bool   `json:"indexMatches"`
+}
+
+func worktreeMatches(t *testing.T, gs *GitService) matchesResponse {
+	t.Helper()
+	rec := serve(t, gs.matchesHandler, "GET", "/git/p/matches?index=true", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body matchesResponse
+	decodeBody(t, rec, &body)
+	return body
+}
+
+func TestMatchesAfterEdit(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	dir := gs.getProjectPath("p")
+	commitTestFiles(t, repo, "Add nested", map[string]string{"dir/b.txt": "b\n"})
+
+	body := worktreeMatches(t, gs)
+	if !body.Matches || !body.IndexMatches || body.WorktreeTree != body.Tree {
+		t.Errorf("clean working tree: %+v", body)
+	}
+
+	writeFiles(t, repo, map[string]string{"dir/b.txt": "edited\n"})
+	body = worktreeMatches(t, gs)
+	if body.Matches || !body.IndexMatches {
+		t.Errorf("after an edit: %+v", body)
+	}
+
+	// The working tree hash is the tree git would write once it is staged
+	runGit(t, dir, "add", "-A")
+	want := runGit(t, dir, "write-tree")
+	body = worktreeMatches(t, gs)
+	if body.WorktreeTree != want || body.IndexTree != want || body.IndexMatches {
+		t.Errorf("after staging: %+v, want both trees %s", body, want)
+	}
+}
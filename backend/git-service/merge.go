@@ -0,0 +1,271 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// mergeLabels names the sides of a merge in conflict markers
+type mergeLabels struct {
+	ours   string
+	base   string
+	theirs string
+}
+
+// treeMerge is the outcome of a three-way merge of two trees. Conflicted
+// files are included with conflict markers and listed in conflicts.
+type treeMerge struct {
+	entries   map[string]*diffEntry
+	conflicts []string
+}
+
+// mergeTrees merges the changes from base to theirs into ours, file by file.
+// Renames are not followed, so a file renamed on one side and edited on the
+// other conflicts. Merged blobs are written to s, or only hashed when s is nil.
+func mergeTrees(s storer.EncodedObjectStorer, base, ours, theirs map[string]*diffEntry, labels mergeLabels, style string) (*treeMerge, error) {
+	paths := make(map[string]bool)
+	for _, entries := range []map[string]*diffEntry{base, ours, theirs} {
+		for p := range entries {
+			paths[p] = true
+		}
+	}
+
+	result := &treeMerge{entries: make(map[string]*diffEntry)}
+	for p := range paths {
+		b, o, t := base[p], ours[p], theirs[p]
+		switch {
+		case sameEntry(o, t), sameEntry(b, t):
+			if o != nil {
+				result.entries[p] = o
+			}
+			continue
+		case sameEntry(b, o):
+			if t != nil {
+				result.entries[p] = t
+			}
+			continue
+		}
+
+		// Both sides changed the file differently
+		if o == nil || t == nil {
+			if o != nil {
+				result.entries[p] = o
+			} else {
+				result.entries[p] = t
+			}
+			result.conflicts = append(result.conflicts, p)
+			continue
+		}
+
+		mode := o.mode
+		if o.mode != t.mode {
+			if b != nil && o.mode == b.mode {
+				mode = t.mode
+			} else if b == nil || t.mode != b.mode {
+				result.entries[p] = o
+				result.conflicts = append(result.conflicts, p)
+				continue
+			}
+		}
+
+		var baseData []byte
+		if b != nil {
+			var err error
+			if baseData, err = b.read(); err != nil {
+				return nil, err
+			}
+		}
+		oursData, err := o.read()
+		if err != nil {
+			return nil, err
+		}
+		theirsData, err := t.read()
+		if err != nil {
+			return nil, err
+		}
+		if isBinary(baseData) || isBinary(oursData) || isBinary(theirsData) {
+			result.entries[p] = o
+			result.conflicts = append(result.conflicts, p)
+			continue
+		}
+
+		merged, clean := mergeLines(string(baseData), string(oursData), string(theirsData), labels, style)
+		hash, err := storeBlob(s, []byte(merged))
+		if err != nil {
+			return nil, err
+		}
+		data := []byte(merged)
+		result.entries[p] = &diffEntry{hash: hash, mode: mode, read: func() ([]byte, error) { return data, nil }}
+		if !clean {
+			result.conflicts = append(result.conflicts, p)
+		}
+	}
+
+	sort.Strings(result.conflicts)
+	return result, nil
+}
+
+// sameEntry reports whether two sides hold the same file, treating two
+// missing files as equal
+func sameEntry(a, b *diffEntry) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.hash == b.hash && a.mode == b.mode
+}
+
+// lineChange replaces the base lines [start, end) with lines
+type lineChange struct {
+	start int
+	end   int
+	lines []string
+}
+
+// lineChanges lists the regions of base that other changes
+func lineChanges(base, other string) []lineChange {
+	var changes []lineChange
+	var current *lineChange
+	pos := 0
+	for _, op := range diffLines(base, other) {
+		if op.Type == diffmatchpatch.DiffEqual {
+			if current != nil {
+				changes = append(changes, *current)
+				current = nil
+			}
+			pos++
+			continue
+		}
+		if current == nil {
+			current = &lineChange{start: pos, end: pos}
+		}
+		if op.Type == diffmatchpatch.DiffDelete {
+			pos++
+			current.end = pos
+		} else {
+			current.lines = append(current.lines, op.Text)
+		}
+	}
+	if current != nil {
+		changes = append(changes, *current)
+	}
+	return changes
+}
+
+// mergeLines merges the line changes from base to theirs into ours. Changes
+// that overlap or touch conflict, as in git, unless both sides made the same
+// change. Conflicts are written with markers in the merge or diff3 style.
+func mergeLines(base, ours, theirs string, labels mergeLabels, style string) (string, bool) {
+	baseLines := splitLines(base)
+	oursChanges, theirsChanges := lineChanges(base, ours), lineChanges(base, theirs)
+
+	var out strings.Builder
+	clean := true
+	pos, i, j := 0, 0, 0
+	for i < len(oursChanges) || j < len(theirsChanges) {
+		// Start a group at the earliest change and pull in every change on
+		// either side that overlaps or touches it
+		start, end := 0, 0
+		if j >= len(theirsChanges) || i < len(oursChanges) && oursChanges[i].start <= theirsChanges[j].start {
+			start, end = oursChanges[i].start, oursChanges[i].end
+		} else {
+			start, end = theirsChanges[j].start, theirsChanges[j].end
+		}
+		oi, tj := i, j
+		for {
+			grew := false
+			for i < len(oursChanges) && oursChanges[i].start <= end {
+				if oursChanges[i].end > end {
+					end = oursChanges[i].end
+				}
+				i++
+				grew = true
+			}
+			for j < len(theirsChanges) && theirsChanges[j].start <= end {
+				if theirsChanges[j].end > end {
+					end = theirsChanges[j].end
+				}
+				j++
+				grew = true
+			}
+			if !grew {
+				break
+			}
+		}
+
+		writeLines(&out, baseLines[pos:start])
+		oursText := applyLineChanges(baseLines, start, end, oursChanges[oi:i])
+		theirsText := applyLineChanges(baseLines, start, end, theirsChanges[tj:j])
+		switch {
+		case oi == i:
+			writeLines(&out, theirsText)
+		case tj == j, strings.Join(oursText, "") == strings.Join(theirsText, ""):
+			writeLines(&out, oursText)
+		default:
+			clean = false
+			writeConflictSide(&out, "<<<<<<< "+labels.ours, oursText)
+			if style == conflictStyleDiff3 {
+				writeConflictSide(&out, "||||||| "+labels.base, baseLines[start:end])
+			}
+			writeConflictSide(&out, "=======", theirsText)
+			out.WriteString(">>>>>>> " + labels.theirs + "\n")
+		}
+		pos = end
+	}
+	writeLines(&out, baseLines[pos:])
+	return out.String(), clean
+}
+
+// applyLineChanges returns base lines [start, end) with one side's changes applied
+func applyLineChanges(base []string, start, end int, changes []lineChange) []string {
+	var lines []string
+	pos := start
+	for _, change := range changes {
+		lines = append(lines, base[pos:change.start]...)
+		lines = append(lines, change.lines...)
+		pos = change.end
+	}
+	return append(lines, base[pos:end]...)
+}
+
+// writeLines appends lines to out
+func writeLines(out *strings.Builder, lines []string) {
+	for _, line := range lines {
+		out.WriteString(line)
+	}
+}
+
+// writeConflictSide writes a conflict marker followed by one side's lines,
+// ending the last line so the next marker starts on its own line
+func writeConflictSide(out *strings.Builder, marker string, lines []string) {
+	out.WriteString(marker + "\n")
+	writeLines(out, lines)
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		out.WriteString("\n")
+	}
+}
+
+// storeBlob writes data as a blob to s, or only hashes it when s is nil
+func storeBlob(s storer.EncodedObjectStorer, data []byte) (plumbing.Hash, error) {
+	if s == nil {
+		return plumbing.ComputeHash(plumbing.BlobObject, data), nil
+	}
+	obj := s.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(data)))
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return plumbing.ZeroHash, err
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return s.SetEncodedObject(obj)
+}
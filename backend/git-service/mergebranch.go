@@ -0,0 +1,642 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+)
+
+// Merge strategies. A three-way merge uses a single merge base and does not
+// follow renames; when histories cross and there are several bases the
+// first one is used rather than building a virtual base as git's recursive
+// and ort strategies do. ours records the merge but keeps the current tree.
+const (
+	mergeStrategyThreeWay = "three-way"
+	mergeStrategyOurs     = "ours"
+)
+
+// mergeStrategies maps the accepted strategy names to the merge performed
+var mergeStrategies = map[string]string{
+	"":                    mergeStrategyThreeWay,
+	mergeStrategyThreeWay: mergeStrategyThreeWay,
+	"recursive":           mergeStrategyThreeWay,
+	"ort":                 mergeStrategyThreeWay,
+	mergeStrategyOurs:     mergeStrategyOurs,
+}
+
+// Files git keeps while a merge waits for its conflicts to be resolved
+const (
+	mergeHeadFile = "MERGE_HEAD"
+	mergeMsgFile  = "MERGE_MSG"
+	origHeadFile  = "ORIG_HEAD"
+)
+
+// MergeRequest represents a request to merge a branch into the current one
+type MergeRequest struct {
+	Branch          string `json:"branch"`
+	Message         string `json:"message,omitempty"`
+	FastForwardOnly bool   `json:"fastForwardOnly,omitempty"`
+	NoFastForward   bool   `json:"noFastForward,omitempty"`
+	Strategy        string `json:"strategy,omitempty"`
+	Author          Author `json:"author"`
+}
+
+// Merge branch endpoint
+func (gs *GitService) mergeHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req MergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Branch == "" {
+		gs.sendError(w, "Branch is required", http.StatusBadRequest)
+		return
+	}
+	if req.FastForwardOnly && req.NoFastForward {
+		gs.sendError(w, "fastForwardOnly and noFastForward cannot be combined", http.StatusBadRequest)
+		return
+	}
+	strategy, ok := mergeStrategies[req.Strategy]
+	if !ok {
+		gs.sendError(w, fmt.Sprintf("Unsupported merge strategy %s; supported strategies are recursive (a three-way merge) and ours", req.Strategy), http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := os.Stat(filepath.Join(gs.gitDir(projectID), mergeHeadFile)); err == nil {
+		gs.sendError(w, "A merge is already in progress; resolve the conflicts and commit first", http.StatusConflict)
+		return
+	}
+
+	headRef, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil || headRef.Type() != plumbing.SymbolicReference {
+		gs.sendError(w, "Cannot merge with a detached HEAD", http.StatusBadRequest)
+		return
+	}
+	current := headRef.Target()
+	head, err := repo.Head()
+	if err != nil {
+		gs.sendError(w, "Cannot merge into a branch with no commits", http.StatusBadRequest)
+		return
+	}
+	ours, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		gs.sendError(w, "Failed to read HEAD", http.StatusInternalServerError)
+		return
+	}
+
+	theirs, source, err := gs.resolveMergeSource(repo, req.Branch)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Branch %s not found", req.Branch), http.StatusNotFound)
+		return
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+	// As with pull, the merge needs a clean tree so conflicts can be left
+	// in it without mixing them with local work
+	status, err := worktree.Status()
+	if err != nil {
+		gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+		return
+	}
+	if dirty := uncommittedFiles(status); len(dirty) > 0 {
+		gs.sendErrorWithDetails(w, "Commit or stash local changes before merging", http.StatusConflict, map[string]interface{}{
+			"files": dirty,
+		})
+		return
+	}
+
+	if upToDate, err := theirs.IsAncestor(ours); err != nil {
+		gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+		return
+	} else if upToDate {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":         "Already up to date",
+			"alreadyUpToDate": true,
+			"fastForward":     false,
+			"commit":          newCommitInfo(ours),
+		})
+		return
+	}
+
+	canFastForward, err := ours.IsAncestor(theirs)
+	if err != nil {
+		gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+		return
+	}
+	if req.FastForwardOnly && !canFastForward {
+		gs.sendError(w, fmt.Sprintf("Not possible to fast-forward to %s", req.Branch), http.StatusConflict)
+		return
+	}
+
+	who := gs.fillIdentity(projectID, req.Author)
+
+	if canFastForward && !req.NoFastForward {
+		if files, err := gs.switchCarryingChanges(repo, worktree, ours.Hash, theirs.Hash, status); err != nil {
+			gs.sendInternalError(w, "Failed to update working tree", err)
+			return
+		} else if len(files) > 0 {
+			gs.sendErrorWithDetails(w, "Local changes would be overwritten by the merge", http.StatusConflict, map[string]interface{}{
+				"files": files,
+			})
+			return
+		}
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(current, theirs.Hash)); err != nil {
+			gs.sendError(w, "Failed to update HEAD", http.StatusInternalServerError)
+			return
+		}
+		gs.logHeadUpdate(projectID, repo, ours.Hash, theirs.Hash, who, fmt.Sprintf("merge %s: Fast-forward", req.Branch))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":         fmt.Sprintf("Fast-forwarded %s to %s", current.Short(), req.Branch),
+			"alreadyUpToDate": false,
+			"fastForward":     true,
+			"commit":          newCommitInfo(theirs),
+		})
+		return
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+	if settings.RequireSignedCommits {
+		gs.sendError(w, unsignedCommitMessage, http.StatusUnprocessableEntity)
+		return
+	}
+	if who.Name == "" || who.Email == "" {
+		gs.sendError(w, missingIdentityMessage, http.StatusBadRequest)
+		return
+	}
+
+	message := req.Message
+	if message == "" {
+		message = defaultMergeMessage(source, req.Branch, current.Short())
+	}
+	if !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+
+	oursEntries, err := treeEntries(ours, "")
+	if err != nil {
+		gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+		return
+	}
+	merged := &treeMerge{entries: oursEntries}
+	var base, theirsEntries map[string]*diffEntry
+	if strategy == mergeStrategyThreeWay {
+		base = map[string]*diffEntry{}
+		bases, err := ours.MergeBase(theirs)
+		if err != nil {
+			gs.sendError(w, "Failed to find merge base", http.StatusInternalServerError)
+			return
+		}
+		if len(bases) > 0 {
+			if base, err = treeEntries(bases[0], ""); err != nil {
+				gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+				return
+			}
+		}
+		if theirsEntries, err = treeEntries(theirs, ""); err != nil {
+			gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+			return
+		}
+		labels := mergeLabels{ours: "HEAD", base: "merged common ancestors", theirs: req.Branch}
+		if merged, err = mergeTrees(repo.Storer, base, oursEntries, theirsEntries, labels, settings.ConflictStyle); err != nil {
+			gs.sendInternalError(w, "Failed to merge", err)
+			return
+		}
+	}
+
+	// Files the merge would create must not clobber untracked ones
+	var clobbered []string
+	for p := range merged.entries {
+		if _, tracked := oursEntries[p]; !tracked {
+			if fileStatus, ok := status[p]; ok && fileStatus.Worktree == git.Untracked {
+				clobbered = append(clobbered, p)
+			}
+		}
+	}
+	if len(clobbered) > 0 {
+		sort.Strings(clobbered)
+		gs.sendErrorWithDetails(w, "Untracked files would be overwritten by the merge", http.StatusConflict, map[string]interface{}{
+			"files": clobbered,
+		})
+		return
+	}
+
+	if err := writeMergeResult(repo, worktree, oursEntries, merged, base, theirsEntries); err != nil {
+		gs.sendInternalError(w, "Failed to update working tree", err)
+		return
+	}
+
+	// A conflicted merge stops here, like git: the markers stay in the tree
+	// and committing once they are resolved concludes the merge
+	if len(merged.conflicts) > 0 {
+		if err := gs.writeMergeState(projectID, ours.Hash, theirs.Hash, message, merged.conflicts); err != nil {
+			gs.sendError(w, "Failed to record merge state", http.StatusInternalServerError)
+			return
+		}
+		conflicts, err := indexConflicts(repo)
+		if err != nil {
+			gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+			return
+		}
+		gs.sendErrorWithDetails(w, fmt.Sprintf("Merging %s has conflicts; resolve them and commit the result", req.Branch), http.StatusConflict, map[string]interface{}{
+			"conflicts": conflicts,
+			"mergeHead": theirs.Hash.String(),
+		})
+		return
+	}
+
+	treeHash, err := buildTree(repo.Storer, merged.entries)
+	if err != nil {
+		gs.sendError(w, "Failed to write tree", http.StatusInternalServerError)
+		return
+	}
+	signature := object.Signature{Name: who.Name, Email: who.Email, When: time.Now()}
+	result := &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      message,
+		TreeHash:     treeHash,
+		ParentHashes: []plumbing.Hash{ours.Hash, theirs.Hash},
+	}
+	if result.Hash, err = storeObject(repo.Storer, result); err != nil {
+		gs.sendError(w, "Failed to write merge commit", http.StatusInternalServerError)
+		return
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(current, result.Hash)); err != nil {
+		gs.sendError(w, "Failed to update HEAD", http.StatusInternalServerError)
+		return
+	}
+	entry := fmt.Sprintf("merge %s: Merge made by a three-way merge", req.Branch)
+	if strategy == mergeStrategyOurs {
+		entry = fmt.Sprintf("merge %s: Merge made by the 'ours' strategy", req.Branch)
+	}
+	gs.logHeadUpdate(projectID, repo, ours.Hash, result.Hash, who, entry)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":         fmt.Sprintf("Merged %s into %s", req.Branch, current.Short()),
+		"alreadyUpToDate": false,
+		"fastForward":     false,
+		"strategy":        strategy,
+		"commit":          newCommitInfo(result),
+	})
+}
+
+// Abort merge endpoint. The index and working tree go back to the commit the
+// merge started from; a merge only starts from a clean tree, so nothing but
+// the merge's own changes is lost. Untracked files are kept.
+func (gs *GitService) abortMergeHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	if _, merging := gs.readMergeHead(projectID); !merging {
+		gs.sendError(w, "There is no merge to abort", http.StatusConflict)
+		return
+	}
+	head, err := repo.Head()
+	if err != nil {
+		gs.sendError(w, "Failed to read HEAD", http.StatusInternalServerError)
+		return
+	}
+	target := head.Hash()
+	if origHead, ok := gs.readOrigHead(projectID); ok {
+		target = origHead
+	}
+	commit, err := repo.CommitObject(target)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Commit %s not found", target), http.StatusInternalServerError)
+		return
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+	if err := hardReset(repo, worktree, head.Hash(), commit); err != nil {
+		gs.sendInternalError(w, "Failed to abort merge", err)
+		return
+	}
+	gs.clearMergeState(projectID)
+	if target != head.Hash() {
+		gs.logHeadUpdate(projectID, repo, head.Hash(), target, gs.resolveIdentity(projectID), "merge: abort")
+	}
+
+	status, err := gs.getRepositoryStatus(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Merge aborted",
+		"head":    newCommitInfo(commit),
+		"status":  status,
+	})
+}
+
+// resolveMergeSource finds the commit to merge, preferring a local branch
+// over a remote-tracking one or any other revision. The reference it came
+// from is returned for the merge message.
+func (gs *GitService) resolveMergeSource(repo *git.Repository, name string) (*object.Commit, plumbing.ReferenceName, error) {
+	for _, ref := range []plumbing.ReferenceName{plumbing.NewBranchReferenceName(name), plumbing.ReferenceName("refs/remotes/" + name)} {
+		if resolved, err := repo.Reference(ref, true); err == nil {
+			commit, err := repo.CommitObject(resolved.Hash())
+			return commit, ref, err
+		}
+	}
+	commit, err := gs.resolveCommit(repo, name)
+	return commit, "", err
+}
+
+// defaultMergeMessage words the merge commit message the way git does
+func defaultMergeMessage(source plumbing.ReferenceName, name, into string) string {
+	var message string
+	switch {
+	case source.IsBranch():
+		message = fmt.Sprintf("Merge branch '%s'", name)
+	case source.IsRemote():
+		message = fmt.Sprintf("Merge remote-tracking branch '%s'", name)
+	default:
+		message = fmt.Sprintf("Merge commit '%s'", name)
+	}
+	if into != "main" && into != "master" {
+		message += " into " + into
+	}
+	return message + "\n"
+}
+
+// uncommittedFiles lists tracked files with staged or unstaged changes
+func uncommittedFiles(status git.Status) []string {
+	var dirty []string
+	for file, fileStatus := range status {
+		if fileStatus.Worktree == git.Untracked {
+			continue
+		}
+		if fileStatus.Staging != git.Unmodified || fileStatus.Worktree != git.Unmodified {
+			dirty = append(dirty, file)
+		}
+	}
+	sort.Strings(dirty)
+	return dirty
+}
+
+// writeMergeResult updates the working tree and index from ours to the
+// merged entries. Conflicted paths keep their base, ours and theirs
+// versions as index stages 1 to 3.
+func writeMergeResult(repo *git.Repository, worktree *git.Worktree, ours map[string]*diffEntry, merged *treeMerge, base, theirs map[string]*diffEntry) error {
+	conflicted := make(map[string]bool, len(merged.conflicts))
+	for _, p := range merged.conflicts {
+		conflicted[p] = true
+	}
+	paths := make(map[string]bool)
+	for _, entries := range []map[string]*diffEntry{ours, merged.entries} {
+		for p := range entries {
+			paths[p] = true
+		}
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+	for p := range paths {
+		entry := merged.entries[p]
+		if !conflicted[p] && sameEntry(ours[p], entry) {
+			continue
+		}
+
+		for {
+			if _, err := idx.Remove(p); err != nil {
+				break
+			}
+		}
+		if entry == nil {
+			if err := worktree.Filesystem.Remove(p); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			removeEmptyParents(worktree.Filesystem, p)
+		} else {
+			blob, err := repo.BlobObject(entry.hash)
+			if err != nil {
+				return err
+			}
+			if err := writeBlobToWorktree(worktree.Filesystem, p, blob, entry.mode); err != nil {
+				return err
+			}
+		}
+
+		if !conflicted[p] {
+			if entry != nil {
+				if err := addIndexEntry(repo, worktree, idx, p, entry, 0); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		stages := []struct {
+			entry *diffEntry
+			stage index.Stage
+		}{{base[p], index.AncestorMode}, {ours[p], index.OurMode}, {theirs[p], index.TheirMode}}
+		for _, s := range stages {
+			if s.entry != nil {
+				if err := addIndexEntry(repo, worktree, idx, p, s.entry, s.stage); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	sortIndexEntries(idx)
+	return repo.Storer.SetIndex(idx)
+}
+
+// sortIndexEntries orders index entries by path and stage. The index encoder
+// only orders them by path, which can leave the stages of a path shuffled.
+func sortIndexEntries(idx *index.Index) {
+	sort.SliceStable(idx.Entries, func(i, j int) bool {
+		if idx.Entries[i].Name != idx.Entries[j].Name {
+			return idx.Entries[i].Name < idx.Entries[j].Name
+		}
+		return idx.Entries[i].Stage < idx.Entries[j].Stage
+	})
+}
+
+// addIndexEntry stages entry at path with the given stage
+func addIndexEntry(repo *git.Repository, worktree *git.Worktree, idx *index.Index, path string, entry *diffEntry, stage index.Stage) error {
+	blob, err := repo.BlobObject(entry.hash)
+	if err != nil {
+		return err
+	}
+	e := idx.Add(path)
+	e.Hash = entry.hash
+	e.Mode = entry.mode
+	e.Stage = stage
+	e.Size = uint32(blob.Size)
+	e.ModifiedAt = time.Now()
+	if stage == 0 {
+		if info, err := worktree.Filesystem.Lstat(path); err == nil {
+			e.ModifiedAt = info.ModTime()
+		}
+	}
+	return nil
+}
+
+// writeMergeState records an unfinished merge the way git does, so either
+// this service or the git CLI can conclude it with a commit. ORIG_HEAD keeps
+// the commit the merge started from for an abort.
+func (gs *GitService) writeMergeState(projectID string, origHead, mergeHead plumbing.Hash, message string, conflicts []string) error {
+	gitDir := gs.gitDir(projectID)
+	if err := os.WriteFile(filepath.Join(gitDir, origHeadFile), []byte(origHead.String()+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, mergeHeadFile), []byte(mergeHead.String()+"\n"), 0644); err != nil {
+		return err
+	}
+	var msg strings.Builder
+	msg.WriteString(message)
+	msg.WriteString("\n# Conflicts:\n")
+	for _, p := range conflicts {
+		fmt.Fprintf(&msg, "#\t%s\n", p)
+	}
+	return os.WriteFile(filepath.Join(gitDir, mergeMsgFile), []byte(msg.String()), 0644)
+}
+
+// readOrigHead returns the commit recorded in ORIG_HEAD, if any
+func (gs *GitService) readOrigHead(projectID string) (plumbing.Hash, bool) {
+	data, err := os.ReadFile(filepath.Join(gs.gitDir(projectID), origHeadFile))
+	if err != nil {
+		return plumbing.ZeroHash, false
+	}
+	hash := plumbing.NewHash(strings.TrimSpace(string(data)))
+	return hash, !hash.IsZero()
+}
+
+// readMergeHead returns the commit an unfinished merge is merging, if any
+func (gs *GitService) readMergeHead(projectID string) (plumbing.Hash, bool) {
+	data, err := os.ReadFile(filepath.Join(gs.gitDir(projectID), mergeHeadFile))
+	if err != nil {
+		return plumbing.ZeroHash, false
+	}
+	hash := plumbing.NewHash(strings.TrimSpace(string(data)))
+	return hash, !hash.IsZero()
+}
+
+// clearMergeState removes the files of an unfinished merge
+func (gs *GitService) clearMergeState(projectID string) {
+	gitDir := gs.gitDir(projectID)
+	for _, name := range []string{mergeHeadFile, mergeMsgFile, "MERGE_MODE"} {
+		os.Remove(filepath.Join(gitDir, name))
+	}
+}
+
+// resolveConflictStages collapses the conflict stages of the paths about to
+// be staged into a placeholder entry, so staging the file from the working
+// tree resolves the conflict as git add does. A file deleted from the
+// working tree is resolved as a deletion. No files means every path.
+func resolveConflictStages(repo *git.Repository, worktree *git.Worktree, files []string) error {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return err
+	}
+	modes := make(map[string]index.Entry)
+	kept := idx.Entries[:0]
+	for _, e := range idx.Entries {
+		if e.Stage == 0 || !pathSelected(e.Name, files) {
+			kept = append(kept, e)
+			continue
+		}
+		if mode, ok := modes[e.Name]; !ok || e.Stage == index.OurMode || mode.Stage == index.AncestorMode {
+			modes[e.Name] = *e
+		}
+	}
+	if len(modes) == 0 {
+		return nil
+	}
+	idx.Entries = kept
+	for p, stage := range modes {
+		if _, err := worktree.Filesystem.Lstat(p); err != nil {
+			continue
+		}
+		e := idx.Add(p)
+		e.Mode = stage.Mode
+	}
+	return repo.Storer.SetIndex(idx)
+}
+
+// unmergedPaths lists the paths that still have conflict stages in the index
+func unmergedPaths(repo *git.Repository) ([]string, error) {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var paths []string
+	for _, e := range idx.Entries {
+		if e.Stage != 0 && !seen[e.Name] {
+			seen[e.Name] = true
+			paths = append(paths, e.Name)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// pathSelected reports whether p is one of files or inside one of them.
+// No files, or ".", selects every path.
+func pathSelected(p string, files []string) bool {
+	if len(files) == 0 {
+		return true
+	}
+	for _, file := range files {
+		file = filepath.ToSlash(filepath.Clean(file))
+		if file == "." || p == file || strings.HasPrefix(p, file+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// maxCombinedParents is the most parents a combined diff can track, one bit each
+const maxCombinedParents = 64
+
+// CombinedFileDiff is one file of a merge commit's combined diff.
+// ResolvedLines are the result lines that match none of the parents.
+type CombinedFileDiff struct {
+	Path          string `json:"path"`
+	Binary        bool   `json:"binary"`
+	ResolvedLines []int  `json:"resolvedLines"`
+	Patch         string `json:"patch"`
+}
+
+// combinedRow is a line of a combined diff. A result line records the
+// parents it is new against; a lost line the parents it was removed from.
+type combinedRow struct {
+	text    string
+	parents uint64
+	lost    bool
+	line    int
+}
+
+// Get combined diff of a merge commit endpoint
+func (gs *GitService) mergeDiffHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	hash := vars["hash"]
+	query := r.URL.Query()
+
+	dense := true
+	if value := query.Get("dense"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			gs.sendError(w, "Invalid dense value", http.StatusBadRequest)
+			return
+		}
+		dense = parsed
+	}
+	filter := strings.Trim(query.Get("path"), "/")
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+
+	commit, err := gs.resolveCommit(repo, hash)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Commit %s not found", hash), http.StatusNotFound)
+		return
+	}
+	if commit.NumParents() > maxCombinedParents {
+		gs.sendError(w, fmt.Sprintf("Combined diffs support at most %d parents", maxCombinedParents), http.StatusUnprocessableEntity)
+		return
+	}
+
+	result, err := treeEntries(commit, filter)
+	if err != nil {
+		gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+		return
+	}
+	var parents []map[string]*diffEntry
+	var parentHashes []string
+	err = commit.Parents().ForEach(func(parent *object.Commit) error {
+		entries, err := treeEntries(parent, filter)
+		if err != nil {
+			return err
+		}
+		parents = append(parents, entries)
+		parentHashes = append(parentHashes, parent.Hash.String())
+		return nil
+	})
+	if err != nil {
+		gs.sendError(w, "Failed to read parent trees", http.StatusInternalServerError)
+		return
+	}
+
+	// Anything but a merge has a single side to compare against
+	if len(parents) < 2 {
+		from := map[string]*diffEntry{}
+		if len(parents) == 1 {
+			from = parents[0]
+		}
+		files, err := diffEntries(from, result, settings.diffOptions())
+		if err != nil {
+			gs.sendInternalError(w, "Failed to compute diff", err)
+			return
+		}
+		var patch strings.Builder
+		for _, file := range files {
+			patch.WriteString(file.Patch)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"commit":   commit.Hash.String(),
+			"parents":  parentHashes,
+			"combined": false,
+			"files":    files,
+			"patch":    patch.String(),
+		})
+		return
+	}
+
+	files, err := combinedDiff(parents, result, settings.diffOptions(), dense)
+	if err != nil {
+		gs.sendInternalError(w, "Failed to compute diff", err)
+		return
+	}
+	var patch strings.Builder
+	for _, file := range files {
+		patch.WriteString(file.Patch)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"commit":   commit.Hash.String(),
+		"parents":  parentHashes,
+		"combined": true,
+		"dense":    dense,
+		"files":    files,
+		"patch":    patch.String(),
+	})
+}
+
+// combinedDiff compares a merge result with all of its parents at once.
+// Like git, only files that differ from every parent are shown; dense
+// additionally drops hunks where the result took one parent's version as is.
+func combinedDiff(parents []map[string]*diffEntry, result map[string]*diffEntry, opts diffOptions, dense bool) ([]*CombinedFileDiff, error) {
+	paths := map[string]bool{}
+	for p := range result {
+		paths[p] = true
+	}
+	for _, entries := range parents {
+		for p := range entries {
+			paths[p] = true
+		}
+	}
+	var sorted []string
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	files := []*CombinedFileDiff{}
+	for _, p := range sorted {
+		dst := result[p]
+		changed := true
+		srcs := make([]*diffEntry, len(parents))
+		for i, entries := range parents {
+			srcs[i] = entries[p]
+			if sameEntry(srcs[i], dst) {
+				changed = false
+			}
+		}
+		if !changed {
+			continue
+		}
+		file, err := combinedFileDiff(p, srcs, dst, opts, dense)
+		if err != nil {
+			return nil, err
+		}
+		if file != nil {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// combinedFileDiff renders one file of a combined diff in git's --cc format
+func combinedFileDiff(p string, srcs []*diffEntry, dst *diffEntry, opts diffOptions, dense bool) (*CombinedFileDiff, error) {
+	read := func(entry *diffEntry) ([]byte, error) {
+		if entry == nil {
+			return nil, nil
+		}
+		return entry.read()
+	}
+	dstData, err := read(dst)
+	if err != nil {
+		return nil, err
+	}
+	srcData := make([][]byte, len(srcs))
+	binary := isBinary(dstData)
+	for i, src := range srcs {
+		if srcData[i], err = read(src); err != nil {
+			return nil, err
+		}
+		binary = binary || isBinary(srcData[i])
+	}
+
+	file := &CombinedFileDiff{Path: p, Binary: binary, ResolvedLines: []int{}}
+	var header strings.Builder
+	if dense {
+		fmt.Fprintf(&header, "diff --cc %s\n", p)
+	} else {
+		fmt.Fprintf(&header, "diff --combined %s\n", p)
+	}
+	short := func(entry *diffEntry) string {
+		if entry == nil {
+			return plumbing.ZeroHash.String()[:7]
+		}
+		return entry.hash.String()[:7]
+	}
+	var hashes []string
+	isNew := true
+	for _, src := range srcs {
+		hashes = append(hashes, short(src))
+		isNew = isNew && src == nil
+	}
+	fmt.Fprintf(&header, "index %s..%s\n", strings.Join(hashes, ","), short(dst))
+	switch {
+	case dst == nil:
+		fmt.Fprintf(&header, "deleted file mode %s\n", gitMode(srcs[0].mode))
+	case isNew:
+		fmt.Fprintf(&header, "new file mode %s\n", gitMode(dst.mode))
+	}
+	if binary {
+		fmt.Fprintf(&header, "Binary files differ\n")
+		file.Patch = header.String()
+		return file, nil
+	}
+
+	rows := combinedRows(srcData, string(dstData), opts)
+	all := uint64(1)<<len(srcs) - 1
+	if len(srcs) == maxCombinedParents {
+		all = ^uint64(0)
+	}
+	for _, row := range rows {
+		if !row.lost && row.parents == all {
+			file.ResolvedLines = append(file.ResolvedLines, row.line)
+		}
+	}
+
+	hunks := combinedHunks(rows, len(srcs), all, dense)
+	if hunks == "" && dense {
+		return nil, nil
+	}
+	if hunks != "" {
+		srcName := "a/" + p
+		if isNew {
+			srcName = "/dev/null"
+		}
+		fmt.Fprintf(&header, "--- %s\n+++ %s\n", srcName, diffSideName("b", p, dst))
+	}
+	file.Patch = header.String() + hunks
+	return file, nil
+}
+
+// combinedRows lines up the result with each parent. Lines removed at the
+// same spot from several parents are kept once, marked with all of them.
+func combinedRows(parents [][]byte, result string, opts diffOptions) []combinedRow {
+	resultLines := splitLines(result)
+	added := make([]uint64, len(resultLines))
+	lost := make([][]combinedRow, len(resultLines)+1)
+	for i, parent := range parents {
+		bit := uint64(1) << i
+		cursor := make([]int, len(resultLines)+1)
+		line := 0
+		for _, op := range diffLinesWith(string(parent), result, opts) {
+			switch op.Type {
+			case diffmatchpatch.DiffEqual:
+				line++
+			case diffmatchpatch.DiffInsert:
+				added[line] |= bit
+				line++
+			case diffmatchpatch.DiffDelete:
+				rows := lost[line]
+				j := cursor[line]
+				for j < len(rows) && (rows[j].text != op.Text || rows[j].parents&bit != 0) {
+					j++
+				}
+				if j < len(rows) {
+					rows[j].parents |= bit
+				} else {
+					lost[line] = append(rows, combinedRow{text: op.Text, parents: bit, lost: true})
+				}
+				cursor[line] = j + 1
+			}
+		}
+	}
+
+	var rows []combinedRow
+	for i := 0; i <= len(resultLines); i++ {
+		rows = append(rows, lost[i]...)
+		if i < len(resultLines) {
+			rows = append(rows, combinedRow{text: resultLines[i], parents: added[i], line: i + 1})
+		}
+	}
+	return rows
+}
+
+// combinedHunks renders the changed rows with diffContextLines of context,
+// one prefix column per parent
+func combinedHunks(rows []combinedRow, n int, all uint64, dense bool) string {
+	// Lines each parent and the result have before each row
+	before := make([][]int, len(rows)+1)
+	counts := make([]int, n+1)
+	for i, row := range rows {
+		before[i] = append([]int(nil), counts...)
+		for p := 0; p < n; p++ {
+			if row.lost == (row.parents&(1<<p) != 0) {
+				counts[p]++
+			}
+		}
+		if !row.lost {
+			counts[n]++
+		}
+	}
+	before[len(rows)] = counts
+
+	var patch strings.Builder
+	for i := 0; i < len(rows); {
+		if rows[i].parents == 0 {
+			i++
+			continue
+		}
+
+		start := i
+		for start > 0 && i-start < diffContextLines && rows[start-1].parents == 0 {
+			start--
+		}
+		end := i
+		for end < len(rows) {
+			if rows[end].parents != 0 {
+				end++
+				continue
+			}
+			run := end
+			for run < len(rows) && rows[run].parents == 0 {
+				run++
+			}
+			if run == len(rows) || run-end > 2*diffContextLines {
+				end += min(run-end, diffContextLines)
+				break
+			}
+			end = run
+		}
+		hunk := rows[start:end]
+		i = end
+
+		// A hunk where some parents match the result and the rest share the
+		// same change only shows the result picking one side
+		var union uint64
+		for _, row := range hunk {
+			union |= row.parents
+		}
+		if dense && union != all {
+			interesting := false
+			for _, row := range hunk {
+				if row.parents != 0 && row.parents != union {
+					interesting = true
+				}
+			}
+			if !interesting {
+				continue
+			}
+		}
+
+		// Unlike unified diffs, git always writes the count here, and an
+		// empty range starts at the line after it
+		marker := strings.Repeat("@", n+1)
+		patch.WriteString(marker)
+		for p := 0; p <= n; p++ {
+			sign := "-"
+			if p == n {
+				sign = "+"
+			}
+			fmt.Fprintf(&patch, " %s%d,%d", sign, before[start][p]+1, before[end][p]-before[start][p])
+		}
+		patch.WriteString(" " + marker + "\n")
+
+		for _, row := range hunk {
+			for p := 0; p < n; p++ {
+				switch {
+				case row.parents&(1<<p) == 0:
+					patch.WriteString(" ")
+				case row.lost:
+					patch.WriteString("-")
+				default:
+					patch.WriteString("+")
+				}
+			}
+			patch.WriteString(row.text)
+			if !strings.HasSuffix(row.text, "\n") {
+				patch.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return patch.String()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type mergeDiffResponse struct {
+	Parents  []string            `json:"parents"`
+	Combined bool                `json:"combined"`
+	Files    []*CombinedFileDiff `json:"files"`
+	Patch    string              `json:"patch"`
+}
+
+func getMergeDiff(t *testing.T, gs *GitService, hash, query string) mergeDiffResponse {
+	t.Helper()
+	rec := serve(t, gs.mergeDiffHandler, "GET", "/git/p/commits/"+hash+"/merge-diff"+query, map[string]string{"projectId": "p", "hash": hash}, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body mergeDiffResponse
+	decodeBody(t, rec, &body)
+	return body
+}
+
+func TestMergeDiffShowsConflictResolution(t *testing.T) {
+	gs := newTestService(t)
+	dir := conflictedRepo(t, gs)
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("ours and theirs\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "add", "a.txt")
+	runGit(t, dir, "commit", "-q", "--no-edit")
+
+	body := getMergeDiff(t, gs, "HEAD", "")
+	if !body.Combined || len(body.Parents) != 2 {
+		t.Fatalf("merge diff: %+v", body)
+	}
+	// b.txt came from the first parent unchanged and is left out
+	if len(body.Files) != 1 || body.Files[0].Path != "a.txt" || !equalInts(body.Files[0].ResolvedLines, []int{1}) {
+		t.Fatalf("files: %+v", body.Files)
+	}
+	if want := runGit(t, dir, "show", "--cc", "--format=", "HEAD") + "\n"; body.Patch != want {
+		t.Errorf("patch\n%s\nwant git's\n%s", body.Patch, want)
+	}
+	if want := runGit(t, dir, "show", "-c", "--format=", "HEAD") + "\n"; getMergeDiff(t, gs, "HEAD", "?dense=false").Patch != want {
+		t.Errorf("combined patch differs from git show -c:\n%s", want)
+	}
+
+	// Taking one side as is resolves nothing worth showing
+	runGit(t, dir, "reset", "-q", "--hard", "HEAD^")
+	runGit(t, dir, "merge", "-q", "-s", "ours", "--no-edit", "other")
+	if body := getMergeDiff(t, gs, "HEAD", ""); len(body.Files) != 0 || body.Patch != "" {
+		t.Errorf("merge keeping ours: %+v", body)
+	}
+}
+
+// An evil merge adding lines neither side had, and a file of its own,
+// renders like git show --cc
+func TestMergeDiffMatchesGit(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	dir := gs.getProjectPath("p")
+	commitTestFiles(t, repo, "Base", map[string]string{"f": "a\nb\nc\n"})
+	runGit(t, dir, "branch", "other")
+	commitTestFiles(t, repo, "Ours", map[string]string{"f": "a\nb\nc\nours\n"})
+	runGit(t, dir, "checkout", "-q", "other")
+	commitTestFiles(t, repo, "Theirs", map[string]string{"f": "a\nb\nc\ntheirs\n"})
+	runGit(t, dir, "checkout", "-q", "master")
+	runGit(t, dir, "merge", "-q", "-s", "ours", "--no-commit", "other")
+	writeFiles(t, repo, map[string]string{"f": "a\nb\nX\nc\nours\ntheirs\n", "g": "new\n"})
+	runGit(t, dir, "add", "f", "g")
+	runGit(t, dir, "commit", "-q", "--no-edit")
+
+	for _, query := range []string{"", "?dense=false"} {
+		args := []string{"show", "--cc", "--format=", "HEAD"}
+		if query != "" {
+			args[1] = "-c"
+		}
+		want := runGit(t, dir, args...) + "\n"
+		if got := getMergeDiff(t, gs, "HEAD", query).Patch; got != want {
+			t.Errorf("git %v:\n%s\ngot\n%s", args, want, got)
+		}
+	}
+}
+
+func TestMergeDiffOfOrdinaryCommit(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	hash := commitTestFiles(t, repo, "Change", map[string]string{"a.txt": "two\n"})
+
+	body := getMergeDiff(t, gs, hash.String(), "")
+	if body.Combined || len(body.Parents) != 1 {
+		t.Errorf("ordinary commit: %+v", body)
+	}
+	if want := runGit(t, gs.getProjectPath("p"), "show", "--format=", hash.String()) + "\n"; body.Patch != want {
+		t.Errorf("patch\n%s\nwant\n%s", body.Patch, want)
+	}
+
+	rec := serve(t, gs.mergeDiffHandler, "GET", "/git/p/commits/HEAD/merge-diff?dense=maybe", map[string]string{"projectId": "p", "hash": "HEAD"}, nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
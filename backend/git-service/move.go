@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// validateProjectID checks that a project id names a single directory
+// directly inside the workspace
+func validateProjectID(id string) error {
+	if id == "" {
+		return fmt.Errorf("project id is empty")
+	}
+	if id == "." || id == ".." {
+		return fmt.Errorf("project id %q is not allowed", id)
+	}
+	if strings.ContainsAny(id, "/\\\x00") {
+		return fmt.Errorf("project id %q cannot contain path separators", id)
+	}
+	if filepath.IsAbs(id) || filepath.VolumeName(id) != "" {
+		return fmt.Errorf("project id %q cannot be an absolute path", id)
+	}
+	return nil
+}
+
+// Move project to a new id endpoint
+func (gs *GitService) moveProjectHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req struct {
+		NewProjectID string `json:"newProjectId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateProjectID(projectID); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid project id: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := validateProjectID(req.NewProjectID); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid newProjectId: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.NewProjectID == projectID {
+		gs.sendError(w, "newProjectId is the current project id", http.StatusBadRequest)
+		return
+	}
+
+	// Both ids are locked, always in the same order so two opposite moves
+	// cannot deadlock. Every operation that writes to a project holds its
+	// lock, so none is running on either directory once both are acquired.
+	first, second := projectID, req.NewProjectID
+	if second < first {
+		first, second = second, first
+	}
+	unlockFirst := gs.lockProject(first)
+	defer unlockFirst()
+	unlockSecond := gs.lockProject(second)
+	defer unlockSecond()
+
+	if _, err := gs.openLockedRepository(projectID); err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	destination := gs.getProjectPath(req.NewProjectID)
+	if _, err := os.Lstat(destination); err == nil {
+		gs.sendError(w, fmt.Sprintf("Project %s already exists", req.NewProjectID), http.StatusConflict)
+		return
+	} else if !os.IsNotExist(err) {
+		gs.sendError(w, "Failed to check destination", http.StatusInternalServerError)
+		return
+	}
+
+	// Settings, reflogs and the other per-project state live in the git
+	// directory and move along with it
+	if err := os.Rename(gs.getProjectPath(projectID), destination); err != nil {
+		gs.sendInternalError(w, "Failed to move project", err)
+		return
+	}
+
+	// Only the caches keyed by project id are left to carry over
+	gs.countsMu.Lock()
+	for key, count := range gs.commitCounts {
+		if scope, ok := strings.CutPrefix(key, projectID+"\x00"); ok {
+			delete(gs.commitCounts, key)
+			gs.commitCounts[req.NewProjectID+"\x00"+scope] = count
+		}
+	}
+	gs.countsMu.Unlock()
+	gs.statsMu.Lock()
+	delete(gs.stats, projectID)
+	gs.statsMu.Unlock()
+	gs.repos.invalidate(projectID)
+	gs.readRepos.invalidate(projectID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":           fmt.Sprintf("Project moved from %s to %s", projectID, req.NewProjectID),
+		"projectId":         req.NewProjectID,
+		"previousProjectId": projectID,
+		"path":              destination,
+		"gitDir":            gs.gitDir(req.NewProjectID),
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestMoveProject(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "p")
+	updateSettings(t, gs, map[string]bool{"ignoreAllSpace": true})
+	rec := serve(t, gs.commitCountHandler, "GET", "/git/p/commit-count", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = serve(t, gs.moveProjectHandler, "POST", "/git/p/move", project("p"), map[string]string{"newProjectId": "q"})
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		ProjectID         string `json:"projectId"`
+		PreviousProjectID string `json:"previousProjectId"`
+		Path              string `json:"path"`
+		GitDir            string `json:"gitDir"`
+	}
+	decodeBody(t, rec, &body)
+	if body.ProjectID != "q" || body.PreviousProjectID != "p" || body.Path != gs.getProjectPath("q") || body.GitDir != gs.gitDir("q") {
+		t.Errorf("move response: %+v", body)
+	}
+	if _, err := os.Stat(gs.getProjectPath("p")); !os.IsNotExist(err) {
+		t.Errorf("the old directory is still there: %v", err)
+	}
+
+	// The old id is gone and everything answers under the new one
+	rec = serve(t, gs.statusHandler, "GET", "/git/p/status", project("p"), nil)
+	expectStatus(t, rec, http.StatusNotFound)
+	rec = serve(t, gs.statusHandler, "GET", "/git/q/status", project("q"), nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = serve(t, gs.getSettingsHandler, "GET", "/git/q/settings", project("q"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var settings struct {
+		Settings ProjectSettings `json:"settings"`
+	}
+	decodeBody(t, rec, &settings)
+	if !settings.Settings.IgnoreAllSpace {
+		t.Errorf("settings did not move with the project: %+v", settings.Settings)
+	}
+
+	rec = serve(t, gs.commitCountHandler, "GET", "/git/q/commit-count", project("q"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var count commitCountResponse
+	decodeBody(t, rec, &count)
+	if count.Count != 1 || !count.Cached {
+		t.Errorf("commit count after the move: %+v", count)
+	}
+}
+
+func TestMoveProjectRejections(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "p")
+	initTestRepo(t, gs, "taken")
+
+	for _, test := range []struct {
+		from, to string
+		status   int
+	}{
+		{"p", "taken", http.StatusConflict},
+		{"p", "p", http.StatusBadRequest},
+		{"p", "../escape", http.StatusBadRequest},
+		{"p", "..", http.StatusBadRequest},
+		{"p", "", http.StatusBadRequest},
+		{"..", "q", http.StatusBadRequest},
+		{"missing", "q", http.StatusNotFound},
+	} {
+		rec := serve(t, gs.moveProjectHandler, "POST", "/git/"+test.from+"/move", project(test.from), map[string]string{"newProjectId": test.to})
+		if rec.Code != test.status {
+			t.Errorf("move %q to %q: status %d, want %d; body: %s", test.from, test.to, rec.Code, test.status, rec.Body.String())
+		}
+	}
+	rec := serve(t, gs.statusHandler, "GET", "/git/p/status", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+}
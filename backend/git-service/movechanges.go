@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/gorilla/mux"
+)
+
+// Move uncommitted changes to another branch endpoint
+func (gs *GitService) moveChangesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req struct {
+		Branch string `json:"branch"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateRefName(req.Branch); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid branch name: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	previousHead, err := repo.Head()
+	if err != nil {
+		gs.sendError(w, "The repository has no commits to branch from", http.StatusBadRequest)
+		return
+	}
+	branchRef := plumbing.NewBranchReferenceName(req.Branch)
+	if previousHead.Name() == branchRef {
+		gs.sendError(w, fmt.Sprintf("Already on branch '%s'", req.Branch), http.StatusBadRequest)
+		return
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+
+	status, err := worktree.Status()
+	if err != nil {
+		gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+		return
+	}
+	var carried []string
+	for file, fileStatus := range status {
+		if fileStatus.Staging != git.Unmodified || fileStatus.Worktree != git.Unmodified {
+			carried = append(carried, file)
+		}
+	}
+	sort.Strings(carried)
+
+	// A new branch starts at HEAD, so only HEAD moves. An existing branch
+	// needs the files that differ between the two commits updated, which
+	// is refused where that would overwrite a local change, like git switch.
+	created := false
+	target, err := repo.Reference(branchRef, true)
+	if err == plumbing.ErrReferenceNotFound {
+		// The naming policy only governs new branches
+		settings, err := gs.loadSettings(projectID)
+		if err != nil {
+			gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+			return
+		}
+		if !gs.checkBranchName(w, settings, req.Branch) {
+			return
+		}
+		created = true
+	} else if err != nil {
+		gs.sendError(w, "Failed to read branch", http.StatusInternalServerError)
+		return
+	} else if target.Hash() != previousHead.Hash() {
+		conflicts, err := gs.switchCarryingChanges(repo, worktree, previousHead.Hash(), target.Hash(), status)
+		if err != nil {
+			gs.sendInternalError(w, "Failed to update working tree", err)
+			return
+		}
+		if len(conflicts) > 0 {
+			gs.sendErrorWithDetails(w, fmt.Sprintf("Local changes would be overwritten by switching to '%s'", req.Branch), http.StatusConflict, map[string]interface{}{
+				"conflicts": conflicts,
+			})
+			return
+		}
+	}
+
+	if created {
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(branchRef, previousHead.Hash())); err != nil {
+			gs.sendError(w, "Failed to create branch", http.StatusInternalServerError)
+			return
+		}
+		gs.appendReflog(projectID, branchRef, plumbing.ZeroHash, previousHead.Hash(), gs.resolveIdentity(projectID), "branch: Created from HEAD")
+	}
+	if err := repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, branchRef)); err != nil {
+		gs.sendError(w, "Failed to switch branch", http.StatusInternalServerError)
+		return
+	}
+	gs.logCheckout(projectID, repo, previousHead)
+	gs.recordRecentBranch(projectID, req.Branch)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Moved %d changed files to branch '%s'", len(carried), req.Branch),
+		"branch":  req.Branch,
+		"created": created,
+		"files":   carried,
+	})
+}
+
+// switchCarryingChanges updates the index and working tree from the from
+// commit to the to commit, leaving locally changed files alone. If any file
+// that differs between the commits has local changes, nothing is written and
+// the conflicting paths are returned.
+func (gs *GitService) switchCarryingChanges(repo *git.Repository, worktree *git.Worktree, from, to plumbing.Hash, status git.Status) ([]string, error) {
+	fromCommit, err := repo.CommitObject(from)
+	if err != nil {
+		return nil, err
+	}
+	toCommit, err := repo.CommitObject(to)
+	if err != nil {
+		return nil, err
+	}
+	fromEntries, err := treeEntries(fromCommit, "")
+	if err != nil {
+		return nil, err
+	}
+	toEntries, err := treeEntries(toCommit, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var changed, conflicts []string
+	for p, entry := range fromEntries {
+		if other, ok := toEntries[p]; !ok || other.hash != entry.hash || other.mode != entry.mode {
+			changed = append(changed, p)
+		}
+	}
+	for p := range toEntries {
+		if _, ok := fromEntries[p]; !ok {
+			changed = append(changed, p)
+		}
+	}
+	sort.Strings(changed)
+	for _, p := range changed {
+		if fileStatus, ok := status[p]; ok && (fileStatus.Staging != git.Unmodified || fileStatus.Worktree != git.Unmodified) {
+			conflicts = append(conflicts, p)
+		}
+	}
+	if len(conflicts) > 0 {
+		return conflicts, nil
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range changed {
+		entry, ok := toEntries[p]
+		if !ok {
+			if err := worktree.Filesystem.Remove(p); err != nil {
+				return nil, err
+			}
+			removeEmptyParents(worktree.Filesystem, p)
+			if _, err := idx.Remove(p); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		blob, err := repo.BlobObject(entry.hash)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBlobToWorktree(worktree.Filesystem, p, blob, entry.mode); err != nil {
+			return nil, err
+		}
+		e, err := idx.Entry(p)
+		if err == index.ErrEntryNotFound {
+			e = idx.Add(p)
+		} else if err != nil {
+			return nil, err
+		}
+		e.Hash = entry.hash
+		e.Mode = entry.mode
+		e.Size = uint32(blob.Size)
+		e.ModifiedAt = time.Now()
+	}
+	return nil, repo.Storer.SetIndex(idx)
+}
+
+// removeEmptyParents deletes the directories above a removed file that are now empty
+func removeEmptyParents(fs billy.Filesystem, file string) {
+	for dir := path.Dir(file); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		entries, err := fs.ReadDir(dir)
+		if err != nil || len(entries) > 0 {
+			return
+		}
+		if err := fs.Remove(dir); err != nil {
+			return
+		}
+	}
+}
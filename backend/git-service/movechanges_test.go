@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type moveChangesResponse struct {
+	Branch  string   `json:"branch"`
+	Created bool     `json:"created"`
+	Files   []string `json:"files"`
+}
+
+func readProjectFile(t *testing.T, gs *GitService, name string) string {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(gs.getProjectPath("p"), name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func headBranch(t *testing.T, gs *GitService) string {
+	t.Helper()
+	return runGit(t, gs.getProjectPath("p"), "symbolic-ref", "--short", "HEAD")
+}
+
+func TestMoveChangesToNewBranch(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	master := refHash(t, repo, "refs/heads/master")
+	writeFiles(t, repo, map[string]string{"a.txt": "work in progress\n"})
+
+	rec := serve(t, gs.moveChangesHandler, "POST", "/git/p/move-changes", project("p"), map[string]string{"branch": "wip"})
+	expectStatus(t, rec, http.StatusOK)
+	var body moveChangesResponse
+	decodeBody(t, rec, &body)
+	if !body.Created || !equalStrings(body.Files, []string{"a.txt"}) {
+		t.Errorf("response %+v", body)
+	}
+	if headBranch(t, gs) != "wip" || refHash(t, repo, "refs/heads/wip") != master {
+		t.Error("HEAD is not on a new wip branch at master")
+	}
+	if readProjectFile(t, gs, "a.txt") != "work in progress\n" {
+		t.Error("the local change was lost")
+	}
+}
+
+func TestMoveChangesToExistingBranch(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	dir := gs.getProjectPath("p")
+	runGit(t, dir, "checkout", "-q", "-b", "other")
+	commitTestFiles(t, repo, "Other b", map[string]string{"b.txt": "from other\n"})
+	runGit(t, dir, "checkout", "-q", "-b", "clashing", "master")
+	commitTestFiles(t, repo, "Clashing a", map[string]string{"a.txt": "from clashing\n"})
+	runGit(t, dir, "checkout", "-q", "master")
+	writeFiles(t, repo, map[string]string{"a.txt": "work in progress\n"})
+
+	// The branch changed the same file, so switching would lose the change
+	rec := serve(t, gs.moveChangesHandler, "POST", "/git/p/move-changes", project("p"), map[string]string{"branch": "clashing"})
+	expectStatus(t, rec, http.StatusConflict)
+	if headBranch(t, gs) != "master" || readProjectFile(t, gs, "a.txt") != "work in progress\n" {
+		t.Fatal("a refused move changed the working tree")
+	}
+
+	rec = serve(t, gs.moveChangesHandler, "POST", "/git/p/move-changes", project("p"), map[string]string{"branch": "other"})
+	expectStatus(t, rec, http.StatusOK)
+	var body moveChangesResponse
+	decodeBody(t, rec, &body)
+	if body.Created {
+		t.Error("an existing branch was reported created")
+	}
+	if headBranch(t, gs) != "other" {
+		t.Error("HEAD is not on other")
+	}
+	if readProjectFile(t, gs, "a.txt") != "work in progress\n" || readProjectFile(t, gs, "b.txt") != "from other\n" {
+		t.Error("the working tree does not combine other with the local change")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+)
+
+// MoveFileRequest renames a tracked file. Overwrite replaces an existing
+// file at To; without it the move is refused.
+type MoveFileRequest struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Overwrite bool   `json:"overwrite,omitempty"`
+}
+
+// Move file endpoint. Like git mv, the index entry moves along with the
+// file, so the rename is staged with the content the index already had.
+func (gs *GitService) moveFileHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req MoveFileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.From == "" || req.To == "" {
+		gs.sendError(w, "from and to are required", http.StatusBadRequest)
+		return
+	}
+	from, ok := repoPath(req.From)
+	if !ok {
+		gs.sendError(w, fmt.Sprintf("Invalid path %s", req.From), http.StatusBadRequest)
+		return
+	}
+	to, ok := repoPath(req.To)
+	if !ok {
+		gs.sendError(w, fmt.Sprintf("Invalid path %s", req.To), http.StatusBadRequest)
+		return
+	}
+	if from == to {
+		gs.sendError(w, "from and to are the same path", http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+
+	info, err := worktree.Filesystem.Lstat(from)
+	if os.IsNotExist(err) {
+		gs.sendError(w, fmt.Sprintf("Path %s not found", from), http.StatusNotFound)
+		return
+	} else if err != nil {
+		gs.sendError(w, fmt.Sprintf("Failed to read %s", from), http.StatusInternalServerError)
+		return
+	}
+	if info.IsDir() {
+		gs.sendError(w, "Only files can be moved", http.StatusBadRequest)
+		return
+	}
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+	if _, err := idx.Entry(from); err != nil {
+		gs.sendError(w, fmt.Sprintf("Path %s is not tracked; stage it before moving it", from), http.StatusBadRequest)
+		return
+	}
+
+	if existing, err := worktree.Filesystem.Lstat(to); err == nil {
+		if existing.IsDir() {
+			gs.sendError(w, fmt.Sprintf("Destination %s is a directory", to), http.StatusConflict)
+			return
+		}
+		if !req.Overwrite {
+			gs.sendError(w, fmt.Sprintf("Destination %s already exists; set overwrite to true to replace it", to), http.StatusConflict)
+			return
+		}
+		if err := worktree.Filesystem.Remove(to); err != nil {
+			gs.sendInternalError(w, fmt.Sprintf("Failed to remove %s", to), err)
+			return
+		}
+		if _, err := idx.Remove(to); err == nil {
+			if err := repo.Storer.SetIndex(idx); err != nil {
+				gs.sendError(w, "Failed to write index", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	hash, err := worktree.Move(from, to)
+	if err != nil {
+		gs.sendInternalError(w, fmt.Sprintf("Failed to move %s", from), err)
+		return
+	}
+	removeEmptyParents(worktree.Filesystem, from)
+
+	status, err := gs.getRepositoryStatus(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Moved %s to %s", from, to),
+		"from":    from,
+		"to":      to,
+		"hash":    hash.String(),
+		"status":  status,
+	})
+}
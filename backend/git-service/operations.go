@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// operationRetention is how long a finished operation's progress stays readable
+const operationRetention = 10 * time.Minute
+
+var (
+	// errOperationExists is returned when a client reuses the ID of a running operation
+	errOperationExists = errors.New("an operation with this ID is already running")
+
+	// progressLine matches git's "Receiving objects:  42% (420/1000)" and
+	// "Counting objects: 12, done." progress lines, with or without the
+	// "remote: " prefix of server-side phases
+	progressLine = regexp.MustCompile(`^(?:remote: )?([A-Za-z ]+?):\s+(?:(\d+)% \((\d+)/(\d+)\)|(\d+))(.*)$`)
+)
+
+// PhaseProgress is the progress of one phase of a transfer
+type PhaseProgress struct {
+	Name    string `json:"name"`
+	Percent int    `json:"percent"`
+	Current int    `json:"current"`
+	Total   int    `json:"total,omitempty"`
+	Done    bool   `json:"done"`
+}
+
+// OperationProgress is a snapshot of a long-running operation
+type OperationProgress struct {
+	ID         string          `json:"id"`
+	ProjectID  string          `json:"projectId"`
+	Kind       string          `json:"kind"`
+	Status     string          `json:"status"`
+	Phase      string          `json:"phase,omitempty"`
+	Percent    int             `json:"percent"`
+	Phases     []PhaseProgress `json:"phases"`
+	Error      string          `json:"error,omitempty"`
+	StartedAt  time.Time       `json:"startedAt"`
+	UpdatedAt  time.Time       `json:"updatedAt"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// operation tracks the progress of a clone or push. It is an io.Writer for
+// go-git's progress output, which it parses into phases.
+type operation struct {
+	mu       sync.Mutex
+	progress OperationProgress
+	pending  string
+	changed  chan struct{}
+}
+
+// startOperation registers a running operation. An empty id gets a generated one.
+func (gs *GitService) startOperation(id, projectID, kind string) (*operation, error) {
+	if id == "" {
+		buf := make([]byte, 8)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		id = hex.EncodeToString(buf)
+	}
+
+	gs.operationsMu.Lock()
+	defer gs.operationsMu.Unlock()
+	if existing, ok := gs.operations[id]; ok && existing.snapshot().Status == "running" {
+		return nil, errOperationExists
+	}
+	now := time.Now().UTC()
+	op := &operation{
+		progress: OperationProgress{
+			ID:        id,
+			ProjectID: projectID,
+			Kind:      kind,
+			Status:    "running",
+			Phases:    []PhaseProgress{},
+			StartedAt: now,
+			UpdatedAt: now,
+		},
+		changed: make(chan struct{}),
+	}
+	gs.operations[id] = op
+	return op, nil
+}
+
+// finishOperation marks an operation done and forgets it after the retention period
+func (gs *GitService) finishOperation(op *operation, err error) {
+	op.mu.Lock()
+	now := time.Now().UTC()
+	op.progress.Status = "succeeded"
+	if err != nil {
+		op.progress.Status = "failed"
+		op.progress.Error = err.Error()
+	}
+	op.progress.UpdatedAt = now
+	op.progress.FinishedAt = &now
+	op.notifyLocked()
+	id := op.progress.ID
+	progress := op.progress
+	op.mu.Unlock()
+
+	attrs := []any{
+		"operationId", id,
+		"kind", progress.Kind,
+		"projectId", progress.ProjectID,
+		"status", progress.Status,
+		"durationMs", now.Sub(progress.StartedAt).Milliseconds(),
+	}
+	if err != nil {
+		gs.logger.Error("operation failed", append(attrs, "error", err.Error())...)
+	} else {
+		gs.logger.Info("operation finished", attrs...)
+	}
+
+	time.AfterFunc(operationRetention, func() {
+		gs.operationsMu.Lock()
+		defer gs.operationsMu.Unlock()
+		if gs.operations[id] == op {
+			delete(gs.operations, id)
+		}
+	})
+}
+
+// lookupOperation finds an operation of a project
+func (gs *GitService) lookupOperation(projectID, id string) *operation {
+	gs.operationsMu.Lock()
+	defer gs.operationsMu.Unlock()
+	op, ok := gs.operations[id]
+	if !ok || op.snapshot().ProjectID != projectID {
+		return nil
+	}
+	return op
+}
+
+// Write parses progress output. git redraws a line with \r while a phase
+// advances and ends it with \n, so both terminate a line.
+func (op *operation) Write(p []byte) (int, error) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	op.pending += string(p)
+	for {
+		i := strings.IndexAny(op.pending, "\r\n")
+		if i < 0 {
+			break
+		}
+		op.parseLocked(op.pending[:i])
+		op.pending = op.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+// parseLocked applies one progress line to the snapshot
+func (op *operation) parseLocked(line string) {
+	m := progressLine.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return
+	}
+	name := strings.ToLower(strings.Fields(m[1])[0])
+	if name == "total" {
+		return
+	}
+
+	phase := PhaseProgress{Name: name}
+	if m[2] != "" {
+		phase.Percent, _ = strconv.Atoi(m[2])
+		phase.Current, _ = strconv.Atoi(m[3])
+		phase.Total, _ = strconv.Atoi(m[4])
+	} else {
+		phase.Current, _ = strconv.Atoi(m[5])
+	}
+	phase.Done = strings.Contains(m[6], "done")
+	if phase.Done {
+		phase.Percent = 100
+	}
+
+	phases := op.progress.Phases
+	if len(phases) > 0 && phases[len(phases)-1].Name == name {
+		phases[len(phases)-1] = phase
+	} else {
+		// A new phase implies the earlier ones finished even if git did not say so
+		for i := range phases {
+			phases[i].Done = true
+			phases[i].Percent = 100
+		}
+		op.progress.Phases = append(phases, phase)
+	}
+	op.progress.Phase = name
+	op.progress.Percent = phase.Percent
+	op.progress.UpdatedAt = time.Now().UTC()
+	op.notifyLocked()
+}
+
+// notifyLocked wakes everyone waiting for the next update
+func (op *operation) notifyLocked() {
+	close(op.changed)
+	op.changed = make(chan struct{})
+}
+
+// watch copies the current progress along with a channel closed on the next update
+func (op *operation) watch() (OperationProgress, <-chan struct{}) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	progress := op.progress
+	progress.Phases = append([]PhaseProgress{}, op.progress.Phases...)
+	return progress, op.changed
+}
+
+// snapshot copies the current progress
+func (op *operation) snapshot() OperationProgress {
+	progress, _ := op.watch()
+	return progress
+}
+
+// Get operation progress endpoint
+func (gs *GitService) operationProgressHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	op := gs.lookupOperation(projectID, vars["id"])
+	if op == nil {
+		gs.sendError(w, "Operation not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(op.snapshot())
+}
+
+// Stream operation progress endpoint
+func (gs *GitService) operationProgressStreamHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	op := gs.lookupOperation(projectID, vars["id"])
+	if op == nil {
+		gs.sendError(w, "Operation not found", http.StatusNotFound)
+		return
+	}
+
+	sse, err := newSSEWriter(w)
+	if err != nil {
+		gs.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for {
+		progress, changed := op.watch()
+		if progress.Status != "running" {
+			sse.send("done", progress)
+			return
+		}
+		if err := sse.send("progress", progress); err != nil {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestOperationParsesGitProgress(t *testing.T) {
+	gs := newTestService(t)
+	op, err := gs.startOperation("op", "p", "clone")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var percents []int
+	for _, chunk := range []string{
+		"remote: Counting objects: 12, done.\n",
+		"Receiving objects:  10% (1/10)\r",
+		"Receiving objects:  50% (5/10)\rReceiving",
+		" objects:  90% (9/10)\r",
+		"Receiving objects: 100% (10/10), 2.1 KiB | 2.1 MiB/s, done.\n",
+	} {
+		fmt.Fprint(op, chunk)
+		percents = append(percents, op.snapshot().Percent)
+	}
+	if !equalInts(percents, []int{100, 10, 50, 90, 100}) {
+		t.Errorf("percent after each write %v", percents)
+	}
+	progress := op.snapshot()
+	if progress.Phase != "receiving" || len(progress.Phases) != 2 || progress.Phases[0].Name != "counting" || !progress.Phases[0].Done {
+		t.Errorf("phases %+v", progress.Phases)
+	}
+	if last := progress.Phases[1]; last.Current != 10 || last.Total != 10 || !last.Done {
+		t.Errorf("receiving phase %+v", last)
+	}
+
+	if _, err := gs.startOperation("op", "p", "clone"); err != errOperationExists {
+		t.Errorf("reusing a running operation's ID: %v", err)
+	}
+	gs.finishOperation(op, nil)
+	if _, err := gs.startOperation("op", "p", "clone"); err != nil {
+		t.Errorf("reusing a finished operation's ID: %v", err)
+	}
+}
+
+func TestCloneProgressIsPollable(t *testing.T) {
+	gs := newTestService(t)
+	remote := addTestRemote(t, initTestRepo(t, gs, "source"))
+
+	rec := serve(t, gs.cloneHandler, "POST", "/git/clone", nil, CloneRequest{URL: remote, ProjectID: "p", OperationID: "clone-1"})
+	expectStatus(t, rec, http.StatusOK)
+
+	vars := map[string]string{"projectId": "p", "id": "clone-1"}
+	rec = serve(t, gs.operationProgressHandler, "GET", "/git/p/operations/clone-1/progress", vars, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var progress OperationProgress
+	decodeBody(t, rec, &progress)
+	if progress.Kind != "clone" || progress.Status != "succeeded" || progress.FinishedAt == nil {
+		t.Errorf("progress %+v", progress)
+	}
+
+	// A finished operation's stream ends with a single done event
+	rec = serve(t, gs.operationProgressStreamHandler, "GET", "/git/p/operations/clone-1/progress/stream", vars, nil)
+	events := readEvents(t, rec)
+	if len(events) != 1 || events[0].Event != "done" {
+		t.Fatalf("events %+v", events)
+	}
+	var streamed OperationProgress
+	if err := json.Unmarshal([]byte(events[0].Data), &streamed); err != nil || streamed.Status != "succeeded" {
+		t.Errorf("done event %s: %v", events[0].Data, err)
+	}
+
+	// Operations belong to their project
+	rec = serve(t, gs.operationProgressHandler, "GET", "/git/q/operations/clone-1/progress", map[string]string{"projectId": "q", "id": "clone-1"}, nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
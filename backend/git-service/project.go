@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// invalidProjectPath stands in for the path of a project id that could
+// escape the workspace. No file system call accepts a NUL byte, so anything
+// using it fails instead of touching another directory.
+const invalidProjectPath = "\x00invalid-project"
+
+// validateProjectVars rejects requests whose projectId route variable is not
+// a plain directory name
+func (gs *GitService) validateProjectVars(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if projectID, ok := mux.Vars(r)["projectId"]; ok {
+			if err := validateProjectID(projectID); err != nil {
+				gs.sendError(w, fmt.Sprintf("Invalid project id: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Delete project endpoint. The project's directory is removed along with
+// everything in it, so the request must be confirmed.
+func (gs *GitService) deleteProjectHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	confirm := false
+	if value := r.URL.Query().Get("confirm"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			gs.sendError(w, "Invalid confirm value", http.StatusBadRequest)
+			return
+		}
+		confirm = parsed
+	}
+	if !confirm {
+		gs.sendError(w, "Deleting a project removes its directory; set confirm=true to proceed", http.StatusBadRequest)
+		return
+	}
+	if err := validateProjectID(projectID); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid project id: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Clones, fetches, pulls, pushes and gc all hold the project lock, so
+	// none of them is using the directory once it is acquired
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	// Only a directory holding a repository is ever removed
+	if _, err := gs.openLockedRepository(projectID); err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	projectPath := gs.getProjectPath(projectID)
+	if err := gs.removeProject(projectID); err != nil {
+		gs.sendInternalError(w, "Failed to delete project", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   fmt.Sprintf("Project %s deleted", projectID),
+		"projectId": projectID,
+		"path":      projectPath,
+	})
+}
+
+// removeProject deletes a project's directory along with what the service
+// caches about it. The caller holds the project lock.
+func (gs *GitService) removeProject(projectID string) error {
+	if err := os.RemoveAll(gs.getProjectPath(projectID)); err != nil {
+		return err
+	}
+	gs.repos.invalidate(projectID)
+	gs.readRepos.invalidate(projectID)
+
+	gs.countsMu.Lock()
+	for key := range gs.commitCounts {
+		if strings.HasPrefix(key, projectID+"\x00") {
+			delete(gs.commitCounts, key)
+		}
+	}
+	gs.countsMu.Unlock()
+	gs.statsMu.Lock()
+	delete(gs.stats, projectID)
+	gs.statsMu.Unlock()
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDeleteProjectRequiresConfirmation(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "p")
+
+	rec := serve(t, gs.deleteProjectHandler, "DELETE", "/git/p", project("p"), nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+	if _, err := os.Stat(gs.getProjectPath("p")); err != nil {
+		t.Fatalf("project was removed without confirmation: %v", err)
+	}
+
+	rec = serve(t, gs.deleteProjectHandler, "DELETE", "/git/p?confirm=true", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	if _, err := os.Stat(gs.getProjectPath("p")); !os.IsNotExist(err) {
+		t.Fatalf("project directory still exists: %v", err)
+	}
+	rec = serve(t, gs.statusHandler, "GET", "/git/p/status", project("p"), nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestDeleteProjectRefusesNonRepository(t *testing.T) {
+	gs := newTestService(t)
+	if err := os.MkdirAll(gs.getProjectPath("plain"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	rec := serve(t, gs.deleteProjectHandler, "DELETE", "/git/plain?confirm=true", project("plain"), nil)
+	expectStatus(t, rec, http.StatusNotFound)
+	if _, err := os.Stat(gs.getProjectPath("plain")); err != nil {
+		t.Fatalf("a directory without a repository was removed: %v", err)
+	}
+}
+
+// A delete waits for whatever operation holds the project lock instead of
+// pulling the directory out from under it
+func TestDeleteProjectWaitsForLockHolder(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "p")
+
+	unlock := gs.lockProject("p")
+	done := make(chan int)
+	go func() {
+		done <- serve(t, gs.deleteProjectHandler, "DELETE", "/git/p?confirm=true", project("p"), nil).Code
+	}()
+
+	select {
+	case code := <-done:
+		unlock()
+		t.Fatalf("delete finished with %d while the project was locked", code)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, err := os.Stat(gs.getProjectPath("p")); err != nil {
+		t.Fatalf("project removed while locked: %v", err)
+	}
+	unlock()
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("delete status %d after the lock was released", code)
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+)
+
+// PullRequest represents a pull request. Branch names the remote branch and
+// defaults to the current branch's upstream.
+type PullRequest struct {
+	Remote      string      `json:"remote,omitempty"`
+	Branch      string      `json:"branch,omitempty"`
+	Rebase      bool        `json:"rebase,omitempty"`
+	Author      Author      `json:"author"`
+	OperationID string      `json:"operationId,omitempty"`
+	Auth        *RemoteAuth `json:"auth,omitempty"`
+}
+
+// Pull changes endpoint
+func (gs *GitService) pullHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req PullRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Branch != "" {
+		if err := validateRefName(req.Branch); err != nil {
+			gs.sendError(w, fmt.Sprintf("Invalid branch name: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	headRef, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil || headRef.Type() != plumbing.SymbolicReference {
+		gs.sendError(w, "Cannot pull with a detached HEAD", http.StatusBadRequest)
+		return
+	}
+	current := headRef.Target()
+
+	cfg, err := repo.Config()
+	if err != nil {
+		gs.sendError(w, "Failed to read config", http.StatusInternalServerError)
+		return
+	}
+	remoteName, remoteBranch := req.Remote, plumbing.ReferenceName("")
+	if req.Branch != "" {
+		remoteBranch = plumbing.NewBranchReferenceName(req.Branch)
+	}
+	if b, ok := cfg.Branches[current.Short()]; ok {
+		if remoteName == "" {
+			remoteName = b.Remote
+		}
+		if remoteBranch == "" {
+			remoteBranch = b.Merge
+		}
+	}
+	if remoteName == "" {
+		remoteName = git.DefaultRemoteName
+	}
+	if remoteBranch == "" {
+		remoteBranch = current
+	}
+	remote, ok := cfg.Remotes[remoteName]
+	if !ok {
+		gs.sendError(w, fmt.Sprintf("Remote %s not found", remoteName), http.StatusNotFound)
+		return
+	}
+	auth, err := remoteAuthFor(repo, remoteName, req.Auth)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid auth: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+
+	// go-git moves HEAD before it finds out local changes are in the way,
+	// so a pull over uncommitted work is refused up front
+	status, err := worktree.Status()
+	if err != nil {
+		gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+		return
+	}
+	if dirty := uncommittedFiles(status); len(dirty) > 0 {
+		gs.sendErrorWithDetails(w, "Commit or stash local changes before pulling", http.StatusConflict, map[string]interface{}{
+			"files": dirty,
+		})
+		return
+	}
+
+	oldHead := plumbing.ZeroHash
+	if head, err := repo.Head(); err == nil {
+		oldHead = head.Hash()
+	}
+
+	op, err := gs.startOperation(req.OperationID, projectID, "pull")
+	if err != nil {
+		gs.sendError(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	ctx, cancel := gs.remoteContext(r.Context())
+	defer cancel()
+	err = worktree.PullContext(ctx, &git.PullOptions{
+		RemoteName:    remoteName,
+		ReferenceName: remoteBranch,
+		Auth:          auth,
+		Progress:      io.MultiWriter(os.Stdout, op),
+	})
+	err = redactError(timeoutError(ctx, err), req.Auth)
+	gs.finishOperation(op, err)
+
+	// Each of these outcomes means the fetch half went through
+	if err == nil || err == git.NoErrAlreadyUpToDate || err == git.ErrNonFastForwardUpdate {
+		gs.recordFetch(projectID, remoteName)
+	}
+
+	alreadyUpToDate, mode := false, "fast-forward"
+	switch err {
+	case nil:
+		if newHead, err := repo.Head(); err == nil && newHead.Hash() != oldHead {
+			gs.logHeadUpdate(projectID, repo, oldHead, newHead.Hash(), gs.resolveIdentity(projectID), "pull: Fast-forward")
+		}
+	case git.NoErrAlreadyUpToDate:
+		alreadyUpToDate = true
+	case git.ErrNonFastForwardUpdate:
+		// The fetch has happened; go-git cannot merge or rebase, so the
+		// diverged histories are combined here
+		tracking := plumbing.NewRemoteReferenceName(remoteName, remoteBranch.Short())
+		theirs, err := gs.resolveCommit(repo, tracking.String())
+		if err != nil {
+			gs.sendError(w, fmt.Sprintf("Remote branch %s not found", tracking.Short()), http.StatusNotFound)
+			return
+		}
+		ours, err := repo.CommitObject(oldHead)
+		if err != nil {
+			gs.sendError(w, "Failed to read HEAD", http.StatusInternalServerError)
+			return
+		}
+		if upToDate, err := theirs.IsAncestor(ours); err != nil {
+			gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+			return
+		} else if upToDate {
+			alreadyUpToDate = true
+			break
+		}
+
+		settings, err := gs.loadSettings(projectID)
+		if err != nil {
+			gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+			return
+		}
+		if settings.RequireSignedCommits {
+			gs.sendError(w, unsignedCommitMessage, http.StatusUnprocessableEntity)
+			return
+		}
+		committer := gs.fillIdentity(projectID, req.Author)
+		if committer.Name == "" || committer.Email == "" {
+			gs.sendError(w, missingIdentityMessage, http.StatusBadRequest)
+			return
+		}
+
+		var result *object.Commit
+		var entry string
+		if req.Rebase {
+			mode = "rebase"
+			commits, failed, conflicts, err := rebaseCommits(repo, ours, theirs, committer, settings.ConflictStyle)
+			if err != nil {
+				gs.sendInternalError(w, "Failed to rebase", err)
+				return
+			}
+			if len(conflicts) > 0 {
+				gs.sendErrorWithDetails(w, fmt.Sprintf("Rebasing %s conflicts with %s", failed.Hash.String()[:7], tracking.Short()), http.StatusConflict, map[string]interface{}{
+					"commit":    failed.Hash.String(),
+					"conflicts": conflicts,
+				})
+				return
+			}
+			result = theirs
+			if len(commits) > 0 {
+				result = commits[len(commits)-1]
+			}
+			entry = fmt.Sprintf("pull --rebase: rebased %d commit%s onto %s", len(commits), plural(len(commits)), tracking.Short())
+		} else {
+			mode = "merge"
+			url := remoteName
+			if len(remote.URLs) > 0 {
+				url = anonymizeURL(remote.URLs[0])
+			}
+			message := fmt.Sprintf("Merge branch '%s' of %s\n", remoteBranch.Short(), url)
+			var conflicts []Conflict
+			result, conflicts, err = mergeCommits(repo, ours, theirs, committer, message, settings.ConflictStyle)
+			if err != nil {
+				gs.sendInternalError(w, "Failed to merge", err)
+				return
+			}
+			if len(conflicts) > 0 {
+				gs.sendErrorWithDetails(w, fmt.Sprintf("Merging %s conflicts with the current branch", tracking.Short()), http.StatusConflict, map[string]interface{}{
+					"conflicts": conflicts,
+				})
+				return
+			}
+			entry = "pull: Merge made by a three-way merge"
+		}
+
+		if _, err := gs.switchCarryingChanges(repo, worktree, ours.Hash, result.Hash, status); err != nil {
+			gs.sendInternalError(w, "Failed to update working tree", err)
+			return
+		}
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(current, result.Hash)); err != nil {
+			gs.sendError(w, "Failed to update HEAD", http.StatusInternalServerError)
+			return
+		}
+		gs.logHeadUpdate(projectID, repo, ours.Hash, result.Hash, committer, entry)
+	default:
+		if errors.Is(err, errRemoteTimeout) {
+			gs.sendError(w, fmt.Sprintf("Failed to pull: %v", err), http.StatusGatewayTimeout)
+			return
+		}
+		gs.sendInternalError(w, "Failed to pull", err)
+		return
+	}
+
+	repoStatus, err := gs.getRepositoryStatus(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+		return
+	}
+	var headInfo *Commit
+	if head, err := gs.resolveCommit(repo, ""); err == nil {
+		headInfo = newCommitInfo(head)
+	}
+
+	message := "Changes pulled successfully"
+	if alreadyUpToDate {
+		message = "Already up to date"
+		mode = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":         message,
+		"alreadyUpToDate": alreadyUpToDate,
+		"mode":            mode,
+		"head":            headInfo,
+		"status":          repoStatus,
+		"operationId":     op.snapshot().ID,
+	})
+}
+
+// mergeCommits three-way merges theirs into ours in memory, writing a merge
+// commit when the result is clean and returning the conflicts otherwise
+func mergeCommits(repo *git.Repository, ours, theirs *object.Commit, committer Author, message, style string) (*object.Commit, []Conflict, error) {
+	bases, err := ours.MergeBase(theirs)
+	if err != nil {
+		return nil, nil, err
+	}
+	base := map[string]*diffEntry{}
+	if len(bases) > 0 {
+		if base, err = treeEntries(bases[0], ""); err != nil {
+			return nil, nil, err
+		}
+	}
+	oursEntries, err := treeEntries(ours, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	theirsEntries, err := treeEntries(theirs, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	labels := mergeLabels{ours: "HEAD", base: "merged common ancestors", theirs: theirs.Hash.String()[:7]}
+	merged, err := mergeTrees(repo.Storer, base, oursEntries, theirsEntries, labels, style)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(merged.conflicts) > 0 {
+		return nil, newConflicts(merged.conflicts, base, oursEntries, theirsEntries), nil
+	}
+
+	treeHash, err := buildTree(repo.Storer, merged.entries)
+	if err != nil {
+		return nil, nil, err
+	}
+	signature := object.Signature{Name: committer.Name, Email: committer.Email, When: time.Now()}
+	commit := &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      message,
+		TreeHash:     treeHash,
+		ParentHashes: []plumbing.Hash{ours.Hash, theirs.Hash},
+	}
+	if commit.Hash, err = storeObject(repo.Storer, commit); err != nil {
+		return nil, nil, err
+	}
+	return commit, nil, nil
+}
+
+// rebaseCommits replays the commits of ours that onto lacks on top of onto,
+// keeping their authors. Merge commits are dropped like git rebase does. On
+// a conflict nothing is kept and the commit that failed is returned.
+func rebaseCommits(repo *git.Repository, ours, onto *object.Commit, committer Author, style string) ([]*object.Commit, *object.Commit, []Conflict, error) {
+	series, err := seriesCommits(repo, ours, onto)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	current, err := treeEntries(onto, "")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var rebased []*object.Commit
+	parent := onto.Hash
+	for _, commit := range series {
+		changed, err := treeEntries(commit, "")
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		before := map[string]*diffEntry{}
+		if commit.NumParents() > 0 {
+			commitParent, err := commit.Parent(0)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if before, err = treeEntries(commitParent, ""); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+
+		subject, _ := splitCommitMessage(commit.Message)
+		labels := mergeLabels{
+			ours:   onto.Hash.String()[:7],
+			base:   "parent of " + commit.Hash.String()[:7],
+			theirs: fmt.Sprintf("%s (%s)", commit.Hash.String()[:7], subject),
+		}
+		merged, err := mergeTrees(repo.Storer, before, current, changed, labels, style)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(merged.conflicts) > 0 {
+			return nil, commit, newConflicts(merged.conflicts, before, current, changed), nil
+		}
+		current = merged.entries
+
+		treeHash, err := buildTree(repo.Storer, current)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		replayed := &object.Commit{
+			Author:       commit.Author,
+			Committer:    object.Signature{Name: committer.Name, Email: committer.Email, When: time.Now()},
+			Message:      commit.Message,
+			TreeHash:     treeHash,
+			ParentHashes: []plumbing.Hash{parent},
+		}
+		if replayed.Hash, err = storeObject(repo.Storer, replayed); err != nil {
+			return nil, nil, nil, err
+		}
+		rebased = append(rebased, replayed)
+		parent = replayed.Hash
+	}
+	return rebased, nil, nil, nil
+}
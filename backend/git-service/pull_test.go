@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type pullResponse struct {
+	AlreadyUpToDate bool    `json:"alreadyUpToDate"`
+	Mode            string  `json:"mode"`
+	Head            *Commit `json:"head"`
+	Status          *Status `json:"status"`
+}
+
+func pull(t *testing.T, gs *GitService, req PullRequest, status int) pullResponse {
+	t.Helper()
+	if req.Author.Name == "" {
+		req.Author = testAuthor()
+	}
+	rec := serve(t, gs.pullHandler, "POST", "/git/p/pull", project("p"), req)
+	expectStatus(t, rec, status)
+	var body pullResponse
+	decodeBody(t, rec, &body)
+	return body
+}
+
+func TestPullFastForwardThenUpToDate(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	remote := addTestRemote(t, repo)
+	pushed := pushFromClone(t, remote, map[string]string{"b.txt": "from elsewhere\n"})
+
+	body := pull(t, gs, PullRequest{}, http.StatusOK)
+	if body.AlreadyUpToDate || body.Mode != "fast-forward" || body.Head == nil || body.Head.Hash != pushed.String() {
+		t.Fatalf("pull: %+v", body)
+	}
+	if body.Status == nil || !body.Status.Clean {
+		t.Errorf("status after the pull: %+v", body.Status)
+	}
+	if got := readProjectFile(t, gs, "b.txt"); got != "from elsewhere\n" {
+		t.Errorf("b.txt = %q", got)
+	}
+
+	body = pull(t, gs, PullRequest{}, http.StatusOK)
+	if !body.AlreadyUpToDate || body.Mode != "" || body.Head.Hash != pushed.String() {
+		t.Errorf("second pull: %+v", body)
+	}
+}
+
+func TestPullDivergedHistories(t *testing.T) {
+	for _, rebase := range []bool{false, true} {
+		gs := newTestService(t)
+		repo := initTestRepo(t, gs, "p")
+		remote := addTestRemote(t, repo)
+		pushed := pushFromClone(t, remote, map[string]string{"b.txt": "b\n"})
+		local := commitTestFiles(t, repo, "Local change", map[string]string{"c.txt": "c\n"})
+
+		body := pull(t, gs, PullRequest{Rebase: rebase}, http.StatusOK)
+		head, err := repo.CommitObject(refHash(t, repo, "HEAD"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rebase {
+			if body.Mode != "rebase" || head.NumParents() != 1 || head.ParentHashes[0] != pushed || head.Message != "Local change" {
+				t.Errorf("rebase pull: %+v, parents %v", body, head.ParentHashes)
+			}
+		} else if body.Mode != "merge" || head.NumParents() != 2 || head.ParentHashes[0] != local || head.ParentHashes[1] != pushed {
+			t.Errorf("merge pull: %+v, parents %v", body, head.ParentHashes)
+		}
+		for _, name := range []string{"b.txt", "c.txt"} {
+			if readProjectFile(t, gs, name) == "" {
+				t.Errorf("rebase %v: %s is missing", rebase, name)
+			}
+		}
+	}
+}
+
+func TestPullConflictIsRefused(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	remote := addTestRemote(t, repo)
+	pushFromClone(t, remote, map[string]string{"a.txt": "theirs\n"})
+	local := commitTestFiles(t, repo, "Ours", map[string]string{"a.txt": "ours\n"})
+
+	rec := serve(t, gs.pullHandler, "POST", "/git/p/pull", project("p"), PullRequest{Author: testAuthor()})
+	expectStatus(t, rec, http.StatusConflict)
+	var body struct {
+		Conflicts []Conflict `json:"conflicts"`
+	}
+	decodeBody(t, rec, &body)
+	if len(body.Conflicts) != 1 || body.Conflicts[0].Path != "a.txt" {
+		t.Errorf("conflicts: %+v", body.Conflicts)
+	}
+	if refHash(t, repo, "HEAD") != local {
+		t.Error("a conflicted pull moved HEAD")
+	}
+	if got := readProjectFile(t, gs, "a.txt"); got != "ours\n" {
+		t.Errorf("a.txt = %q after a conflicted pull", got)
+	}
+
+	// Uncommitted changes are refused before anything is fetched
+	writeFiles(t, repo, map[string]string{"a.txt": "unsaved\n"})
+	rec = serve(t, gs.pullHandler, "POST", "/git/p/pull", project("p"), PullRequest{Author: testAuthor()})
+	expectStatus(t, rec, http.StatusConflict)
+	var dirty struct {
+		Files []string `json:"files"`
+	}
+	decodeBody(t, rec, &dirty)
+	if !equalStrings(dirty.Files, []string{"a.txt"}) {
+		t.Errorf("dirty files: %v", dirty.Files)
+	}
+}
+
+func TestPullMergeMessageOmitsCredentials(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	remote := addTestRemote(t, repo)
+	base := serveGitHTTP(t, filepath.Dir(remote))
+	remoteURL := base + "/" + filepath.Base(remote)
+	runGit(t, gs.getProjectPath("p"), "remote", "set-url", "origin", strings.Replace(remoteURL, "http://", "http://user:s3cret@", 1))
+	pushFromClone(t, remote, map[string]string{"b.txt": "b\n"})
+	commitTestFiles(t, repo, "Local change", map[string]string{"c.txt": "c\n"})
+
+	pull(t, gs, PullRequest{}, http.StatusOK)
+	head, err := repo.CommitObject(refHash(t, repo, "HEAD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Merge branch 'master' of " + remoteURL + "\n"; head.Message != want {
+		t.Errorf("merge message %q, want %q", head.Message, want)
+	}
+}
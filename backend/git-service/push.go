@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// pushLeaseError reports that the remote branch moved away from the leased hash
+type pushLeaseError struct {
+	Ref      plumbing.ReferenceName
+	Expected plumbing.Hash
+	Actual   plumbing.Hash
+}
+
+func (e *pushLeaseError) Error() string {
+	return fmt.Sprintf("Remote %s has moved since it was last fetched", e.Ref.Short())
+}
+
+// details returns what a client needs to fetch and retry
+func (e *pushLeaseError) details() map[string]interface{} {
+	return map[string]interface{}{
+		"ref":          e.Ref,
+		"expectedHash": e.Expected.String(),
+		"remoteHash":   e.Actual.String(),
+	}
+}
+
+// pushLease holds the push settings for a force-with-lease push
+type pushLease struct {
+	refSpec  config.RefSpec
+	options  *git.ForceWithLease
+	expected plumbing.Hash
+}
+
+// preparePushLease verifies that a remote branch still points at the
+// expected hash and returns the forced refspec to push it with. When no
+// expected hash is given the local remote-tracking ref is used, as git does.
+func (gs *GitService) preparePushLease(ctx context.Context, repo *git.Repository, remoteName, branch, expected string, auth transport.AuthMethod) (*pushLease, error) {
+	if branch == "" {
+		head, err := repo.Head()
+		if err != nil {
+			return nil, err
+		}
+		if !head.Name().IsBranch() {
+			return nil, errors.New("HEAD is detached; specify a branch")
+		}
+		branch = head.Name().Short()
+	}
+	branchRef := plumbing.NewBranchReferenceName(branch)
+
+	if _, err := repo.Reference(branchRef, false); err != nil {
+		return nil, fmt.Errorf("branch %s not found", branch)
+	}
+
+	var expectedHash plumbing.Hash
+	if expected != "" {
+		expected = strings.ToLower(expected)
+		if len(expected) != 40 || strings.Trim(expected, "0123456789abcdef") != "" {
+			return nil, errors.New("expectedHash must be a full commit hash")
+		}
+		expectedHash = plumbing.NewHash(expected)
+	} else {
+		tracking, err := repo.Reference(plumbing.NewRemoteReferenceName(remoteName, branch), true)
+		if err != nil {
+			return nil, errors.New("no remote-tracking ref to lease against; provide expectedHash")
+		}
+		expectedHash = tracking.Hash()
+	}
+
+	remote, err := repo.Remote(remoteName)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return nil, timeoutError(ctx, err)
+	}
+
+	// A branch missing on the remote is only acceptable if the lease expects that
+	actual := plumbing.ZeroHash
+	for _, ref := range refs {
+		if ref.Name() == branchRef {
+			actual = ref.Hash()
+		}
+	}
+	if actual != expectedHash {
+		return nil, &pushLeaseError{Ref: branchRef, Expected: expectedHash, Actual: actual}
+	}
+
+	lease := &pushLease{
+		refSpec:  config.RefSpec(fmt.Sprintf("+%s:%s", branchRef, branchRef)),
+		expected: expectedHash,
+	}
+	// go-git re-checks the lease against the ref advertisement of the push
+	// itself, closing the window between our check and the update, but it
+	// needs a remote-tracking ref and an existing remote branch to do so
+	if _, err := repo.Reference(plumbing.NewRemoteReferenceName(remoteName, branch), true); err == nil && !expectedHash.IsZero() {
+		lease.options = &git.ForceWithLease{RefName: branchRef, Hash: expectedHash}
+	}
+	return lease, nil
+}
+
+// rejectedPush turns the error go-git raises when a pushed branch is not
+// where the push expected it, either because the lease no longer holds or
+// because the update is not a fast-forward, into a pushLeaseError carrying
+// the remote's current hash. The expected hash is the lease's, or else the
+// remote-tracking ref's. Any other error is returned as it is.
+func rejectedPush(ctx context.Context, repo *git.Repository, remoteName string, lease *pushLease, auth transport.AuthMethod, err error) error {
+	const prefix = "non-fast-forward update: "
+	if err == nil || !strings.Contains(err.Error(), prefix) {
+		return err
+	}
+	msg := err.Error()
+	ref := plumbing.ReferenceName(strings.TrimSpace(msg[strings.Index(msg, prefix)+len(prefix):]))
+
+	remote, remoteErr := repo.Remote(remoteName)
+	if remoteErr != nil {
+		return err
+	}
+	refs, listErr := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if listErr != nil {
+		return err
+	}
+	rejected := &pushLeaseError{Ref: ref}
+	for _, remoteRef := range refs {
+		if remoteRef.Name() == ref {
+			rejected.Actual = remoteRef.Hash()
+		}
+	}
+	if lease != nil {
+		rejected.Expected = lease.expected
+	} else if tracking, err := repo.Reference(plumbing.NewRemoteReferenceName(remoteName, ref.Short()), true); err == nil {
+		rejected.Expected = tracking.Hash()
+	}
+	return rejected
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// rewriteHead replaces the last commit of master with one changing files,
+// so pushing it needs a force
+func rewriteHead(t *testing.T, repo *git.Repository, files map[string]string) {
+	t.Helper()
+	writeFiles(t, repo, files)
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name := range files {
+		if _, err := worktree.Add(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := worktree.Commit("Rewritten", &git.CommitOptions{Author: testSignature(), Amend: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPushWithLeaseOverwritesUnmovedRemote(t *testing.T) {
+	for _, expected := range []string{"", "lower", "upper"} {
+		t.Run("expected "+expected, func(t *testing.T) {
+			gs := newTestService(t)
+			repo := initTestRepo(t, gs, "p")
+			remote := addTestRemote(t, repo)
+			leased := refHash(t, repo, "refs/remotes/origin/master")
+			rewriteHead(t, repo, map[string]string{"a.txt": "rewritten\n"})
+
+			body := map[string]interface{}{"forceWithLease": true}
+			switch expected {
+			case "lower":
+				body["expectedHash"] = leased.String()
+			case "upper":
+				body["expectedHash"] = strings.ToUpper(leased.String())
+			}
+			rec := serve(t, gs.pushHandler, "POST", "/git/p/push", project("p"), body)
+			expectStatus(t, rec, http.StatusOK)
+
+			bare, err := git.PlainOpen(remote)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := refHash(t, bare, "refs/heads/master"), refHash(t, repo, "HEAD"); got != want {
+				t.Errorf("remote master is %s, want the rewritten %s", got, want)
+			}
+		})
+	}
+}
+
+func TestPushWithLeaseRefusesMovedRemote(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	remote := addTestRemote(t, repo)
+	moved := pushFromClone(t, remote, map[string]string{"b.txt": "theirs\n"})
+	rewriteHead(t, repo, map[string]string{"a.txt": "rewritten\n"})
+
+	rec := serve(t, gs.pushHandler, "POST", "/git/p/push", project("p"), map[string]interface{}{"forceWithLease": true})
+	expectStatus(t, rec, http.StatusConflict)
+	var body map[string]interface{}
+	decodeBody(t, rec, &body)
+	if body["remoteHash"] != moved.String() {
+		t.Errorf("remoteHash = %v, want %s", body["remoteHash"], moved)
+	}
+	if body["expectedHash"] != refHash(t, repo, "refs/remotes/origin/master").String() {
+		t.Errorf("expectedHash = %v, want the remote-tracking hash", body["expectedHash"])
+	}
+
+	bare, err := git.PlainOpen(remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := refHash(t, bare, "refs/heads/master"); got != moved {
+		t.Errorf("remote master was overwritten: %s", got)
+	}
+}
+
+// A rejection found by the push itself, not the lease check before it, is a
+// conflict with the remote's hash too
+func TestPushRejectedAsNonFastForwardIsConflict(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	remote := addTestRemote(t, repo)
+	moved := pushFromClone(t, remote, map[string]string{"b.txt": "theirs\n"})
+	commitTestFiles(t, repo, "Ours", map[string]string{"c.txt": "ours\n"})
+
+	rec := serve(t, gs.pushHandler, "POST", "/git/p/push", project("p"), map[string]interface{}{})
+	expectStatus(t, rec, http.StatusConflict)
+	var body map[string]interface{}
+	decodeBody(t, rec, &body)
+	if body["remoteHash"] != moved.String() {
+		t.Errorf("remoteHash = %v, want %s", body["remoteHash"], moved)
+	}
+	if body["ref"] != "refs/heads/master" {
+		t.Errorf("ref = %v, want refs/heads/master", body["ref"])
+	}
+}
+
+func TestPushLeaseRejectsMalformedExpectedHash(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	addTestRemote(t, repo)
+	rec := serve(t, gs.pushHandler, "POST", "/git/p/push", project("p"), map[string]interface{}{"forceWithLease": true, "expectedHash": "abc123"})
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+type pushPreviewResponse struct {
+	Upstream    string      `json:"upstream"`
+	NewBranch   bool        `json:"newBranch"`
+	Ahead       int         `json:"ahead"`
+	Behind      int         `json:"behind"`
+	FastForward bool        `json:"fastForward"`
+	Commits     []*Commit   `json:"commits"`
+	Files       []*FileDiff `json:"files"`
+	Patch       string      `json:"patch"`
+}
+
+func pushPreview(t *testing.T, gs *GitService) pushPreviewResponse {
+	t.Helper()
+	rec := serve(t, gs.pushPreviewHandler, "GET", "/git/p/push/preview", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body pushPreviewResponse
+	decodeBody(t, rec, &body)
+	return body
+}
+
+func TestPushPreviewWhenAhead(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	remote := addTestRemote(t, repo)
+	commitTestFiles(t, repo, "Add b", map[string]string{"b.txt": "b\n"})
+	commitTestFiles(t, repo, "Add c", map[string]string{"c.txt": "c\n"})
+
+	body := pushPreview(t, gs)
+	if body.Upstream != "origin/master" || body.NewBranch || body.Ahead != 2 || body.Behind != 0 || !body.FastForward {
+		t.Errorf("preview %+v", body)
+	}
+	var files []string
+	for _, file := range body.Files {
+		files = append(files, file.Path)
+	}
+	if !equalStrings(files, []string{"b.txt", "c.txt"}) || !strings.Contains(body.Patch, "+b\n") || !strings.Contains(body.Patch, "+c\n") {
+		t.Errorf("files %v, patch:\n%s", files, body.Patch)
+	}
+
+	// Once the remote moves on the push would no longer fast-forward
+	pushFromClone(t, remote, map[string]string{"d.txt": "d\n"})
+	body = pushPreview(t, gs)
+	if body.Ahead != 2 || body.Behind != 1 || body.FastForward {
+		t.Errorf("preview after the remote moved: %+v", body)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+)
+
+// Preview what a push of the current branch would send endpoint
+func (gs *GitService) pushPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	remoteName := r.URL.Query().Get("remote")
+	if remoteName == "" {
+		remoteName = "origin"
+	}
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		gs.sendError(w, "Nothing to push: the repository has no commits", http.StatusBadRequest)
+		return
+	}
+	if !head.Name().IsBranch() {
+		gs.sendError(w, "HEAD is detached; check out a branch to push", http.StatusBadRequest)
+		return
+	}
+	branch := head.Name().Short()
+
+	if _, err := repo.Remote(remoteName); err != nil {
+		gs.sendError(w, fmt.Sprintf("Remote '%s' not found", remoteName), http.StatusNotFound)
+		return
+	}
+
+	// Refresh remote-tracking refs so the preview reflects the remote as it is now
+	auth, err := remoteAuthFor(repo, remoteName, nil)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid auth: %v", err), http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := gs.remoteContext(r.Context())
+	defer cancel()
+	err = repo.FetchContext(ctx, &git.FetchOptions{RemoteName: remoteName, Auth: auth})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		err = timeoutError(ctx, err)
+		gs.sendError(w, fmt.Sprintf("Failed to fetch from %s: %v", remoteName, redactError(err, nil)), remoteErrorStatus(err, http.StatusBadGateway))
+		return
+	}
+
+	out, err := outgoingCommits(repo, remoteName, head)
+	if err != nil {
+		gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+		return
+	}
+	local, upstream, onRemote := out.local, out.upstream, out.onRemote
+
+	commits := make([]*Commit, 0, len(out.commits))
+	for _, c := range out.commits {
+		commits = append(commits, newCommitInfo(c))
+	}
+
+	// Commits the remote has that we don't would make the push non-fast-forward
+	behind := 0
+	if upstream != nil {
+		localAll, err := commitAncestors(repo, []plumbing.Hash{local.Hash}, nil)
+		if err != nil {
+			gs.sendError(w, "Failed to walk local history", http.StatusInternalServerError)
+			return
+		}
+		for hash := range onRemote {
+			if !localAll[hash] {
+				behind++
+			}
+		}
+	}
+
+	// The cumulative diff runs from the newest commit the remote already has
+	from := map[string]*diffEntry{}
+	if base := newestSharedAncestor(local, onRemote); base != nil {
+		if from, err = treeEntries(base, ""); err != nil {
+			gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+			return
+		}
+	}
+	to, err := treeEntries(local, "")
+	if err != nil {
+		gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+		return
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+	files, err := diffEntries(from, to, settings.diffOptions())
+	if err != nil {
+		gs.sendInternalError(w, "Failed to compute diff", err)
+		return
+	}
+	var patch strings.Builder
+	for _, file := range files {
+		patch.WriteString(file.Patch)
+	}
+
+	var upstreamName interface{}
+	if upstream != nil {
+		upstreamName = upstream.Name().Short()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"remote":      remoteName,
+		"branch":      branch,
+		"upstream":    upstreamName,
+		"newBranch":   upstream == nil,
+		"ahead":       len(commits),
+		"behind":      behind,
+		"fastForward": behind == 0,
+		"commits":     commits,
+		"files":       files,
+		"stat":        newDiffStat(files),
+		"patch":       patch.String(),
+	})
+}
+
+// outgoing describes the commits a push of a branch would send
+type outgoing struct {
+	local    *object.Commit
+	upstream *plumbing.Reference
+	onRemote map[plumbing.Hash]bool
+	commits  []*object.Commit
+}
+
+// outgoingCommits lists the commits of branch the remote does not have yet,
+// newest first and never before their descendants. Without an upstream the
+// push would create the branch and send whatever no branch of the remote has.
+func outgoingCommits(repo *git.Repository, remoteName string, branch *plumbing.Reference) (*outgoing, error) {
+	local, err := repo.CommitObject(branch.Hash())
+	if err != nil {
+		return nil, err
+	}
+	out := &outgoing{local: local}
+
+	var remoteHashes []plumbing.Hash
+	if ref, err := repo.Reference(plumbing.NewRemoteReferenceName(remoteName, branch.Name().Short()), true); err == nil {
+		out.upstream = ref
+		remoteHashes = []plumbing.Hash{ref.Hash()}
+	} else {
+		refs, err := repo.References()
+		if err != nil {
+			return nil, err
+		}
+		prefix := "refs/remotes/" + remoteName + "/"
+		refs.ForEach(func(ref *plumbing.Reference) error {
+			if ref.Type() == plumbing.HashReference && strings.HasPrefix(ref.Name().String(), prefix) {
+				remoteHashes = append(remoteHashes, ref.Hash())
+			}
+			return nil
+		})
+	}
+
+	if out.onRemote, err = commitAncestors(repo, remoteHashes, nil); err != nil {
+		return nil, err
+	}
+	err = object.NewCommitIterCTime(local, out.onRemote, nil).ForEach(func(c *object.Commit) error {
+		out.commits = append(out.commits, c)
+		return nil
+	})
+	return out, err
+}
+
+// commitAncestors returns the commits reachable from roots, including the
+// roots themselves, without descending into commits in stop
+func commitAncestors(repo *git.Repository, roots []plumbing.Hash, stop map[plumbing.Hash]bool) (map[plumbing.Hash]bool, error) {
+	seen := make(map[plumbing.Hash]bool)
+	stack := append([]plumbing.Hash(nil), roots...)
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[hash] || stop[hash] {
+			continue
+		}
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			return nil, err
+		}
+		seen[hash] = true
+		stack = append(stack, commit.ParentHashes...)
+	}
+	return seen, nil
+}
+
+// newestSharedAncestor follows first parents from commit to the first one in
+// shared, returning nil when none is
+func newestSharedAncestor(commit *object.Commit, shared map[plumbing.Hash]bool) *object.Commit {
+	for commit != nil {
+		if shared[commit.Hash] {
+			return commit
+		}
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil
+		}
+		commit = parent
+	}
+	return nil
+}
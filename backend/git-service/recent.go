@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/gorilla/mux"
+)
+
+// maxRecentBranches bounds how many checkouts are remembered per project
+const maxRecentBranches = 20
+
+// RecentBranch represents a branch in the recently checked out list
+type RecentBranch struct {
+	Name         string    `json:"name"`
+	IsActive     bool      `json:"isActive"`
+	CheckedOutAt time.Time `json:"checkedOutAt"`
+}
+
+// recentBranchesState is the persisted checkout history, most recent first
+type recentBranchesState struct {
+	Branches []RecentBranch `json:"branches"`
+}
+
+// recordRecentBranch moves a branch to the front of the project's recent list.
+// Failures are logged rather than returned since the checkout itself succeeded.
+func (gs *GitService) recordRecentBranch(projectID, branchName string) {
+	var state recentBranchesState
+	err := gs.updateState(projectID, "recent-branches", &state, func() error {
+		branches := []RecentBranch{{Name: branchName, CheckedOutAt: time.Now().UTC()}}
+		for _, b := range state.Branches {
+			if b.Name != branchName && len(branches) < maxRecentBranches {
+				branches = append(branches, b)
+			}
+		}
+		state.Branches = branches
+		return nil
+	})
+	if err != nil {
+		gs.logger.Warn("failed to record recent branch", "projectId", projectID, "error", err)
+	}
+}
+
+// Get recently checked out branches endpoint
+func (gs *GitService) recentBranchesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	limit := 10 // default
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	var state recentBranchesState
+	if err := gs.loadState(projectID, "recent-branches", &state); err != nil {
+		gs.sendError(w, "Failed to read recent branches", http.StatusInternalServerError)
+		return
+	}
+
+	var currentBranch string
+	if head, err := repo.Head(); err == nil && head.Name().IsBranch() {
+		currentBranch = strings.TrimPrefix(head.Name().String(), "refs/heads/")
+	}
+
+	// The current branch always leads the list, even if it was checked out
+	// outside the service and never recorded
+	recent := []RecentBranch{}
+	if currentBranch != "" {
+		current := RecentBranch{Name: currentBranch, IsActive: true}
+		for _, b := range state.Branches {
+			if b.Name == currentBranch {
+				current.CheckedOutAt = b.CheckedOutAt
+			}
+		}
+		recent = append(recent, current)
+	}
+
+	for _, b := range state.Branches {
+		if len(recent) >= limit {
+			break
+		}
+		if b.Name == currentBranch {
+			continue
+		}
+		// Skip branches that have been deleted since they were checked out
+		if _, err := repo.Reference(plumbing.NewBranchReferenceName(b.Name), false); err != nil {
+			continue
+		}
+		recent = append(recent, b)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"branches": recent,
+	})
+}
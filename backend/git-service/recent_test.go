@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func checkout(t *testing.T, gs *GitService, branch string) {
+	t.Helper()
+	rec := serve(t, gs.switchBranchHandler, "POST", "/git/p/branches/"+branch+"/checkout", map[string]string{"projectId": "p", "branchName": branch}, nil)
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func recentBranchNames(t *testing.T, gs *GitService, query string) []string {
+	t.Helper()
+	rec := serve(t, gs.recentBranchesHandler, "GET", "/git/p/branches/recent"+query, project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Branches []RecentBranch `json:"branches"`
+	}
+	decodeBody(t, rec, &body)
+	names := make([]string, len(body.Branches))
+	for i, b := range body.Branches {
+		names[i] = b.Name
+		if b.IsActive != (i == 0) {
+			t.Errorf("%s: isActive %v", b.Name, b.IsActive)
+		}
+	}
+	return names
+}
+
+func TestRecentBranchesOrderedByCheckout(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	head := refHash(t, repo, "HEAD")
+	for _, name := range []string{"alpha", "beta", "gamma"} {
+		setRef(t, repo, "refs/heads/"+name, head)
+	}
+
+	for _, branch := range []string{"alpha", "beta", "gamma", "alpha", "master"} {
+		checkout(t, gs, branch)
+	}
+	want := []string{"master", "alpha", "gamma", "beta"}
+	if got := recentBranchNames(t, gs, ""); !equalStrings(got, want) {
+		t.Errorf("recent = %v, want %v", got, want)
+	}
+	if got := recentBranchNames(t, gs, "?limit=2"); !equalStrings(got, want[:2]) {
+		t.Errorf("limited recent = %v, want %v", got, want[:2])
+	}
+
+	// A deleted branch drops out of the list
+	if err := repo.Storer.RemoveReference("refs/heads/gamma"); err != nil {
+		t.Fatal(err)
+	}
+	if got := recentBranchNames(t, gs, ""); !equalStrings(got, []string{"master", "alpha", "beta"}) {
+		t.Errorf("after deleting gamma recent = %v", got)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// serviceIdentity is recorded in reflogs when no user identity is configured
+var serviceIdentity = Author{Name: "neoai-git-service", Email: "git-service@neoai.local"}
+
+// ReflogEntry represents a single reflog line
+type ReflogEntry struct {
+	OldHash   string    `json:"oldHash"`
+	NewHash   string    `json:"newHash"`
+	Committer Author    `json:"committer"`
+	Date      time.Time `json:"date"`
+	Message   string    `json:"message"`
+}
+
+// reflogPath returns the log file for a ref inside the git dir
+func (gs *GitService) reflogPath(projectID string, ref plumbing.ReferenceName) string {
+	return filepath.Join(gs.gitDir(projectID), "logs", filepath.FromSlash(ref.String()))
+}
+
+// appendReflog records a ref update in git's reflog format so the history is
+// shared with the git CLI. go-git does not maintain reflogs itself. Failures
+// are logged rather than returned since the ref update already happened.
+func (gs *GitService) appendReflog(projectID string, ref plumbing.ReferenceName, oldHash, newHash plumbing.Hash, who Author, message string) {
+	if who.Name == "" || who.Email == "" {
+		who = serviceIdentity
+	}
+
+	path := gs.reflogPath(projectID, ref)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		gs.logger.Warn("failed to write reflog", "projectId", projectID, "ref", ref.String(), "error", err)
+		return
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		gs.logger.Warn("failed to write reflog", "projectId", projectID, "ref", ref.String(), "error", err)
+		return
+	}
+	defer f.Close()
+
+	now := time.Now()
+	message = strings.ReplaceAll(strings.TrimSpace(message), "\n", " ")
+	line := fmt.Sprintf("%s %s %s <%s> %d %s\t%s\n",
+		oldHash, newHash, who.Name, who.Email, now.Unix(), now.Format("-0700"), message)
+	if _, err := f.WriteString(line); err != nil {
+		gs.logger.Warn("failed to write reflog", "projectId", projectID, "ref", ref.String(), "error", err)
+	}
+}
+
+// logCommit records a new commit in the reflogs of HEAD and the current branch
+func (gs *GitService) logCommit(projectID string, repo *git.Repository, oldHash, newHash plumbing.Hash, who Author, message string) {
+	subject := strings.SplitN(strings.TrimSpace(message), "\n", 2)[0]
+	entry := "commit: " + subject
+	if oldHash.IsZero() {
+		entry = "commit (initial): " + subject
+	}
+
+	gs.logHeadUpdate(projectID, repo, oldHash, newHash, who, entry)
+}
+
+// logHeadUpdate records a move of HEAD in its reflog and, when HEAD is on a
+// branch, in the branch's reflog too
+func (gs *GitService) logHeadUpdate(projectID string, repo *git.Repository, oldHash, newHash plumbing.Hash, who Author, entry string) {
+	gs.appendReflog(projectID, plumbing.HEAD, oldHash, newHash, who, entry)
+	if head, err := repo.Storer.Reference(plumbing.HEAD); err == nil && head.Type() == plumbing.SymbolicReference {
+		gs.appendReflog(projectID, head.Target(), oldHash, newHash, who, entry)
+	}
+}
+
+// logCheckout records a HEAD move from a previously captured HEAD
+func (gs *GitService) logCheckout(projectID string, repo *git.Repository, previous *plumbing.Reference) {
+	head, err := repo.Head()
+	if err != nil || previous == nil {
+		return
+	}
+	message := fmt.Sprintf("checkout: moving from %s to %s", describeHead(previous), describeHead(head))
+	gs.appendReflog(projectID, plumbing.HEAD, previous.Hash(), head.Hash(), gs.resolveIdentity(projectID), message)
+}
+
+// describeHead names a resolved HEAD the way reflog messages do
+func describeHead(head *plumbing.Reference) string {
+	if head.Name().IsBranch() {
+		return head.Name().Short()
+	}
+	return head.Hash().String()
+}
+
+// readReflog parses the reflog of a ref, oldest entry first. A missing log is empty.
+func (gs *GitService) readReflog(projectID string, ref plumbing.ReferenceName) ([]ReflogEntry, error) {
+	f, err := os.Open(gs.reflogPath(projectID, ref))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []ReflogEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if entry, ok := parseReflogLine(scanner.Text()); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// readAllReflogs returns the reflogs of every ref that has one
+func (gs *GitService) readAllReflogs(projectID string) (map[plumbing.ReferenceName][]ReflogEntry, error) {
+	logsDir := filepath.Join(gs.gitDir(projectID), "logs")
+	logs := make(map[plumbing.ReferenceName][]ReflogEntry)
+
+	err := filepath.Walk(logsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(logsDir, path)
+		if err != nil {
+			return err
+		}
+		ref := plumbing.ReferenceName(filepath.ToSlash(rel))
+		entries, err := gs.readReflog(projectID, ref)
+		if err != nil {
+			return err
+		}
+		logs[ref] = entries
+		return nil
+	})
+	return logs, err
+}
+
+// parseReflogLine parses "<old> <new> <name> <<email>> <unix> <tz>\t<message>"
+func parseReflogLine(line string) (ReflogEntry, bool) {
+	header, message, _ := strings.Cut(line, "\t")
+	if len(header) < 82 {
+		return ReflogEntry{}, false
+	}
+
+	entry := ReflogEntry{
+		OldHash: header[:40],
+		NewHash: header[41:81],
+		Message: message,
+	}
+
+	identity := header[82:]
+	emailStart := strings.Index(identity, "<")
+	emailEnd := strings.Index(identity, ">")
+	if emailStart < 0 || emailEnd < emailStart {
+		return ReflogEntry{}, false
+	}
+	entry.Committer = Author{
+		Name:  strings.TrimSpace(identity[:emailStart]),
+		Email: identity[emailStart+1 : emailEnd],
+	}
+
+	fields := strings.Fields(identity[emailEnd+1:])
+	if len(fields) >= 1 {
+		if unix, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+			entry.Date = time.Unix(unix, 0)
+			if len(fields) >= 2 {
+				if tz, err := time.Parse("-0700", fields[1]); err == nil {
+					entry.Date = entry.Date.In(tz.Location())
+				}
+			}
+		}
+	}
+
+	return entry, true
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// validateRefName checks a branch or tag name against git check-ref-format rules
+func validateRefName(name string) error {
+	if name == "" {
+		return fmt.Errorf("name is empty")
+	}
+	if name == "@" {
+		return fmt.Errorf("name cannot be @")
+	}
+	// git refuses these as branch names; on a command line they read as options
+	if strings.HasPrefix(name, "-") {
+		return fmt.Errorf("name %q cannot start with -", name)
+	}
+	if strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || strings.Contains(name, "//") {
+		return fmt.Errorf("name %q has an empty path component", name)
+	}
+	if strings.HasSuffix(name, ".") {
+		return fmt.Errorf("name %q cannot end with a dot", name)
+	}
+	if strings.Contains(name, "..") {
+		return fmt.Errorf("name %q cannot contain ..", name)
+	}
+	if strings.Contains(name, "@{") {
+		return fmt.Errorf("name %q cannot contain @{", name)
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(" ~^:?*[\\", r) {
+			return fmt.Errorf("name %q contains invalid character %q", name, r)
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") {
+			return fmt.Errorf("name %q has a component starting with a dot", name)
+		}
+		if strings.HasSuffix(component, ".lock") {
+			return fmt.Errorf("name %q has a component ending with .lock", name)
+		}
+	}
+	return nil
+}
+
+// validateFullRefName checks a full ref name such as refs/heads/main. The
+// part after refs/ has to pass validateRefName, so the name cannot climb out
+// of the refs directory.
+func validateFullRefName(name string) error {
+	rest, ok := strings.CutPrefix(name, "refs/")
+	if !ok {
+		return fmt.Errorf("name %q is not under refs/", name)
+	}
+	return validateRefName(rest)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestValidateRefName(t *testing.T) {
+	cases := []struct {
+		name string
+		// rule is part of the error message, empty for a valid name
+		rule string
+	}{
+		{"main", ""},
+		{"feature/login", ""},
+		{"release-1.2", ""},
+		{"fix_123/sub-task", ""},
+		{"user@host", ""},
+		{"a.b", ""},
+		{"", "empty"},
+		{"@", "cannot be @"},
+		{"..", "cannot end with a dot"},
+		{"a..b", "cannot contain .."},
+		{"feature/..", "cannot end with a dot"},
+		{"topic@{1}", "cannot contain @{"},
+		{"branch.lock", "ending with .lock"},
+		{"feature/x.lock/y", "ending with .lock"},
+		{"with space", "invalid character"},
+		{"tab\there", "invalid character"},
+		{"bell\x07", "invalid character"},
+		{"del\x7f", "invalid character"},
+		{"a~1", "invalid character"},
+		{"a^", "invalid character"},
+		{"a:b", "invalid character"},
+		{"what?", "invalid character"},
+		{"glob*", "invalid character"},
+		{"[x", "invalid character"},
+		{"back\\slash", "invalid character"},
+		{"-leading", "cannot start with -"},
+		{"/leading", "empty path component"},
+		{"trailing/", "empty path component"},
+		{"double//slash", "empty path component"},
+		{"dot.", "cannot end with a dot"},
+		{".hidden", "starting with a dot"},
+		{"a/.hidden", "starting with a dot"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateRefName(tc.name)
+			if tc.rule == "" {
+				if err != nil {
+					t.Fatalf("valid name rejected: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("invalid name accepted, want it to fail %q", tc.rule)
+			}
+			if !strings.Contains(err.Error(), tc.rule) {
+				t.Errorf("error %q does not name the rule %q", err, tc.rule)
+			}
+		})
+	}
+
+	// git itself agrees, apart from the names --branch expands: @ is HEAD
+	if _, err := exec.LookPath("git"); err != nil {
+		return
+	}
+	for _, tc := range cases {
+		if tc.name == "" || tc.name == "@" {
+			continue
+		}
+		gitAccepts := exec.Command("git", "check-ref-format", "--branch", tc.name).Run() == nil
+		if gitAccepts != (tc.rule == "") {
+			t.Errorf("%q: git check-ref-format accepts it: %v", tc.name, gitAccepts)
+		}
+	}
+}
+
+func TestCreateBranchRejectsInvalidName(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "p")
+	rec := serve(t, gs.createBranchHandler, "POST", "/git/p/branches", project("p"), map[string]string{"name": "bad..name"})
+	expectStatus(t, rec, http.StatusBadRequest)
+	if !strings.Contains(rec.Body.String(), "cannot contain ..") {
+		t.Errorf("error does not name the failed rule: %s", rec.Body.String())
+	}
+}
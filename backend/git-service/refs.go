@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/gorilla/mux"
+)
+
+// RefSnapshot represents a ref as exported for backup. Symbolic refs carry a
+// target instead of a hash.
+type RefSnapshot struct {
+	Name   string `json:"name"`
+	Hash   string `json:"hash,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+// RefImportRequest represents a ref restore request
+type RefImportRequest struct {
+	Refs  []RefSnapshot `json:"refs"`
+	Force bool          `json:"force"`
+}
+
+// Export all refs endpoint
+func (gs *GitService) exportRefsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	refs, err := repo.References()
+	if err != nil {
+		gs.sendError(w, "Failed to list refs", http.StatusInternalServerError)
+		return
+	}
+
+	snapshots := []RefSnapshot{}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		snapshots = append(snapshots, newRefSnapshot(ref))
+		return nil
+	})
+	if err != nil {
+		gs.sendError(w, "Failed to list refs", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Name < snapshots[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"refs":       snapshots,
+		"exportedAt": time.Now(),
+	})
+}
+
+// Import refs from a backup endpoint
+func (gs *GitService) importRefsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req RefImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Refs) == 0 {
+		gs.sendError(w, "Refs are required", http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	// Validate the whole dump before touching anything
+	imported := make(map[string]bool, len(req.Refs))
+	for _, snapshot := range req.Refs {
+		imported[snapshot.Name] = true
+	}
+	var refs []*plumbing.Reference
+	for _, snapshot := range req.Refs {
+		ref, err := snapshot.reference()
+		if err != nil {
+			gs.sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ref.Type() == plumbing.HashReference {
+			if _, err := repo.Object(plumbing.AnyObject, ref.Hash()); err != nil {
+				gs.sendError(w, fmt.Sprintf("Object %s for %s does not exist", ref.Hash(), ref.Name()), http.StatusUnprocessableEntity)
+				return
+			}
+		} else if !imported[ref.Target().String()] {
+			if _, err := repo.Reference(ref.Target(), false); err != nil {
+				gs.sendError(w, fmt.Sprintf("Target %s for %s does not exist", ref.Target(), ref.Name()), http.StatusUnprocessableEntity)
+				return
+			}
+		}
+		refs = append(refs, ref)
+	}
+
+	var created, updated, unchanged []string
+	var conflicts []map[string]string
+	previous := make(map[plumbing.ReferenceName]*plumbing.Reference)
+	for _, ref := range refs {
+		current, err := repo.Storer.Reference(ref.Name())
+		switch {
+		case err == plumbing.ErrReferenceNotFound:
+			created = append(created, ref.Name().String())
+		case err != nil:
+			gs.sendError(w, "Failed to read refs", http.StatusInternalServerError)
+			return
+		case current.String() == ref.String():
+			unchanged = append(unchanged, ref.Name().String())
+		default:
+			previous[ref.Name()] = current
+			updated = append(updated, ref.Name().String())
+			conflicts = append(conflicts, map[string]string{
+				"ref":      ref.Name().String(),
+				"current":  describeRef(current),
+				"imported": describeRef(ref),
+			})
+		}
+	}
+
+	if len(conflicts) > 0 && !req.Force {
+		gs.sendErrorWithDetails(w, "Import would overwrite existing refs; retry with force to restore them", http.StatusConflict, map[string]interface{}{
+			"conflicts": conflicts,
+		})
+		return
+	}
+
+	for _, ref := range refs {
+		if err := repo.Storer.SetReference(ref); err != nil {
+			gs.sendError(w, fmt.Sprintf("Failed to restore %s", ref.Name()), http.StatusInternalServerError)
+			return
+		}
+		if ref.Type() == plumbing.HashReference {
+			oldHash := plumbing.ZeroHash
+			if old, ok := previous[ref.Name()]; ok && old.Type() == plumbing.HashReference {
+				oldHash = old.Hash()
+			}
+			if oldHash != ref.Hash() {
+				gs.appendReflog(projectID, ref.Name(), oldHash, ref.Hash(), gs.resolveIdentity(projectID), "refs: restored from backup")
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   fmt.Sprintf("Restored %d refs", len(created)+len(updated)),
+		"created":   created,
+		"updated":   updated,
+		"unchanged": unchanged,
+	})
+}
+
+// newRefSnapshot captures a ref for export
+func newRefSnapshot(ref *plumbing.Reference) RefSnapshot {
+	if ref.Type() == plumbing.SymbolicReference {
+		return RefSnapshot{Name: ref.Name().String(), Target: ref.Target().String()}
+	}
+	return RefSnapshot{Name: ref.Name().String(), Hash: ref.Hash().String()}
+}
+
+// reference validates a snapshot and turns it back into a ref
+func (s RefSnapshot) reference() (*plumbing.Reference, error) {
+	name := plumbing.ReferenceName(s.Name)
+	if name != plumbing.HEAD {
+		if err := validateFullRefName(s.Name); err != nil {
+			return nil, fmt.Errorf("Invalid ref name: %v", err)
+		}
+	}
+	if (s.Hash == "") == (s.Target == "") {
+		return nil, fmt.Errorf("Ref %s needs exactly one of hash or target", s.Name)
+	}
+	if s.Target != "" {
+		if err := validateFullRefName(s.Target); err != nil {
+			return nil, fmt.Errorf("Invalid target for %s: %v", s.Name, err)
+		}
+		return plumbing.NewSymbolicReference(name, plumbing.ReferenceName(s.Target)), nil
+	}
+	if !plumbing.IsHash(s.Hash) {
+		return nil, fmt.Errorf("Invalid hash %q for %s", s.Hash, s.Name)
+	}
+	return plumbing.NewHashReference(name, plumbing.NewHash(s.Hash)), nil
+}
+
+// describeRef renders a ref's value for conflict reports
+func describeRef(ref *plumbing.Reference) string {
+	if ref.Type() == plumbing.SymbolicReference {
+		return "ref: " + ref.Target().String()
+	}
+	return ref.Hash().String()
+}
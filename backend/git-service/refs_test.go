@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestRefExportAndImportRoundTrip(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	initial := refHash(t, repo, "HEAD")
+	head := commitTestFiles(t, repo, "Second", map[string]string{"b.txt": "b\n"})
+	setRef(t, repo, "refs/heads/feature", head)
+	setRef(t, repo, "refs/tags/v1", initial)
+
+	rec := serve(t, gs.exportRefsHandler, "GET", "/git/p/refs/export", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var dump struct {
+		Refs []RefSnapshot `json:"refs"`
+	}
+	decodeBody(t, rec, &dump)
+	var names []string
+	for _, ref := range dump.Refs {
+		names = append(names, ref.Name)
+	}
+	if !equalStrings(names, []string{"HEAD", "refs/heads/feature", "refs/heads/master", "refs/tags/v1"}) {
+		t.Fatalf("exported %v", names)
+	}
+
+	// Lose the feature branch and move master back
+	setRef(t, repo, "refs/heads/master", initial)
+	if err := repo.Storer.RemoveReference("refs/heads/feature"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = serve(t, gs.importRefsHandler, "POST", "/git/p/refs/import", project("p"), RefImportRequest{Refs: dump.Refs})
+	expectStatus(t, rec, http.StatusConflict)
+	if _, err := repo.Reference("refs/heads/feature", false); err == nil {
+		t.Error("a refused import restored refs")
+	}
+
+	rec = serve(t, gs.importRefsHandler, "POST", "/git/p/refs/import", project("p"), RefImportRequest{Refs: dump.Refs, Force: true})
+	expectStatus(t, rec, http.StatusOK)
+	var result struct {
+		Created   []string `json:"created"`
+		Updated   []string `json:"updated"`
+		Unchanged []string `json:"unchanged"`
+	}
+	decodeBody(t, rec, &result)
+	if !equalStrings(result.Created, []string{"refs/heads/feature"}) || !equalStrings(result.Updated, []string{"refs/heads/master"}) {
+		t.Errorf("created %v, updated %v", result.Created, result.Updated)
+	}
+	if refHash(t, repo, "refs/heads/master") != head || refHash(t, repo, "refs/heads/feature") != head {
+		t.Error("the branches were not restored")
+	}
+}
+
+func TestRefImportRejectsMissingObjects(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	master := refHash(t, repo, "refs/heads/master")
+
+	missing := RefSnapshot{Name: "refs/heads/master", Hash: plumbing.NewHash("0123456789abcdef0123456789abcdef01234567").String()}
+	rec := serve(t, gs.importRefsHandler, "POST", "/git/p/refs/import", project("p"), RefImportRequest{Refs: []RefSnapshot{missing}, Force: true})
+	expectStatus(t, rec, http.StatusUnprocessableEntity)
+	if refHash(t, repo, "refs/heads/master") != master {
+		t.Error("master moved")
+	}
+}
+
+func TestRefImportRejectsNamesOutsideRefs(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	master := refHash(t, repo, "refs/heads/master").String()
+	config, err := os.ReadFile(filepath.Join(gs.gitDir("p"), "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, snapshot := range []RefSnapshot{
+		{Name: "refs/../config", Hash: master},
+		{Name: "refs/heads/../../x", Hash: master},
+		{Name: "refs/../index", Hash: master},
+		{Name: "refs/heads/.hidden", Hash: master},
+		{Name: "refs/heads/x.lock", Hash: master},
+		{Name: "refs/", Hash: master},
+		{Name: "HEAD", Target: "refs/../config"},
+		{Name: "refs/heads/alias", Target: "refs/heads/../../HEAD"},
+	} {
+		rec := serve(t, gs.importRefsHandler, "POST", "/git/p/refs/import", project("p"), RefImportRequest{Refs: []RefSnapshot{snapshot}, Force: true})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%+v: status %d; body: %s", snapshot, rec.Code, rec.Body.String())
+		}
+	}
+
+	after, err := os.ReadFile(filepath.Join(gs.gitDir("p"), "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(config) {
+		t.Errorf(".git/config changed to %q", after)
+	}
+	if _, err := os.Stat(filepath.Join(gs.gitDir("p"), "x")); !os.IsNotExist(err) {
+		t.Errorf("a ref was written outside the git directory: %v", err)
+	}
+}
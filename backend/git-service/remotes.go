@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/gorilla/mux"
+)
+
+// RemoteInfo describes a configured remote. Credentials embedded in URLs
+// are redacted.
+type RemoteInfo struct {
+	Name  string   `json:"name"`
+	URLs  []string `json:"urls"`
+	Fetch []string `json:"fetch"`
+}
+
+// AddRemoteRequest represents a request to add a remote
+type AddRemoteRequest struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// DeleteRemoteBranchRequest carries the credentials for deleting a remote
+// branch. The body is optional.
+type DeleteRemoteBranchRequest struct {
+	Auth *RemoteAuth `json:"auth,omitempty"`
+}
+
+// newRemoteInfo converts a remote's config for the API
+func newRemoteInfo(remote *config.RemoteConfig) RemoteInfo {
+	info := RemoteInfo{Name: remote.Name, URLs: []string{}, Fetch: []string{}}
+	for _, url := range remote.URLs {
+		info.URLs = append(info.URLs, redactSecrets(url, nil))
+	}
+	for _, spec := range remote.Fetch {
+		info.Fetch = append(info.Fetch, spec.String())
+	}
+	return info
+}
+
+// List remotes endpoint
+func (gs *GitService) remotesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		gs.sendError(w, "Failed to read config", http.StatusInternalServerError)
+		return
+	}
+
+	remotes := []RemoteInfo{}
+	for _, remote := range cfg.Remotes {
+		remotes = append(remotes, newRemoteInfo(remote))
+	}
+	sort.Slice(remotes, func(i, j int) bool { return remotes[i].Name < remotes[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"remotes": remotes,
+	})
+}
+
+// Add remote endpoint
+func (gs *GitService) addRemoteHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req AddRemoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" || req.URL == "" {
+		gs.sendError(w, "Remote name and url are required", http.StatusBadRequest)
+		return
+	}
+	// The name becomes part of refs/remotes/<name>/, so it must make valid refs
+	if err := validateRefName(req.Name); err != nil || strings.Contains(req.Name, "/") {
+		gs.sendError(w, fmt.Sprintf("Invalid remote name '%s'", req.Name), http.StatusBadRequest)
+		return
+	}
+	if _, err := transport.NewEndpoint(req.URL); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid remote url: %v", redactError(err, nil)), http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		gs.sendError(w, "Failed to read config", http.StatusInternalServerError)
+		return
+	}
+	if _, ok := cfg.Remotes[req.Name]; ok {
+		gs.sendError(w, fmt.Sprintf("Remote '%s' already exists", req.Name), http.StatusConflict)
+		return
+	}
+
+	// Validate fills in the default fetch refspec, as git remote add does
+	remoteConfig := &config.RemoteConfig{Name: req.Name, URLs: []string{req.URL}}
+	if err := remoteConfig.Validate(); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid remote: %v", err), http.StatusBadRequest)
+		return
+	}
+	remote, err := repo.CreateRemote(remoteConfig)
+	if err != nil {
+		gs.sendError(w, "Failed to add remote", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Remote '%s' added", req.Name),
+		"remote":  newRemoteInfo(remote.Config()),
+	})
+}
+
+// Remove remote endpoint
+func (gs *GitService) deleteRemoteHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	name := vars["name"]
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		gs.sendError(w, "Failed to read config", http.StatusInternalServerError)
+		return
+	}
+	if _, ok := cfg.Remotes[name]; !ok {
+		gs.sendError(w, fmt.Sprintf("Remote '%s' not found", name), http.StatusNotFound)
+		return
+	}
+
+	// Like git remote remove, branches stop tracking the remote
+	delete(cfg.Remotes, name)
+	untracked := []string{}
+	for branchName, branch := range cfg.Branches {
+		if branch.Remote == name {
+			branch.Remote = ""
+			branch.Merge = ""
+			untracked = append(untracked, branchName)
+		}
+	}
+	sort.Strings(untracked)
+	if err := repo.SetConfig(cfg); err != nil {
+		gs.sendError(w, "Failed to remove remote", http.StatusInternalServerError)
+		return
+	}
+
+	// The remote-tracking refs and their reflogs go with the remote
+	prefix := "refs/remotes/" + name + "/"
+	var tracking []plumbing.ReferenceName
+	refs, err := repo.References()
+	if err != nil {
+		gs.sendError(w, "Failed to list references", http.StatusInternalServerError)
+		return
+	}
+	refs.ForEach(func(ref *plumbing.Reference) error {
+		if strings.HasPrefix(ref.Name().String(), prefix) {
+			tracking = append(tracking, ref.Name())
+		}
+		return nil
+	})
+	for _, ref := range tracking {
+		if err := repo.Storer.RemoveReference(ref); err != nil {
+			gs.logger.Warn("failed to remove ref", "projectId", projectID, "ref", ref.String(), "error", err)
+		}
+		if err := os.Remove(gs.reflogPath(projectID, ref)); err != nil && !os.IsNotExist(err) {
+			gs.logger.Warn("failed to remove reflog", "projectId", projectID, "ref", ref.String(), "error", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":           fmt.Sprintf("Remote '%s' removed", name),
+		"remote":            name,
+		"removedRefs":       len(tracking),
+		"untrackedBranches": untracked,
+	})
+}
+
+// Delete remote branch endpoint
+func (gs *GitService) deleteRemoteBranchHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	remoteName := vars["remote"]
+	branchName := vars["branchName"]
+
+	var req DeleteRemoteBranchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validateRefName(branchName); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid branch name: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+	if _, err := repo.Remote(remoteName); err != nil {
+		gs.sendError(w, fmt.Sprintf("Remote '%s' not found", remoteName), http.StatusNotFound)
+		return
+	}
+
+	auth, err := remoteAuthFor(repo, remoteName, req.Auth)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid auth: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	tracking := plumbing.NewRemoteReferenceName(remoteName, branchName)
+	_, trackingErr := repo.Reference(tracking, false)
+
+	branchRef := plumbing.NewBranchReferenceName(branchName)
+	ctx, cancel := gs.remoteContext(r.Context())
+	defer cancel()
+	err = timeoutError(ctx, repo.PushContext(ctx, &git.PushOptions{
+		RemoteName: remoteName,
+		RefSpecs:   []config.RefSpec{config.RefSpec(":" + branchRef.String())},
+		Auth:       auth,
+	}))
+	// go-git skips deleting a ref the remote does not have, so nothing is pushed
+	if err == git.NoErrAlreadyUpToDate {
+		gs.sendError(w, fmt.Sprintf("Branch '%s' not found on remote '%s'", branchName, remoteName), http.StatusNotFound)
+		return
+	} else if err != nil {
+		gs.sendError(w, fmt.Sprintf("Failed to delete remote branch: %v", redactError(err, req.Auth)), remoteErrorStatus(err, http.StatusBadGateway))
+		return
+	}
+
+	// Like git push --delete, the remote-tracking ref goes too. go-git
+	// usually removes it itself; its reflog is left to us.
+	if err := repo.Storer.RemoveReference(tracking); err != nil {
+		gs.logger.Warn("failed to remove ref", "projectId", projectID, "ref", tracking.String(), "error", err)
+	}
+	if err := os.Remove(gs.reflogPath(projectID, tracking)); err != nil && !os.IsNotExist(err) {
+		gs.logger.Warn("failed to remove reflog", "projectId", projectID, "ref", tracking.String(), "error", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":         fmt.Sprintf("Branch '%s' deleted from remote '%s'", branchName, remoteName),
+		"remote":          remoteName,
+		"branch":          branchName,
+		"removedTracking": trackingErr == nil,
+	})
+}
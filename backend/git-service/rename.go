@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// maxRenameCandidates caps the sources and destinations compared by content,
+// like git's diff.renameLimit; past it only exact renames are found
+const maxRenameCandidates = 1000
+
+// parseRenameOptions reads the renames and renameThreshold query parameters,
+// defaulting both to the project settings
+func parseRenameOptions(query url.Values, settings ProjectSettings) (bool, int, error) {
+	enabled := settings.DetectRenames
+	if value := query.Get("renames"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, 0, errors.New("Invalid renames value")
+		}
+		enabled = parsed
+	}
+
+	threshold := settings.RenameThreshold
+	if value := query.Get("renameThreshold"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 || parsed > 100 {
+			return false, 0, errors.New("renameThreshold must be between 0 and 100")
+		}
+		threshold = parsed
+	}
+	return enabled, threshold, nil
+}
+
+// RenamedFile represents a file detected as moved
+type RenamedFile struct {
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Similarity int    `json:"similarity"`
+}
+
+// renameCandidate is a possible pairing of a deleted and an added file
+type renameCandidate struct {
+	src, dst string
+	score    int
+}
+
+// detectRenames pairs files only present in from with files only present in
+// to. Identical content always pairs; otherwise pairs must reach threshold
+// percent similarity, and the most similar pairs win.
+func detectRenames(from, to map[string]*diffEntry, threshold int) ([]filePair, error) {
+	var deleted, added []string
+	for p := range from {
+		if _, ok := to[p]; !ok {
+			deleted = append(deleted, p)
+		}
+	}
+	for p := range to {
+		if _, ok := from[p]; !ok {
+			added = append(added, p)
+		}
+	}
+	sort.Strings(deleted)
+	sort.Strings(added)
+
+	var pairs []filePair
+	used := make(map[string]bool)
+
+	// Exact renames first, matched by blob hash
+	byHash := make(map[string][]string)
+	for _, p := range deleted {
+		key := from[p].hash.String()
+		byHash[key] = append(byHash[key], p)
+	}
+	for _, p := range added {
+		key := to[p].hash.String()
+		if candidates := byHash[key]; len(candidates) > 0 {
+			src := candidates[0]
+			byHash[key] = candidates[1:]
+			used[src], used[p] = true, true
+			pairs = append(pairs, filePair{srcPath: src, dstPath: p, src: from[src], dst: to[p], rename: true, similarity: 100})
+		}
+	}
+
+	deleted, added = unused(deleted, used), unused(added, used)
+	if len(deleted) == 0 || len(added) == 0 || len(deleted) > maxRenameCandidates || len(added) > maxRenameCandidates {
+		return pairs, nil
+	}
+
+	srcData, err := readEntries(from, deleted)
+	if err != nil {
+		return nil, err
+	}
+	dstData, err := readEntries(to, added)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []renameCandidate
+	for _, src := range deleted {
+		for _, dst := range added {
+			// Unchanged content can't exceed the smaller file, so skip pairs whose sizes rule a match out
+			larger, smaller := len(srcData[src]), len(dstData[dst])
+			if smaller > larger {
+				larger, smaller = smaller, larger
+			}
+			if smaller*100 < threshold*larger {
+				continue
+			}
+			if score := similarity(srcData[src], dstData[dst]); score >= threshold {
+				candidates = append(candidates, renameCandidate{src: src, dst: dst, score: score})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	for _, c := range candidates {
+		if used[c.src] || used[c.dst] {
+			continue
+		}
+		used[c.src], used[c.dst] = true, true
+		pairs = append(pairs, filePair{srcPath: c.src, dstPath: c.dst, src: from[c.src], dst: to[c.dst], rename: true, similarity: c.score})
+	}
+	return pairs, nil
+}
+
+// unused filters out paths that have already been paired
+func unused(paths []string, used map[string]bool) []string {
+	var remaining []string
+	for _, p := range paths {
+		if !used[p] {
+			remaining = append(remaining, p)
+		}
+	}
+	return remaining
+}
+
+// readEntries loads the content of the named entries
+func readEntries(entries map[string]*diffEntry, paths []string) (map[string][]byte, error) {
+	data := make(map[string][]byte, len(paths))
+	for _, p := range paths {
+		content, err := entries[p].read()
+		if err != nil {
+			return nil, err
+		}
+		data[p] = content
+	}
+	return data, nil
+}
+
+// similarity scores two file contents 0-100 as the share of the larger file
+// left unchanged, in bytes. Binary content only matches exactly.
+func similarity(src, dst []byte) int {
+	larger, smaller := len(src), len(dst)
+	if smaller > larger {
+		larger, smaller = smaller, larger
+	}
+	if larger == 0 {
+		return 100
+	}
+	if smaller == 0 || isBinary(src) || isBinary(dst) {
+		return 0
+	}
+
+	unchanged := 0
+	for _, op := range diffLines(string(src), string(dst)) {
+		if op.Type == diffmatchpatch.DiffEqual {
+			unchanged += len(op.Text)
+		}
+	}
+	return unchanged * 100 / larger
+}
+
+// stagedRenames detects renames between HEAD and the index
+func (gs *GitService) stagedRenames(repo *git.Repository, threshold int) ([]*RenamedFile, error) {
+	from := map[string]*diffEntry{}
+	if _, err := repo.Head(); err == nil {
+		head, err := gs.resolveCommit(repo, "")
+		if err != nil {
+			return nil, err
+		}
+		if from, err = treeEntries(head, ""); err != nil {
+			return nil, err
+		}
+	} else if err != plumbing.ErrReferenceNotFound {
+		return nil, err
+	}
+
+	to, err := indexEntries(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs, err := detectRenames(from, to, threshold)
+	if err != nil {
+		return nil, err
+	}
+	renames := make([]*RenamedFile, 0, len(pairs))
+	for _, pair := range pairs {
+		renames = append(renames, &RenamedFile{From: pair.srcPath, To: pair.dstPath, Similarity: pair.similarity})
+	}
+	sort.Slice(renames, func(i, j int) bool {
+		return renames[i].To < renames[j].To
+	})
+	return renames, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tenLines returns ten numbered lines, with the first changed lines edited
+func tenLines(changed int) string {
+	var b strings.Builder
+	for i := 0; i < 10; i++ {
+		if i < changed {
+			b.WriteString("edited line\n")
+		} else {
+			fmt.Fprintf(&b, "line %d of the file\n", i)
+		}
+	}
+	return b.String()
+}
+
+// moveWithEdits commits old.txt, then moves it to new.txt with three of its
+// ten lines changed, returning the diff query between the two commits
+func moveWithEdits(t *testing.T, gs *GitService) string {
+	t.Helper()
+	repo := initTestRepo(t, gs, "p")
+	from := commitTestFiles(t, repo, "Add old", map[string]string{"old.txt": tenLines(0)})
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worktree.Remove("old.txt"); err != nil {
+		t.Fatal(err)
+	}
+	to := commitTestFiles(t, repo, "Move old", map[string]string{"new.txt": tenLines(3)})
+	return "from=" + from.String() + "&to=" + to.String()
+}
+
+func TestDiffRenameThreshold(t *testing.T) {
+	gs := newTestService(t)
+	query := moveWithEdits(t, gs)
+
+	body := getDiff(t, gs, query+"&renames=true&renameThreshold=50")
+	if len(body.Files) != 1 {
+		t.Fatalf("got %d files, want one rename: %+v", len(body.Files), body.Files)
+	}
+	file := body.Files[0]
+	if file.ChangeType != changeRenamed || file.OldPath != "old.txt" || file.Path != "new.txt" {
+		t.Errorf("got %s %s -> %s, want old.txt renamed to new.txt", file.ChangeType, file.OldPath, file.Path)
+	}
+	if file.Similarity < 50 || file.Similarity >= 90 {
+		t.Errorf("similarity %d, want between 50 and 90", file.Similarity)
+	}
+
+	// Above the similarity the pair is a deletion and an addition again
+	body = getDiff(t, gs, query+"&renames=true&renameThreshold=90")
+	changes := map[string]string{}
+	for _, file := range body.Files {
+		changes[file.Path] = file.ChangeType
+	}
+	if len(changes) != 2 || changes["old.txt"] != changeDeleted || changes["new.txt"] != changeAdded {
+		t.Errorf("changes above the threshold: %v", changes)
+	}
+
+	rec := serve(t, gs.diffHandler, "GET", "/git/p/diff?"+query+"&renameThreshold=101", project("p"), nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestStatusReportsStagedRename(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "p")
+	runGit(t, gs.getProjectPath("p"), "mv", "a.txt", "b.txt")
+
+	rec := serve(t, gs.statusHandler, "GET", "/git/p/status?renames=true", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Status Status `json:"status"`
+	}
+	decodeBody(t, rec, &body)
+	if len(body.Status.Renames) != 1 || body.Status.Renames[0].From != "a.txt" || body.Status.Renames[0].To != "b.txt" {
+		t.Fatalf("renames %+v, want a.txt -> b.txt", body.Status.Renames)
+	}
+	for _, file := range body.Status.StagedFiles {
+		if file == "a.txt" {
+			t.Error("the rename source is still listed as staged")
+		}
+	}
+}
+
+func TestDiffDetectsRenamesByDefault(t *testing.T) {
+	gs := newTestService(t)
+	query := moveWithEdits(t, gs)
+
+	body := getDiff(t, gs, query)
+	if len(body.Files) != 1 || body.Files[0].ChangeType != changeRenamed || body.Files[0].Similarity < 50 {
+		t.Fatalf("default diff: %+v", body.Files)
+	}
+	if want := runGit(t, gs.getProjectPath("p"), "diff", "-M50%", strings.ReplaceAll(strings.TrimPrefix(query, "from="), "&to=", "..")) + "\n"; body.Patch != want {
+		t.Errorf("patch\n%s\nwant git's\n%s", body.Patch, want)
+	}
+
+	body = getDiff(t, gs, query+"&renames=false")
+	changes := map[string]string{}
+	for _, file := range body.Files {
+		changes[file.Path] = file.ChangeType
+	}
+	if len(changes) != 2 || changes["old.txt"] != changeDeleted || changes["new.txt"] != changeAdded {
+		t.Errorf("changes with renames=false: %v", changes)
+	}
+
+	// The project setting turns the default off; the query still wins
+	updateSettings(t, gs, map[string]bool{"detectRenames": false})
+	if body := getDiff(t, gs, query); len(body.Files) != 2 {
+		t.Errorf("diff with detectRenames off: %+v", body.Files)
+	}
+	if body := getDiff(t, gs, query+"&renames=true"); len(body.Files) != 1 {
+		t.Errorf("diff with renames=true over the setting: %+v", body.Files)
+	}
+}
+
+func TestDiffExactRename(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	from := refHash(t, repo, "HEAD")
+	if err := os.Mkdir(filepath.Join(gs.getProjectPath("p"), "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, gs.getProjectPath("p"), "mv", "a.txt", "dir/moved.txt")
+	runGit(t, gs.getProjectPath("p"), "commit", "-q", "-m", "Move")
+
+	body := getDiff(t, gs, "from="+from.String()+"&to=HEAD")
+	if len(body.Files) != 1 {
+		t.Fatalf("files %+v", body.Files)
+	}
+	file := body.Files[0]
+	if file.ChangeType != changeRenamed || file.OldPath != "a.txt" || file.Path != "dir/moved.txt" || file.Similarity != 100 || file.Additions != 0 || file.Deletions != 0 {
+		t.Errorf("exact rename: %+v", file)
+	}
+	if want := runGit(t, gs.getProjectPath("p"), "diff", "-M", from.String(), "HEAD") + "\n"; body.Patch != want {
+		t.Errorf("patch\n%s\nwant git's\n%s", body.Patch, want)
+	}
+}
+
+func TestStatusDetectsRenamesByDefault(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "p")
+	runGit(t, gs.getProjectPath("p"), "mv", "a.txt", "b.txt")
+
+	status := func(query string) Status {
+		t.Helper()
+		rec := serve(t, gs.statusHandler, "GET", "/git/p/status"+query, project("p"), nil)
+		expectStatus(t, rec, http.StatusOK)
+		var body struct {
+			Status Status `json:"status"`
+		}
+		decodeBody(t, rec, &body)
+		return body.Status
+	}
+	if renames := status("").Renames; len(renames) != 1 || renames[0].From != "a.txt" || renames[0].Similarity != 100 {
+		t.Errorf("default status renames %+v", renames)
+	}
+	if off := status("?renames=false"); len(off.Renames) != 0 || len(off.StagedFiles) != 2 {
+		t.Errorf("status with renames=false: renames %+v, staged %v", off.Renames, off.StagedFiles)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"container/list"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// Repository cache defaults. Each handle keeps go-git's object cache and
+// pack indexes, so the size bounds memory as much as it bounds open
+// repositories.
+const (
+	defaultRepoCacheSize = 32
+	defaultRepoCacheTTL  = 30 * time.Second
+)
+
+// repoCache keeps opened repositories so the next user does not reload the
+// pack indexes. go-git's storage fills its caches without synchronization,
+// so a cached handle has one user at a time: in gs.repos the project lock
+// ensures that, and in gs.readRepos each entry's inUse mutex.
+//
+// Refs, the index and config are read from disk on every call, and objects
+// are immutable, so the only state that can go stale is the set of packs.
+// An entry is dropped when the pack directory changes, which covers packs
+// written or removed outside the handle, and after ttl regardless.
+type repoCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type repoCacheEntry struct {
+	projectID string
+	repo      *git.Repository
+	packs     time.Time
+	openedAt  time.Time
+
+	// inUse is held by the reader using repo, for the readers' cache
+	inUse sync.Mutex
+}
+
+// newRepoCache creates a cache of at most size repositories. A size of zero
+// disables caching.
+func newRepoCache(size int, ttl time.Duration) *repoCache {
+	return &repoCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// repoCacheFromEnv sizes the cache from REPO_CACHE_SIZE and REPO_CACHE_TTL
+// (a duration such as 30s), falling back to the defaults when unset or
+// invalid
+func repoCacheFromEnv() *repoCache {
+	size := defaultRepoCacheSize
+	if value, err := strconv.Atoi(os.Getenv("REPO_CACHE_SIZE")); err == nil && value >= 0 {
+		size = value
+	}
+	ttl := defaultRepoCacheTTL
+	if value, err := time.ParseDuration(os.Getenv("REPO_CACHE_TTL")); err == nil && value > 0 {
+		ttl = value
+	}
+	return newRepoCache(size, ttl)
+}
+
+// get returns the cached repository of a project, if it has not expired and
+// was opened against the same pack directory
+func (c *repoCache) get(projectID string, packs time.Time) *git.Repository {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry := c.lookup(projectID, packs); entry != nil {
+		return entry.repo
+	}
+	return nil
+}
+
+// acquire is get for the readers' cache. The repository is the caller's
+// alone until it calls release; nil means there is none or another reader
+// has it.
+func (c *repoCache) acquire(projectID string, packs time.Time) (repo *git.Repository, release func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.lookup(projectID, packs)
+	if entry == nil || !entry.inUse.TryLock() {
+		return nil, nil
+	}
+	return entry.repo, entry.inUse.Unlock
+}
+
+// lookup finds a live entry and marks it most recently used. The caller
+// holds c.mu.
+func (c *repoCache) lookup(projectID string, packs time.Time) *repoCacheEntry {
+	element, ok := c.entries[projectID]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*repoCacheEntry)
+	if time.Since(entry.openedAt) > c.ttl || !entry.packs.Equal(packs) {
+		c.order.Remove(element)
+		delete(c.entries, projectID)
+		return nil
+	}
+	c.order.MoveToFront(element)
+	return entry
+}
+
+// put caches a repository, evicting the least recently used one when full
+func (c *repoCache) put(projectID string, repo *git.Repository, packs time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.insert(&repoCacheEntry{projectID: projectID, repo: repo, packs: packs, openedAt: time.Now()})
+}
+
+// putAcquired is put for the readers' cache, for a repository the caller
+// goes on to use. It returns the release func acquire would have. A handle
+// another reader is using is left in place.
+func (c *repoCache) putAcquired(projectID string, repo *git.Repository, packs time.Time) (release func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[projectID]; ok {
+		busy := &element.Value.(*repoCacheEntry).inUse
+		if !busy.TryLock() {
+			return func() {}
+		}
+		busy.Unlock()
+	}
+	entry := &repoCacheEntry{projectID: projectID, repo: repo, packs: packs, openedAt: time.Now()}
+	entry.inUse.Lock()
+	c.insert(entry)
+	return entry.inUse.Unlock
+}
+
+// insert adds an entry in place of any other for its project. The caller
+// holds c.mu.
+func (c *repoCache) insert(entry *repoCacheEntry) {
+	if c.size == 0 {
+		return
+	}
+	if element, ok := c.entries[entry.projectID]; ok {
+		c.order.Remove(element)
+	}
+	c.entries[entry.projectID] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*repoCacheEntry).projectID)
+	}
+}
+
+// invalidate drops a project's cached repository
+func (c *repoCache) invalidate(projectID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[projectID]; ok {
+		c.order.Remove(element)
+		delete(c.entries, projectID)
+	}
+}
+
+// openLockedRepository opens a repository for a caller holding its project
+// lock, reusing the handle the previous holder left in the cache. The
+// handle must not be kept or shared past the lock's release.
+func (gs *GitService) openLockedRepository(projectID string) (*git.Repository, error) {
+	packs := gs.packDirModTime(projectID)
+	if repo := gs.repos.get(projectID, packs); repo != nil {
+		return repo, nil
+	}
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		return nil, err
+	}
+	gs.repos.put(projectID, repo, packs)
+	return repo, nil
+}
+
+// openReadRepository opens a repository for a reader without the project
+// lock, reusing a cached handle when no other reader has it. The caller
+// must call release once it is done with the handle.
+func (gs *GitService) openReadRepository(projectID string) (repo *git.Repository, release func(), err error) {
+	packs := gs.packDirModTime(projectID)
+	if repo, release := gs.readRepos.acquire(projectID, packs); repo != nil {
+		return repo, release, nil
+	}
+	repo, err = gs.openRepository(projectID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return repo, gs.readRepos.putAcquired(projectID, repo, packs), nil
+}
+
+// packDirModTime returns when packs were last added to or removed from a
+// project, or the zero time if it has no pack directory
+func (gs *GitService) packDirModTime(projectID string) time.Time {
+	info, err := os.Stat(filepath.Join(gs.gitDir(projectID), "objects", "pack"))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func TestRepoCacheReusesHandleForLockHolders(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "p")
+
+	unlock := gs.lockProject("p")
+	first, err := gs.openLockedRepository("p")
+	unlock()
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	unlock = gs.lockProject("p")
+	second, err := gs.openLockedRepository("p")
+	unlock()
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if first != second {
+		t.Error("the next lock holder did not get the cached handle")
+	}
+
+	unlocked, err := gs.openRepository("p")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if unlocked == first {
+		t.Error("an unlocked reader got the cached handle")
+	}
+}
+
+func TestRepoCacheLendsReaderHandlesOneAtATime(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "p")
+
+	first, release, err := gs.openReadRepository("p")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	busy, releaseBusy, err := gs.openReadRepository("p")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if busy == first {
+		t.Error("a second reader got the handle the first is using")
+	}
+	releaseBusy()
+	release()
+
+	again, release, err := gs.openReadRepository("p")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer release()
+	if again != first {
+		t.Error("a released handle was not reused")
+	}
+	unlock := gs.lockProject("p")
+	defer unlock()
+	if locked, err := gs.openLockedRepository("p"); err != nil || locked == first {
+		t.Errorf("a lock holder got a reader's handle (%v)", err)
+	}
+}
+
+func TestRepoCacheReopensAfterPacksChange(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "p")
+
+	unlock := gs.lockProject("p")
+	defer unlock()
+	first, err := gs.openLockedRepository("p")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	// The pack directory's modification time is what is compared
+	packDir := filepath.Join(gs.gitDir("p"), "objects", "pack")
+	if err := os.MkdirAll(packDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(packDir, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := gs.openLockedRepository("p")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if first == second {
+		t.Error("the handle was reused after the packs changed")
+	}
+}
+
+func TestRepoCacheExpiryAndEviction(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	var packs time.Time
+
+	cache := newRepoCache(1, time.Millisecond)
+	cache.put("p", repo, packs)
+	time.Sleep(5 * time.Millisecond)
+	if cache.get("p", packs) != nil {
+		t.Error("an expired entry was returned")
+	}
+
+	cache = newRepoCache(1, time.Hour)
+	cache.put("p", repo, packs)
+	cache.put("q", repo, packs)
+	if cache.get("p", packs) != nil {
+		t.Error("the least recently used entry was not evicted")
+	}
+	if cache.get("q", packs) == nil {
+		t.Error("the newest entry was evicted")
+	}
+	cache.invalidate("q")
+	if cache.get("q", packs) != nil {
+		t.Error("an invalidated entry was returned")
+	}
+
+	cache = newRepoCache(0, time.Hour)
+	cache.put("p", repo, packs)
+	if cache.get("p", packs) != nil {
+		t.Error("a zero-sized cache kept an entry")
+	}
+}
+
+func TestRepoCacheConfiguredFromEnv(t *testing.T) {
+	t.Setenv("REPO_CACHE_SIZE", "4")
+	t.Setenv("REPO_CACHE_TTL", "2m")
+	cache := repoCacheFromEnv()
+	if cache.size != 4 || cache.ttl != 2*time.Minute {
+		t.Errorf("size %d, ttl %v; want 4 and 2m", cache.size, cache.ttl)
+	}
+
+	t.Setenv("REPO_CACHE_SIZE", "-1")
+	t.Setenv("REPO_CACHE_TTL", "soon")
+	cache = repoCacheFromEnv()
+	if cache.size != defaultRepoCacheSize || cache.ttl != defaultRepoCacheTTL {
+		t.Errorf("invalid values were not replaced by the defaults: size %d, ttl %v", cache.size, cache.ttl)
+	}
+}
+
+// Readers without the lock and lock holders share nothing, so running them
+// together on a packed repository is safe under the race detector
+func TestRepoCacheConcurrentReadersAndLockHolders(t *testing.T) {
+	gs := newTestService(t)
+	initTestRepo(t, gs, "p")
+	runGit(t, gs.getProjectPath("p"), "gc", "--quiet")
+
+	read := func(locked bool) error {
+		if locked {
+			unlock := gs.lockProject("p")
+			defer unlock()
+		}
+		open := gs.openRepository
+		if locked {
+			open = gs.openLockedRepository
+		}
+		repo, err := open("p")
+		if err != nil {
+			return err
+		}
+		head, err := repo.Head()
+		if err != nil {
+			return err
+		}
+		_, err = repo.CommitObject(head.Hash())
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(locked bool) {
+			defer wg.Done()
+			if err := read(locked); err != nil {
+				errs <- err
+			}
+		}(i%2 == 0)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// BenchmarkOpenRepository compares opening a packed repository and reading
+// its head commit with and without the cached handle, which keeps the pack
+// index loaded
+func BenchmarkOpenRepository(b *testing.B) {
+	gs := newTestService(b)
+	repo := initTestRepo(b, gs, "p")
+	for i := 0; i < 50; i++ {
+		files := make(map[string]string)
+		for j := 0; j < 20; j++ {
+			files[fmt.Sprintf("dir%d/file%d.txt", j, i)] = fmt.Sprintf("commit %d file %d\n", i, j)
+		}
+		commitTestFiles(b, repo, fmt.Sprintf("Commit %d", i), files)
+	}
+	runGit(b, gs.getProjectPath("p"), "gc", "--quiet")
+
+	readHead := func(b *testing.B, open func(string) (*git.Repository, error)) {
+		for i := 0; i < b.N; i++ {
+			unlock := gs.lockProject("p")
+			repo, err := open("p")
+			if err != nil {
+				b.Fatal(err)
+			}
+			head, err := repo.Head()
+			if err != nil {
+				b.Fatal(err)
+			}
+			commit, err := repo.CommitObject(head.Hash())
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := commit.Tree(); err != nil {
+				b.Fatal(err)
+			}
+			unlock()
+		}
+	}
+	b.Run("cold", func(b *testing.B) { readHead(b, gs.openRepository) })
+	b.Run("cached", func(b *testing.B) { readHead(b, gs.openLockedRepository) })
+}
+
+// BenchmarkReadHandlers runs the status and info endpoints with and without
+// the readers' cache
+func BenchmarkReadHandlers(b *testing.B) {
+	gs := newTestService(b)
+	repo := initTestRepo(b, gs, "p")
+	for i := 0; i < 50; i++ {
+		files := make(map[string]string)
+		for j := 0; j < 20; j++ {
+			files[fmt.Sprintf("dir%d/file%d.txt", j, i)] = fmt.Sprintf("commit %d file %d\n", i, j)
+		}
+		commitTestFiles(b, repo, fmt.Sprintf("Commit %d", i), files)
+	}
+	runGit(b, gs.getProjectPath("p"), "gc", "--quiet")
+
+	handlers := []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+	}{
+		{"status", gs.statusHandler, "/git/p/status"},
+		{"info", gs.infoHandler, "/git/p/info"},
+	}
+	for _, h := range handlers {
+		for _, cached := range []bool{false, true} {
+			name := h.name + "/cold"
+			if cached {
+				name = h.name + "/cached"
+			}
+			b.Run(name, func(b *testing.B) {
+				gs.readRepos = newRepoCache(0, time.Hour)
+				if cached {
+					gs.readRepos = newRepoCache(defaultRepoCacheSize, time.Hour)
+				}
+				for i := 0; i < b.N; i++ {
+					if rec := serve(b, h.handler, "GET", h.target, project("p"), nil); rec.Code != http.StatusOK {
+						b.Fatalf("%s answered %d", h.target, rec.Code)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+)
+
+// resetModes maps the reset modes accepted by the API to go-git's
+var resetModes = map[string]git.ResetMode{
+	"soft":  git.SoftReset,
+	"mixed": git.MixedReset,
+	"hard":  git.HardReset,
+}
+
+// ResetRequest represents a reset request. Commit defaults to HEAD and mode
+// to mixed; a hard reset discards local changes and must be confirmed.
+type ResetRequest struct {
+	Commit  string `json:"commit,omitempty"`
+	Mode    string `json:"mode,omitempty"`
+	Confirm bool   `json:"confirm,omitempty"`
+}
+
+// Reset HEAD endpoint
+func (gs *GitService) resetHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req ResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = "mixed"
+	}
+	mode, ok := resetModes[req.Mode]
+	if !ok {
+		gs.sendError(w, "Mode must be one of soft, mixed or hard", http.StatusBadRequest)
+		return
+	}
+	if mode == git.HardReset && !req.Confirm {
+		gs.sendError(w, "A hard reset discards uncommitted changes; set confirm to true to proceed", http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		gs.sendError(w, "Nothing to reset: the repository has no commits", http.StatusBadRequest)
+		return
+	}
+	commit, err := gs.resolveCommit(repo, req.Commit)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Commit %s not found", req.Commit), http.StatusNotFound)
+		return
+	}
+
+	// Like git, a soft reset keeps the index, which cannot conclude a merge
+	_, merging := gs.readMergeHead(projectID)
+	if merging && mode == git.SoftReset {
+		gs.sendError(w, "Cannot do a soft reset in the middle of a merge", http.StatusConflict)
+		return
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+	if mode == git.HardReset {
+		err = hardReset(repo, worktree, head.Hash(), commit)
+	} else {
+		err = worktree.Reset(&git.ResetOptions{Commit: commit.Hash, Mode: mode})
+	}
+	if err != nil {
+		gs.sendInternalError(w, "Failed to reset", err)
+		return
+	}
+	if merging {
+		gs.clearMergeState(projectID)
+	}
+
+	target := req.Commit
+	if target == "" {
+		target = plumbing.HEAD.String()
+	}
+	gs.logHeadUpdate(projectID, repo, head.Hash(), commit.Hash, gs.resolveIdentity(projectID), fmt.Sprintf("reset: moving to %s", target))
+
+	status, err := gs.getRepositoryStatus(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      fmt.Sprintf("HEAD is now at %s", commit.Hash.String()[:7]),
+		"mode":         req.Mode,
+		"previousHead": head.Hash().String(),
+		"head":         newCommitInfo(commit),
+		"status":       status,
+	})
+}
+
+// hardReset resets the index and working tree to target. go-git's hard reset
+// also deletes untracked files, so the working tree is updated here: files
+// tracked before the reset are restored or removed and untracked ones kept.
+func hardReset(repo *git.Repository, worktree *git.Worktree, head plumbing.Hash, target *object.Commit) error {
+	headCommit, err := repo.CommitObject(head)
+	if err != nil {
+		return err
+	}
+	tracked, err := treeEntries(headCommit, "")
+	if err != nil {
+		return err
+	}
+	staged, err := indexEntries(repo)
+	if err != nil {
+		return err
+	}
+	for p, entry := range staged {
+		tracked[p] = entry
+	}
+	// Conflicted paths are tracked as well
+	unmerged, err := unmergedPaths(repo)
+	if err != nil {
+		return err
+	}
+	for _, p := range unmerged {
+		if _, ok := tracked[p]; !ok {
+			tracked[p] = nil
+		}
+	}
+
+	if err := worktree.Reset(&git.ResetOptions{Commit: target.Hash, Mode: git.MixedReset}); err != nil {
+		return err
+	}
+	entries, err := treeEntries(target, "")
+	if err != nil {
+		return err
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for p := range status {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		fileStatus := status[p]
+		entry, inTarget := entries[p]
+		switch {
+		case inTarget && fileStatus.Worktree != git.Unmodified:
+			blob, err := repo.BlobObject(entry.hash)
+			if err != nil {
+				return err
+			}
+			if err := writeBlobToWorktree(worktree.Filesystem, p, blob, entry.mode); err != nil {
+				return err
+			}
+		case !inTarget && fileStatus.Worktree == git.Untracked:
+			if _, wasTracked := tracked[p]; !wasTracked {
+				continue
+			}
+			if err := worktree.Filesystem.Remove(p); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			removeEmptyParents(worktree.Filesystem, p)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RestoreRequest names the files to restore from Source, HEAD by default.
+// Staged restores the index entries and leaves the working tree alone;
+// otherwise only the working tree files are rewritten.
+type RestoreRequest struct {
+	Files  []string `json:"files"`
+	Source string   `json:"source,omitempty"`
+	Staged bool     `json:"staged,omitempty"`
+}
+
+// Restore files endpoint
+func (gs *GitService) restoreHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req RestoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Files) == 0 {
+		gs.sendError(w, "Files are required", http.StatusBadRequest)
+		return
+	}
+	var paths []string
+	for _, file := range req.Files {
+		p, ok := repoPath(file)
+		if !ok {
+			gs.sendError(w, fmt.Sprintf("Invalid path %s", file), http.StatusBadRequest)
+			return
+		}
+		paths = append(paths, p)
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+
+	source, err := gs.resolveCommit(repo, req.Source)
+	if err != nil {
+		if req.Source == "" {
+			gs.sendError(w, "Nothing to restore from: the repository has no commits", http.StatusBadRequest)
+		} else {
+			gs.sendError(w, fmt.Sprintf("Revision %s not found", req.Source), http.StatusNotFound)
+		}
+		return
+	}
+	entries, err := treeEntries(source, "")
+	if err != nil {
+		gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+		return
+	}
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+	staged := make(map[string]bool, len(idx.Entries))
+	for _, e := range idx.Entries {
+		staged[e.Name] = true
+	}
+
+	// Like git restore, a path must be a file the source or the index knows
+	var directories, unknown []string
+	for _, p := range paths {
+		if info, err := worktree.Filesystem.Lstat(p); err == nil && info.IsDir() {
+			directories = append(directories, p)
+			continue
+		}
+		if _, ok := entries[p]; ok || staged[p] {
+			continue
+		}
+		isDir := false
+		for name := range entries {
+			if strings.HasPrefix(name, p+"/") {
+				isDir = true
+				break
+			}
+		}
+		if isDir {
+			directories = append(directories, p)
+		} else {
+			unknown = append(unknown, p)
+		}
+	}
+	if len(directories) > 0 {
+		gs.sendErrorWithDetails(w, "Only files can be restored", http.StatusBadRequest, map[string]interface{}{
+			"files": directories,
+		})
+		return
+	}
+	if len(unknown) > 0 {
+		gs.sendErrorWithDetails(w, "Some paths are not known to git", http.StatusNotFound, map[string]interface{}{
+			"files": unknown,
+		})
+		return
+	}
+
+	if req.Staged {
+		selected := make(map[string]bool, len(paths))
+		for _, p := range paths {
+			selected[p] = true
+		}
+		kept := idx.Entries[:0]
+		for _, e := range idx.Entries {
+			if !selected[e.Name] {
+				kept = append(kept, e)
+			}
+		}
+		idx.Entries = kept
+		for _, p := range paths {
+			entry, ok := entries[p]
+			if !ok {
+				continue
+			}
+			blob, err := repo.BlobObject(entry.hash)
+			if err != nil {
+				gs.sendError(w, "Failed to read blob", http.StatusInternalServerError)
+				return
+			}
+			e := idx.Add(p)
+			e.Hash = entry.hash
+			e.Mode = entry.mode
+			e.Size = uint32(blob.Size)
+			e.ModifiedAt = time.Now()
+			if info, err := worktree.Filesystem.Lstat(p); err == nil {
+				e.ModifiedAt = info.ModTime()
+			}
+		}
+		sortIndexEntries(idx)
+		if err := repo.Storer.SetIndex(idx); err != nil {
+			gs.sendError(w, "Failed to write index", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		for _, p := range paths {
+			entry, ok := entries[p]
+			if !ok {
+				// Staged but absent from the source, so it goes from the working tree
+				if err := worktree.Filesystem.Remove(p); err != nil && !os.IsNotExist(err) {
+					gs.sendInternalError(w, fmt.Sprintf("Failed to remove %s", p), err)
+					return
+				}
+				removeEmptyParents(worktree.Filesystem, p)
+				continue
+			}
+			blob, err := repo.BlobObject(entry.hash)
+			if err != nil {
+				gs.sendError(w, "Failed to read blob", http.StatusInternalServerError)
+				return
+			}
+			if err := writeBlobToWorktree(worktree.Filesystem, p, blob, entry.mode); err != nil {
+				gs.sendInternalError(w, fmt.Sprintf("Failed to restore %s", p), err)
+				return
+			}
+		}
+	}
+
+	status, err := gs.getRepositoryStatus(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Restored %d file%s from %s", len(paths), plural(len(paths)), source.Hash.String()[:7]),
+		"staged":  req.Staged,
+		"files":   paths,
+		"status":  status,
+	})
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+)
+
+// RevertRequest selects the commits to revert: a single commit, or the
+// commits after From up to and including To
+type RevertRequest struct {
+	Commit  string `json:"commit,omitempty"`
+	From    string `json:"from,omitempty"`
+	To      string `json:"to,omitempty"`
+	Squash  bool   `json:"squash,omitempty"`
+	Message string `json:"message,omitempty"`
+	Author  Author `json:"author"`
+}
+
+// Revert commits endpoint
+func (gs *GitService) revertHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req RevertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if (req.Commit != "") == (req.From != "") {
+		gs.sendError(w, "Specify either commit or from", http.StatusBadRequest)
+		return
+	}
+	if req.Commit != "" && req.To != "" {
+		gs.sendError(w, "to can only be used with from", http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+	if settings.RequireSignedCommits {
+		gs.sendError(w, unsignedCommitMessage, http.StatusUnprocessableEntity)
+		return
+	}
+
+	headRef, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		gs.sendError(w, "Failed to read HEAD", http.StatusInternalServerError)
+		return
+	}
+	head, err := gs.resolveCommit(repo, "")
+	if err != nil {
+		gs.sendError(w, "Nothing to revert: the repository has no commits", http.StatusBadRequest)
+		return
+	}
+
+	// Collect the commits newest first, which is the order they are reverted in
+	var commits []*object.Commit
+	if req.Commit != "" {
+		commit, err := gs.resolveCommit(repo, req.Commit)
+		if err != nil {
+			gs.sendError(w, fmt.Sprintf("Commit %s not found", req.Commit), http.StatusNotFound)
+			return
+		}
+		commits = append(commits, commit)
+	} else {
+		from, err := gs.resolveCommit(repo, req.From)
+		if err != nil {
+			gs.sendError(w, fmt.Sprintf("Commit %s not found", req.From), http.StatusNotFound)
+			return
+		}
+		to, err := gs.resolveCommit(repo, req.To)
+		if err != nil {
+			gs.sendError(w, fmt.Sprintf("Commit %s not found", req.To), http.StatusNotFound)
+			return
+		}
+		for commit := to; commit.Hash != from.Hash; {
+			commits = append(commits, commit)
+			if commit.NumParents() == 0 {
+				gs.sendError(w, fmt.Sprintf("Commit %s is not an ancestor of %s", req.From, commits[0].Hash), http.StatusBadRequest)
+				return
+			}
+			if commit, err = commit.Parent(0); err != nil {
+				gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+				return
+			}
+		}
+		if len(commits) == 0 {
+			gs.sendError(w, "The range contains no commits", http.StatusBadRequest)
+			return
+		}
+	}
+	for _, commit := range commits {
+		if commit.NumParents() > 1 {
+			gs.sendErrorWithDetails(w, "Cannot revert merge commits", http.StatusConflict, map[string]interface{}{
+				"commit": commit.Hash.String(),
+			})
+			return
+		}
+	}
+
+	// Every revert is merged in memory first so a conflict leaves the
+	// repository untouched
+	current, err := treeEntries(head, "")
+	if err != nil {
+		gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+		return
+	}
+	committer := gs.fillIdentity(projectID, req.Author)
+	if committer.Name == "" || committer.Email == "" {
+		gs.sendError(w, missingIdentityMessage, http.StatusBadRequest)
+		return
+	}
+	parent := head.Hash
+	var created []*object.Commit
+	for _, commit := range commits {
+		reverted, err := treeEntries(commit, "")
+		if err != nil {
+			gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+			return
+		}
+		before := map[string]*diffEntry{}
+		if commit.NumParents() > 0 {
+			commitParent, err := commit.Parent(0)
+			if err != nil {
+				gs.sendError(w, "Failed to read parent commit", http.StatusInternalServerError)
+				return
+			}
+			if before, err = treeEntries(commitParent, ""); err != nil {
+				gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		subject, _ := splitCommitMessage(commit.Message)
+		labels := mergeLabels{
+			ours:   "HEAD",
+			base:   fmt.Sprintf("%s (%s)", commit.Hash.String()[:7], subject),
+			theirs: fmt.Sprintf("parent of %s (%s)", commit.Hash.String()[:7], subject),
+		}
+		merged, err := mergeTrees(repo.Storer, reverted, current, before, labels, settings.ConflictStyle)
+		if err != nil {
+			gs.sendInternalError(w, fmt.Sprintf("Failed to revert %s", commit.Hash), err)
+			return
+		}
+		if len(merged.conflicts) > 0 {
+			gs.sendErrorWithDetails(w, fmt.Sprintf("Reverting %s conflicts with the current branch", commit.Hash.String()[:7]), http.StatusConflict, map[string]interface{}{
+				"commit":    commit.Hash.String(),
+				"conflicts": merged.conflicts,
+			})
+			return
+		}
+		current = merged.entries
+
+		if req.Squash {
+			continue
+		}
+		message := fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s.\n", subject, commit.Hash)
+		revert, err := gs.storeRevertCommit(repo, current, parent, committer, message)
+		if err != nil {
+			gs.sendError(w, "Failed to write commit", http.StatusInternalServerError)
+			return
+		}
+		created = append(created, revert)
+		parent = revert.Hash
+	}
+
+	if req.Squash {
+		message := req.Message
+		if message == "" {
+			if len(commits) == 1 {
+				subject, _ := splitCommitMessage(commits[0].Message)
+				message = fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s.\n", subject, commits[0].Hash)
+			} else {
+				var body strings.Builder
+				fmt.Fprintf(&body, "Revert %d commits\n\nThis reverts commits:\n", len(commits))
+				for _, commit := range commits {
+					subject, _ := splitCommitMessage(commit.Message)
+					fmt.Fprintf(&body, "  %s %s\n", commit.Hash, subject)
+				}
+				message = body.String()
+			}
+		}
+		revert, err := gs.storeRevertCommit(repo, current, parent, committer, message)
+		if err != nil {
+			gs.sendError(w, "Failed to write commit", http.StatusInternalServerError)
+			return
+		}
+		created = append(created, revert)
+	}
+	final := created[len(created)-1]
+
+	// Bring the working tree along, refusing where that would overwrite a local change
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+		return
+	}
+	localConflicts, err := gs.switchCarryingChanges(repo, worktree, head.Hash, final.Hash, status)
+	if err != nil {
+		gs.sendInternalError(w, "Failed to update working tree", err)
+		return
+	}
+	if len(localConflicts) > 0 {
+		gs.sendErrorWithDetails(w, "Local changes would be overwritten by the revert", http.StatusConflict, map[string]interface{}{
+			"conflicts": localConflicts,
+		})
+		return
+	}
+
+	name := plumbing.HEAD
+	if headRef.Type() == plumbing.SymbolicReference {
+		name = headRef.Target()
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(name, final.Hash)); err != nil {
+		gs.sendError(w, "Failed to update HEAD", http.StatusInternalServerError)
+		return
+	}
+	previous := head.Hash
+	for _, commit := range created {
+		subject, _ := splitCommitMessage(commit.Message)
+		gs.logHeadUpdate(projectID, repo, previous, commit.Hash, committer, "revert: "+subject)
+		previous = commit.Hash
+	}
+
+	infos := make([]*Commit, 0, len(created))
+	for _, commit := range created {
+		infos = append(infos, newCommitInfo(commit))
+	}
+	reverted := make([]string, 0, len(commits))
+	for _, commit := range commits {
+		reverted = append(reverted, commit.Hash.String())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  fmt.Sprintf("Reverted %d commit%s", len(commits), plural(len(commits))),
+		"commits":  infos,
+		"reverted": reverted,
+		"squash":   req.Squash,
+	})
+}
+
+// storeRevertCommit writes a commit of entries on top of parent, authored
+// and committed by whoever runs the revert like git revert
+func (gs *GitService) storeRevertCommit(repo *git.Repository, entries map[string]*diffEntry, parent plumbing.Hash, committer Author, message string) (*object.Commit, error) {
+	treeHash, err := buildTree(repo.Storer, entries)
+	if err != nil {
+		return nil, err
+	}
+	signature := object.Signature{Name: committer.Name, Email: committer.Email, When: time.Now()}
+	commit := &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      message,
+		TreeHash:     treeHash,
+		ParentHashes: []plumbing.Hash{parent},
+	}
+	if commit.Hash, err = storeObject(repo.Storer, commit); err != nil {
+		return nil, err
+	}
+	return commit, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+type revertResponse struct {
+	Commits  []*Commit `json:"commits"`
+	Reverted []string  `json:"reverted"`
+}
+
+// revertFixture commits three changes on top of the initial commit and
+// returns the initial commit's tree and the three commits
+func revertFixture(t *testing.T, gs *GitService) (string, []string) {
+	t.Helper()
+	repo := initTestRepo(t, gs, "p")
+	tree := headTree(t, repo).String()
+	commits := []string{
+		commitTestFiles(t, repo, "Add b", map[string]string{"b.txt": "b\n"}).String(),
+		commitTestFiles(t, repo, "Edit a", map[string]string{"a.txt": "two\n"}).String(),
+		commitTestFiles(t, repo, "Add c", map[string]string{"c.txt": "c\n"}).String(),
+	}
+	return tree, commits
+}
+
+func TestRevertRangeRestoresTree(t *testing.T) {
+	for _, squash := range []bool{false, true} {
+		gs := newTestService(t)
+		tree, commits := revertFixture(t, gs)
+
+		rec := serve(t, gs.revertHandler, "POST", "/git/p/revert", project("p"), RevertRequest{From: "HEAD~3", To: "HEAD", Squash: squash, Author: testAuthor()})
+		expectStatus(t, rec, http.StatusOK)
+		var body revertResponse
+		decodeBody(t, rec, &body)
+		wantCommits := 3
+		if squash {
+			wantCommits = 1
+		}
+		if len(body.Commits) != wantCommits || !equalStrings(body.Reverted, []string{commits[2], commits[1], commits[0]}) {
+			t.Errorf("squash %v: %d commits reverting %v", squash, len(body.Commits), body.Reverted)
+		}
+
+		dir := gs.getProjectPath("p")
+		if got := runGit(t, dir, "rev-parse", "HEAD^{tree}"); got != tree {
+			t.Errorf("squash %v: tree %s, want the initial tree %s", squash, got, tree)
+		}
+		if status := runGit(t, dir, "status", "--porcelain"); status != "" {
+			t.Errorf("squash %v: working tree not updated:\n%s", squash, status)
+		}
+	}
+}
+
+func TestRevertSingleCommitAndConflict(t *testing.T) {
+	gs := newTestService(t)
+	_, commits := revertFixture(t, gs)
+	repo, err := gs.openRepository("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(t, gs.revertHandler, "POST", "/git/p/revert", project("p"), RevertRequest{Commit: commits[1], Author: testAuthor()})
+	expectStatus(t, rec, http.StatusOK)
+	if readProjectFile(t, gs, "a.txt") != "one\n" || readProjectFile(t, gs, "c.txt") != "c\n" {
+		t.Error("only the middle commit should be undone")
+	}
+
+	// Reverting the first commit again after b.txt changed cannot apply cleanly
+	commitTestFiles(t, repo, "Edit b", map[string]string{"b.txt": "b2\n"})
+	head := refHash(t, repo, "HEAD")
+	rec = serve(t, gs.revertHandler, "POST", "/git/p/revert", project("p"), RevertRequest{Commit: commits[0], Author: testAuthor()})
+	expectStatus(t, rec, http.StatusConflict)
+	if refHash(t, repo, "HEAD") != head {
+		t.Error("a conflicting revert moved HEAD")
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Conflict styles for merge output
+const (
+	conflictStyleMerge = "merge"
+	conflictStyleDiff3 = "diff3"
+)
+
+// ProjectSettings holds per-project defaults for diff, merge and blame, and
+// the policies enforced on commits and pushes
+type ProjectSettings struct {
+	DetectRenames   bool   `json:"detectRenames"`
+	RenameThreshold int    `json:"renameThreshold"`
+	IgnoreAllSpace  bool   `json:"ignoreAllSpace"`
+	IgnoreEOL       bool   `json:"ignoreEol"`
+	ConflictStyle   string `json:"conflictStyle"`
+
+	// BlameMaxFileSize is the largest file, in bytes, that can be blamed
+	BlameMaxFileSize int64 `json:"blameMaxFileSize"`
+
+	// Signing policy
+	RequireSignedCommits bool `json:"requireSignedCommits"`
+	RejectUnsignedPushes bool `json:"rejectUnsignedPushes"`
+
+	// Branch policy: new branch names must match this regular expression in full
+	BranchNamePattern string `json:"branchNamePattern"`
+}
+
+// SettingsUpdate represents a partial settings update; nil fields are left unchanged
+type SettingsUpdate struct {
+	DetectRenames   *bool   `json:"detectRenames,omitempty"`
+	RenameThreshold *int    `json:"renameThreshold,omitempty"`
+	IgnoreAllSpace  *bool   `json:"ignoreAllSpace,omitempty"`
+	IgnoreEOL       *bool   `json:"ignoreEol,omitempty"`
+	ConflictStyle   *string `json:"conflictStyle,omitempty"`
+
+	BlameMaxFileSize *int64 `json:"blameMaxFileSize,omitempty"`
+
+	RequireSignedCommits *bool `json:"requireSignedCommits,omitempty"`
+	RejectUnsignedPushes *bool `json:"rejectUnsignedPushes,omitempty"`
+
+	BranchNamePattern *string `json:"branchNamePattern,omitempty"`
+}
+
+// defaultSettings mirrors git's own defaults
+func defaultSettings() ProjectSettings {
+	return ProjectSettings{
+		DetectRenames:    true,
+		RenameThreshold:  50,
+		ConflictStyle:    conflictStyleMerge,
+		BlameMaxFileSize: 1 << 20,
+	}
+}
+
+// loadSettings returns a project's settings, falling back to defaults
+func (gs *GitService) loadSettings(projectID string) (ProjectSettings, error) {
+	settings := defaultSettings()
+	err := gs.loadState(projectID, "settings", &settings)
+	return settings, err
+}
+
+// diffOptions returns the line diff options implied by the settings
+func (s ProjectSettings) diffOptions() diffOptions {
+	return diffOptions{
+		ignoreAllSpace: s.IgnoreAllSpace,
+		ignoreEOL:      s.IgnoreEOL,
+	}
+}
+
+// Get project settings endpoint
+func (gs *GitService) getSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	if _, err := gs.openRepository(projectID); err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"settings": settings,
+	})
+}
+
+// Update project settings endpoint
+func (gs *GitService) updateSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req SettingsUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.RenameThreshold != nil && (*req.RenameThreshold < 0 || *req.RenameThreshold > 100) {
+		gs.sendError(w, "renameThreshold must be between 0 and 100", http.StatusBadRequest)
+		return
+	}
+	if req.ConflictStyle != nil && *req.ConflictStyle != conflictStyleMerge && *req.ConflictStyle != conflictStyleDiff3 {
+		gs.sendError(w, "conflictStyle must be merge or diff3", http.StatusBadRequest)
+		return
+	}
+	if req.BlameMaxFileSize != nil && *req.BlameMaxFileSize <= 0 {
+		gs.sendError(w, "blameMaxFileSize must be positive", http.StatusBadRequest)
+		return
+	}
+	if req.BranchNamePattern != nil {
+		if _, err := compileBranchPattern(*req.BranchNamePattern); err != nil {
+			gs.sendError(w, fmt.Sprintf("Invalid branchNamePattern: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if _, err := gs.openRepository(projectID); err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	settings := defaultSettings()
+	err := gs.updateState(projectID, "settings", &settings, func() error {
+		if req.DetectRenames != nil {
+			settings.DetectRenames = *req.DetectRenames
+		}
+		if req.RenameThreshold != nil {
+			settings.RenameThreshold = *req.RenameThreshold
+		}
+		if req.IgnoreAllSpace != nil {
+			settings.IgnoreAllSpace = *req.IgnoreAllSpace
+		}
+		if req.IgnoreEOL != nil {
+			settings.IgnoreEOL = *req.IgnoreEOL
+		}
+		if req.ConflictStyle != nil {
+			settings.ConflictStyle = *req.ConflictStyle
+		}
+		if req.BlameMaxFileSize != nil {
+			settings.BlameMaxFileSize = *req.BlameMaxFileSize
+		}
+		if req.RequireSignedCommits != nil {
+			settings.RequireSignedCommits = *req.RequireSignedCommits
+		}
+		if req.RejectUnsignedPushes != nil {
+			settings.RejectUnsignedPushes = *req.RejectUnsignedPushes
+		}
+		if req.BranchNamePattern != nil {
+			settings.BranchNamePattern = *req.BranchNamePattern
+		}
+		return nil
+	})
+	if err != nil {
+		gs.sendError(w, "Failed to save settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "Settings updated successfully",
+		"settings": settings,
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func updateSettings(t *testing.T, gs *GitService, update interface{}) ProjectSettings {
+	t.Helper()
+	rec := serve(t, gs.updateSettingsHandler, "PATCH", "/git/p/settings", project("p"), update)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Settings ProjectSettings `json:"settings"`
+	}
+	decodeBody(t, rec, &body)
+	return body.Settings
+}
+
+func TestIgnoreAllSpaceSettingChangesDiff(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	from := commitTestFiles(t, repo, "Add code", map[string]string{"code.go": "if x {\n\treturn y\n}\n"})
+	to := commitTestFiles(t, repo, "Reindent", map[string]string{"code.go": "if x {\n        return  y\n}\n"})
+	query := "from=" + from.String() + "&to=" + to.String()
+
+	if added, removed := changedLines(getDiff(t, gs, query)); added != 1 || removed != 1 {
+		t.Fatalf("whitespace change without the setting: +%d -%d", added, removed)
+	}
+
+	settings := updateSettings(t, gs, map[string]bool{"ignoreAllSpace": true})
+	if !settings.IgnoreAllSpace {
+		t.Errorf("settings after the update: %+v", settings)
+	}
+	if added, removed := changedLines(getDiff(t, gs, query)); added != 0 || removed != 0 {
+		t.Errorf("whitespace change with ignoreAllSpace: +%d -%d", added, removed)
+	}
+
+	// The query overrides the setting for one request
+	if added, removed := changedLines(getDiff(t, gs, query+"&ignoreAllSpace=false")); added != 1 || removed != 1 {
+		t.Errorf("whitespace change with the setting overridden: +%d -%d", added, removed)
+	}
+
+	rec := serve(t, gs.updateSettingsHandler, "PATCH", "/git/p/settings", project("p"), map[string]string{"conflictStyle": "zdiff3"})
+	expectStatus(t, rec, http.StatusBadRequest)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const (
+	// shutdownTimeout bounds how long a shutdown waits for running
+	// operations and in-flight requests before the process exits anyway
+	shutdownTimeout = 5 * time.Minute
+
+	// drainPollInterval is how often a draining service checks whether its
+	// operations have finished
+	drainPollInterval = 100 * time.Millisecond
+)
+
+// rejectWritesWhileDraining answers requests that could change a repository
+// with 503 once shutdown has begun, so nothing new starts writing to disk.
+// Reads are still served while running operations finish.
+func (gs *GitService) rejectWritesWhileDraining(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if gs.draining.Load() {
+				w.Header().Set("Retry-After", "30")
+				gs.sendError(w, "The service is shutting down", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// runningOperations counts the clones, pushes, fetches and pulls in progress
+func (gs *GitService) runningOperations() int {
+	gs.operationsMu.Lock()
+	defer gs.operationsMu.Unlock()
+	running := 0
+	for _, op := range gs.operations {
+		if op.snapshot().Status == "running" {
+			running++
+		}
+	}
+	return running
+}
+
+// shutdown stops the service without cutting an operation off mid-write:
+// new writes are refused, running operations are waited for, then the
+// server is shut down once its in-flight requests are done. All of it is
+// bounded by timeout.
+func (gs *GitService) shutdown(srv *http.Server, timeout time.Duration) error {
+	gs.draining.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	logged := 0
+	for running := gs.runningOperations(); running > 0; running = gs.runningOperations() {
+		if running != logged {
+			gs.logger.Info("waiting for operations to finish", "running", running)
+			logged = running
+		}
+		select {
+		case <-ctx.Done():
+			gs.logger.Warn("shutdown timed out with operations running", "running", running)
+			return srv.Close()
+		case <-ticker.C:
+		}
+	}
+
+	return srv.Shutdown(ctx)
+}
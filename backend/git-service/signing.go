@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// unsignedCommitMessage explains why commits are refused under the signing
+// policy: the service holds no signing key, so it can only create unsigned
+// commits
+const unsignedCommitMessage = "Signed commits are required by project policy; this service cannot sign commits, so commit with a signing client instead"
+
+// UnsignedCommit identifies an outgoing commit without a signature
+type UnsignedCommit struct {
+	Branch string `json:"branch"`
+	Commit string `json:"commit"`
+}
+
+// unsignedOutgoingCommits lists the commits a push of branches would send
+// that carry no signature
+func unsignedOutgoingCommits(repo *git.Repository, remoteName string, branches []*plumbing.Reference) ([]UnsignedCommit, error) {
+	var unsigned []UnsignedCommit
+	seen := make(map[plumbing.Hash]bool)
+	for _, branch := range branches {
+		out, err := outgoingCommits(repo, remoteName, branch)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range out.commits {
+			if seen[c.Hash] || c.PGPSignature != "" {
+				continue
+			}
+			seen[c.Hash] = true
+			unsigned = append(unsigned, UnsignedCommit{Branch: branch.Name().Short(), Commit: c.Hash.String()})
+		}
+	}
+	return unsigned, nil
+}
+
+// unsignedPushCommits fetches the remote and lists the unsigned commits a
+// push with opts would send. Without explicit refspecs go-git pushes every
+// local branch, so every branch is checked.
+func (gs *GitService) unsignedPushCommits(ctx context.Context, repo *git.Repository, opts *git.PushOptions) ([]UnsignedCommit, error) {
+	err := repo.FetchContext(ctx, &git.FetchOptions{RemoteName: opts.RemoteName, Auth: opts.Auth})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, timeoutError(ctx, err)
+	}
+
+	var branches []*plumbing.Reference
+	if len(opts.RefSpecs) > 0 {
+		for _, spec := range opts.RefSpecs {
+			ref, err := repo.Reference(plumbing.ReferenceName(spec.Src()), true)
+			if err != nil {
+				return nil, err
+			}
+			branches = append(branches, ref)
+		}
+	} else {
+		iter, err := repo.Branches()
+		if err != nil {
+			return nil, err
+		}
+		err = iter.ForEach(func(ref *plumbing.Reference) error {
+			branches = append(branches, ref)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return unsignedOutgoingCommits(repo, opts.RemoteName, branches)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// storeSignedCommit writes a commit with a signature on top of parent. The
+// policy only checks that one is present, so it need not verify.
+func storeSignedCommit(t *testing.T, repo *git.Repository, parent plumbing.Hash) plumbing.Hash {
+	t.Helper()
+	commit := &object.Commit{
+		Author:       *testSignature(),
+		Committer:    *testSignature(),
+		Message:      "Signed\n",
+		TreeHash:     headTree(t, repo),
+		ParentHashes: []plumbing.Hash{parent},
+		PGPSignature: "-----BEGIN PGP SIGNATURE-----\n\nnot a real signature\n-----END PGP SIGNATURE-----\n",
+	}
+	obj := repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestSigningPolicyRefusesCommits(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	head := refHash(t, repo, "HEAD")
+	updateSettings(t, gs, map[string]bool{"requireSignedCommits": true})
+
+	writeFiles(t, repo, map[string]string{"a.txt": "two\n"})
+	expectStatus(t, serveCommit(t, gs, CommitRequest{Message: "Unsigned"}), http.StatusUnprocessableEntity)
+	if refHash(t, repo, "HEAD") != head {
+		t.Fatal("a refused commit moved HEAD")
+	}
+
+	updateSettings(t, gs, map[string]bool{"requireSignedCommits": false})
+	expectStatus(t, serveCommit(t, gs, CommitRequest{Message: "Unsigned"}), http.StatusOK)
+}
+
+func TestSigningPolicyRejectsUnsignedPushes(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	remote := addTestRemote(t, repo)
+	updateSettings(t, gs, map[string]bool{"rejectUnsignedPushes": true})
+	unsigned := commitTestFiles(t, repo, "Unsigned", map[string]string{"b.txt": "b\n"})
+
+	rec := serve(t, gs.pushHandler, "POST", "/git/p/push", project("p"), PushRequest{})
+	expectStatus(t, rec, http.StatusUnprocessableEntity)
+	var body struct {
+		UnsignedCommits []UnsignedCommit `json:"unsignedCommits"`
+	}
+	decodeBody(t, rec, &body)
+	if len(body.UnsignedCommits) != 1 || body.UnsignedCommits[0] != (UnsignedCommit{Branch: "master", Commit: unsigned.String()}) {
+		t.Errorf("unsigned commits %+v, want only %s", body.UnsignedCommits, unsigned)
+	}
+
+	// Replace the unsigned commit with a signed one and the push goes through
+	signed := storeSignedCommit(t, repo, refHash(t, repo, "refs/remotes/origin/master"))
+	setRef(t, repo, "refs/heads/master", signed)
+	rec = serve(t, gs.pushHandler, "POST", "/git/p/push", project("p"), PushRequest{})
+	expectStatus(t, rec, http.StatusOK)
+	if got := runGit(t, remote, "rev-parse", "master"); got != signed.String() {
+		t.Errorf("remote master = %s, want %s", got, signed)
+	}
+}
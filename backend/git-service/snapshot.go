@@ -0,0 +1,443 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+)
+
+// snapshotRefPrefix is where snapshots are kept, out of sight of branch and tag listings
+const snapshotRefPrefix = "refs/neoai/snapshots/"
+
+// Snapshot retention unless a request overrides it
+const (
+	defaultSnapshotKeep   = 20
+	defaultSnapshotMaxAge = 7 * 24 * time.Hour
+)
+
+// Snapshot is a saved copy of the index and working tree. The snapshot
+// commit holds the working tree; its last parent is a commit of the index
+// and, when HEAD had a commit, its first parent is that commit.
+type Snapshot struct {
+	ID      string    `json:"id"`
+	Ref     string    `json:"ref"`
+	Hash    string    `json:"hash"`
+	Message string    `json:"message"`
+	Date    time.Time `json:"date"`
+	Head    string    `json:"head,omitempty"`
+	commit  *object.Commit
+}
+
+// SnapshotRequest configures a snapshot and how many older ones to keep.
+// MaxAge is a Go duration such as "72h".
+type SnapshotRequest struct {
+	Message string `json:"message,omitempty"`
+	Keep    *int   `json:"keep,omitempty"`
+	MaxAge  string `json:"maxAge,omitempty"`
+}
+
+// Create working tree snapshot endpoint
+func (gs *GitService) createSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req SnapshotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	keep := defaultSnapshotKeep
+	if req.Keep != nil {
+		if *req.Keep < 1 {
+			gs.sendError(w, "keep must be at least 1", http.StatusBadRequest)
+			return
+		}
+		keep = *req.Keep
+	}
+	maxAge := defaultSnapshotMaxAge
+	if req.MaxAge != "" {
+		d, err := time.ParseDuration(req.MaxAge)
+		if err != nil || d <= 0 {
+			gs.sendError(w, "maxAge must be a positive duration such as 72h", http.StatusBadRequest)
+			return
+		}
+		maxAge = d
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	snapshot, created, err := gs.createSnapshot(projectID, repo, req.Message)
+	if err != nil {
+		gs.sendInternalError(w, "Failed to create snapshot", err)
+		return
+	}
+	pruned, err := pruneSnapshots(repo, keep, maxAge, snapshot.Hash)
+	if err != nil {
+		gs.sendError(w, "Failed to prune snapshots", http.StatusInternalServerError)
+		return
+	}
+
+	message := "Snapshot created"
+	if !created {
+		message = "Nothing changed since the last snapshot"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  message,
+		"snapshot": snapshot,
+		"created":  created,
+		"pruned":   pruned,
+	})
+}
+
+// List snapshots endpoint
+func (gs *GitService) snapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	snapshots, err := listSnapshots(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to list snapshots", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"snapshots": snapshots,
+	})
+}
+
+// Restore snapshot endpoint
+func (gs *GitService) restoreSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	id := vars["snapshotId"]
+
+	if err := validateRefName(id); err != nil || strings.Contains(id, "/") {
+		gs.sendError(w, "Invalid snapshot id", http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	ref, err := repo.Storer.Reference(plumbing.ReferenceName(snapshotRefPrefix + id))
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Snapshot %s not found", id), http.StatusNotFound)
+		return
+	}
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil || commit.NumParents() == 0 {
+		gs.sendError(w, fmt.Sprintf("Snapshot %s is damaged", id), http.StatusInternalServerError)
+		return
+	}
+	indexCommit, err := repo.CommitObject(commit.ParentHashes[commit.NumParents()-1])
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Snapshot %s is damaged", id), http.StatusInternalServerError)
+		return
+	}
+
+	// The state being replaced is saved first, so a restore can be undone
+	backup, _, err := gs.createSnapshot(projectID, repo, "Before restoring snapshot "+id)
+	if err != nil {
+		gs.sendInternalError(w, "Failed to save current state", err)
+		return
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+	saved, err := treeEntries(commit, "")
+	if err != nil {
+		gs.sendError(w, "Failed to read snapshot", http.StatusInternalServerError)
+		return
+	}
+	staged, err := treeEntries(indexCommit, "")
+	if err != nil {
+		gs.sendError(w, "Failed to read snapshot", http.StatusInternalServerError)
+		return
+	}
+	current, err := worktreeEntries(repo, "")
+	if err != nil {
+		gs.sendError(w, "Failed to read working tree", http.StatusInternalServerError)
+		return
+	}
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+	tracked := make(map[string]bool, len(idx.Entries))
+	for _, e := range idx.Entries {
+		tracked[e.Name] = true
+	}
+
+	// Files the snapshot lacks are only removed when tracked; untracked
+	// work created since is left alone
+	var written, removed []string
+	for p := range current {
+		if _, ok := saved[p]; ok || !tracked[p] {
+			continue
+		}
+		if err := worktree.Filesystem.Remove(p); err != nil {
+			gs.sendInternalError(w, fmt.Sprintf("Failed to remove %s", p), err)
+			return
+		}
+		removeEmptyParents(worktree.Filesystem, p)
+		removed = append(removed, p)
+	}
+	for p, entry := range saved {
+		if now, ok := current[p]; ok && now.hash == entry.hash && now.mode == entry.mode {
+			continue
+		}
+		blob, err := repo.BlobObject(entry.hash)
+		if err != nil {
+			gs.sendError(w, "Failed to read snapshot", http.StatusInternalServerError)
+			return
+		}
+		if err := writeBlobToWorktree(worktree.Filesystem, p, blob, entry.mode); err != nil {
+			gs.sendInternalError(w, fmt.Sprintf("Failed to write %s", p), err)
+			return
+		}
+		written = append(written, p)
+	}
+
+	restored := &index.Index{Version: idx.Version}
+	names := make([]string, 0, len(staged))
+	for p := range staged {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+	for _, p := range names {
+		entry := staged[p]
+		blob, err := repo.BlobObject(entry.hash)
+		if err != nil {
+			gs.sendError(w, "Failed to read snapshot", http.StatusInternalServerError)
+			return
+		}
+		e := restored.Add(p)
+		e.Hash = entry.hash
+		e.Mode = entry.mode
+		e.Size = uint32(blob.Size)
+		e.ModifiedAt = time.Now()
+	}
+	if err := repo.Storer.SetIndex(restored); err != nil {
+		gs.sendError(w, "Failed to write index", http.StatusInternalServerError)
+		return
+	}
+
+	sort.Strings(written)
+	sort.Strings(removed)
+	if written == nil {
+		written = []string{}
+	}
+	if removed == nil {
+		removed = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Restored snapshot %s", id),
+		"written": written,
+		"removed": removed,
+		"backup":  backup,
+	})
+}
+
+// createSnapshot records the index and working tree under a new snapshot
+// ref. When both match the newest snapshot that one is returned instead.
+func (gs *GitService) createSnapshot(projectID string, repo *git.Repository, message string) (*Snapshot, bool, error) {
+	var parents []plumbing.Hash
+	branch := "HEAD"
+	if head, err := repo.Head(); err == nil {
+		parents = append(parents, head.Hash())
+		if head.Name().IsBranch() {
+			branch = head.Name().Short()
+		}
+	} else if err != plumbing.ErrReferenceNotFound {
+		return nil, false, err
+	} else if target, err := repo.Storer.Reference(plumbing.HEAD); err == nil {
+		branch = target.Target().Short()
+	}
+
+	staged, err := indexEntries(repo)
+	if err != nil {
+		return nil, false, err
+	}
+	indexTree, err := buildTree(repo.Storer, staged)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Untracked files are only hashed while walking, so their content has
+	// to be written before a tree can refer to it
+	files, err := worktreeEntries(repo, "")
+	if err != nil {
+		return nil, false, err
+	}
+	for _, entry := range files {
+		if _, err := repo.Storer.EncodedObject(plumbing.BlobObject, entry.hash); err == nil {
+			continue
+		}
+		data, err := entry.read()
+		if err != nil {
+			return nil, false, err
+		}
+		if _, err := storeBlob(repo.Storer, data); err != nil {
+			return nil, false, err
+		}
+	}
+	worktreeTree, err := buildTree(repo.Storer, files)
+	if err != nil {
+		return nil, false, err
+	}
+
+	existing, err := listSnapshots(repo)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(existing) > 0 {
+		newest := existing[0].commit
+		if newest.TreeHash == worktreeTree && newest.NumParents() == len(parents)+1 {
+			same := true
+			for i, parent := range parents {
+				same = same && newest.ParentHashes[i] == parent
+			}
+			if last, err := repo.CommitObject(newest.ParentHashes[newest.NumParents()-1]); err == nil && same && last.TreeHash == indexTree {
+				return existing[0], false, nil
+			}
+		}
+	}
+
+	identity := gs.resolveIdentity(projectID)
+	if identity.Name == "" || identity.Email == "" {
+		identity = serviceIdentity
+	}
+	now := time.Now()
+	signature := object.Signature{Name: identity.Name, Email: identity.Email, When: now}
+	if message == "" {
+		message = "Snapshot of " + branch
+	}
+
+	indexCommit := &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      "index on " + branch,
+		TreeHash:     indexTree,
+		ParentHashes: parents,
+	}
+	if indexCommit.Hash, err = storeObject(repo.Storer, indexCommit); err != nil {
+		return nil, false, err
+	}
+	commit := &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      message,
+		TreeHash:     worktreeTree,
+		ParentHashes: append(parents, indexCommit.Hash),
+	}
+	if commit.Hash, err = storeObject(repo.Storer, commit); err != nil {
+		return nil, false, err
+	}
+
+	id := now.UTC().Format("20060102T150405.000000000Z")
+	name := plumbing.ReferenceName(snapshotRefPrefix + id)
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(name, commit.Hash)); err != nil {
+		return nil, false, err
+	}
+	return newSnapshot(name, commit), true, nil
+}
+
+// listSnapshots returns the project's snapshots, newest first
+func listSnapshots(repo *git.Repository) ([]*Snapshot, error) {
+	iter, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []*Snapshot{}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if !strings.HasPrefix(ref.Name().String(), snapshotRefPrefix) || ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		commit, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return err
+		}
+		snapshots = append(snapshots, newSnapshot(ref.Name(), commit))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].ID > snapshots[j].ID })
+	return snapshots, nil
+}
+
+// pruneSnapshots deletes snapshots beyond the newest keep and those older
+// than maxAge, never the one just taken
+func pruneSnapshots(repo *git.Repository, keep int, maxAge time.Duration, current string) ([]string, error) {
+	snapshots, err := listSnapshots(repo)
+	if err != nil {
+		return nil, err
+	}
+	pruned := []string{}
+	cutoff := time.Now().Add(-maxAge)
+	for i, snapshot := range snapshots {
+		if snapshot.Hash == current || (i < keep && !snapshot.Date.Before(cutoff)) {
+			continue
+		}
+		if err := repo.Storer.RemoveReference(plumbing.ReferenceName(snapshot.Ref)); err != nil {
+			return nil, err
+		}
+		pruned = append(pruned, snapshot.ID)
+	}
+	return pruned, nil
+}
+
+// newSnapshot describes the snapshot commit a ref points at
+func newSnapshot(ref plumbing.ReferenceName, commit *object.Commit) *Snapshot {
+	snapshot := &Snapshot{
+		ID:      strings.TrimPrefix(ref.String(), snapshotRefPrefix),
+		Ref:     ref.String(),
+		Hash:    commit.Hash.String(),
+		Message: commit.Message,
+		Date:    commit.Committer.When,
+		commit:  commit,
+	}
+	if commit.NumParents() > 1 {
+		snapshot.Head = commit.ParentHashes[0].String()
+	}
+	return snapshot
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+type snapshotResponse struct {
+	Snapshot Snapshot `json:"snapshot"`
+	Created  bool     `json:"created"`
+	Pruned   []string `json:"pruned"`
+}
+
+func takeSnapshot(t *testing.T, gs *GitService, req SnapshotRequest) snapshotResponse {
+	t.Helper()
+	rec := serve(t, gs.createSnapshotHandler, "POST", "/git/p/snapshot", project("p"), req)
+	expectStatus(t, rec, http.StatusOK)
+	var body snapshotResponse
+	decodeBody(t, rec, &body)
+	return body
+}
+
+// stagedContent returns what the index holds for name, or "" if it is not staged
+func stagedContent(t *testing.T, repo *git.Repository, name string) string {
+	t.Helper()
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	entry, err := idx.Entry(name)
+	if err != nil {
+		return ""
+	}
+	blob, err := repo.BlobObject(entry.Hash)
+	if err != nil {
+		t.Fatalf("blob of %s: %v", name, err)
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSnapshotAndRestore(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	head := refHash(t, repo, "HEAD")
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, repo, map[string]string{"b.txt": "staged\n"})
+	if _, err := worktree.Add("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, repo, map[string]string{"a.txt": "unsaved\n", "b.txt": "unstaged\n", "notes.txt": "untracked\n"})
+
+	taken := takeSnapshot(t, gs, SnapshotRequest{Message: "Autosave"})
+	if !taken.Created || taken.Snapshot.Message != "Autosave" || taken.Snapshot.Head != head.String() {
+		t.Fatalf("snapshot: %+v", taken)
+	}
+	if refHash(t, repo, "HEAD") != head {
+		t.Error("taking a snapshot moved HEAD")
+	}
+	if again := takeSnapshot(t, gs, SnapshotRequest{}); again.Created || again.Snapshot.ID != taken.Snapshot.ID {
+		t.Errorf("snapshot of an unchanged tree: %+v", again)
+	}
+
+	rec := serve(t, gs.snapshotsHandler, "GET", "/git/p/snapshots", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var list struct {
+		Snapshots []Snapshot `json:"snapshots"`
+	}
+	decodeBody(t, rec, &list)
+	if len(list.Snapshots) != 1 || list.Snapshots[0].Hash != taken.Snapshot.Hash {
+		t.Fatalf("snapshots: %+v", list.Snapshots)
+	}
+
+	// Lose the work, as a crash or a careless reset would
+	if err := worktree.Reset(&git.ResetOptions{Mode: git.HardReset}); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, repo, map[string]string{"later.txt": "made after the snapshot\n"})
+
+	id := taken.Snapshot.ID
+	rec = serve(t, gs.restoreSnapshotHandler, "POST", "/git/p/snapshots/"+id+"/restore", map[string]string{"projectId": "p", "snapshotId": id}, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var restored struct {
+		Written []string  `json:"written"`
+		Backup  *Snapshot `json:"backup"`
+	}
+	decodeBody(t, rec, &restored)
+	if !equalStrings(restored.Written, []string{"a.txt", "b.txt", "notes.txt"}) || restored.Backup == nil {
+		t.Errorf("restore: %+v", restored)
+	}
+
+	for name, want := range map[string]string{"a.txt": "unsaved\n", "b.txt": "unstaged\n", "notes.txt": "untracked\n", "later.txt": "made after the snapshot\n"} {
+		if got := readProjectFile(t, gs, name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if got := stagedContent(t, repo, "b.txt"); got != "staged\n" {
+		t.Errorf("staged b.txt = %q", got)
+	}
+	if got := stagedContent(t, repo, "notes.txt"); got != "" {
+		t.Errorf("untracked notes.txt was staged: %q", got)
+	}
+	if refHash(t, repo, "HEAD") != head {
+		t.Error("restoring a snapshot moved HEAD")
+	}
+}
+
+func TestSnapshotPruning(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	var ids []string
+	for _, content := range []string{"1\n", "2\n", "3\n"} {
+		writeFiles(t, repo, map[string]string{"a.txt": content})
+		ids = append(ids, takeSnapshot(t, gs, SnapshotRequest{}).Snapshot.ID)
+	}
+
+	one := 1
+	writeFiles(t, repo, map[string]string{"a.txt": "4\n"})
+	body := takeSnapshot(t, gs, SnapshotRequest{Keep: &one})
+	if !equalStrings(body.Pruned, []string{ids[2], ids[1], ids[0]}) {
+		t.Errorf("pruned %v, want the three older snapshots %v", body.Pruned, ids)
+	}
+	snapshots, err := listSnapshots(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || snapshots[0].ID != body.Snapshot.ID {
+		t.Errorf("snapshots left: %+v", snapshots)
+	}
+
+	rec := serve(t, gs.createSnapshotHandler, "POST", "/git/p/snapshot", project("p"), SnapshotRequest{MaxAge: "-1h"})
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = serve(t, gs.restoreSnapshotHandler, "POST", "/git/p/snapshots/missing/restore", map[string]string{"projectId": "p", "snapshotId": "missing"}, nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+)
+
+// SquashRequest selects the commits to squash: either the last Count commits
+// or every commit after From
+type SquashRequest struct {
+	Count   int    `json:"count"`
+	From    string `json:"from"`
+	Message string `json:"message"`
+	Force   bool   `json:"force"`
+}
+
+// Squash commits endpoint
+func (gs *GitService) squashHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req SquashRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if (req.Count > 0) == (req.From != "") {
+		gs.sendError(w, "Specify either count or from", http.StatusBadRequest)
+		return
+	}
+	if req.Count < 0 {
+		gs.sendError(w, "count must be positive", http.StatusBadRequest)
+		return
+	}
+	if !req.Force {
+		gs.sendError(w, "Squashing rewrites history; set force to confirm", http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	settings, err := gs.loadSettings(projectID)
+	if err != nil {
+		gs.sendError(w, "Failed to read settings", http.StatusInternalServerError)
+		return
+	}
+	if settings.RequireSignedCommits {
+		gs.sendError(w, unsignedCommitMessage, http.StatusUnprocessableEntity)
+		return
+	}
+
+	headRef, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		gs.sendError(w, "Failed to read HEAD", http.StatusInternalServerError)
+		return
+	}
+	head, err := gs.resolveCommit(repo, "")
+	if err != nil {
+		gs.sendError(w, "Nothing to squash: the repository has no commits", http.StatusBadRequest)
+		return
+	}
+
+	var base *object.Commit
+	if req.From != "" {
+		if base, err = gs.resolveCommit(repo, req.From); err != nil {
+			gs.sendError(w, fmt.Sprintf("Commit %s not found", req.From), http.StatusNotFound)
+			return
+		}
+	}
+
+	// Walk first parents from HEAD, refusing merges since squashing one
+	// would silently drop the history it joined
+	var squashed []*object.Commit
+	for commit := head; ; {
+		if base != nil && commit.Hash == base.Hash {
+			break
+		}
+		if commit.NumParents() > 1 {
+			gs.sendErrorWithDetails(w, "Cannot squash merge commits", http.StatusConflict, map[string]interface{}{
+				"commit": commit.Hash.String(),
+			})
+			return
+		}
+		squashed = append(squashed, commit)
+		if req.Count > 0 && len(squashed) == req.Count {
+			break
+		}
+		if commit.NumParents() == 0 {
+			if base != nil {
+				gs.sendError(w, fmt.Sprintf("Commit %s is not an ancestor of HEAD", req.From), http.StatusBadRequest)
+				return
+			}
+			gs.sendError(w, fmt.Sprintf("Cannot squash %d commits: the branch only has %d", req.Count, len(squashed)), http.StatusBadRequest)
+			return
+		}
+		if commit, err = commit.Parent(0); err != nil {
+			gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+			return
+		}
+	}
+	if len(squashed) < 2 {
+		gs.sendError(w, "At least two commits are needed to squash", http.StatusBadRequest)
+		return
+	}
+	oldest := squashed[len(squashed)-1]
+
+	// Without a message, join the squashed messages oldest first like git's
+	// squash template
+	message := req.Message
+	if message == "" {
+		messages := make([]string, 0, len(squashed))
+		for i := len(squashed) - 1; i >= 0; i-- {
+			messages = append(messages, strings.TrimSpace(squashed[i].Message))
+		}
+		message = strings.Join(messages, "\n\n") + "\n"
+	}
+
+	committer := gs.resolveIdentity(projectID)
+	commit := &object.Commit{
+		Author:       oldest.Author,
+		Committer:    object.Signature{Name: committer.Name, Email: committer.Email, When: time.Now()},
+		Message:      message,
+		TreeHash:     head.TreeHash,
+		ParentHashes: oldest.ParentHashes,
+	}
+	if commit.Hash, err = storeObject(repo.Storer, commit); err != nil {
+		gs.sendError(w, "Failed to write commit", http.StatusInternalServerError)
+		return
+	}
+
+	name := plumbing.HEAD
+	if headRef.Type() == plumbing.SymbolicReference {
+		name = headRef.Target()
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(name, commit.Hash)); err != nil {
+		gs.sendError(w, "Failed to update HEAD", http.StatusInternalServerError)
+		return
+	}
+	subject := strings.SplitN(strings.TrimSpace(message), "\n", 2)[0]
+	gs.logHeadUpdate(projectID, repo, head.Hash, commit.Hash, committer, fmt.Sprintf("squash: %d commits into %s", len(squashed), subject))
+
+	replaced := make([]string, 0, len(squashed))
+	for _, c := range squashed {
+		replaced = append(replaced, c.Hash.String())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  fmt.Sprintf("Squashed %d commits", len(squashed)),
+		"commit":   newCommitInfo(commit),
+		"replaces": replaced,
+		"previous": head.Hash.String(),
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSquashThreeCommits(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	base := refHash(t, repo, "HEAD")
+	commitTestFiles(t, repo, "One", map[string]string{"b.txt": "b\n"})
+	commitTestFiles(t, repo, "Two", map[string]string{"c.txt": "c\n"})
+	head := commitTestFiles(t, repo, "Three", map[string]string{"b.txt": "b2\n"})
+	tree := headTree(t, repo)
+
+	rec := serve(t, gs.squashHandler, "POST", "/git/p/squash", project("p"), SquashRequest{Count: 3})
+	expectStatus(t, rec, http.StatusBadRequest)
+	if refHash(t, repo, "HEAD") != head {
+		t.Fatal("an unconfirmed squash moved HEAD")
+	}
+
+	rec = serve(t, gs.squashHandler, "POST", "/git/p/squash", project("p"), SquashRequest{Count: 3, Force: true})
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Replaces []string `json:"replaces"`
+		Previous string   `json:"previous"`
+	}
+	decodeBody(t, rec, &body)
+	if len(body.Replaces) != 3 || body.Previous != head.String() {
+		t.Errorf("response %+v", body)
+	}
+
+	commit, err := repo.CommitObject(refHash(t, repo, "refs/heads/master"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit.TreeHash != tree {
+		t.Errorf("squashed tree %s, want the tree of the last commit %s", commit.TreeHash, tree)
+	}
+	if len(commit.ParentHashes) != 1 || commit.ParentHashes[0] != base {
+		t.Errorf("parents %v, want %s", commit.ParentHashes, base)
+	}
+	if commit.Message != "One\n\nTwo\n\nThree\n" {
+		t.Errorf("message %q, want the messages oldest first", commit.Message)
+	}
+
+	// Only the initial commit and the squashed one are left
+	rec = serve(t, gs.squashHandler, "POST", "/git/p/squash", project("p"), SquashRequest{Count: 3, Force: true})
+	expectStatus(t, rec, http.StatusBadRequest)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// sseWriter writes Server-Sent Events to a streaming response
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// newSSEWriter prepares a response for Server-Sent Events
+func newSSEWriter(w http.ResponseWriter) (*sseWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming not supported")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &sseWriter{w: w, flusher: flusher}, nil
+}
+
+// send writes one event with a JSON payload and flushes it to the client
+func (s *sseWriter) send(event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// wantsEventStream reports whether the client asked for Server-Sent Events
+func wantsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// progressStream passes go-git's progress output on through a channel. Once
+// ctx is done writes are dropped, so a client that went away never stalls
+// the transfer.
+type progressStream struct {
+	ctx    context.Context
+	chunks chan string
+}
+
+func (p *progressStream) Write(b []byte) (int, error) {
+	select {
+	case p.chunks <- string(b):
+	case <-p.ctx.Done():
+	}
+	return len(b), nil
+}
+
+// streamOperation runs a clone or push while sending its sideband output as
+// progress events, then a done event with the result or an error event. The
+// transfer shares the request context, so a disconnect cancels it; the
+// handler still waits for it to stop before returning.
+func (gs *GitService) streamOperation(w http.ResponseWriter, r *http.Request, op *operation, run func(ctx context.Context, progress io.Writer) (interface{}, error)) {
+	ctx := r.Context()
+	progress := &progressStream{ctx: ctx, chunks: make(chan string, 64)}
+
+	type outcome struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := run(ctx, progress)
+		done <- outcome{result, err}
+	}()
+
+	sse, err := newSSEWriter(w)
+	if err != nil {
+		<-done
+		gs.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sendProgress := func(chunk string) error {
+		return sse.send("progress", map[string]interface{}{
+			"text":      chunk,
+			"operation": op.snapshot(),
+		})
+	}
+
+	for {
+		select {
+		case chunk := <-progress.chunks:
+			if err := sendProgress(chunk); err != nil {
+				<-done
+				return
+			}
+		case out := <-done:
+			for len(progress.chunks) > 0 {
+				sendProgress(<-progress.chunks)
+			}
+			if out.err != nil {
+				sse.send("error", map[string]interface{}{
+					"message":     out.err.Error(),
+					"operationId": op.snapshot().ID,
+				})
+				return
+			}
+			sse.send("done", out.result)
+			return
+		case <-ctx.Done():
+			<-done
+			return
+		}
+	}
+}
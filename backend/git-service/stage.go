@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/gorilla/mux"
+)
+
+// StageRequest names the files to stage or unstage. "." means everything;
+// a directory covers the files inside it.
+type StageRequest struct {
+	Files []string `json:"files"`
+}
+
+// stagePaths validates the requested paths. A nil result with ok set means
+// every path.
+func stagePaths(files []string) ([]string, string, bool) {
+	var paths []string
+	for _, file := range files {
+		if file == "." {
+			return nil, "", true
+		}
+		p, ok := repoPath(file)
+		if !ok {
+			return nil, file, false
+		}
+		paths = append(paths, p)
+	}
+	return paths, "", true
+}
+
+// missingPaths lists the paths that match nothing in the working tree or in
+// any of the given entry sets
+func missingPaths(worktree *git.Worktree, paths []string, known ...map[string]*diffEntry) []string {
+	missing := []string{}
+	for _, p := range paths {
+		if _, err := worktree.Filesystem.Lstat(p); err == nil {
+			continue
+		}
+		found := false
+		for _, entries := range known {
+			for name := range entries {
+				if name == p || strings.HasPrefix(name, p+"/") {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			missing = append(missing, p)
+		}
+	}
+	return missing
+}
+
+// Stage files endpoint
+func (gs *GitService) stageHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req StageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Files) == 0 {
+		gs.sendError(w, "Files are required", http.StatusBadRequest)
+		return
+	}
+	paths, invalid, ok := stagePaths(req.Files)
+	if !ok {
+		gs.sendError(w, fmt.Sprintf("Invalid path %s", invalid), http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+
+	// A path deleted from the working tree can still be staged while the
+	// index knows it
+	staged, err := indexEntries(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+	unmerged, err := unmergedPaths(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+	for _, p := range unmerged {
+		staged[p] = nil
+	}
+	if missing := missingPaths(worktree, paths, staged); len(missing) > 0 {
+		gs.sendErrorWithDetails(w, "Some paths do not exist", http.StatusNotFound, map[string]interface{}{
+			"files": missing,
+		})
+		return
+	}
+
+	// Staging a conflicted file resolves it
+	if err := resolveConflictStages(repo, worktree, paths); err != nil {
+		gs.sendError(w, "Failed to update index", http.StatusInternalServerError)
+		return
+	}
+
+	if paths == nil {
+		if _, err := worktree.Add("."); err != nil {
+			gs.sendError(w, "Failed to stage changes", http.StatusInternalServerError)
+			return
+		}
+		if err := stageDeletions(worktree); err != nil {
+			gs.sendError(w, "Failed to stage deletions", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		for _, p := range paths {
+			if _, err := worktree.Filesystem.Lstat(p); err != nil {
+				continue
+			}
+			if _, err := worktree.Add(p); err != nil {
+				gs.sendInternalError(w, fmt.Sprintf("Failed to stage file %s", p), err)
+				return
+			}
+		}
+		status, err := worktree.Status()
+		if err != nil {
+			gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+			return
+		}
+		for file, fileStatus := range status {
+			if fileStatus.Worktree == git.Deleted && pathSelected(file, paths) {
+				if _, err := worktree.Remove(file); err != nil {
+					gs.sendInternalError(w, fmt.Sprintf("Failed to stage deletion of %s", file), err)
+					return
+				}
+			}
+		}
+	}
+
+	status, err := gs.getRepositoryStatus(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Changes staged",
+		"status":  status,
+	})
+}
+
+// Unstage files endpoint. The index entries are reset to HEAD's, leaving
+// the working tree alone; without a HEAD the paths are removed from the index.
+func (gs *GitService) unstageHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req StageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Files) == 0 {
+		gs.sendError(w, "Files are required", http.StatusBadRequest)
+		return
+	}
+	paths, invalid, ok := stagePaths(req.Files)
+	if !ok {
+		gs.sendError(w, fmt.Sprintf("Invalid path %s", invalid), http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+
+	headEntries := map[string]*diffEntry{}
+	if head, err := repo.Head(); err == nil {
+		commit, err := repo.CommitObject(head.Hash())
+		if err != nil {
+			gs.sendError(w, "Failed to read HEAD", http.StatusInternalServerError)
+			return
+		}
+		if headEntries, err = treeEntries(commit, ""); err != nil {
+			gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+	staged := make(map[string]*diffEntry, len(idx.Entries))
+	for _, e := range idx.Entries {
+		staged[e.Name] = nil
+	}
+	if missing := missingPaths(worktree, paths, staged, headEntries); len(missing) > 0 {
+		gs.sendErrorWithDetails(w, "Some paths do not exist", http.StatusNotFound, map[string]interface{}{
+			"files": missing,
+		})
+		return
+	}
+
+	kept := idx.Entries[:0]
+	for _, e := range idx.Entries {
+		if !pathSelected(e.Name, paths) {
+			kept = append(kept, e)
+		}
+	}
+	idx.Entries = kept
+
+	var restored []string
+	for p := range headEntries {
+		if pathSelected(p, paths) {
+			restored = append(restored, p)
+		}
+	}
+	sort.Strings(restored)
+	for _, p := range restored {
+		entry := headEntries[p]
+		blob, err := repo.BlobObject(entry.hash)
+		if err != nil {
+			gs.sendError(w, "Failed to read blob", http.StatusInternalServerError)
+			return
+		}
+		e := idx.Add(p)
+		e.Hash = entry.hash
+		e.Mode = entry.mode
+		e.Size = uint32(blob.Size)
+		e.ModifiedAt = time.Now()
+		if info, err := worktree.Filesystem.Lstat(p); err == nil {
+			e.ModifiedAt = info.ModTime()
+		}
+	}
+	sortIndexEntries(idx)
+	if err := repo.Storer.SetIndex(idx); err != nil {
+		gs.sendError(w, "Failed to write index", http.StatusInternalServerError)
+		return
+	}
+
+	status, err := gs.getRepositoryStatus(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Changes unstaged",
+		"status":  status,
+	})
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/gorilla/mux"
+)
+
+// StageContentRequest stages content for a path and writes it to the working tree
+type StageContentRequest struct {
+	Path            string `json:"path"`
+	Content         string `json:"content"`
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+	Executable      *bool  `json:"executable,omitempty"`
+}
+
+// Get staged file contents endpoint
+func (gs *GitService) stagedBlobHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	path := strings.Trim(r.URL.Query().Get("path"), "/")
+	if path == "" {
+		gs.sendError(w, "Path is required", http.StatusBadRequest)
+		return
+	}
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+
+	conflicted := false
+	for _, e := range idx.Entries {
+		if e.Name != path {
+			continue
+		}
+		if e.Stage != 0 {
+			conflicted = true
+			continue
+		}
+
+		content, err := blobEntry(repo, e.Hash, e.Mode).read()
+		if err != nil {
+			gs.sendError(w, "Failed to read staged blob", http.StatusInternalServerError)
+			return
+		}
+
+		binary := isBinary(content)
+		encoded := string(content)
+		if binary {
+			encoded = base64.StdEncoding.EncodeToString(content)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"path":    path,
+			"hash":    e.Hash.String(),
+			"mode":    gitMode(e.Mode),
+			"size":    len(content),
+			"binary":  binary,
+			"content": encoded,
+		})
+		return
+	}
+
+	if conflicted {
+		gs.sendError(w, fmt.Sprintf("Path %s has unresolved conflicts", path), http.StatusConflict)
+		return
+	}
+	gs.sendError(w, fmt.Sprintf("Path %s is not staged", path), http.StatusNotFound)
+}
+
+// Stage content endpoint
+func (gs *GitService) stageContentHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req StageContentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	path, ok := repoPath(req.Path)
+	if !ok {
+		gs.sendError(w, "A path inside the repository is required", http.StatusBadRequest)
+		return
+	}
+
+	content, warnings, err := decodeContent(req.Content, req.ContentEncoding)
+	if err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid content: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+
+	content, binary, normalized, warnings := gs.convertContent(projectID, worktree.Filesystem, path, content, req.ContentEncoding == "base64", warnings)
+
+	hash, err := storeBlob(repo.Storer, content)
+	if err != nil {
+		gs.sendError(w, "Failed to write blob", http.StatusInternalServerError)
+		return
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+
+	// Staging content resolves any conflict on the path, like git add
+	mode := filemode.Regular
+	for {
+		e, err := idx.Remove(path)
+		if err != nil {
+			break
+		}
+		if e.Stage == 0 || e.Stage == index.OurMode {
+			mode = e.Mode
+		}
+	}
+	if req.Executable != nil {
+		mode = filemode.Regular
+		if *req.Executable {
+			mode = filemode.Executable
+		}
+	}
+
+	// The working tree gets the staged bytes too, so the file stays clean and
+	// a later commit of the whole tree does not see it as deleted
+	blob, err := repo.BlobObject(hash)
+	if err != nil {
+		gs.sendError(w, "Failed to read blob", http.StatusInternalServerError)
+		return
+	}
+	if err := writeBlobToWorktree(worktree.Filesystem, path, blob, mode); err != nil {
+		gs.sendInternalError(w, fmt.Sprintf("Failed to write %s", path), err)
+		return
+	}
+	modifiedAt := time.Now()
+	if info, err := worktree.Filesystem.Lstat(path); err == nil {
+		modifiedAt = info.ModTime()
+	}
+
+	entry := idx.Add(path)
+	entry.Hash = hash
+	entry.Mode = mode
+	entry.Size = uint32(len(content))
+	entry.ModifiedAt = modifiedAt
+	if err := repo.Storer.SetIndex(idx); err != nil {
+		gs.sendError(w, "Failed to write index", http.StatusInternalServerError)
+		return
+	}
+
+	if warnings == nil {
+		warnings = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    fmt.Sprintf("Staged %s", path),
+		"path":       path,
+		"hash":       hash.String(),
+		"mode":       gitMode(mode),
+		"size":       len(content),
+		"binary":     binary,
+		"normalized": normalized,
+		"warnings":   warnings,
+	})
+}
+
+// repoPath cleans a client-supplied path, rejecting absolute paths and
+// anything outside the working tree or inside .git
+func repoPath(p string) (string, bool) {
+	if strings.HasPrefix(p, "/") || filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
+		return "", false
+	}
+	cleaned := filepath.ToSlash(filepath.Clean(strings.TrimRight(p, "/")))
+	if p == "" || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") || cleaned == ".git" || strings.HasPrefix(cleaned, ".git/") {
+		return "", false
+	}
+	return cleaned, true
+}
+
+// decodeContent decodes a payload sent as utf8 text or base64. Binary
+// payloads travel as base64 and are kept byte for byte.
+func decodeContent(content, encoding string) ([]byte, []string, error) {
+	switch encoding {
+	case "", "utf8", "utf-8":
+		var warnings []string
+		if strings.ContainsRune(content, '\uFFFD') {
+			warnings = append(warnings, "Content contains U+FFFD replacement characters, which usually means binary data was sent as text; use contentEncoding base64")
+		}
+		return []byte(content), warnings, nil
+	case "base64":
+		decoded, err := base64.StdEncoding.DecodeString(content)
+		if err != nil {
+			return nil, nil, errors.New("content is not valid base64")
+		}
+		return decoded, nil, nil
+	}
+	return nil, nil, errors.New("contentEncoding must be utf8 or base64")
+}
+
+// convertContent applies the line ending normalization git would apply when
+// staging content for path. Binary content is never converted.
+func (gs *GitService) convertContent(projectID string, fs billy.Filesystem, path string, content []byte, base64Encoded bool, warnings []string) ([]byte, bool, bool, []string) {
+	binary := base64Encoded || isBinary(content)
+	normalized := false
+	if gs.normalizesLineEndings(projectID, fs, path, content) {
+		if binary {
+			warnings = append(warnings, "Content looks binary, so line endings were left unchanged despite the text attributes")
+		} else if bytes.Contains(content, []byte("\r\n")) {
+			content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+			normalized = true
+		}
+	}
+	return content, binary, normalized, warnings
+}
+
+// normalizesLineEndings reports whether git would convert CRLF to LF when
+// staging a path, from its text and eol attributes or core.autocrlf
+func (gs *GitService) normalizesLineEndings(projectID string, fs billy.Filesystem, path string, content []byte) bool {
+	stack, _ := gitattributes.ReadPatterns(fs, nil)
+	if f, err := os.Open(filepath.Join(gs.gitDir(projectID), "info", "attributes")); err == nil {
+		if info, err := gitattributes.ReadAttributes(f, nil, true); err == nil {
+			stack = append(stack, info...)
+		}
+		f.Close()
+	}
+
+	// Later patterns take precedence; the first match found from the end wins
+	parts := strings.Split(path, "/")
+	attrs := make(map[string]gitattributes.Attribute)
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].Pattern == nil || !stack[i].Pattern.Match(parts) {
+			continue
+		}
+		for _, attr := range stack[i].Attributes {
+			name := attr.Name()
+			if name == "binary" && attr.IsSet() {
+				name = "text"
+				attr = nil
+			}
+			if _, ok := attrs[name]; !ok {
+				attrs[name] = attr
+			}
+		}
+	}
+
+	if text, ok := attrs["text"]; ok {
+		switch {
+		case text == nil || text.IsUnset():
+			return false
+		case text.IsValueSet() && text.Value() == "auto":
+			return !isBinary(content)
+		case text.IsSet():
+			return true
+		}
+	}
+	if eol, ok := attrs["eol"]; ok && eol != nil && eol.IsValueSet() {
+		return true
+	}
+
+	entries, err := gs.loadConfigEntries(projectID, "effective")
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(lookupConfig(entries, "core.autocrlf")) {
+	case "true", "input":
+		return !isBinary(content)
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"testing"
+)
+
+type stagedBlobResponse struct {
+	Path    string `json:"path"`
+	Hash    string `json:"hash"`
+	Mode    string `json:"mode"`
+	Size    int    `json:"size"`
+	Binary  bool   `json:"binary"`
+	Content string `json:"content"`
+}
+
+func TestStagedBlobReturnsIndexVersion(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	dir := gs.getProjectPath("p")
+	writeFiles(t, repo, map[string]string{"a.txt": "staged\n"})
+	runGit(t, dir, "add", "a.txt")
+	writeFiles(t, repo, map[string]string{"a.txt": "in the working tree\n"})
+
+	rec := serve(t, gs.stagedBlobHandler, "GET", "/git/p/staged-blob?path=a.txt", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body stagedBlobResponse
+	decodeBody(t, rec, &body)
+	if body.Content != "staged\n" || body.Binary || body.Size != len("staged\n") {
+		t.Errorf("got %+v, want the staged text", body)
+	}
+	if want := runGit(t, dir, "rev-parse", ":a.txt"); body.Hash != want {
+		t.Errorf("hash %s, want %s", body.Hash, want)
+	}
+
+	rec = serve(t, gs.stagedBlobHandler, "GET", "/git/p/staged-blob?path=missing.txt", project("p"), nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestStagedBlobRefusesConflictedPath(t *testing.T) {
+	gs := newTestService(t)
+	conflictedRepo(t, gs)
+
+	rec := serve(t, gs.stagedBlobHandler, "GET", "/git/p/staged-blob?path=a.txt", project("p"), nil)
+	expectStatus(t, rec, http.StatusConflict)
+}
+
+func TestStageContentKeepsBinaryBytes(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	// Attributes that would convert line endings must not touch binary content
+	commitTestFiles(t, repo, "Attributes", map[string]string{".gitattributes": "* text\n"})
+	payload := []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\r', '\n', 0x00, 0xff, '\r', '\n'}
+
+	req := StageContentRequest{Path: "img/logo.png", Content: base64.StdEncoding.EncodeToString(payload), ContentEncoding: "base64"}
+	rec := serve(t, gs.stageContentHandler, "POST", "/git/p/stage-content", project("p"), req)
+	expectStatus(t, rec, http.StatusOK)
+	var staged struct {
+		Binary     bool     `json:"binary"`
+		Normalized bool     `json:"normalized"`
+		Size       int      `json:"size"`
+		Warnings   []string `json:"warnings"`
+	}
+	decodeBody(t, rec, &staged)
+	if !staged.Binary || staged.Normalized || staged.Size != len(payload) || len(staged.Warnings) == 0 {
+		t.Errorf("response %+v", staged)
+	}
+
+	rec = serve(t, gs.stagedBlobHandler, "GET", "/git/p/staged-blob?path=img/logo.png", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var blob stagedBlobResponse
+	decodeBody(t, rec, &blob)
+	content, err := base64.StdEncoding.DecodeString(blob.Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !blob.Binary || !bytes.Equal(content, payload) {
+		t.Errorf("staged bytes %q, want %q", content, payload)
+	}
+
+	// Text is still normalized under the same attributes
+	req = StageContentRequest{Path: "notes.txt", Content: "one\r\ntwo\r\n"}
+	rec = serve(t, gs.stageContentHandler, "POST", "/git/p/stage-content", project("p"), req)
+	expectStatus(t, rec, http.StatusOK)
+	if got := runGit(t, gs.getProjectPath("p"), "cat-file", "-p", ":notes.txt"); got != "one\ntwo" {
+		t.Errorf("staged text %q, want LF line endings", got)
+	}
+}
@@ -0,0 +1,672 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+)
+
+// stashRef holds the newest stash; older ones live only in its reflog
+const stashRef = plumbing.ReferenceName("refs/stash")
+
+// StashSummary describes the newest stash
+type StashSummary struct {
+	Hash    string    `json:"hash"`
+	Message string    `json:"message"`
+	Date    time.Time `json:"date"`
+}
+
+// Get stash count endpoint
+func (gs *GitService) stashCountHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	count := 0
+	var latest *StashSummary
+	ref, err := repo.Storer.Reference(stashRef)
+	if err == nil {
+		// Like git stash list, each reflog entry of refs/stash is one stash
+		entries, err := gs.readReflog(projectID, stashRef)
+		if err != nil {
+			gs.sendError(w, "Failed to read stash list", http.StatusInternalServerError)
+			return
+		}
+		count = len(entries)
+		latest = &StashSummary{Hash: ref.Hash().String()}
+		if count > 0 {
+			newest := entries[count-1]
+			latest.Message = newest.Message
+			latest.Date = newest.Date
+		} else {
+			// A stash ref without a reflog still holds one stash
+			count = 1
+			commit, err := repo.CommitObject(ref.Hash())
+			if err != nil {
+				gs.sendError(w, "Failed to read stash", http.StatusInternalServerError)
+				return
+			}
+			subject, _ := splitCommitMessage(commit.Message)
+			latest.Message = subject
+			latest.Date = commit.Committer.When
+		}
+	} else if err != plumbing.ErrReferenceNotFound {
+		gs.sendError(w, "Failed to read stash list", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":  count,
+		"latest": latest,
+	})
+}
+
+// stashStateName is the sidecar recording what a stash commit does not
+const stashStateName = "stash"
+
+// stashMeta is the sidecar record of a stash saved by this service, keyed by
+// the stash commit hash
+type stashMeta struct {
+	Branch           string    `json:"branch"`
+	IncludeUntracked bool      `json:"includeUntracked"`
+	CreatedBy        Author    `json:"createdBy"`
+	CreatedAt        time.Time `json:"createdAt"`
+}
+
+// StashRequest represents a stash save request
+type StashRequest struct {
+	Message          string `json:"message,omitempty"`
+	IncludeUntracked bool   `json:"includeUntracked,omitempty"`
+}
+
+// StashEntry describes one stash. Index 0 is the newest, as in stash@{0}.
+type StashEntry struct {
+	Index            int       `json:"index"`
+	Ref              string    `json:"ref"`
+	Hash             string    `json:"hash"`
+	Message          string    `json:"message"`
+	Branch           string    `json:"branch,omitempty"`
+	IncludeUntracked bool      `json:"includeUntracked"`
+	Date             time.Time `json:"date"`
+}
+
+// stashBranch reads the branch out of a "WIP on <branch>: ..." or
+// "On <branch>: ..." stash message
+func stashBranch(message string) string {
+	message = strings.TrimPrefix(message, "WIP ")
+	if !strings.HasPrefix(message, "On ") {
+		return ""
+	}
+	branch, _, ok := strings.Cut(strings.TrimPrefix(message, "On "), ":")
+	if !ok {
+		return ""
+	}
+	return branch
+}
+
+// stashList lists the stashes newest first. Stashes made with the git CLI
+// have no sidecar record, so their details come from the stash commit.
+func (gs *GitService) stashList(projectID string, repo *git.Repository) ([]StashEntry, error) {
+	ref, err := repo.Storer.Reference(stashRef)
+	if err == plumbing.ErrReferenceNotFound {
+		return []StashEntry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entries, err := gs.readReflog(projectID, stashRef)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		// A stash ref without a reflog still holds one stash
+		commit, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return nil, err
+		}
+		subject, _ := splitCommitMessage(commit.Message)
+		entries = []ReflogEntry{{NewHash: ref.Hash().String(), Message: subject, Date: commit.Committer.When}}
+	}
+
+	metas := map[string]stashMeta{}
+	if err := gs.loadState(projectID, stashStateName, &metas); err != nil {
+		return nil, err
+	}
+
+	stashes := make([]StashEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		index := len(stashes)
+		stash := StashEntry{
+			Index:   index,
+			Ref:     fmt.Sprintf("stash@{%d}", index),
+			Hash:    entry.NewHash,
+			Message: entry.Message,
+			Branch:  stashBranch(entry.Message),
+			Date:    entry.Date,
+		}
+		if meta, ok := metas[entry.NewHash]; ok {
+			stash.Branch = meta.Branch
+			stash.IncludeUntracked = meta.IncludeUntracked
+		} else if commit, err := repo.CommitObject(plumbing.NewHash(entry.NewHash)); err == nil {
+			// The untracked files commit is the stash's third parent
+			stash.IncludeUntracked = commit.NumParents() > 2
+		}
+		stashes = append(stashes, stash)
+	}
+	return stashes, nil
+}
+
+// List stashes endpoint
+func (gs *GitService) stashListHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	stashes, err := gs.stashList(projectID, repo)
+	if err != nil {
+		gs.sendError(w, "Failed to read stash list", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"stashes": stashes,
+	})
+}
+
+// Save stash endpoint. The stash is stored the way git stash stores it: a
+// commit of the working tree whose parents are HEAD, a commit of the index
+// and, with includeUntracked, a commit of the untracked files. The git CLI
+// can list and apply stashes saved here.
+func (gs *GitService) stashSaveHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req StashRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		gs.sendError(w, "Cannot stash: the repository has no commits", http.StatusBadRequest)
+		return
+	}
+	unmerged, err := unmergedPaths(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+	if len(unmerged) > 0 {
+		gs.sendErrorWithDetails(w, "Cannot stash with unresolved conflicts", http.StatusConflict, map[string]interface{}{
+			"files": unmerged,
+		})
+		return
+	}
+
+	headCommit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		gs.sendError(w, "Failed to read HEAD", http.StatusInternalServerError)
+		return
+	}
+	headEntries, err := treeEntries(headCommit, "")
+	if err != nil {
+		gs.sendError(w, "Failed to read tree", http.StatusInternalServerError)
+		return
+	}
+	staged, err := indexEntries(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+	current, err := worktreeEntries(repo, "")
+	if err != nil {
+		gs.sendError(w, "Failed to read working tree", http.StatusInternalServerError)
+		return
+	}
+
+	// The working tree commit covers tracked files only; files deleted from
+	// the working tree are left out of it
+	tracked := make(map[string]*diffEntry, len(staged))
+	untracked := make(map[string]*diffEntry)
+	for p, entry := range current {
+		if _, ok := staged[p]; ok {
+			tracked[p] = entry
+		} else if req.IncludeUntracked {
+			untracked[p] = entry
+		}
+	}
+	if sameEntrySet(headEntries, staged) && sameEntrySet(staged, tracked) && len(untracked) == 0 {
+		gs.sendError(w, "No local changes to save", http.StatusBadRequest)
+		return
+	}
+
+	for _, entries := range []map[string]*diffEntry{tracked, untracked} {
+		for p, entry := range entries {
+			if repo.Storer.HasEncodedObject(entry.hash) == nil {
+				continue
+			}
+			content, err := entry.read()
+			if err == nil {
+				_, err = storeBlob(repo.Storer, content)
+			}
+			if err != nil {
+				gs.sendError(w, fmt.Sprintf("Failed to store %s", p), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	branch := "(no branch)"
+	if head.Name().IsBranch() {
+		branch = head.Name().Short()
+	}
+	subject, _ := splitCommitMessage(headCommit.Message)
+	base := fmt.Sprintf("%s: %s %s", branch, head.Hash().String()[:7], subject)
+	message := "WIP on " + base
+	if req.Message != "" {
+		message = fmt.Sprintf("On %s: %s", branch, strings.TrimSpace(req.Message))
+	}
+
+	who := gs.resolveIdentity(projectID)
+	if who.Name == "" || who.Email == "" {
+		who = serviceIdentity
+	}
+	signature := object.Signature{Name: who.Name, Email: who.Email, When: time.Now()}
+	storeCommit := func(entries map[string]*diffEntry, message string, parents ...plumbing.Hash) (plumbing.Hash, error) {
+		tree, err := buildTree(repo.Storer, entries)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		return storeObject(repo.Storer, &object.Commit{
+			Author:       signature,
+			Committer:    signature,
+			Message:      message + "\n",
+			TreeHash:     tree,
+			ParentHashes: parents,
+		})
+	}
+
+	indexCommit, err := storeCommit(staged, "index on "+base, head.Hash())
+	if err != nil {
+		gs.sendError(w, "Failed to write stash", http.StatusInternalServerError)
+		return
+	}
+	parents := []plumbing.Hash{head.Hash(), indexCommit}
+	if len(untracked) > 0 {
+		untrackedCommit, err := storeCommit(untracked, "untracked files on "+base)
+		if err != nil {
+			gs.sendError(w, "Failed to write stash", http.StatusInternalServerError)
+			return
+		}
+		parents = append(parents, untrackedCommit)
+	}
+	stashCommit, err := storeCommit(tracked, message, parents...)
+	if err != nil {
+		gs.sendError(w, "Failed to write stash", http.StatusInternalServerError)
+		return
+	}
+
+	previous := plumbing.ZeroHash
+	if ref, err := repo.Storer.Reference(stashRef); err == nil {
+		previous = ref.Hash()
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(stashRef, stashCommit)); err != nil {
+		gs.sendError(w, "Failed to update stash", http.StatusInternalServerError)
+		return
+	}
+	gs.appendReflog(projectID, stashRef, previous, stashCommit, who, message)
+	metas := map[string]stashMeta{}
+	err = gs.updateState(projectID, stashStateName, &metas, func() error {
+		metas[stashCommit.String()] = stashMeta{
+			Branch:           branch,
+			IncludeUntracked: len(untracked) > 0,
+			CreatedBy:        who,
+			CreatedAt:        signature.When,
+		}
+		return nil
+	})
+	if err != nil {
+		gs.logger.Warn("failed to record stash metadata", "projectId", projectID, "error", err)
+	}
+
+	// Like git stash, the working tree and index go back to HEAD
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+	if err := hardReset(repo, worktree, head.Hash(), headCommit); err != nil {
+		gs.sendInternalError(w, "Stash saved but failed to clean the working tree", err)
+		return
+	}
+	for p := range untracked {
+		if err := worktree.Filesystem.Remove(p); err != nil && !os.IsNotExist(err) {
+			gs.sendInternalError(w, fmt.Sprintf("Stash saved but failed to remove %s", p), err)
+			return
+		}
+		removeEmptyParents(worktree.Filesystem, p)
+	}
+
+	stashes, err := gs.stashList(projectID, repo)
+	if err != nil || len(stashes) == 0 {
+		gs.sendError(w, "Failed to read stash list", http.StatusInternalServerError)
+		return
+	}
+	status, err := gs.getRepositoryStatus(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Saved working directory and index state " + message,
+		"stash":   stashes[0],
+		"status":  status,
+	})
+}
+
+// sameEntrySet reports whether two file sets hold the same files
+func sameEntrySet(a, b map[string]*diffEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for p, entry := range a {
+		if !sameEntry(entry, b[p]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Pop stash endpoint. The stash is merged into the working tree like git
+// stash pop does: its changes are left unstaged except for files it added.
+// A stash that does not apply cleanly is kept and nothing is written.
+func (gs *GitService) stashPopHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	index, err := strconv.Atoi(vars["index"])
+	if err != nil || index < 0 {
+		gs.sendError(w, "Invalid stash index", http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	stashes, err := gs.stashList(projectID, repo)
+	if err != nil {
+		gs.sendError(w, "Failed to read stash list", http.StatusInternalServerError)
+		return
+	}
+	if index >= len(stashes) {
+		gs.sendError(w, fmt.Sprintf("stash@{%d} not found", index), http.StatusNotFound)
+		return
+	}
+	stash := stashes[index]
+	stashCommit, err := repo.CommitObject(plumbing.NewHash(stash.Hash))
+	if err != nil || stashCommit.NumParents() < 2 {
+		gs.sendError(w, fmt.Sprintf("%s is not a valid stash", stash.Ref), http.StatusInternalServerError)
+		return
+	}
+
+	if _, merging := gs.readMergeHead(projectID); merging {
+		gs.sendError(w, "Cannot apply a stash in the middle of a merge", http.StatusConflict)
+		return
+	}
+	unmerged, err := unmergedPaths(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+	if len(unmerged) > 0 {
+		gs.sendErrorWithDetails(w, "Cannot apply a stash with unresolved conflicts", http.StatusConflict, map[string]interface{}{
+			"files": unmerged,
+		})
+		return
+	}
+
+	baseCommit, err := stashCommit.Parent(0)
+	if err != nil {
+		gs.sendError(w, "Failed to read stash", http.StatusInternalServerError)
+		return
+	}
+	base, err := treeEntries(baseCommit, "")
+	if err != nil {
+		gs.sendError(w, "Failed to read stash", http.StatusInternalServerError)
+		return
+	}
+	stashed, err := treeEntries(stashCommit, "")
+	if err != nil {
+		gs.sendError(w, "Failed to read stash", http.StatusInternalServerError)
+		return
+	}
+	untracked := map[string]*diffEntry{}
+	if stashCommit.NumParents() > 2 {
+		untrackedCommit, err := stashCommit.Parent(2)
+		if err == nil {
+			untracked, err = treeEntries(untrackedCommit, "")
+		}
+		if err != nil {
+			gs.sendError(w, "Failed to read stashed untracked files", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// The stash is merged into the index, as git does
+	ours, err := indexEntries(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+	labels := mergeLabels{ours: "Updated upstream", base: "Stash base", theirs: "Stashed changes"}
+	merged, err := mergeTrees(repo.Storer, base, ours, stashed, labels, "")
+	if err != nil {
+		gs.sendError(w, "Failed to merge stash", http.StatusInternalServerError)
+		return
+	}
+	if len(merged.conflicts) > 0 {
+		gs.sendErrorWithDetails(w, fmt.Sprintf("%s does not apply cleanly; the stash was kept", stash.Ref), http.StatusConflict, map[string]interface{}{
+			"conflicts": newConflicts(merged.conflicts, base, ours, stashed),
+		})
+		return
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+	workStatus, err := worktree.Status()
+	if err != nil {
+		gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+		return
+	}
+
+	seen := make(map[string]bool)
+	var changed, overwritten []string
+	for _, entries := range []map[string]*diffEntry{ours, merged.entries} {
+		for p := range entries {
+			if !seen[p] && !sameEntry(ours[p], merged.entries[p]) {
+				seen[p] = true
+				changed = append(changed, p)
+			}
+		}
+	}
+	sort.Strings(changed)
+	for _, p := range changed {
+		if fileStatus, ok := workStatus[p]; ok && fileStatus.Worktree != git.Unmodified {
+			overwritten = append(overwritten, p)
+		}
+	}
+	for p := range untracked {
+		if _, err := worktree.Filesystem.Lstat(p); err == nil {
+			overwritten = append(overwritten, p)
+		}
+	}
+	if len(overwritten) > 0 {
+		sort.Strings(overwritten)
+		gs.sendErrorWithDetails(w, "Local changes would be overwritten by the stash; commit or stash them first", http.StatusConflict, map[string]interface{}{
+			"files": overwritten,
+		})
+		return
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		gs.sendError(w, "Failed to read index", http.StatusInternalServerError)
+		return
+	}
+	for _, p := range changed {
+		entry := merged.entries[p]
+		if entry == nil {
+			if err := worktree.Filesystem.Remove(p); err != nil && !os.IsNotExist(err) {
+				gs.sendInternalError(w, fmt.Sprintf("Failed to remove %s", p), err)
+				return
+			}
+			removeEmptyParents(worktree.Filesystem, p)
+			continue
+		}
+		blob, err := repo.BlobObject(entry.hash)
+		if err == nil {
+			err = writeBlobToWorktree(worktree.Filesystem, p, blob, entry.mode)
+		}
+		if err != nil {
+			gs.sendInternalError(w, fmt.Sprintf("Failed to write %s", p), err)
+			return
+		}
+		// Files the stash added stay tracked
+		if ours[p] == nil {
+			if err := addIndexEntry(repo, worktree, idx, p, entry, 0); err != nil {
+				gs.sendError(w, "Failed to update index", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	sortIndexEntries(idx)
+	if err := repo.Storer.SetIndex(idx); err != nil {
+		gs.sendError(w, "Failed to write index", http.StatusInternalServerError)
+		return
+	}
+	for p, entry := range untracked {
+		blob, err := repo.BlobObject(entry.hash)
+		if err == nil {
+			err = writeBlobToWorktree(worktree.Filesystem, p, blob, entry.mode)
+		}
+		if err != nil {
+			gs.sendInternalError(w, fmt.Sprintf("Failed to restore %s", p), err)
+			return
+		}
+	}
+
+	if err := gs.dropStash(projectID, repo, index); err != nil {
+		gs.sendInternalError(w, fmt.Sprintf("Stash applied but failed to drop %s", stash.Ref), err)
+		return
+	}
+
+	status, err := gs.getRepositoryStatus(repo)
+	if err != nil {
+		gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Dropped %s (%s)", stash.Ref, stash.Hash),
+		"stash":   stash,
+		"status":  status,
+	})
+}
+
+// dropStash removes stash@{index} from the reflog of refs/stash and points
+// the ref at the newest remaining stash, deleting it when none is left
+func (gs *GitService) dropStash(projectID string, repo *git.Repository, index int) error {
+	path := gs.reflogPath(projectID, stashRef)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if _, ok := parseReflogLine(line); ok {
+			lines = append(lines, line)
+		}
+	}
+	var dropped string
+	if len(lines) > 0 {
+		if index >= len(lines) {
+			return fmt.Errorf("stash@{%d} not found", index)
+		}
+		i := len(lines) - 1 - index
+		dropped = lines[i][41:81]
+		lines = append(lines[:i], lines[i+1:]...)
+	} else if ref, err := repo.Storer.Reference(stashRef); err == nil && index == 0 {
+		dropped = ref.Hash().String()
+	} else {
+		return fmt.Errorf("stash@{%d} not found", index)
+	}
+
+	if len(lines) == 0 {
+		if err := repo.Storer.RemoveReference(stashRef); err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		newest, _ := parseReflogLine(lines[len(lines)-1])
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(stashRef, plumbing.NewHash(newest.NewHash))); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+			return err
+		}
+	}
+
+	metas := map[string]stashMeta{}
+	return gs.updateState(projectID, stashStateName, &metas, func() error {
+		delete(metas, dropped)
+		return nil
+	})
+}
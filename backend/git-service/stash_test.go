@@ -0,0 +1,199 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+type stashCountResponse struct {
+	Count  int           `json:"count"`
+	Latest *StashSummary `json:"latest"`
+}
+
+func stashCount(t *testing.T, gs *GitService) stashCountResponse {
+	t.Helper()
+	rec := serve(t, gs.stashCountHandler, "GET", "/git/p/stash/count", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body stashCountResponse
+	decodeBody(t, rec, &body)
+	return body
+}
+
+func TestStashCountFollowsGitStash(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	dir := gs.getProjectPath("p")
+
+	if body := stashCount(t, gs); body.Count != 0 || body.Latest != nil {
+		t.Fatalf("fresh repository: %+v", body)
+	}
+
+	writeFiles(t, repo, map[string]string{"a.txt": "first\n"})
+	runGit(t, dir, "stash", "push", "-q", "-m", "first")
+	writeFiles(t, repo, map[string]string{"a.txt": "second\n"})
+	runGit(t, dir, "stash", "push", "-q", "-m", "second")
+
+	body := stashCount(t, gs)
+	if body.Count != 2 || body.Latest == nil {
+		t.Fatalf("after two stashes: %+v", body)
+	}
+	if body.Latest.Hash != runGit(t, dir, "rev-parse", "stash@{0}") || body.Latest.Message != "On master: second" {
+		t.Errorf("latest %+v", body.Latest)
+	}
+
+	runGit(t, dir, "stash", "drop", "-q")
+	if body := stashCount(t, gs); body.Count != 1 || body.Latest.Message != "On master: first" {
+		t.Errorf("after dropping one: %+v", body)
+	}
+}
+
+type stashResponse struct {
+	Stash  StashEntry `json:"stash"`
+	Status *Status    `json:"status"`
+}
+
+func stashSave(t *testing.T, gs *GitService, req StashRequest, status int) stashResponse {
+	t.Helper()
+	rec := serve(t, gs.stashSaveHandler, "POST", "/git/p/stash", project("p"), req)
+	expectStatus(t, rec, status)
+	var body stashResponse
+	decodeBody(t, rec, &body)
+	return body
+}
+
+func stashPop(t *testing.T, gs *GitService, index string, status int) stashResponse {
+	t.Helper()
+	rec := serve(t, gs.stashPopHandler, "POST", "/git/p/stash/"+index+"/pop", map[string]string{"projectId": "p", "index": index}, nil)
+	expectStatus(t, rec, status)
+	var body stashResponse
+	decodeBody(t, rec, &body)
+	return body
+}
+
+func stashList(t *testing.T, gs *GitService) []StashEntry {
+	t.Helper()
+	rec := serve(t, gs.stashListHandler, "GET", "/git/p/stash", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Stashes []StashEntry `json:"stashes"`
+	}
+	decodeBody(t, rec, &body)
+	return body.Stashes
+}
+
+func TestStashRoundTripWithUntracked(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	dir := gs.getProjectPath("p")
+	writeFiles(t, repo, map[string]string{"b.txt": "staged\n"})
+	runGit(t, dir, "add", "b.txt")
+	writeFiles(t, repo, map[string]string{"a.txt": "modified\n", "notes/u.txt": "untracked\n"})
+	before := runGit(t, dir, "status", "--porcelain", "-uall")
+
+	saved := stashSave(t, gs, StashRequest{Message: "wip", IncludeUntracked: true}, http.StatusOK)
+	if saved.Stash.Index != 0 || !saved.Stash.IncludeUntracked || saved.Stash.Message != "On master: wip" || saved.Stash.Branch != "master" {
+		t.Errorf("saved %+v", saved.Stash)
+	}
+	if got := runGit(t, dir, "status", "--porcelain", "-uall"); got != "" {
+		t.Errorf("working tree after the stash:\n%s", got)
+	}
+
+	// The git CLI sees the same stash, untracked files and all
+	if got := runGit(t, dir, "rev-parse", "stash@{0}"); got != saved.Stash.Hash {
+		t.Errorf("stash@{0} is %s, saved %s", got, saved.Stash.Hash)
+	}
+	if got := runGit(t, dir, "show", "--format=", "--name-only", "stash@{0}^3"); got != "notes/u.txt" {
+		t.Errorf("untracked files in the stash: %q", got)
+	}
+	if list := stashList(t, gs); len(list) != 1 || list[0].Hash != saved.Stash.Hash {
+		t.Errorf("stash list %+v", list)
+	}
+
+	popped := stashPop(t, gs, "0", http.StatusOK)
+	if popped.Stash.Hash != saved.Stash.Hash {
+		t.Errorf("popped %+v", popped.Stash)
+	}
+	if got := runGit(t, dir, "status", "--porcelain", "-uall"); got != before {
+		t.Errorf("status after the pop:\n%s\nwant\n%s", got, before)
+	}
+	if got := readProjectFile(t, gs, "notes/u.txt"); got != "untracked\n" {
+		t.Errorf("notes/u.txt = %q", got)
+	}
+	if list := stashList(t, gs); len(list) != 0 {
+		t.Errorf("stash list after the pop: %+v", list)
+	}
+	if body := stashCount(t, gs); body.Count != 0 {
+		t.Errorf("stash count after the pop: %+v", body)
+	}
+}
+
+func TestStashLeavesUntrackedFilesByDefault(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	dir := gs.getProjectPath("p")
+	writeFiles(t, repo, map[string]string{"a.txt": "modified\n", "u.txt": "untracked\n"})
+
+	saved := stashSave(t, gs, StashRequest{}, http.StatusOK)
+	if saved.Stash.IncludeUntracked || saved.Stash.Message != "WIP on master: "+runGit(t, dir, "log", "-1", "--format=%h %s") {
+		t.Errorf("saved %+v", saved.Stash)
+	}
+	if got := runGit(t, dir, "status", "--porcelain"); got != "?? u.txt" {
+		t.Errorf("status after the stash:\n%s", got)
+	}
+
+	// Only untracked files left: nothing to stash without includeUntracked
+	stashSave(t, gs, StashRequest{}, http.StatusBadRequest)
+
+	stashPop(t, gs, "0", http.StatusOK)
+	if got := readProjectFile(t, gs, "a.txt"); got != "modified\n" {
+		t.Errorf("a.txt = %q after the pop", got)
+	}
+}
+
+func TestStashPopConflictKeepsStash(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	writeFiles(t, repo, map[string]string{"a.txt": "stashed\n"})
+	saved := stashSave(t, gs, StashRequest{}, http.StatusOK)
+	commitTestFiles(t, repo, "Conflicting", map[string]string{"a.txt": "committed\n"})
+
+	rec := serve(t, gs.stashPopHandler, "POST", "/git/p/stash/0/pop", map[string]string{"projectId": "p", "index": "0"}, nil)
+	expectStatus(t, rec, http.StatusConflict)
+	var body struct {
+		Conflicts []Conflict `json:"conflicts"`
+	}
+	decodeBody(t, rec, &body)
+	if len(body.Conflicts) != 1 || body.Conflicts[0].Path != "a.txt" {
+		t.Errorf("conflicts %+v", body.Conflicts)
+	}
+	if list := stashList(t, gs); len(list) != 1 || list[0].Hash != saved.Stash.Hash {
+		t.Errorf("stash list after the failed pop: %+v", list)
+	}
+	if got := readProjectFile(t, gs, "a.txt"); got != "committed\n" {
+		t.Errorf("a.txt = %q", got)
+	}
+
+	stashPop(t, gs, "1", http.StatusNotFound)
+	stashPop(t, gs, "x", http.StatusBadRequest)
+}
+
+// A stash made by the git CLI pops through the service
+func TestStashPopsGitStash(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	dir := gs.getProjectPath("p")
+	writeFiles(t, repo, map[string]string{"a.txt": "modified\n", "u.txt": "untracked\n"})
+	runGit(t, dir, "stash", "push", "-q", "-u")
+
+	list := stashList(t, gs)
+	if len(list) != 1 || !list[0].IncludeUntracked {
+		t.Fatalf("stash list %+v", list)
+	}
+	stashPop(t, gs, "0", http.StatusOK)
+	if got := runGit(t, dir, "status", "--porcelain"); got != "M a.txt\n?? u.txt" {
+		t.Errorf("status after the pop:\n%s", got)
+	}
+	if got := runGit(t, dir, "stash", "list"); got != "" {
+		t.Errorf("git stash list after the pop: %s", got)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// stateDirName is the directory inside a repository's git dir that holds
+// service-owned per-project state (never part of the repository history)
+const stateDirName = "neoai"
+
+// gitDir returns the git directory for a project, handling bare repositories
+func (gs *GitService) gitDir(projectID string) string {
+	projectPath := gs.getProjectPath(projectID)
+	dotGit := filepath.Join(projectPath, ".git")
+	if info, err := os.Stat(dotGit); err == nil && info.IsDir() {
+		return dotGit
+	}
+	return projectPath
+}
+
+// statePath returns the path of a named per-project state file
+func (gs *GitService) statePath(projectID, name string) string {
+	return filepath.Join(gs.gitDir(projectID), stateDirName, name+".json")
+}
+
+// loadState reads a per-project state file into v. A missing file leaves v untouched.
+func (gs *GitService) loadState(projectID, name string, v interface{}) error {
+	gs.stateMu.Lock()
+	defer gs.stateMu.Unlock()
+	return gs.readStateFile(projectID, name, v)
+}
+
+// saveState writes v as a per-project state file
+func (gs *GitService) saveState(projectID, name string, v interface{}) error {
+	gs.stateMu.Lock()
+	defer gs.stateMu.Unlock()
+	return gs.writeStateFile(projectID, name, v)
+}
+
+// updateState loads a state file into v, applies fn and writes the result back
+// while holding the state lock, so concurrent updates are not lost
+func (gs *GitService) updateState(projectID, name string, v interface{}, fn func() error) error {
+	gs.stateMu.Lock()
+	defer gs.stateMu.Unlock()
+
+	if err := gs.readStateFile(projectID, name, v); err != nil {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	return gs.writeStateFile(projectID, name, v)
+}
+
+func (gs *GitService) readStateFile(projectID, name string, v interface{}) error {
+	data, err := os.ReadFile(gs.statePath(projectID, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (gs *GitService) writeStateFile(projectID, name string, v interface{}) error {
+	path := gs.statePath(projectID, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write through a temp file so a crash never leaves truncated state behind
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
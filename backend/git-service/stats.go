@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/gorilla/mux"
+)
+
+// repoStatsTTL is how long computed stats are served before the repository
+// is walked again
+const repoStatsTTL = 30 * time.Second
+
+// RepositoryStats describes how much space a repository takes up
+type RepositoryStats struct {
+	GitDirBytes   int64     `json:"gitDirBytes"`
+	WorktreeBytes int64     `json:"worktreeBytes"`
+	TotalBytes    int64     `json:"totalBytes"`
+	Objects       GcStats   `json:"objects"`
+	Refs          int       `json:"refs"`
+	Commits       int       `json:"commits"`
+	ComputedAt    time.Time `json:"computedAt"`
+}
+
+// Get repository stats endpoint. Results are cached for repoStatsTTL;
+// refresh=true recomputes them.
+func (gs *GitService) statsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	refresh := false
+	if value := r.URL.Query().Get("refresh"); value != "" {
+		var err error
+		if refresh, err = strconv.ParseBool(value); err != nil {
+			gs.sendError(w, "Invalid refresh value", http.StatusBadRequest)
+			return
+		}
+	}
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	gs.statsMu.Lock()
+	cached, ok := gs.stats[projectID]
+	gs.statsMu.Unlock()
+	fromCache := ok && !refresh && time.Since(cached.ComputedAt) < repoStatsTTL
+	if !fromCache {
+		gitDir := gs.gitDir(projectID)
+		stats := &RepositoryStats{ComputedAt: time.Now()}
+		if stats.GitDirBytes, err = dirSize(gitDir, ""); err != nil {
+			gs.sendInternalError(w, "Failed to measure git directory", err)
+			return
+		}
+		// A bare repository is all git directory
+		if projectPath := gs.getProjectPath(projectID); gitDir != projectPath {
+			if stats.WorktreeBytes, err = dirSize(projectPath, gitDir); err != nil {
+				gs.sendInternalError(w, "Failed to measure working tree", err)
+				return
+			}
+		}
+		stats.TotalBytes = stats.GitDirBytes + stats.WorktreeBytes
+		if stats.Objects, err = gs.gcStats(projectID); err != nil {
+			gs.sendInternalError(w, "Failed to count objects", err)
+			return
+		}
+
+		iter, err := repo.References()
+		if err != nil {
+			gs.sendError(w, "Failed to list references", http.StatusInternalServerError)
+			return
+		}
+		err = iter.ForEach(func(ref *plumbing.Reference) error {
+			if ref.Name() != plumbing.HEAD {
+				stats.Refs++
+			}
+			return nil
+		})
+		if err != nil {
+			gs.sendError(w, "Failed to list references", http.StatusInternalServerError)
+			return
+		}
+		roots, err := gs.refRoots(repo)
+		if err != nil {
+			gs.sendError(w, "Failed to list references", http.StatusInternalServerError)
+			return
+		}
+		reachable, err := commitAncestors(repo, roots, nil)
+		if err != nil {
+			gs.sendError(w, "Failed to walk history", http.StatusInternalServerError)
+			return
+		}
+		stats.Commits = len(reachable)
+
+		cached = stats
+		gs.statsMu.Lock()
+		gs.stats[projectID] = stats
+		gs.statsMu.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"stats":  cached,
+		"cached": fromCache,
+	})
+}
+
+// dirSize adds up the sizes of the regular files under root, leaving out the
+// directory skip. Symlinks count as themselves, not what they point at.
+func dirSize(root, skip string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p == skip {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
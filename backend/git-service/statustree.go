@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/gorilla/mux"
+)
+
+// statusNames maps go-git status codes to the names used in the API
+var statusNames = map[git.StatusCode]string{
+	git.Modified:           "modified",
+	git.Added:              "added",
+	git.Deleted:            "deleted",
+	git.Renamed:            "renamed",
+	git.Copied:             "copied",
+	git.Untracked:          "untracked",
+	git.UpdatedButUnmerged: "conflicted",
+}
+
+// ChangeCounts aggregates the changes below a directory
+type ChangeCounts struct {
+	Staged    int `json:"staged"`
+	Modified  int `json:"modified"`
+	Untracked int `json:"untracked"`
+	Conflicts int `json:"conflicts"`
+	Total     int `json:"total"`
+}
+
+// StatusNode is a directory or changed file in the status tree
+type StatusNode struct {
+	Name     string        `json:"name"`
+	Path     string        `json:"path"`
+	Type     string        `json:"type"`
+	Staging  string        `json:"staging,omitempty"`
+	Worktree string        `json:"worktree,omitempty"`
+	Counts   *ChangeCounts `json:"counts,omitempty"`
+	Children []*StatusNode `json:"children,omitempty"`
+}
+
+// Get repository status as a directory tree endpoint
+func (gs *GitService) statusTreeHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+
+	status, err := worktree.Status()
+	if err != nil {
+		gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+		return
+	}
+
+	root := &StatusNode{Name: "", Path: "", Type: "dir", Counts: &ChangeCounts{}}
+	for file, fileStatus := range status {
+		if fileStatus.Staging == git.Unmodified && fileStatus.Worktree == git.Unmodified {
+			continue
+		}
+		addStatusNode(root, file, fileStatus)
+	}
+	sortStatusTree(root)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"clean": status.IsClean(),
+		"tree":  root,
+	})
+}
+
+// addStatusNode inserts a changed file, creating its parent directories and
+// adding the change to the counts of every directory on the way
+func addStatusNode(root *StatusNode, file string, fileStatus *git.FileStatus) {
+	counts := changeCountsFor(fileStatus)
+
+	node := root
+	parts := strings.Split(file, "/")
+	for i, part := range parts {
+		node.Counts.add(counts)
+		if i == len(parts)-1 {
+			node.Children = append(node.Children, &StatusNode{
+				Name:     part,
+				Path:     file,
+				Type:     "file",
+				Staging:  statusNames[fileStatus.Staging],
+				Worktree: statusNames[fileStatus.Worktree],
+			})
+			return
+		}
+
+		var child *StatusNode
+		for _, existing := range node.Children {
+			if existing.Type == "dir" && existing.Name == part {
+				child = existing
+				break
+			}
+		}
+		if child == nil {
+			child = &StatusNode{Name: part, Path: strings.Join(parts[:i+1], "/"), Type: "dir", Counts: &ChangeCounts{}}
+			node.Children = append(node.Children, child)
+		}
+		node = child
+	}
+}
+
+// changeCountsFor counts a single changed file
+func changeCountsFor(fileStatus *git.FileStatus) ChangeCounts {
+	var counts ChangeCounts
+	switch {
+	case fileStatus.Staging == git.UpdatedButUnmerged || fileStatus.Worktree == git.UpdatedButUnmerged:
+		counts.Conflicts = 1
+	case fileStatus.Worktree == git.Untracked:
+		counts.Untracked = 1
+	default:
+		if fileStatus.Staging != git.Unmodified {
+			counts.Staged = 1
+		}
+		if fileStatus.Worktree != git.Unmodified {
+			counts.Modified = 1
+		}
+	}
+	counts.Total = 1
+	return counts
+}
+
+// add accumulates another set of counts
+func (c *ChangeCounts) add(other ChangeCounts) {
+	c.Staged += other.Staged
+	c.Modified += other.Modified
+	c.Untracked += other.Untracked
+	c.Conflicts += other.Conflicts
+	c.Total += other.Total
+}
+
+// sortStatusTree orders each directory's children, directories first
+func sortStatusTree(node *StatusNode) {
+	sort.Slice(node.Children, func(i, j int) bool {
+		a, b := node.Children[i], node.Children[j]
+		if a.Type != b.Type {
+			return a.Type == "dir"
+		}
+		return a.Name < b.Name
+	})
+	for _, child := range node.Children {
+		sortStatusTree(child)
+	}
+}
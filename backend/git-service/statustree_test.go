@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestStatusTreeAggregatesByDirectory(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	commitTestFiles(t, repo, "Add src", map[string]string{"src/x.go": "x\n", "src/sub/y.go": "y\n"})
+	writeFiles(t, repo, map[string]string{"src/x.go": "staged\n"})
+	runGit(t, gs.getProjectPath("p"), "add", "src/x.go")
+	writeFiles(t, repo, map[string]string{"src/sub/y.go": "modified\n", "src/sub/new.txt": "new\n", "a.txt": "modified\n"})
+
+	rec := serve(t, gs.statusTreeHandler, "GET", "/git/p/status/tree", project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Clean bool       `json:"clean"`
+		Tree  StatusNode `json:"tree"`
+	}
+	decodeBody(t, rec, &body)
+	if body.Clean {
+		t.Error("a changed repository is reported clean")
+	}
+
+	root := &body.Tree
+	if *root.Counts != (ChangeCounts{Staged: 1, Modified: 2, Untracked: 1, Total: 4}) {
+		t.Errorf("root counts %+v", *root.Counts)
+	}
+	if len(root.Children) != 2 || root.Children[0].Path != "src" || root.Children[1].Path != "a.txt" {
+		t.Fatalf("root children %+v; want src before a.txt", root.Children)
+	}
+	if a := root.Children[1]; a.Type != "file" || a.Worktree != "modified" || a.Staging != "" {
+		t.Errorf("a.txt %+v", a)
+	}
+
+	src := root.Children[0]
+	if *src.Counts != (ChangeCounts{Staged: 1, Modified: 1, Untracked: 1, Total: 3}) {
+		t.Errorf("src counts %+v", *src.Counts)
+	}
+	if len(src.Children) != 2 || src.Children[0].Path != "src/sub" || src.Children[1].Path != "src/x.go" || src.Children[1].Staging != "modified" {
+		t.Fatalf("src children %+v", src.Children)
+	}
+	sub := src.Children[0]
+	if *sub.Counts != (ChangeCounts{Modified: 1, Untracked: 1, Total: 2}) {
+		t.Errorf("src/sub counts %+v", *sub.Counts)
+	}
+	if len(sub.Children) != 2 || sub.Children[0].Name != "new.txt" || sub.Children[0].Worktree != "untracked" {
+		t.Errorf("src/sub children %+v", sub.Children)
+	}
+}
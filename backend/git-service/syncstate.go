@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/gorilla/mux"
+)
+
+// defaultFetchStaleAfter is how old the last fetch may be before the sync
+// state suggests fetching again
+const defaultFetchStaleAfter = time.Hour
+
+// lastFetchState records when each remote was last fetched by the service
+type lastFetchState struct {
+	Remotes map[string]time.Time `json:"remotes"`
+}
+
+// SyncState is the current branch's tracking state in one compact value
+type SyncState struct {
+	Branch            string       `json:"branch,omitempty"`
+	Detached          bool         `json:"detached"`
+	Head              string       `json:"head,omitempty"`
+	Upstream          string       `json:"upstream,omitempty"`
+	Remote            string       `json:"remote,omitempty"`
+	Ahead             *int         `json:"ahead,omitempty"`
+	Behind            *int         `json:"behind,omitempty"`
+	Dirty             bool         `json:"dirty"`
+	Changes           ChangeCounts `json:"changes"`
+	LastFetchedAt     *time.Time   `json:"lastFetchedAt,omitempty"`
+	SecondsSinceFetch *int64       `json:"secondsSinceFetch,omitempty"`
+	FetchStale        bool         `json:"fetchStale"`
+}
+
+// recordFetch remembers that a remote was just fetched. Failures are logged
+// rather than returned since the fetch itself succeeded.
+func (gs *GitService) recordFetch(projectID, remote string) {
+	var state lastFetchState
+	err := gs.updateState(projectID, "last-fetch", &state, func() error {
+		if state.Remotes == nil {
+			state.Remotes = make(map[string]time.Time)
+		}
+		state.Remotes[remote] = time.Now().UTC()
+		return nil
+	})
+	if err != nil {
+		gs.logger.Warn("failed to record fetch", "projectId", projectID, "remote", remote, "error", err)
+	}
+}
+
+// lastFetchTime returns when a remote was last fetched, by the service or
+// by the git CLI, which touches FETCH_HEAD on every fetch
+func (gs *GitService) lastFetchTime(projectID, remote string) (time.Time, error) {
+	var state lastFetchState
+	if err := gs.loadState(projectID, "last-fetch", &state); err != nil {
+		return time.Time{}, err
+	}
+	last := state.Remotes[remote]
+	if info, err := os.Stat(filepath.Join(gs.gitDir(projectID), "FETCH_HEAD")); err == nil && info.ModTime().After(last) {
+		last = info.ModTime().UTC()
+	}
+	return last, nil
+}
+
+// Get branch sync state endpoint
+func (gs *GitService) syncStateHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	staleAfter := defaultFetchStaleAfter
+	if value := r.URL.Query().Get("staleAfter"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			gs.sendError(w, "staleAfter must be a positive duration such as 30m", http.StatusBadRequest)
+			return
+		}
+		staleAfter = d
+	}
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	head, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		gs.sendError(w, "Failed to read HEAD", http.StatusInternalServerError)
+		return
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		gs.sendError(w, "Failed to read config", http.StatusInternalServerError)
+		return
+	}
+
+	state := &SyncState{}
+	if head.Type() == plumbing.SymbolicReference {
+		state.Branch = head.Target().Short()
+	} else {
+		state.Detached = true
+	}
+	resolved, err := repo.Head()
+	if err == nil {
+		state.Head = resolved.Hash().String()
+	} else if err != plumbing.ErrReferenceNotFound {
+		gs.sendError(w, "Failed to read HEAD", http.StatusInternalServerError)
+		return
+	}
+
+	// A detached HEAD has no upstream; an unborn branch has one but nothing
+	// to count against it yet
+	if state.Branch != "" {
+		state.Remote = git.DefaultRemoteName
+		if branch, ok := cfg.Branches[state.Branch]; ok && branch.Remote != "" {
+			state.Remote = branch.Remote
+		}
+		if upstream := upstreamRef(repo, cfg, state.Branch); upstream != nil {
+			state.Upstream = upstream.Name().Short()
+			if resolved != nil {
+				if state.Ahead, state.Behind, err = trackingCounts(newCommitGraph(repo), cfg, resolved); err != nil {
+					gs.sendError(w, "Failed to count commits", http.StatusInternalServerError)
+					return
+				}
+			}
+		}
+		if _, ok := cfg.Remotes[state.Remote]; !ok && state.Remote != "." {
+			state.Remote = ""
+		}
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		gs.sendError(w, "Failed to get worktree", http.StatusInternalServerError)
+		return
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		gs.sendError(w, "Failed to get repository status", http.StatusInternalServerError)
+		return
+	}
+	for _, fileStatus := range status {
+		if fileStatus.Staging != git.Unmodified || fileStatus.Worktree != git.Unmodified {
+			state.Changes.add(changeCountsFor(fileStatus))
+		}
+	}
+	state.Dirty = !status.IsClean()
+
+	// Fetch staleness only means something for a branch with a real remote;
+	// a local upstream is always current
+	if state.Remote != "" && state.Remote != "." {
+		last, err := gs.lastFetchTime(projectID, state.Remote)
+		if err != nil {
+			gs.sendError(w, "Failed to read fetch state", http.StatusInternalServerError)
+			return
+		}
+		if last.IsZero() {
+			state.FetchStale = true
+		} else {
+			since := int64(time.Since(last).Seconds())
+			state.LastFetchedAt = &last
+			state.SecondsSinceFetch = &since
+			state.FetchStale = time.Since(last) > staleAfter
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"syncState": state,
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func getSyncState(t *testing.T, gs *GitService, query string) SyncState {
+	t.Helper()
+	rec := serve(t, gs.syncStateHandler, "GET", "/git/p/sync-state"+query, project("p"), nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		SyncState SyncState `json:"syncState"`
+	}
+	decodeBody(t, rec, &body)
+	return body.SyncState
+}
+
+func TestSyncStateAheadWithLocalChanges(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	addTestRemote(t, repo)
+	commitTestFiles(t, repo, "Local one", map[string]string{"b.txt": "b\n"})
+	head := commitTestFiles(t, repo, "Local two", map[string]string{"c.txt": "c\n"})
+	writeFiles(t, repo, map[string]string{"a.txt": "modified\n", "new.txt": "untracked\n"})
+
+	state := getSyncState(t, gs, "")
+	if state.Branch != "master" || state.Detached || state.Head != head.String() || state.Upstream != "origin/master" || state.Remote != "origin" {
+		t.Errorf("branch fields: %+v", state)
+	}
+	if state.Ahead == nil || state.Behind == nil || *state.Ahead != 2 || *state.Behind != 0 {
+		t.Errorf("ahead/behind = %v/%v, want 2/0", state.Ahead, state.Behind)
+	}
+	if !state.Dirty || state.Changes != (ChangeCounts{Modified: 1, Untracked: 1, Total: 2}) {
+		t.Errorf("dirty %v, changes %+v", state.Dirty, state.Changes)
+	}
+	// The test remote was fetched behind the service's back
+	if !state.FetchStale || state.LastFetchedAt != nil || state.SecondsSinceFetch != nil {
+		t.Errorf("fetch state before any fetch: %+v", state)
+	}
+
+	rec := serve(t, gs.fetchHandler, "POST", "/git/p/fetch", project("p"), FetchRequest{})
+	expectStatus(t, rec, http.StatusOK)
+	state = getSyncState(t, gs, "")
+	if state.FetchStale || state.LastFetchedAt == nil || state.SecondsSinceFetch == nil || *state.SecondsSinceFetch > 60 {
+		t.Errorf("fetch state after a fetch: %+v", state)
+	}
+	if state := getSyncState(t, gs, "?staleAfter=1ns"); !state.FetchStale {
+		t.Errorf("a fetch older than staleAfter is not stale: %+v", state)
+	}
+}
+
+func TestSyncStateWithoutUpstream(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+
+	state := getSyncState(t, gs, "")
+	if state.Branch != "master" || state.Upstream != "" || state.Remote != "" || state.Ahead != nil || state.Dirty || state.FetchStale {
+		t.Errorf("branch without upstream: %+v", state)
+	}
+
+	runGit(t, gs.getProjectPath("p"), "checkout", "-q", "--detach")
+	state = getSyncState(t, gs, "")
+	if !state.Detached || state.Branch != "" || state.Head != refHash(t, repo, "HEAD").String() {
+		t.Errorf("detached HEAD: %+v", state)
+	}
+
+	rec := serve(t, gs.syncStateHandler, "GET", "/git/p/sync-state?staleAfter=0s", project("p"), nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
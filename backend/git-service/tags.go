@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gorilla/mux"
+)
+
+// Outcomes reported for each tag in a batch
+const (
+	tagCreated     = "created"
+	tagOverwritten = "overwritten"
+	tagSkipped     = "skipped"
+	tagFailed      = "failed"
+)
+
+// TagSpec describes a tag to create. A message makes it an annotated tag.
+type TagSpec struct {
+	Name    string `json:"name"`
+	Hash    string `json:"hash"`
+	Message string `json:"message,omitempty"`
+}
+
+// TagBatchRequest represents a bulk tag creation request
+type TagBatchRequest struct {
+	Tags      []TagSpec `json:"tags"`
+	Overwrite bool      `json:"overwrite"`
+}
+
+// TagResult reports what happened to one tag of a batch
+type TagResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Hash   string `json:"hash,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// TagInfo describes a tag. Commit is the commit the tag peels to; the
+// message and tagger are only set for annotated tags.
+type TagInfo struct {
+	Name      string     `json:"name"`
+	Hash      string     `json:"hash"`
+	Commit    string     `json:"commit,omitempty"`
+	Annotated bool       `json:"annotated"`
+	Message   string     `json:"message,omitempty"`
+	Tagger    *Author    `json:"tagger,omitempty"`
+	Date      *time.Time `json:"date,omitempty"`
+}
+
+// CreateTagRequest represents a request to create a tag. Ref defaults to
+// HEAD and a message makes the tag annotated.
+type CreateTagRequest struct {
+	Name    string `json:"name"`
+	Ref     string `json:"ref,omitempty"`
+	Message string `json:"message,omitempty"`
+	Force   bool   `json:"force,omitempty"`
+}
+
+// newTagInfo describes a tag reference, peeling annotated tags down to the
+// commit they point at
+func newTagInfo(repo *git.Repository, ref *plumbing.Reference) (TagInfo, error) {
+	info := TagInfo{Name: ref.Name().Short(), Hash: ref.Hash().String()}
+
+	hash := ref.Hash()
+	for {
+		tag, err := repo.TagObject(hash)
+		if err == plumbing.ErrObjectNotFound {
+			break
+		} else if err != nil {
+			return info, err
+		}
+		// Only the outermost tag object describes this tag
+		if !info.Annotated {
+			info.Annotated = true
+			info.Message = tag.Message
+			info.Tagger = &Author{Name: tag.Tagger.Name, Email: tag.Tagger.Email}
+			when := tag.Tagger.When
+			info.Date = &when
+		}
+		if tag.TargetType != plumbing.TagObject && tag.TargetType != plumbing.CommitObject {
+			return info, nil
+		}
+		hash = tag.Target
+	}
+	if _, err := repo.CommitObject(hash); err == nil {
+		info.Commit = hash.String()
+	}
+	return info, nil
+}
+
+// List tags endpoint
+func (gs *GitService) tagsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	repo, err := gs.openRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	refs, err := repo.Tags()
+	if err != nil {
+		gs.sendError(w, "Failed to list tags", http.StatusInternalServerError)
+		return
+	}
+	tags := []TagInfo{}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		info, err := newTagInfo(repo, ref)
+		if err != nil {
+			return err
+		}
+		tags = append(tags, info)
+		return nil
+	})
+	if err != nil {
+		gs.sendError(w, "Failed to read tags", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"tags": tags,
+	})
+}
+
+// Create tag endpoint
+func (gs *GitService) createTagHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req CreateTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" {
+		gs.sendError(w, "Tag name is required", http.StatusBadRequest)
+		return
+	}
+	if err := validateRefName(req.Name); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid tag name: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Ref == "" {
+		req.Ref = "HEAD"
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := repo.ResolveRevision(plumbing.Revision(req.Ref)); err != nil {
+		gs.sendError(w, fmt.Sprintf("Revision %s not found", req.Ref), http.StatusNotFound)
+		return
+	}
+	if _, err := repo.Tag(req.Name); err == nil && !req.Force {
+		gs.sendError(w, fmt.Sprintf("Tag '%s' already exists", req.Name), http.StatusConflict)
+		return
+	}
+
+	tagger := gs.resolveIdentity(projectID)
+	if tagger.Name == "" || tagger.Email == "" {
+		tagger = serviceIdentity
+	}
+	spec := TagSpec{Name: req.Name, Hash: req.Ref, Message: req.Message}
+	result := gs.createTag(repo, spec, req.Force, tagger)
+	if result.Status == tagFailed {
+		gs.sendError(w, fmt.Sprintf("Failed to create tag: %s", result.Error), http.StatusInternalServerError)
+		return
+	}
+
+	ref, err := repo.Tag(req.Name)
+	if err != nil {
+		gs.sendError(w, "Failed to read tag", http.StatusInternalServerError)
+		return
+	}
+	info, err := newTagInfo(repo, ref)
+	if err != nil {
+		gs.sendError(w, "Failed to read tag", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Tag '%s' %s", req.Name, result.Status),
+		"tag":     info,
+	})
+}
+
+// Delete tag endpoint
+func (gs *GitService) deleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+	name := vars["name"]
+
+	if err := validateRefName(name); err != nil {
+		gs.sendError(w, fmt.Sprintf("Invalid tag name: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	ref, err := repo.Tag(name)
+	if err == git.ErrTagNotFound {
+		gs.sendError(w, fmt.Sprintf("Tag '%s' not found", name), http.StatusNotFound)
+		return
+	} else if err != nil {
+		gs.sendError(w, "Failed to read tag", http.StatusInternalServerError)
+		return
+	}
+	if err := repo.DeleteTag(name); err != nil {
+		gs.sendError(w, "Failed to delete tag", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Tag '%s' deleted", name),
+		"hash":    ref.Hash().String(),
+	})
+}
+
+// Create tags in bulk endpoint
+func (gs *GitService) batchTagsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	projectID := vars["projectId"]
+
+	var req TagBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		gs.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Tags) == 0 {
+		gs.sendError(w, "Tags are required", http.StatusBadRequest)
+		return
+	}
+
+	unlock := gs.lockProject(projectID)
+	defer unlock()
+
+	repo, err := gs.openLockedRepository(projectID)
+	if err != nil {
+		gs.sendError(w, "Repository not found", http.StatusNotFound)
+		return
+	}
+
+	tagger := gs.resolveIdentity(projectID)
+	if tagger.Name == "" || tagger.Email == "" {
+		tagger = serviceIdentity
+	}
+
+	results := make([]TagResult, 0, len(req.Tags))
+	counts := make(map[string]int)
+	for _, spec := range req.Tags {
+		result := gs.createTag(repo, spec, req.Overwrite, tagger)
+		counts[result.Status]++
+		results = append(results, result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Created %d tags, overwrote %d, skipped %d, failed %d",
+			counts[tagCreated], counts[tagOverwritten], counts[tagSkipped], counts[tagFailed]),
+		"results": results,
+	})
+}
+
+// createTag creates a single tag of a batch, reporting failures in its result
+func (gs *GitService) createTag(repo *git.Repository, spec TagSpec, overwrite bool, tagger Author) TagResult {
+	result := TagResult{Name: spec.Name, Status: tagFailed}
+
+	if err := validateRefName(spec.Name); err != nil {
+		result.Error = fmt.Sprintf("invalid tag name: %v", err)
+		return result
+	}
+	if spec.Hash == "" {
+		result.Error = "hash is required"
+		return result
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(spec.Hash))
+	if err != nil {
+		result.Error = fmt.Sprintf("revision %s not found", spec.Hash)
+		return result
+	}
+	if _, err := repo.Object(plumbing.AnyObject, *hash); err != nil {
+		result.Error = fmt.Sprintf("object %s not found", hash)
+		return result
+	}
+	result.Hash = hash.String()
+
+	created := tagCreated
+	if _, err := repo.Tag(spec.Name); err == nil {
+		if !overwrite {
+			result.Status = tagSkipped
+			result.Error = "tag already exists"
+			return result
+		}
+		if err := repo.DeleteTag(spec.Name); err != nil {
+			result.Error = fmt.Sprintf("failed to replace existing tag: %v", err)
+			return result
+		}
+		created = tagOverwritten
+	} else if err != git.ErrTagNotFound {
+		result.Error = fmt.Sprintf("failed to read tag: %v", err)
+		return result
+	}
+
+	var opts *git.CreateTagOptions
+	if spec.Message != "" {
+		opts = &git.CreateTagOptions{
+			Tagger: &object.Signature{
+				Name:  tagger.Name,
+				Email: tagger.Email,
+				When:  time.Now(),
+			},
+			Message: spec.Message,
+		}
+	}
+	if _, err := repo.CreateTag(spec.Name, *hash, opts); err != nil {
+		result.Error = fmt.Sprintf("failed to create tag: %v", err)
+		return result
+	}
+
+	result.Status = created
+	return result
+}
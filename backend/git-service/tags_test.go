@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func batchTags(t *testing.T, gs *GitService, req TagBatchRequest) []TagResult {
+	t.Helper()
+	rec := serve(t, gs.batchTagsHandler, "POST", "/git/p/tags/batch", project("p"), req)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		Results []TagResult `json:"results"`
+	}
+	decodeBody(t, rec, &body)
+	return body.Results
+}
+
+func TestBatchTagsOverwrite(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	first := refHash(t, repo, "HEAD")
+	second := commitTestFiles(t, repo, "Second", map[string]string{"b.txt": "b\n"})
+
+	results := batchTags(t, gs, TagBatchRequest{Tags: []TagSpec{
+		{Name: "v1", Hash: first.String()},
+		{Name: "v2", Hash: second.String(), Message: "Release 2"},
+		{Name: "bad..name", Hash: first.String()},
+		{Name: "v3", Hash: "0123456789abcdef0123456789abcdef01234567"},
+	}})
+	statuses := make(map[string]string)
+	for _, result := range results {
+		statuses[result.Name] = result.Status
+	}
+	if statuses["v1"] != tagCreated || statuses["v2"] != tagCreated || statuses["bad..name"] != tagFailed || statuses["v3"] != tagFailed {
+		t.Fatalf("results %+v", results)
+	}
+	if tag, err := repo.TagObject(refHash(t, repo, "refs/tags/v2")); err != nil || tag.Target != second {
+		t.Errorf("v2 is not an annotated tag of %s: %v", second, err)
+	}
+
+	// Without overwrite an existing tag is skipped and left alone
+	results = batchTags(t, gs, TagBatchRequest{Tags: []TagSpec{{Name: "v1", Hash: second.String()}}})
+	if results[0].Status != tagSkipped || refHash(t, repo, "refs/tags/v1") != first {
+		t.Errorf("without overwrite: %+v", results[0])
+	}
+	results = batchTags(t, gs, TagBatchRequest{Tags: []TagSpec{{Name: "v1", Hash: second.String()}}, Overwrite: true})
+	if results[0].Status != tagOverwritten || refHash(t, repo, "refs/tags/v1") != second {
+		t.Errorf("with overwrite: %+v", results[0])
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+)
+
+// defaultRemoteTimeout bounds a clone, fetch, pull or push when
+// GIT_OPERATION_TIMEOUT is unset
+const defaultRemoteTimeout = 10 * time.Minute
+
+// errRemoteTimeout replaces whatever error a remote call ended with once
+// its deadline passed, since go-git's transports do not report it uniformly
+var errRemoteTimeout = errors.New("the remote did not respond in time")
+
+// remoteTimeoutFromEnv reads GIT_OPERATION_TIMEOUT, a duration such as 5m.
+// Zero disables the deadline; an invalid value falls back to the default.
+func remoteTimeoutFromEnv() time.Duration {
+	if value, err := time.ParseDuration(os.Getenv("GIT_OPERATION_TIMEOUT")); err == nil && value >= 0 {
+		return value
+	}
+	return defaultRemoteTimeout
+}
+
+// remoteContext derives the context of a call to a remote from the
+// request's, so a client going away cancels it, and adds the deadline
+func (gs *GitService) remoteContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if gs.remoteTimeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, gs.remoteTimeout)
+}
+
+// timeoutError returns errRemoteTimeout if ctx's deadline is what ended a
+// failed call, and err otherwise
+func timeoutError(ctx context.Context, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return errRemoteTimeout
+	}
+	return err
+}
+
+// remoteErrorStatus answers a timed out remote call with 504 and anything
+// else with status
+func remoteErrorStatus(err error, status int) int {
+	if errors.Is(err, errRemoteTimeout) {
+		return http.StatusGatewayTimeout
+	}
+	return status
+}
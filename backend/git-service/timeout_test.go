@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/config"
+)
+
+// stallingRemote returns the URL of a remote that never answers, until the
+// client gives up or the test ends
+func stallingRemote(t *testing.T) string {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	return server.URL + "/repo.git"
+}
+
+func TestRemoteOperationsTimeOut(t *testing.T) {
+	cases := []struct {
+		name    string
+		handler func(gs *GitService) http.HandlerFunc
+		target  string
+		body    func(url string) interface{}
+	}{
+		{"clone", func(gs *GitService) http.HandlerFunc { return gs.cloneHandler }, "/git/clone",
+			func(url string) interface{} { return CloneRequest{URL: url, ProjectID: "cloned"} }},
+		{"inspect", func(gs *GitService) http.HandlerFunc { return gs.inspectHandler }, "/git/inspect",
+			func(url string) interface{} { return InspectRequest{URL: url} }},
+		{"fetch", func(gs *GitService) http.HandlerFunc { return gs.fetchHandler }, "/git/p/fetch",
+			func(string) interface{} { return map[string]string{} }},
+		{"pull", func(gs *GitService) http.HandlerFunc { return gs.pullHandler }, "/git/p/pull",
+			func(string) interface{} { return map[string]string{} }},
+		{"push", func(gs *GitService) http.HandlerFunc { return gs.pushHandler }, "/git/p/push",
+			func(string) interface{} { return map[string]string{} }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gs := newTestService(t)
+			gs.remoteTimeout = 200 * time.Millisecond
+			url := stallingRemote(t)
+			repo := initTestRepo(t, gs, "p")
+			if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{url}}); err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			rec := serve(t, tc.handler(gs), "POST", tc.target, project("p"), tc.body(url))
+			expectStatus(t, rec, http.StatusGatewayTimeout)
+			if !strings.Contains(rec.Body.String(), errRemoteTimeout.Error()) {
+				t.Errorf("body does not report the timeout: %s", rec.Body.String())
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("gave up after %v, want about %v", elapsed, gs.remoteTimeout)
+			}
+		})
+	}
+}
+
+func TestTimedOutCloneRemovesProjectDirectory(t *testing.T) {
+	gs := newTestService(t)
+	gs.remoteTimeout = 200 * time.Millisecond
+	rec := serve(t, gs.cloneHandler, "POST", "/git/clone", nil, CloneRequest{URL: stallingRemote(t), ProjectID: "p"})
+	expectStatus(t, rec, http.StatusGatewayTimeout)
+	expectNoProject(t, gs, "p")
+}
+
+func TestTimeoutError(t *testing.T) {
+	failure := errors.New("read: connection reset")
+
+	expired, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-expired.Done()
+	if err := timeoutError(expired, failure); !errors.Is(err, errRemoteTimeout) {
+		t.Errorf("past the deadline got %v, want errRemoteTimeout", err)
+	}
+	if remoteErrorStatus(timeoutError(expired, failure), http.StatusBadGateway) != http.StatusGatewayTimeout {
+		t.Error("a timeout does not map to 504")
+	}
+	if err := timeoutError(expired, nil); err != nil {
+		t.Errorf("a call that succeeded reported %v", err)
+	}
+
+	// A client going away is not a timeout
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := timeoutError(canceled, failure); err != failure {
+		t.Errorf("after cancellation got %v, want the original error", err)
+	}
+	if remoteErrorStatus(failure, http.StatusBadGateway) != http.StatusBadGateway {
+		t.Error("other errors do not keep their status")
+	}
+}
+
+func TestRemoteTimeoutFromEnv(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"":      defaultRemoteTimeout,
+		"90s":   90 * time.Second,
+		"0":     0,
+		"-1m":   defaultRemoteTimeout,
+		"never": defaultRemoteTimeout,
+	} {
+		t.Setenv("GIT_OPERATION_TIMEOUT", value)
+		if got := remoteTimeoutFromEnv(); got != want {
+			t.Errorf("GIT_OPERATION_TIMEOUT=%q gives %v, want %v", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// upstreamRef returns the remote-tracking ref a local branch follows: the one
+// configured by branch.<name>.remote and .merge, or else origin's branch of
+// the same name. It returns nil when the branch has no upstream.
+func upstreamRef(repo *git.Repository, cfg *config.Config, branch string) *plumbing.Reference {
+	name := plumbing.NewRemoteReferenceName("origin", branch)
+	if b, ok := cfg.Branches[branch]; ok && b.Remote != "" && b.Merge != "" {
+		if b.Remote == "." {
+			name = b.Merge
+		} else {
+			name = plumbing.NewRemoteReferenceName(b.Remote, b.Merge.Short())
+		}
+	}
+	ref, err := repo.Reference(name, true)
+	if err != nil {
+		return nil
+	}
+	return ref
+}
+
+// commitGraph remembers the parents of every commit it reads, so counting
+// ahead and behind for many branches decodes each commit once instead of
+// once per branch. The histories reachable from upstream tips, which
+// branches often share, are kept as well.
+type commitGraph struct {
+	repo      *git.Repository
+	parents   map[plumbing.Hash][]plumbing.Hash
+	upstreams map[plumbing.Hash]map[plumbing.Hash]bool
+}
+
+func newCommitGraph(repo *git.Repository) *commitGraph {
+	return &commitGraph{
+		repo:      repo,
+		parents:   make(map[plumbing.Hash][]plumbing.Hash),
+		upstreams: make(map[plumbing.Hash]map[plumbing.Hash]bool),
+	}
+}
+
+// parentsOf returns a commit's parents, reading the commit the first time
+func (g *commitGraph) parentsOf(hash plumbing.Hash) ([]plumbing.Hash, error) {
+	if parents, ok := g.parents[hash]; ok {
+		return parents, nil
+	}
+	commit, err := g.repo.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	g.parents[hash] = commit.ParentHashes
+	return commit.ParentHashes, nil
+}
+
+// walk visits the commits reachable from roots, including the roots, that
+// are not in stop
+func (g *commitGraph) walk(roots []plumbing.Hash, stop map[plumbing.Hash]bool, visit func(plumbing.Hash)) error {
+	seen := make(map[plumbing.Hash]bool)
+	stack := append([]plumbing.Hash(nil), roots...)
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[hash] || stop[hash] {
+			continue
+		}
+		seen[hash] = true
+		parents, err := g.parentsOf(hash)
+		if err != nil {
+			return err
+		}
+		visit(hash)
+		stack = append(stack, parents...)
+	}
+	return nil
+}
+
+// upstreamHistory returns the commits reachable from an upstream tip
+func (g *commitGraph) upstreamHistory(tip plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	if history, ok := g.upstreams[tip]; ok {
+		return history, nil
+	}
+	history := make(map[plumbing.Hash]bool)
+	if err := g.walk([]plumbing.Hash{tip}, nil, func(hash plumbing.Hash) { history[hash] = true }); err != nil {
+		return nil, err
+	}
+	g.upstreams[tip] = history
+	return history, nil
+}
+
+// aheadBehind counts the commits local has that upstream lacks, and the
+// other way round, like git rev-list --left-right --count local...upstream.
+// The walk from local stops where it meets the upstream's history; the
+// commits it stopped at lead to everything the two share.
+func (g *commitGraph) aheadBehind(local, upstream plumbing.Hash) (int, int, error) {
+	if local == upstream {
+		return 0, 0, nil
+	}
+	onUpstream, err := g.upstreamHistory(upstream)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ahead := 0
+	var boundary []plumbing.Hash
+	seen := make(map[plumbing.Hash]bool)
+	stack := []plumbing.Hash{local}
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		if onUpstream[hash] {
+			boundary = append(boundary, hash)
+			continue
+		}
+		ahead++
+		parents, err := g.parentsOf(hash)
+		if err != nil {
+			return 0, 0, err
+		}
+		stack = append(stack, parents...)
+	}
+
+	shared := 0
+	if err := g.walk(boundary, nil, func(plumbing.Hash) { shared++ }); err != nil {
+		return 0, 0, err
+	}
+	return ahead, len(onUpstream) - shared, nil
+}
+
+// aheadBehind counts ahead and behind for a single pair of commits
+func aheadBehind(repo *git.Repository, local, upstream plumbing.Hash) (int, int, error) {
+	return newCommitGraph(repo).aheadBehind(local, upstream)
+}
+
+// trackingCounts returns pointers to the ahead and behind counts of a local
+// branch, or nils when it has no upstream so callers can omit them
+func trackingCounts(graph *commitGraph, cfg *config.Config, branch *plumbing.Reference) (*int, *int, error) {
+	upstream := upstreamRef(graph.repo, cfg, branch.Name().Short())
+	if upstream == nil {
+		return nil, nil, nil
+	}
+	ahead, behind, err := graph.aheadBehind(branch.Hash(), upstream.Hash())
+	if err != nil {
+		return nil, nil, err
+	}
+	return &ahead, &behind, nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// fullWalkAheadBehind is how ahead and behind were counted before the
+// commit graph: both histories walked in full for every branch
+func fullWalkAheadBehind(repo *git.Repository, local, upstream plumbing.Hash) (int, int, error) {
+	onLocal, err := commitAncestors(repo, []plumbing.Hash{local}, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	onUpstream, err := commitAncestors(repo, []plumbing.Hash{upstream}, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	ahead, behind := 0, 0
+	for hash := range onLocal {
+		if !onUpstream[hash] {
+			ahead++
+		}
+	}
+	for hash := range onUpstream {
+		if !onLocal[hash] {
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
+
+// chain stores n commits on top of parent and returns the last
+func chain(t testing.TB, repo *git.Repository, tree, parent plumbing.Hash, n int, label string) plumbing.Hash {
+	for i := 0; i < n; i++ {
+		parent = storeTestCommit(t, repo, tree, fmt.Sprintf("%s %d", label, i), parent)
+	}
+	return parent
+}
+
+func TestAheadBehindMatchesFullWalk(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	tree := headTree(t, repo)
+	head, _ := repo.Head()
+
+	base := chain(t, repo, tree, head.Hash(), 5, "base")
+	local := chain(t, repo, tree, base, 3, "local")
+	upstream := chain(t, repo, tree, base, 4, "upstream")
+	// A merge of upstream into a second local line shares both sides
+	merged := storeTestCommit(t, repo, tree, "merge", chain(t, repo, tree, base, 2, "side"), upstream)
+	merged = chain(t, repo, tree, merged, 2, "after merge")
+
+	cases := []struct {
+		name                  string
+		local, upstream       plumbing.Hash
+		wantAhead, wantBehind int
+	}{
+		{"same commit", base, base, 0, 0},
+		{"ahead only", local, base, 3, 0},
+		{"behind only", base, upstream, 0, 4},
+		{"diverged", local, upstream, 3, 4},
+		{"merged upstream", merged, upstream, 5, 0},
+		{"upstream behind a merge", upstream, merged, 0, 5},
+	}
+	graph := newCommitGraph(repo)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ahead, behind, err := graph.aheadBehind(tc.local, tc.upstream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ahead != tc.wantAhead || behind != tc.wantBehind {
+				t.Errorf("ahead/behind = %d/%d, want %d/%d", ahead, behind, tc.wantAhead, tc.wantBehind)
+			}
+			fullAhead, fullBehind, err := fullWalkAheadBehind(repo, tc.local, tc.upstream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ahead != fullAhead || behind != fullBehind {
+				t.Errorf("shared graph gives %d/%d, full walk %d/%d", ahead, behind, fullAhead, fullBehind)
+			}
+		})
+	}
+}
+
+func TestBranchesReportTrackingCounts(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+	tree := headTree(t, repo)
+	head, _ := repo.Head()
+
+	setRef(t, repo, "refs/remotes/origin/master", chain(t, repo, tree, head.Hash(), 2, "remote"))
+	setRef(t, repo, "refs/heads/feature", chain(t, repo, tree, head.Hash(), 1, "feature"))
+	setRef(t, repo, "refs/remotes/origin/feature", head.Hash())
+
+	branches, err := gs.getBranches(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]int{"master": {0, 2}, "feature": {1, 0}}
+	for _, branch := range branches {
+		counts, ok := want[branch.Name]
+		if !ok {
+			continue
+		}
+		delete(want, branch.Name)
+		if branch.Ahead == nil || branch.Behind == nil {
+			t.Errorf("%s has no tracking counts", branch.Name)
+			continue
+		}
+		if *branch.Ahead != counts[0] || *branch.Behind != counts[1] {
+			t.Errorf("%s ahead/behind = %d/%d, want %d/%d", branch.Name, *branch.Ahead, *branch.Behind, counts[0], counts[1])
+		}
+	}
+	for name := range want {
+		t.Errorf("branch %s not listed", name)
+	}
+}
+
+func TestStatusReportsTrackingCounts(t *testing.T) {
+	gs := newTestService(t)
+	repo := initTestRepo(t, gs, "p")
+
+	// Without an upstream the counts are left out rather than zero
+	status, err := gs.getRepositoryStatus(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Ahead != nil || status.Behind != nil {
+		t.Errorf("counts without an upstream: %v/%v", status.Ahead, status.Behind)
+	}
+
+	remote := addTestRemote(t, repo)
+	pushFromClone(t, remote, map[string]string{"b.txt": "b\n"})
+	if err := repo.Fetch(&git.FetchOptions{RemoteName: "origin"}); err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	commitTestFiles(t, repo, "Local one", map[string]string{"c.txt": "c\n"})
+	commitTestFiles(t, repo, "Local two", map[string]string{"d.txt": "d\n"})
+
+	status, err = gs.getRepositoryStatus(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Ahead == nil || status.Behind == nil || *status.Ahead != 2 || *status.Behind != 1 {
+		t.Fatalf("status counts: %v/%v, want 2/1", status.Ahead, status.Behind)
+	}
+	if out := runGit(t, gs.getProjectPath("p"), "rev-list", "--left-right", "--count", "master...origin/master"); out != "2\t1" {
+		t.Errorf("git counts %q", out)
+	}
+
+	// A branch with no upstream of its own has no counts in the listing
+	setRef(t, repo, "refs/heads/local-only", refHash(t, repo, "HEAD"))
+	branches, err := gs.getBranches(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, branch := range branches {
+		if branch.Name == "local-only" && (branch.Ahead != nil || branch.Behind != nil) {
+			t.Errorf("local-only has counts %v/%v", branch.Ahead, branch.Behind)
+		}
+	}
+}
+
+// BenchmarkBranchTracking counts ahead and behind for 20 branches off a
+// 2000-commit history, each a few commits apart from its upstream, the way
+// the branch list did before and after sharing one commit graph
+func BenchmarkBranchTracking(b *testing.B) {
+	gs := newTestService(b)
+	repo := initTestRepo(b, gs, "p")
+	tree := headTree(b, repo)
+	head, _ := repo.Head()
+
+	trunk := []plumbing.Hash{head.Hash()}
+	for i := 0; i < 2000; i++ {
+		trunk = append(trunk, storeTestCommit(b, repo, tree, fmt.Sprintf("trunk %d", i), trunk[len(trunk)-1]))
+	}
+	type pair struct{ local, upstream plumbing.Hash }
+	var pairs []pair
+	for i := 0; i < 20; i++ {
+		base := trunk[len(trunk)-1-i*10]
+		pairs = append(pairs, pair{
+			local:    chain(b, repo, tree, base, 3, fmt.Sprintf("local %d", i)),
+			upstream: chain(b, repo, tree, base, 2, fmt.Sprintf("upstream %d", i)),
+		})
+	}
+
+	b.Run("previous", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, p := range pairs {
+				if _, _, err := fullWalkAheadBehind(repo, p.local, p.upstream); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("shared graph", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			graph := newCommitGraph(repo)
+			for _, p := range pairs {
+				if _, _, err := graph.aheadBehind(p.local, p.upstream); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
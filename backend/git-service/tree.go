@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// buildTree assembles the nested trees for a flat set of files and returns
+// the root tree hash. Trees are written to s; with a nil storer they are only
+// hashed, which lets previews run without touching the object database.
+func buildTree(s storer.EncodedObjectStorer, entries map[string]*diffEntry) (plumbing.Hash, error) {
+	files := make(map[string]*diffEntry)
+	dirs := make(map[string]map[string]*diffEntry)
+	for p, entry := range entries {
+		if i := strings.Index(p, "/"); i >= 0 {
+			dir := p[:i]
+			if dirs[dir] == nil {
+				dirs[dir] = make(map[string]*diffEntry)
+			}
+			dirs[dir][p[i+1:]] = entry
+			continue
+		}
+		files[p] = entry
+	}
+
+	tree := &object.Tree{}
+	for name, entry := range files {
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: name, Mode: entry.mode, Hash: entry.hash})
+	}
+	for name, children := range dirs {
+		hash, err := buildTree(s, children)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: hash})
+	}
+
+	// git orders entries as if directory names ended with a slash
+	sort.Slice(tree.Entries, func(i, j int) bool {
+		return treeEntrySortKey(tree.Entries[i]) < treeEntrySortKey(tree.Entries[j])
+	})
+
+	return storeObject(s, tree)
+}
+
+// treeEntrySortKey returns the name git sorts a tree entry by
+func treeEntrySortKey(e object.TreeEntry) string {
+	if e.Mode == filemode.Dir {
+		return e.Name + "/"
+	}
+	return e.Name
+}
+
+// storeObject encodes an object and writes it to s, or only hashes it when s is nil
+func storeObject(s storer.EncodedObjectStorer, obj interface {
+	Encode(plumbing.EncodedObject) error
+}) (plumbing.Hash, error) {
+	var encoded plumbing.EncodedObject = &plumbing.MemoryObject{}
+	if s != nil {
+		encoded = s.NewEncodedObject()
+	}
+	if err := obj.Encode(encoded); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if s == nil {
+		return encoded.Hash(), nil
+	}
+	return s.SetEncodedObject(encoded)
+}